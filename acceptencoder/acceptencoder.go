@@ -38,6 +38,9 @@ var (
 	//List of HTTP methods to compress. If not set, only GET requests are compressed.
 	includedMethods map[string]bool
 	getMethodOnly   bool
+	//List of content types that are not compressed, such as the already-compressed images.
+	excludedTypes    map[string]bool
+	excludedPrefixes []string
 )
 
 func InitGzip(minLength, compressLevel int, methods []string) {
@@ -55,6 +58,45 @@ func InitGzip(minLength, compressLevel int, methods []string) {
 	}
 }
 
+// SetExcludedContentTypes sets the content types that are not compressed,
+// the wildcard subtype such as `image/*` is supported.
+func SetExcludedContentTypes(contentTypes []string) {
+	excludedTypes = make(map[string]bool, len(contentTypes))
+	excludedPrefixes = excludedPrefixes[:0]
+	for _, v := range contentTypes {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "" {
+			continue
+		}
+		if strings.HasSuffix(v, "/*") {
+			excludedPrefixes = append(excludedPrefixes, v[:len(v)-1])
+		} else {
+			excludedTypes[v] = true
+		}
+	}
+}
+
+// Compressible returns whether the content of the type should be compressed.
+// The empty content type is compressible.
+func Compressible(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	if i := strings.IndexByte(contentType, ';'); i != -1 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	if excludedTypes[contentType] {
+		return false
+	}
+	for _, prefix := range excludedPrefixes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
 type resetWriter interface {
 	io.Writer
 	Reset(w io.Writer)
@@ -69,66 +111,62 @@ func (n nopResetWriter) Reset(w io.Writer) {
 }
 
 type acceptEncoder struct {
-	name                    string
-	levelEncode             func(int) resetWriter
-	customCompressLevelPool *sync.Pool
-	bestCompressionPool     *sync.Pool
+	name        string
+	levelEncode func(int) resetWriter
+	// writer pools indexed by level-flate.HuffmanOnly,
+	// so that the writers of different levels are never mixed.
+	levelPools []*sync.Pool
+}
+
+func newAcceptEncoder(name string, levelEncode func(int) resetWriter) acceptEncoder {
+	ac := acceptEncoder{
+		name:        name,
+		levelEncode: levelEncode,
+		levelPools:  make([]*sync.Pool, flate.BestCompression-flate.HuffmanOnly+1),
+	}
+	for i := range ac.levelPools {
+		level := i + flate.HuffmanOnly
+		ac.levelPools[i] = &sync.Pool{New: func() interface{} { return levelEncode(level) }}
+	}
+	return ac
+}
+
+// ValidLevel returns whether the compression level is valid.
+func ValidLevel(level int) bool {
+	return level >= flate.HuffmanOnly && level <= flate.BestCompression
 }
 
 func (ac acceptEncoder) encode(wr io.Writer, level int) resetWriter {
-	if ac.customCompressLevelPool == nil || ac.bestCompressionPool == nil {
+	if ac.levelPools == nil {
 		return nopResetWriter{wr}
 	}
 	var rwr resetWriter
-	switch level {
-	case flate.BestSpeed:
-		rwr = ac.customCompressLevelPool.Get().(resetWriter)
-	case flate.BestCompression:
-		rwr = ac.bestCompressionPool.Get().(resetWriter)
-	default:
-		rwr = ac.levelEncode(level)
+	if ValidLevel(level) {
+		rwr = ac.levelPools[level-flate.HuffmanOnly].Get().(resetWriter)
+	} else {
+		rwr = ac.levelEncode(flate.BestSpeed)
 	}
 	rwr.Reset(wr)
 	return rwr
 }
 
 func (ac acceptEncoder) put(wr resetWriter, level int) {
-	if ac.customCompressLevelPool == nil || ac.bestCompressionPool == nil {
+	if ac.levelPools == nil || !ValidLevel(level) {
 		return
 	}
 	wr.Reset(nil)
-
-	//notice
-	//compressionLevel==BestCompression DOES NOT MATTER
-	//sync.Pool will not memory leak
-
-	switch level {
-	case gzipCompressLevel:
-		ac.customCompressLevelPool.Put(wr)
-	case flate.BestCompression:
-		ac.bestCompressionPool.Put(wr)
-	}
+	ac.levelPools[level-flate.HuffmanOnly].Put(wr)
 }
 
 var (
-	noneCompressEncoder = acceptEncoder{"", nil, nil, nil}
-	gzipCompressEncoder = acceptEncoder{
-		name:                    "gzip",
-		levelEncode:             func(level int) resetWriter { wr, _ := gzip.NewWriterLevel(nil, level); return wr },
-		customCompressLevelPool: &sync.Pool{New: func() interface{} { wr, _ := gzip.NewWriterLevel(nil, gzipCompressLevel); return wr }},
-		bestCompressionPool:     &sync.Pool{New: func() interface{} { wr, _ := gzip.NewWriterLevel(nil, flate.BestCompression); return wr }},
-	}
+	noneCompressEncoder = acceptEncoder{name: ""}
+	gzipCompressEncoder = newAcceptEncoder("gzip", func(level int) resetWriter { wr, _ := gzip.NewWriterLevel(nil, level); return wr })
 
 	//according to the sec :http://tools.ietf.org/html/rfc2616#section-3.5 ,the deflate compress in http is zlib indeed
 	//deflate
 	//The "zlib" format defined in RFC 1950 [31] in combination with
 	//the "deflate" compression mechanism described in RFC 1951 [29].
-	deflateCompressEncoder = acceptEncoder{
-		name:                    "deflate",
-		levelEncode:             func(level int) resetWriter { wr, _ := zlib.NewWriterLevel(nil, level); return wr },
-		customCompressLevelPool: &sync.Pool{New: func() interface{} { wr, _ := zlib.NewWriterLevel(nil, gzipCompressLevel); return wr }},
-		bestCompressionPool:     &sync.Pool{New: func() interface{} { wr, _ := zlib.NewWriterLevel(nil, flate.BestCompression); return wr }},
-	}
+	deflateCompressEncoder = newAcceptEncoder("deflate", func(level int) resetWriter { wr, _ := zlib.NewWriterLevel(nil, level); return wr })
 )
 
 var (
@@ -145,13 +183,75 @@ func WriteFile(encoding string, writer io.Writer, file http.File) (bool, string,
 	return writeLevel(encoding, writer, file, flate.BestCompression)
 }
 
+// WriteFileLevel is similar to WriteFile, but uses the specified compression level.
+func WriteFileLevel(encoding string, writer io.Writer, file http.File, level int) (bool, string, error) {
+	return writeLevel(encoding, writer, file, level)
+}
+
 // WriteBody reads  writes content to writer by the specific encoding(gzip/deflate)
 func WriteBody(encoding string, writer io.Writer, content []byte) (bool, string, error) {
-	if encoding == "" || len(content) < gzipMinLength {
+	return WriteBodyLevel(encoding, writer, content, gzipCompressLevel)
+}
+
+// WriteBodyLevel is similar to WriteBody, but uses the specified compression level.
+func WriteBodyLevel(encoding string, writer io.Writer, content []byte, level int) (bool, string, error) {
+	return WriteBodyLevelMin(encoding, writer, content, level, gzipMinLength)
+}
+
+// WriteBodyLevelMin is similar to WriteBodyLevel, but the content shorter than minLength is not compressed,
+// minLength < 0 means the one of InitGzip.
+func WriteBodyLevelMin(encoding string, writer io.Writer, content []byte, level, minLength int) (bool, string, error) {
+	if minLength < 0 {
+		minLength = gzipMinLength
+	}
+	if encoding == "" || len(content) < minLength {
 		// _, err := writer.Write(content)
 		return false, "", nil
 	}
-	return writeLevel(encoding, writer, bytes.NewReader(content), gzipCompressLevel)
+	return writeLevel(encoding, writer, bytes.NewReader(content), level)
+}
+
+// CompressLevel returns the compression level of the body set by InitGzip.
+func CompressLevel() int {
+	return gzipCompressLevel
+}
+
+// StreamWriter compresses a stream, whose Flush writes the pending compressed data
+// to the underlying writer, and Close writes the footer and releases the pooled writer.
+type StreamWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// NewStreamWriter returns the StreamWriter of the specific encoding(gzip/deflate) and compress level,
+// it returns false if the encoding is not supported.
+func NewStreamWriter(encoding string, writer io.Writer, level int) (StreamWriter, bool) {
+	ce, ok := encoderMap[encoding]
+	if !ok || ce.levelPools == nil {
+		return nil, false
+	}
+	w, ok := ce.encode(writer, level).(StreamWriter)
+	if !ok {
+		return nil, false
+	}
+	return &streamWriter{StreamWriter: w, ce: ce, level: level}, true
+}
+
+type streamWriter struct {
+	StreamWriter
+	ce     acceptEncoder
+	level  int
+	closed bool
+}
+
+func (w *streamWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.StreamWriter.Close()
+	w.ce.put(w.StreamWriter.(resetWriter), w.level)
+	return err
 }
 
 // writeLevel reads from reader,writes to writer by specific encoding and compress level
@@ -187,7 +287,12 @@ func ParseEncoding(r *http.Request) string {
 	if r == nil {
 		return ""
 	}
-	if (getMethodOnly && r.Method == "GET") || includedMethods[r.Method] {
+	method := r.Method
+	if method == "HEAD" {
+		// HEAD must report the same headers as GET
+		method = "GET"
+	}
+	if (getMethodOnly && method == "GET") || includedMethods[method] {
 		return parseEncoding(r)
 	}
 	return ""
@@ -15,6 +15,10 @@
 package acceptencoder
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io/ioutil"
 	"net/http"
 	"testing"
 )
@@ -57,3 +61,95 @@ func Test_ExtractEncoding(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func Test_WriteBodyLevel(t *testing.T) {
+	content := bytes.Repeat([]byte("faygo acceptencoder level test "), 100)
+	var sizes []int
+	for _, level := range []int{flate.NoCompression, flate.BestSpeed, flate.BestCompression, flate.NoCompression} {
+		var buf bytes.Buffer
+		ok, encoding, err := WriteBodyLevel("gzip", &buf, content, level)
+		if !ok || encoding != "gzip" || err != nil {
+			t.Fatalf("level %d: ok=%v encoding=%q err=%v", level, ok, encoding, err)
+		}
+		sizes = append(sizes, buf.Len())
+		r, err := gzip.NewReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(b, content) {
+			t.Fatalf("level %d: decompressed content mismatch, err=%v", level, err)
+		}
+	}
+	if sizes[0] <= sizes[1] || sizes[0] != sizes[3] {
+		t.Fatalf("pooled writers mixed the levels: sizes %v", sizes)
+	}
+}
+
+func Test_WriteBodyLevelMin(t *testing.T) {
+	content := bytes.Repeat([]byte("a"), 100)
+	var buf bytes.Buffer
+	if ok, _, _ := WriteBodyLevelMin("gzip", &buf, content, flate.BestSpeed, 101); ok || buf.Len() != 0 {
+		t.Fatalf("content shorter than minLength is compressed")
+	}
+	if ok, encoding, _ := WriteBodyLevelMin("gzip", &buf, content, flate.BestSpeed, 100); !ok || encoding != "gzip" {
+		t.Fatalf("content of minLength is not compressed")
+	}
+	buf.Reset()
+	if ok, _, _ := WriteBodyLevelMin("gzip", &buf, content[:gzipMinLength-1], flate.BestSpeed, -1); ok {
+		t.Fatalf("minLength < 0 does not fall back to the one of InitGzip")
+	}
+}
+
+func benchmarkWriteBody(b *testing.B, level int, pooled bool) {
+	content := bytes.Repeat([]byte("faygo acceptencoder benchmark "), 1000)
+	var buf bytes.Buffer
+	b.SetBytes(int64(len(content)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if pooled {
+			writeLevel("gzip", &buf, bytes.NewReader(content), level)
+			continue
+		}
+		w, _ := gzip.NewWriterLevel(&buf, level)
+		w.Write(content)
+		w.Close()
+	}
+}
+
+func Benchmark_WriteBodyPooledBestSpeed(b *testing.B) {
+	benchmarkWriteBody(b, flate.BestSpeed, true)
+}
+
+func Benchmark_WriteBodyUnpooledBestSpeed(b *testing.B) {
+	benchmarkWriteBody(b, flate.BestSpeed, false)
+}
+
+func Benchmark_WriteBodyPooledBestCompression(b *testing.B) {
+	benchmarkWriteBody(b, flate.BestCompression, true)
+}
+
+func Benchmark_WriteBodyUnpooledBestCompression(b *testing.B) {
+	benchmarkWriteBody(b, flate.BestCompression, false)
+}
+
+func Test_Compressible(t *testing.T) {
+	SetExcludedContentTypes([]string{"image/png", "video/*", " Application/Zip "})
+	defer SetExcludedContentTypes(nil)
+	cases := map[string]bool{
+		"":                          true,
+		"text/html; charset=utf-8":  true,
+		"image/svg+xml":             true,
+		"image/png":                 false,
+		"video/mp4":                 false,
+		"application/zip":           false,
+		"APPLICATION/ZIP; charset=": false,
+	}
+	for contentType, want := range cases {
+		if got := Compressible(contentType); got != want {
+			t.Errorf("Compressible(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
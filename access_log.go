@@ -0,0 +1,87 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// NoAccessLog creates the middleware excluding the requests of the route from the access log,
+// such as the health checks and the metrics scrapes.
+//
+//	e.g. frame.GET("/healthz", faygo.NoAccessLog(), healthHandler)
+func NoAccessLog() HandlerFunc {
+	return func(ctx *Context) error {
+		ctx.noAccessLog = true
+		return nil
+	}
+}
+
+// SampleAccessLog creates the middleware logging 1 in n successful requests of the route,
+// the requests with the status >= 400 are always logged.
+// It is disabled if n <= 1.
+func SampleAccessLog(n int) HandlerFunc {
+	s := &accessLogSampler{n: uint64(n)}
+	return func(ctx *Context) error {
+		if n > 1 {
+			ctx.accessLogSampler = s
+		}
+		return nil
+	}
+}
+
+type accessLogSampler struct {
+	n     uint64
+	count uint64
+}
+
+// sampledOut returns true if the successful request is not the sampled one.
+func (s *accessLogSampler) sampledOut() bool {
+	return atomic.AddUint64(&s.count, 1)%s.n != 1
+}
+
+// SkipAccessLog sets the predicate which is evaluated after the response completes,
+// the request is excluded from the access log if it returns true.
+// The predicate can read the final status by ctx.Status(), the latency by ctx.Latency()
+// and the route pattern by ctx.RoutePattern(), such as skipping the successful static files
+// but logging the errors of the same path.
+// If fn is nil, all of the requests are logged except the ones excluded by the routes.
+// note: it should be called before Run()
+//
+//	e.g. faygo.SkipAccessLog(func(ctx *faygo.Context) bool {
+//		return ctx.Status() < 400 && strings.HasPrefix(ctx.RoutePattern(), "/static/")
+//	})
+func SkipAccessLog(fn func(ctx *Context) bool) {
+	global.skipAccessLog = fn
+}
+
+// Latency returns the time elapsed since the request is received.
+func (ctx *Context) Latency() time.Duration {
+	return time.Since(ctx.start)
+}
+
+// skipAccessLog returns true if the request is excluded from the access log,
+// by NoAccessLog, SampleAccessLog or the predicate of SkipAccessLog.
+// It only affects the access log, the tracing span and the other records are unaffected.
+func (ctx *Context) skipAccessLog() bool {
+	if ctx.noAccessLog {
+		return true
+	}
+	if ctx.accessLogSampler != nil && ctx.Status() < 400 && ctx.accessLogSampler.sampledOut() {
+		return true
+	}
+	return global.skipAccessLog != nil && global.skipAccessLog(ctx)
+}
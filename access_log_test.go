@@ -0,0 +1,79 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSkipAccessLog(t *testing.T) {
+	frame := newTestFrame(t, "skip_access_log_test")
+	status := 200
+	handler := HandlerFunc(func(ctx *Context) error {
+		return ctx.String(status, "ok")
+	})
+	frame.GET("/healthz", NoAccessLog(), handler)
+	frame.GET("/items/:id", SampleAccessLog(3), handler)
+	frame.GET("/static/*filepath", handler)
+
+	// the predicate is reached only by the requests which are not excluded by the routes
+	var reached []string
+	SkipAccessLog(func(ctx *Context) bool {
+		if ctx.Latency() <= 0 {
+			t.Errorf("latency %v", ctx.Latency())
+		}
+		reached = append(reached, ctx.RoutePattern())
+		return ctx.Status() < 400 && ctx.RoutePattern() == "/static/*filepath"
+	})
+	defer SkipAccessLog(nil)
+	serve := func(path string) bool {
+		reached = reached[:0]
+		ctx := frame.getContext(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		defer frame.putContext(ctx)
+		ctx.start = time.Now()
+		frame.serveHTTP(ctx)
+		return ctx.skipAccessLog()
+	}
+	frame.build()
+
+	if !serve("/healthz") || len(reached) != 0 {
+		t.Fatalf("NoAccessLog: reached %v", reached)
+	}
+	var logged int
+	for i := 0; i < 6; i++ {
+		if !serve("/items/1") {
+			logged++
+		}
+	}
+	if logged != 2 {
+		t.Fatalf("SampleAccessLog(3): logged %d of 6, want 2", logged)
+	}
+	if !serve("/static/a.css") || reached[0] != "/static/*filepath" {
+		t.Fatalf("SkipAccessLog: reached %v", reached)
+	}
+
+	// the errors are always logged
+	status = 500
+	if serve("/static/a.css") {
+		t.Fatal("SkipAccessLog: the error is skipped")
+	}
+	for i := 0; i < 3; i++ {
+		if serve("/items/1") {
+			t.Fatal("SampleAccessLog: the error is skipped")
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnableAdmin(t *testing.T) {
+	frame := newTestFrame(t, "admin_test")
+	frame.config.CookieSecret = "cookie-secret"
+	frame.config.XSRF.Key = "xsrf-key"
+	frame.EnableAdmin("/admin/", HandlerFunc(func(ctx *Context) error {
+		if ctx.HeaderParam("X-Token") != "token" {
+			return ctx.String(http.StatusUnauthorized, "unauthorized")
+		}
+		return nil
+	}))
+	enableGzip := global.config.Gzip.Enable
+	global.config.Gzip.Enable = true
+	defer func() { global.config.Gzip.Enable = enableGzip }()
+
+	do := func(method, url string, auth bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if auth {
+			req.Header.Set("X-Token", "token")
+		}
+		return serveTest(frame, req)
+	}
+	for _, url := range []string{
+		"/admin/debug/pprof/",
+		"/admin/debug/pprof/goroutine?debug=1",
+		"/admin/debug/vars",
+		"/admin/debug/routes",
+		"/admin/debug/config",
+	} {
+		if rec := do("GET", url, false); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("%s without auth: got %d", url, rec.Code)
+		}
+		rec := do("GET", url, true)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: got %d %q", url, rec.Code, rec.Body.String())
+		}
+		if enc := rec.Header().Get(HeaderContentEncoding); enc != "" {
+			t.Fatalf("%s: the admin response is compressed by %s", url, enc)
+		}
+	}
+	// only the authorized requests are excluded from the access log
+	frame.build()
+	for auth, skip := range map[bool]bool{false: false, true: true} {
+		req := httptest.NewRequest("GET", "/admin/debug/vars", nil)
+		if auth {
+			req.Header.Set("X-Token", "token")
+		}
+		ctx := frame.getContext(httptest.NewRecorder(), req)
+		frame.serveHTTP(ctx)
+		if ctx.skipAccessLog() != skip {
+			t.Fatalf("authorized %v: skip the access log %v", auth, !skip)
+		}
+		frame.putContext(ctx)
+	}
+	if rec := do("GET", "/admin/debug/pprof/goroutine?debug=1", true); !strings.Contains(rec.Body.String(), "goroutine profile") {
+		t.Fatalf("goroutine profile: got %q", rec.Body.String())
+	}
+	if rec := do("GET", "/admin/debug/vars", true); !strings.Contains(rec.Body.String(), `"memstats"`) ||
+		!strings.Contains(rec.Body.String(), `"faygo_file_cache": {"entries":`) {
+		t.Fatalf("expvar: got %q", rec.Body.String())
+	}
+	if rec := do("GET", "/admin/debug/routes", true); !strings.Contains(rec.Body.String(), "/admin/debug/gc") {
+		t.Fatalf("routes: got %q", rec.Body.String())
+	}
+
+	var config Config
+	rec := do("GET", "/admin/debug/config", true)
+	if err := json.Unmarshal(rec.Body.Bytes(), &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.CookieSecret != redactedValue || config.XSRF.Key != redactedValue || config.Session.ProviderConfig != "" {
+		t.Fatalf("the secrets are not redacted: %q %q %q", config.CookieSecret, config.XSRF.Key, config.Session.ProviderConfig)
+	}
+	if frame.config.CookieSecret != "cookie-secret" {
+		t.Fatal("the config of the frame is changed")
+	}
+
+	if rec := do("GET", "/admin/debug/gc", true); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET gc: got %d", rec.Code)
+	}
+	var stats map[string]uint64
+	rec = do("POST", "/admin/debug/gc", true)
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil || stats["num_gc"] == 0 {
+		t.Fatalf("POST gc: got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestEnablePprof(t *testing.T) {
+	frame := newTestFrame(t, "pprof_test")
+	frame.EnablePprof("/internal/prof/", HandlerFunc(func(ctx *Context) error {
+		if user, pass, ok := ctx.R.BasicAuth(); !ok || user != "admin" || pass != "password" {
+			return ctx.String(http.StatusUnauthorized, "unauthorized")
+		}
+		return nil
+	}))
+	for url, want := range map[string]string{
+		"/internal/prof/":                  "goroutine",
+		"/internal/prof/goroutine?debug=1": "goroutine profile",
+		"/internal/prof/heap?debug=1":      "heap profile",
+		"/internal/prof/symbol":            "num_symbols",
+	} {
+		req := httptest.NewRequest("GET", url, nil)
+		if rec := serveTest(frame, req); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("%s without auth: got %d", url, rec.Code)
+		}
+		req.SetBasicAuth("admin", "password")
+		rec := serveTest(frame, req)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), want) {
+			t.Fatalf("%s: got %d %q", url, rec.Code, rec.Body.String())
+		}
+	}
+	// the other admin endpoints are not registered
+	req := httptest.NewRequest("GET", "/internal/debug/vars", nil)
+	req.SetBasicAuth("admin", "password")
+	if rec := serveTest(frame, req); rec.Code != http.StatusNotFound {
+		t.Fatalf("expvar: got %d", rec.Code)
+	}
+}
+
+// The CPU profile outlives the write timeout of the connection,
+// which is extended by pprof through the wrapped ResponseWriter.
+func TestAdminProfileWriteTimeout(t *testing.T) {
+	frame := newTestFrame(t, "admin_profile_test")
+	addr := freeAddr(t)
+	frame.config.Addrs = []string{addr}
+	frame.config.WriteTimeout = 300 * time.Millisecond
+	frame.EnableAdmin("")
+	if err := frame.run(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		frame.shutdown(ctx)
+	}()
+	resp, err := http.Get("http://" + addr + "/debug/pprof/profile?seconds=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || len(b) == 0 {
+		t.Fatalf("profile: got %d %q", resp.StatusCode, b)
+	}
+}
@@ -168,8 +168,17 @@ func addpath(mux *MuxAPI, tag *swagger.Tag) {
 	pid := apiCreatePath(mux.Path())
 	summary := apiSummary(mux.Name())
 	desc := apiDesc(mux.Notes())
+	version := mux.apiVersion()
+	opid := pid
+	if version != "" {
+		// the versions of the same path are separate operations,
+		// and the fragment is not sent by the requests of the swagger ui.
+		pid += "#v" + version
+		opid += "-v" + version
+		summary += " (v" + version + ")"
+	}
 	for _, method := range mux.Methods() {
-		if method == "CONNECT" || method == "TRACE" {
+		if method == "CONNECT" || method == "TRACE" || !isRESTfulMethod(method) {
 			continue
 		}
 		// if method == "WS" {
@@ -179,7 +188,7 @@ func addpath(mux *MuxAPI, tag *swagger.Tag) {
 			Tags:        []string{tag.Name},
 			Summary:     summary,
 			Description: desc,
-			OperationId: pid + "-" + method,
+			OperationId: opid + "-" + method,
 			Consumes:    swagger.CommonMIMETypes,
 			Produces:    swagger.CommonMIMETypes,
 			Responses:   make(map[string]*swagger.Resp, 1),
@@ -197,7 +206,7 @@ func addpath(mux *MuxAPI, tag *swagger.Tag) {
 			}
 			typ := swagger.ParamType(param.Model)
 			switch p.In {
-			case "cookie":
+			case "cookie", "jwt":
 				continue
 			default:
 				switch typ {
@@ -246,6 +255,18 @@ func addpath(mux *MuxAPI, tag *swagger.Tag) {
 			o.Parameters = append(o.Parameters, p)
 		}
 
+		// the default version extractor reads the X-API-Version header
+		if version != "" && mux.frame.versionExtractor == nil {
+			o.Parameters = append(o.Parameters, &swagger.Parameter{
+				In:          "header",
+				Name:        HeaderXAPIVersion,
+				Type:        "string",
+				Description: "API version",
+				Required:    true,
+				Default:     version,
+			})
+		}
+
 		// static file
 		if strings.HasSuffix(pid, "/{filepath}") {
 			o.Parameters = append(o.Parameters, &swagger.Parameter{
@@ -273,6 +294,9 @@ func addpath(mux *MuxAPI, tag *swagger.Tag) {
 func apiDefinitions(mux *MuxAPI, pname, method string, format interface{}) (ref string) {
 	upath := mux.Path()
 	ref = strings.Replace(path.Join(upath[1:], pname, method), "/", "@", -1)
+	if version := mux.apiVersion(); version != "" {
+		ref += "@v" + version
+	}
 	def := &swagger.Definition{
 		Type: "object",
 		Xml:  &swagger.Xml{Name: ref},
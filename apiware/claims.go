@@ -0,0 +1,79 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+type claimsKey struct{}
+
+// WithClaims returns a copy of the context carrying the verified claims of the request,
+// such as the JWT claims, which are bound to the fields tagged `in:jwt`.
+func WithClaims(ctx context.Context, claims map[string]interface{}) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFrom returns the claims carried by the context, or nil.
+func ClaimsFrom(ctx context.Context) map[string]interface{} {
+	claims, _ := ctx.Value(claimsKey{}).(map[string]interface{})
+	return claims
+}
+
+// claimValues converts the claim to the param values,
+// ok is false if the claim is absent.
+func claimValues(claims map[string]interface{}, name string) (values []string, ok bool) {
+	claim, ok := claims[name]
+	if !ok || claim == nil {
+		return nil, false
+	}
+	if a, isSlice := claim.([]interface{}); isSlice {
+		values = make([]string, len(a))
+		for i, v := range a {
+			values[i] = claimString(v)
+		}
+		return values, true
+	}
+	return []string{claimString(claim)}, true
+}
+
+func claimString(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case json.Number:
+		return x.String()
+	case bool:
+		return strconv.FormatBool(x)
+	}
+	return fmt.Sprint(v)
+}
+
+// assignClaim sets the claim to the field of the same type directly,
+// such as the object claims, otherwise it returns false.
+func assignClaim(value reflect.Value, claim interface{}) bool {
+	v := reflect.ValueOf(claim)
+	if !v.IsValid() || !v.Type().AssignableTo(value.Type()) {
+		return false
+	}
+	value.Set(v)
+	return true
+}
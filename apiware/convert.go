@@ -15,10 +15,16 @@
 package apiware
 
 import (
+	"encoding"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // ConvertAssign type conversions for request params.
@@ -163,3 +169,229 @@ func strconvErr(err error) error {
 	}
 	return err
 }
+
+// typeMessage returns the readable reason why a value can not be converted to the type,
+// without exposing the internal type name.
+func typeMessage(t reflect.Type) string {
+	if t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 {
+		return typeMessage(t.Elem())
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "must be an integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "must be a non-negative integer"
+	case reflect.Float32, reflect.Float64:
+		return "must be a number"
+	case reflect.Bool:
+		return "must be a boolean"
+	default:
+		return "is invalid"
+	}
+}
+
+// TypeConverter converts a request param string to a value of the registered type.
+type TypeConverter func(string) (interface{}, error)
+
+var typeConverters = struct {
+	m map[reflect.Type]TypeConverter
+	sync.RWMutex
+}{m: map[reflect.Type]TypeConverter{}}
+
+// RegisterTypeConverter registers the converter of the type for binding request params,
+// which takes precedence over the built-in conversions.
+// It must be called before the struct with the field of the type is registered,
+// such as in the init function, because the converter is looked up once per field.
+func RegisterTypeConverter(t reflect.Type, fn TypeConverter) {
+	typeConverters.Lock()
+	defer typeConverters.Unlock()
+	if fn == nil {
+		delete(typeConverters.m, t)
+		return
+	}
+	typeConverters.m[t] = fn
+}
+
+func getTypeConverter(t reflect.Type) (TypeConverter, bool) {
+	typeConverters.RLock()
+	defer typeConverters.RUnlock()
+	fn, ok := typeConverters.m[t]
+	return fn, ok
+}
+
+// the format of the string that is validated as a UUID
+const formatUUID = "uuid"
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	ipType              = reflect.TypeOf(net.IP(nil))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// converter sets the request param strings to the field,
+// it is made once per field so that the type is not inspected on every request.
+type converter struct {
+	assign func(dest reflect.Value, src []string) error
+	// the readable reason of the conversion failure, the error message is used if empty
+	message string
+}
+
+// elemConverter converts a string to the value of a type.
+type elemConverter struct {
+	convert func(string) (reflect.Value, error)
+	message string
+}
+
+// newConverter returns the converter of the field type,
+// the format is the layout of time.Time or `uuid` for string.
+func newConverter(t reflect.Type, format string) *converter {
+	if ec := newElemConverter(t, format); ec != nil {
+		return &converter{
+			assign: func(dest reflect.Value, src []string) error {
+				if len(src) == 0 {
+					return nil
+				}
+				v, err := ec.convert(src[0])
+				if err != nil {
+					return err
+				}
+				reflect.Indirect(dest).Set(v)
+				return nil
+			},
+			message: ec.message,
+		}
+	}
+	if t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 {
+		if ec := newElemConverter(t.Elem(), format); ec != nil {
+			return &converter{
+				assign: func(dest reflect.Value, src []string) error {
+					if len(src) == 0 {
+						return nil
+					}
+					s := reflect.MakeSlice(t, 0, len(src))
+					for _, a := range src {
+						v, err := ec.convert(a)
+						if err != nil {
+							return err
+						}
+						s = reflect.Append(s, v)
+					}
+					reflect.Indirect(dest).Set(s)
+					return nil
+				},
+				message: ec.message,
+			}
+		}
+	}
+	return &converter{assign: convertAssign, message: typeMessage(t)}
+}
+
+func newElemConverter(t reflect.Type, format string) *elemConverter {
+	if fn, ok := getTypeConverter(t); ok {
+		return &elemConverter{
+			convert: func(s string) (reflect.Value, error) {
+				i, err := fn(s)
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("is invalid: %v", err)
+				}
+				v := reflect.ValueOf(i)
+				if !v.IsValid() {
+					return reflect.Zero(t), nil
+				}
+				if v.Type() != t {
+					if !v.Type().ConvertibleTo(t) {
+						return reflect.Value{}, fmt.Errorf("is invalid: the converter returns %s instead of %s", v.Type(), t)
+					}
+					v = v.Convert(t)
+				}
+				return v, nil
+			},
+		}
+	}
+	switch {
+	case t == timeType:
+		if format == "" {
+			format = time.RFC3339
+		}
+		return &elemConverter{
+			convert: func(s string) (reflect.Value, error) {
+				tm, err := time.Parse(format, s)
+				return reflect.ValueOf(tm), err
+			},
+			message: "must be a time in the format " + format,
+		}
+	case t == durationType:
+		return &elemConverter{
+			convert: func(s string) (reflect.Value, error) {
+				d, err := time.ParseDuration(s)
+				return reflect.ValueOf(d), err
+			},
+			message: "must be a duration, such as 1h30m",
+		}
+	case t == ipType:
+		return &elemConverter{
+			convert: func(s string) (reflect.Value, error) {
+				ip := net.ParseIP(s)
+				if ip == nil {
+					return reflect.Value{}, errors.New("invalid IP address")
+				}
+				return reflect.ValueOf(ip), nil
+			},
+			message: "must be an IP address",
+		}
+	case t.Kind() == reflect.Array && t.Len() == 16 && t.Elem().Kind() == reflect.Uint8:
+		// such as github.com/google/uuid.UUID
+		return &elemConverter{
+			convert: func(s string) (reflect.Value, error) {
+				b, err := parseUUID(s)
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				v := reflect.New(t).Elem()
+				reflect.Copy(v, reflect.ValueOf(b[:]))
+				return v, nil
+			},
+			message: "must be a UUID",
+		}
+	case t.Kind() == reflect.String && format == formatUUID:
+		return &elemConverter{
+			convert: func(s string) (reflect.Value, error) {
+				if _, err := parseUUID(s); err != nil {
+					return reflect.Value{}, err
+				}
+				return reflect.ValueOf(s).Convert(t), nil
+			},
+			message: "must be a UUID",
+		}
+	case t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(textUnmarshalerType):
+		return &elemConverter{
+			convert: func(s string) (reflect.Value, error) {
+				v := reflect.New(t)
+				if err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+					return reflect.Value{}, err
+				}
+				return v.Elem(), nil
+			},
+			message: "is invalid",
+		}
+	}
+	return nil
+}
+
+// parseUUID parses the UUID string in the form of xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx,
+// with or without the hyphens.
+func parseUUID(s string) (b [16]byte, err error) {
+	switch len(s) {
+	case 36:
+		if s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+			return b, errors.New("invalid UUID format")
+		}
+		s = s[:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+	case 32:
+	default:
+		return b, errors.New("invalid UUID length")
+	}
+	_, err = hex.Decode(b[:], []byte(s))
+	return b, err
+}
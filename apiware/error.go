@@ -14,6 +14,10 @@
 
 package apiware
 
+import (
+	"strings"
+)
+
 // Error a formatted error type
 type Error struct {
 	Api    string `json:"api"`
@@ -36,3 +40,67 @@ var _ error = new(Error)
 func (e *Error) Error() string {
 	return "[apiware] " + e.Api + " | " + e.Param + " | " + e.Reason
 }
+
+// Rules of the binding failure
+const (
+	RuleRequired = "required" // the required param is missing
+	RuleType     = "type"     // the param value can not be converted to the field type
+	RuleDecode   = "decode"   // the body can not be decoded
+	RuleLen      = KEY_LEN
+	RuleRange    = KEY_RANGE
+	RuleNonzero  = KEY_NONZERO
+	RuleRegexp   = KEY_REGEXP
+	RuleMaxSize  = KEY_MAXSIZE
+	RuleMIME     = KEY_MIME
+	RuleAccept   = KEY_ACCEPT
+)
+
+// BindError is the failure of binding or validating a request param.
+type BindError struct {
+	Field   string `json:"field"`          // param name
+	In      string `json:"in,omitempty"`   // param position
+	Rule    string `json:"rule,omitempty"` // the failed rule, e.g. `required`, `type`, `len`
+	Value   string `json:"-"`              // the raw value, it is not exported to the client
+	Message string `json:"message"`        // the readable reason, or the custom error of the `err` tag
+}
+
+var _ error = new(BindError)
+
+// Error implements error interface
+func (e *BindError) Error() string {
+	if e.In == "" {
+		return e.Field + ": " + e.Message
+	}
+	return e.Field + "(" + e.In + "): " + e.Message
+}
+
+// BindErrors is the collection of all the failures of a request.
+type BindErrors []*BindError
+
+var _ error = BindErrors(nil)
+
+// Error implements error interface
+func (errs BindErrors) Error() string {
+	s := make([]string, len(errs))
+	for i, e := range errs {
+		s[i] = e.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// AsBindErrors converts the binding error to BindErrors.
+// The other type of error is wrapped as a BindError whose field is `*`.
+func AsBindErrors(err error) BindErrors {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case BindErrors:
+		return e
+	case *BindError:
+		return BindErrors{e}
+	case *Error:
+		return BindErrors{{Field: e.Param, Message: e.Reason}}
+	default:
+		return BindErrors{{Field: "*", Message: err.Error()}}
+	}
+}
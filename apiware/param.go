@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"mime/multipart"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -38,6 +39,10 @@ const (
 	KEY_REGEXP       = "regexp"   // verify the value of the param with a regular expression(param value can not be null)
 	KEY_MAXMB        = "maxmb"    // when request Content-Type is multipart/form-data, the max memory for body.(multi-param, whichever is greater)
 	KEY_ERR          = "err"      // the custom error for binding or validating
+	KEY_FORMAT       = "format"   // the layout of time.Time, or `uuid` to verify a string; the struct tag `format` is also supported
+	KEY_MAXSIZE      = "maxsize"  // the max size of each uploaded file, e.g. `512KB`, `2MB` or the bytes `1024`
+	KEY_MIME         = "mime"     // the allowed MIME types of the uploaded files separated by `,`, the wildcard subtype such as `image/*` is supported
+	KEY_ACCEPT       = "accept"   // like `mime`, but the MIME types are sniffed from the content of the uploaded files
 
 	MB                 = 1 << 20 // 1MB
 	defaultMaxMemory   = 32 * MB // 32 MB
@@ -121,14 +126,22 @@ func ParseTags(tag string) map[string]string {
 type Param struct {
 	apiName     string // ParamsAPI name
 	name        string // param name
+	field       string // the path of the struct field, e.g. `Filter.Name`
 	indexPath   []int
+	bodyPath    []string          // the path of the sub-object of the JSON body, nil means the whole body
 	isRequired  bool              // file is required or not
 	isFile      bool              // is file param or not
+	isQueryMap  bool              // is the map[string]string param receiving the remaining query params or not
 	tags        map[string]string // struct tags for this param
-	verifyFuncs []func(reflect.Value) error
+	verifyFuncs []verifyFunc
 	rawTag      reflect.StructTag // the raw tag
 	rawValue    reflect.Value     // the raw tag value
 	err         error             // the custom error for binding or validating
+	conv        *converter        // converts the request param strings to the field
+	maxSize     int64             // the max size of each uploaded file, valid if > 0
+	mimeTypes   []string          // the allowed MIME types of the uploaded files
+	acceptTypes []string          // the allowed MIME types sniffed from the uploaded files
+	isUploaded  bool              // is the *UploadedFile or []*UploadedFile param or not
 }
 
 const (
@@ -138,6 +151,8 @@ const (
 	filesTypeString2  = "[]multipart.FileHeader"
 	cookieTypeString  = "*http.Cookie"
 	cookieTypeString2 = "http.Cookie"
+	// receives the remaining query params
+	queryMapTypeString = "map[string]string"
 	// fasthttpCookieTypeString = "fasthttp.Cookie"
 	stringTypeString = "string"
 	bytesTypeString  = "[]byte"
@@ -153,6 +168,7 @@ var (
 		"body":     true,
 		"header":   true,
 		"cookie":   true,
+		"jwt":      true,
 	}
 )
 
@@ -186,11 +202,21 @@ func (param *Param) Description() string {
 	return param.tags[KEY_DESC]
 }
 
-// IsFile tests if the param is type *multipart.FileHeader
+// IsFile tests if the param is type *multipart.FileHeader or *UploadedFile
 func (param *Param) IsFile() bool {
 	return param.isFile
 }
 
+// StructTag returns the struct tag of the param's field
+func (param *Param) StructTag() reflect.StructTag {
+	return param.rawTag
+}
+
+// FieldValue returns the param's field of the struct pointer bound by the ParamsAPI, such as the one returned by BindNew
+func (param *Param) FieldValue(structPointer interface{}) reflect.Value {
+	return reflect.ValueOf(structPointer).Elem().FieldByIndex(param.indexPath)
+}
+
 func (param *Param) myError(reason string) error {
 	if param.err != nil {
 		return param.err
@@ -198,23 +224,63 @@ func (param *Param) myError(reason string) error {
 	return NewError(param.apiName, param.name, reason)
 }
 
+// assign converts the request param values and sets them to the field,
+// it returns the readable reason on failure.
+func (param *Param) assign(value reflect.Value, values []string) (reason string, ok bool) {
+	if err := param.conv.assign(value, values); err != nil {
+		if param.conv.message != "" {
+			return param.conv.message, false
+		}
+		return err.Error(), false
+	}
+	return "", true
+}
+
+// bindError creates the *BindError of the failed rule.
+func (param *Param) bindError(rule string, values []string, reason string) *BindError {
+	e := &BindError{
+		Field:   param.name,
+		In:      param.In(),
+		Rule:    rule,
+		Message: reason,
+	}
+	if len(values) > 0 {
+		e.Value = values[0]
+	}
+	if param.err != nil {
+		e.Message = param.err.Error()
+	}
+	return e
+}
+
 // validate tests if the param conforms to it's validation constraints specified
 // int the KEY_REGEXP struct tag
 func (param *Param) validate(value reflect.Value) (err error) {
+	if _, err = param.verify(value); err != nil {
+		return param.myError(err.Error())
+	}
+	return nil
+}
+
+// verify returns the first failed rule and its error.
+func (param *Param) verify(value reflect.Value) (rule string, err error) {
 	defer func() {
-		p := recover()
-		if p != nil {
-			err = param.myError(fmt.Sprint(p))
-		} else if err != nil {
-			err = param.myError(err.Error())
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v", p)
 		}
 	}()
-	for _, fn := range param.verifyFuncs {
-		if err = fn(value); err != nil {
-			return err
+	for _, vf := range param.verifyFuncs {
+		if err = vf.fn(value); err != nil {
+			return vf.rule, err
 		}
 	}
-	return nil
+	return "", nil
+}
+
+// verifyFunc is the validation function of a rule.
+type verifyFunc struct {
+	rule string
+	fn   func(reflect.Value) error
 }
 
 func (param *Param) makeVerifyFuncs() (err error) {
@@ -227,7 +293,7 @@ func (param *Param) makeVerifyFuncs() (err error) {
 	// length
 	if tuple, ok := param.tags[KEY_LEN]; ok {
 		if fn, err := validateLen(tuple); err == nil {
-			param.verifyFuncs = append(param.verifyFuncs, fn)
+			param.verifyFuncs = append(param.verifyFuncs, verifyFunc{KEY_LEN, fn})
 		} else {
 			return err
 		}
@@ -235,7 +301,7 @@ func (param *Param) makeVerifyFuncs() (err error) {
 	// range
 	if tuple, ok := param.tags[KEY_RANGE]; ok {
 		if fn, err := validateRange(tuple); err == nil {
-			param.verifyFuncs = append(param.verifyFuncs, fn)
+			param.verifyFuncs = append(param.verifyFuncs, verifyFunc{KEY_RANGE, fn})
 		} else {
 			return err
 		}
@@ -243,7 +309,7 @@ func (param *Param) makeVerifyFuncs() (err error) {
 	// nonzero
 	if _, ok := param.tags[KEY_NONZERO]; ok {
 		if fn, err := validateNonZero(); err == nil {
-			param.verifyFuncs = append(param.verifyFuncs, fn)
+			param.verifyFuncs = append(param.verifyFuncs, verifyFunc{KEY_NONZERO, fn})
 		} else {
 			return err
 		}
@@ -252,7 +318,7 @@ func (param *Param) makeVerifyFuncs() (err error) {
 	if reg, ok := param.tags[KEY_REGEXP]; ok {
 		var isStrings = param.rawValue.Kind() == reflect.Slice
 		if fn, err := validateRegexp(isStrings, reg); err == nil {
-			param.verifyFuncs = append(param.verifyFuncs, fn)
+			param.verifyFuncs = append(param.verifyFuncs, verifyFunc{KEY_REGEXP, fn})
 		} else {
 			return err
 		}
@@ -260,6 +326,80 @@ func (param *Param) makeVerifyFuncs() (err error) {
 	return
 }
 
+// verifyFiles tests if the uploaded files conform to the `maxsize`, `mime` and `accept` tags,
+// it returns the files with the sniffed content types if sniffed, the failed rule and the readable reason.
+func (param *Param) verifyFiles(fhs []*multipart.FileHeader) (files []*UploadedFile, rule string, reason string, ok bool) {
+	for _, fh := range fhs {
+		if param.maxSize > 0 && fh.Size > param.maxSize {
+			return nil, KEY_MAXSIZE, fmt.Sprintf("%s is larger than %s", fh.Filename, param.tags[KEY_MAXSIZE]), false
+		}
+		if len(param.mimeTypes) > 0 && !matchMIME(param.mimeTypes, fh.Header.Get("Content-Type")) {
+			return nil, KEY_MIME, fmt.Sprintf("%s is not of the type %s", fh.Filename, param.tags[KEY_MIME]), false
+		}
+	}
+	if !param.isUploaded && len(param.acceptTypes) == 0 {
+		return nil, "", "", true
+	}
+	files = make([]*UploadedFile, len(fhs))
+	for i, fh := range fhs {
+		file, err := newUploadedFile(fh)
+		if err != nil {
+			return nil, RuleType, fmt.Sprintf("%s can not be read", fh.Filename), false
+		}
+		if len(param.acceptTypes) > 0 && !matchMIME(param.acceptTypes, file.ContentType) {
+			return nil, KEY_ACCEPT, fmt.Sprintf("%s is not of the type %s", fh.Filename, param.tags[KEY_ACCEPT]), false
+		}
+		files[i] = file
+	}
+	return files, "", "", true
+}
+
+// parseSize parses the size such as `512KB`, `2MB`, `1GB` or the bytes `1024`.
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	var unit int64 = 1
+	for _, u := range []struct {
+		suffix string
+		unit   int64
+	}{{"GB", 1 << 30}, {"MB", MB}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(s[:len(s)-len(u.suffix)]), u.unit
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, errors.New("it must be a positive size, e.g. `512KB`, `2MB` or `1024`")
+	}
+	return n * unit, nil
+}
+
+// parseMIME parses the MIME types separated by `,`.
+func parseMIME(s string) []string {
+	var types []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// matchMIME returns whether the content type matches one of the types,
+// the wildcard subtype such as `image/*` is supported.
+func matchMIME(types []string, contentType string) bool {
+	if i := strings.IndexByte(contentType, ';'); i != -1 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	for _, t := range types {
+		if t == contentType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(contentType, t[:len(t)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
 func parseTuple(tuple string) (string, string) {
 	c := strings.Split(tuple, ":")
 	var a, b string
@@ -281,6 +421,13 @@ func parseTuple(tuple string) (string, string) {
 
 func validateNonZero() (func(value reflect.Value) error, error) {
 	return func(value reflect.Value) error {
+		switch value.Kind() {
+		case reflect.Slice, reflect.Map:
+			if value.Len() == 0 {
+				return errors.New("not set")
+			}
+			return nil
+		}
 		obj := value.Interface()
 		if obj == reflect.Zero(value.Type()).Interface() {
 			return errors.New("not set")
@@ -17,6 +17,7 @@ package apiware
 import (
 	"bytes"
 	"encoding/gob"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -26,6 +27,7 @@ import (
 	"net/url"
 	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 	// "github.com/valyala/fasthttp"
 )
@@ -45,8 +47,12 @@ type (
 		paramNameMapper ParamNameMapper
 		// decode params from request body
 		bodydecoder Bodydecoder
+		// decode params from request body by the media type of request Content-Type
+		mediaBodydecoders map[string]Bodydecoder
 		//when request Content-Type is multipart/form-data, the max memory for body.
 		maxMemory int64
+		// names of the query params, which are not received by the map[string]string field
+		queryNames map[string]bool
 	}
 
 	// Schema is a collection of ParamsAPI
@@ -79,6 +85,25 @@ func NewParamsAPI(
 ) (
 	*ParamsAPI,
 	error,
+) {
+	paramsAPI, err := ParseParamsAPI(structPointer, paramNameMapper, bodydecoder, useDefaultValues)
+	if err != nil {
+		return nil, err
+	}
+	defaultSchema.set(paramsAPI)
+	return paramsAPI, nil
+}
+
+// ParseParamsAPI is similar to a `NewParamsAPI`, but does not store the struct object,
+// so that it is not got by GetParamsAPI and never replaces the stored one of the same name.
+func ParseParamsAPI(
+	structPointer interface{},
+	paramNameMapper ParamNameMapper,
+	bodydecoder Bodydecoder,
+	useDefaultValues bool,
+) (
+	*ParamsAPI,
+	error,
 ) {
 	name := reflect.TypeOf(structPointer).String()
 	v := reflect.ValueOf(structPointer)
@@ -105,10 +130,19 @@ func NewParamsAPI(
 	} else {
 		paramsAPI.bodydecoder = bodyJONS
 	}
-	err := paramsAPI.addFields([]int{}, paramsAPI.structType, v)
+	err := paramsAPI.addFields([]int{}, nil, "", paramsAPI.structType, v)
 	if err != nil {
 		return nil, err
 	}
+	if err = paramsAPI.checkConflicts(); err != nil {
+		return nil, err
+	}
+	paramsAPI.queryNames = make(map[string]bool)
+	for _, param := range paramsAPI.params {
+		if param.In() == "query" && !param.isQueryMap {
+			paramsAPI.queryNames[param.name] = true
+		}
+	}
 
 	if useDefaultValues && !reflect.DeepEqual(reflect.New(paramsAPI.structType).Interface(), paramsAPI.rawStructPointer) {
 		buf := bytes.NewBuffer(nil)
@@ -117,7 +151,6 @@ func NewParamsAPI(
 			paramsAPI.defaultValues = buf.Bytes()
 		}
 	}
-	defaultSchema.set(paramsAPI)
 	return paramsAPI, nil
 }
 
@@ -135,10 +168,13 @@ func Register(
 	return err
 }
 
-func (paramsAPI *ParamsAPI) addFields(parentIndexPath []int, t reflect.Type, v reflect.Value) error {
+// addFields parses the params of the struct fields.
+// The fields of an anonymous struct field without `param` tag are flattened into the parent's namespace,
+// and the ones of a named struct field without `param` tag are nested in the `group` named by the field,
+// fieldPrefix is the path of the struct field, e.g. `Filter.`.
+func (paramsAPI *ParamsAPI) addFields(parentIndexPath []int, group []string, fieldPrefix string, t reflect.Type, v reflect.Value) error {
 	var err error
 	var maxMemoryMB int64
-	var hasFormData, hasBody bool
 	var deep = len(parentIndexPath) + 1
 	for i := 0; i < t.NumField(); i++ {
 		indexPath := make([]int, deep)
@@ -148,10 +184,17 @@ func (paramsAPI *ParamsAPI) addFields(parentIndexPath []int, t reflect.Type, v r
 		var field = t.Field(i)
 		tag, ok := field.Tag.Lookup(TAG_PARAM)
 		if !ok {
-			if field.Anonymous && field.Type.Kind() == reflect.Struct {
-				if err = paramsAPI.addFields(indexPath, field.Type, v.Field(i)); err != nil {
-					return err
-				}
+			if field.Type.Kind() != reflect.Struct {
+				continue
+			}
+			if field.Anonymous {
+				err = paramsAPI.addFields(indexPath, group, fieldPrefix+field.Name+".", field.Type, v.Field(i))
+			} else if field.PkgPath == "" && hasParamFields(field.Type) {
+				subgroup := append(group[:len(group):len(group)], paramsAPI.paramNameMapper(field.Name))
+				err = paramsAPI.addFields(indexPath, subgroup, fieldPrefix+field.Name+".", field.Type, v.Field(i))
+			}
+			if err != nil {
+				return err
 			}
 			continue
 		}
@@ -159,7 +202,7 @@ func (paramsAPI *ParamsAPI) addFields(parentIndexPath []int, t reflect.Type, v r
 		if tag == TAG_IGNORE_PARAM {
 			continue
 		}
-		if field.Type.Kind() == reflect.Ptr && field.Type.String() != fileTypeString && field.Type.String() != cookieTypeString {
+		if field.Type.Kind() == reflect.Ptr && field.Type.String() != fileTypeString && field.Type.String() != uploadedFileTypeString && field.Type.String() != cookieTypeString {
 			return NewError(t.String(), field.Name, "field can not be a pointer")
 		}
 
@@ -173,7 +216,7 @@ func (paramsAPI *ParamsAPI) addFields(parentIndexPath []int, t reflect.Type, v r
 		var paramTypeString = field.Type.String()
 
 		switch paramTypeString {
-		case fileTypeString, filesTypeString, fileTypeString2, filesTypeString2:
+		case fileTypeString, filesTypeString, fileTypeString2, filesTypeString2, uploadedFileTypeString, uploadedFilesTypeString:
 			if paramPosition != "formData" {
 				return NewError(t.String(), field.Name, "when field type is `"+paramTypeString+"`, tag `in` value must be `formData`")
 			}
@@ -181,22 +224,14 @@ func (paramsAPI *ParamsAPI) addFields(parentIndexPath []int, t reflect.Type, v r
 			if paramPosition != "cookie" {
 				return NewError(t.String(), field.Name, "when field type is `"+paramTypeString+"`, tag `in` value must be `cookie`")
 			}
+		case queryMapTypeString:
+			if paramPosition != "query" {
+				return NewError(t.String(), field.Name, "when field type is `"+paramTypeString+"`, tag `in` value must be `query`")
+			}
 		}
 
 		switch paramPosition {
-		case "formData":
-			if hasBody {
-				return NewError(t.String(), field.Name, "tags of `in(formData)` and `in(body)` can not exist at the same time")
-			}
-			hasFormData = true
-		case "body":
-			if hasFormData {
-				return NewError(t.String(), field.Name, "tags of `in(formData)` and `in(body)` can not exist at the same time")
-			}
-			if hasBody {
-				return NewError(t.String(), field.Name, "there should not be more than one tag `in(body)`")
-			}
-			hasBody = true
+		case "formData", "body":
 		case "path":
 			parsedTags[KEY_REQUIRED] = KEY_REQUIRED
 		// case "cookie":
@@ -207,7 +242,7 @@ func (paramsAPI *ParamsAPI) addFields(parentIndexPath []int, t reflect.Type, v r
 		// 	}
 		default:
 			if !TagInValues[paramPosition] {
-				return NewError(t.String(), field.Name, "invalid tag `in` value, refer to the following: `path`, `query`, `formData`, `body`, `header` or `cookie`")
+				return NewError(t.String(), field.Name, "invalid tag `in` value, refer to the following: `path`, `query`, `formData`, `body`, `header`, `cookie` or `jwt`")
 			}
 		}
 		if _, ok := parsedTags[KEY_LEN]; ok {
@@ -242,6 +277,7 @@ func (paramsAPI *ParamsAPI) addFields(parentIndexPath []int, t reflect.Type, v r
 
 		fd := &Param{
 			apiName:   paramsAPI.name,
+			field:     fieldPrefix + field.Name,
 			indexPath: indexPath,
 			tags:      parsedTags,
 			rawTag:    field.Tag,
@@ -257,11 +293,52 @@ func (paramsAPI *ParamsAPI) addFields(parentIndexPath []int, t reflect.Type, v r
 		if fd.name, ok = parsedTags[KEY_NAME]; !ok {
 			fd.name = paramsAPI.paramNameMapper(field.Name)
 		}
-		if paramPosition == "header" {
+		switch paramPosition {
+		case "header":
 			fd.name = textproto.CanonicalMIMEHeaderKey(fd.name)
+		case "query", "formData", "body":
+			if len(group) > 0 {
+				fd.name = strings.Join(group, ".") + "." + fd.name
+			}
+			if paramPosition == "body" {
+				// decoded from the sub-object of the JSON body
+				fd.bodyPath = group
+			}
+		}
+
+		fd.isUploaded = paramTypeString == uploadedFileTypeString || paramTypeString == uploadedFilesTypeString
+		fd.isFile = fd.isUploaded || paramTypeString == fileTypeString || paramTypeString == filesTypeString || paramTypeString == fileTypeString2 || paramTypeString == filesTypeString2
+
+		_, hasMaxSize := parsedTags[KEY_MAXSIZE]
+		_, hasMIME := parsedTags[KEY_MIME]
+		_, hasAccept := parsedTags[KEY_ACCEPT]
+		if (hasMaxSize || hasMIME || hasAccept) && !fd.isFile {
+			return NewError(t.String(), field.Name, "invalid `"+KEY_MAXSIZE+"`, `"+KEY_MIME+"` or `"+KEY_ACCEPT+"` tag for non-file field")
+		}
+		if hasMaxSize {
+			if fd.maxSize, err = parseSize(parsedTags[KEY_MAXSIZE]); err != nil {
+				return NewError(t.String(), field.Name, "invalid `"+KEY_MAXSIZE+"` tag, "+err.Error())
+			}
+		}
+		if hasMIME {
+			if fd.mimeTypes = parseMIME(parsedTags[KEY_MIME]); len(fd.mimeTypes) == 0 {
+				return NewError(t.String(), field.Name, "invalid `"+KEY_MIME+"` tag, it can not be empty")
+			}
+		}
+		if hasAccept {
+			if fd.acceptTypes = parseMIME(parsedTags[KEY_ACCEPT]); len(fd.acceptTypes) == 0 {
+				return NewError(t.String(), field.Name, "invalid `"+KEY_ACCEPT+"` tag, it can not be empty")
+			}
 		}
 
-		fd.isFile = paramTypeString == fileTypeString || paramTypeString == filesTypeString || paramTypeString == fileTypeString2 || paramTypeString == filesTypeString2
+		fd.isQueryMap = paramTypeString == queryMapTypeString
+		if !fd.isFile && !fd.isQueryMap {
+			format, ok := parsedTags[KEY_FORMAT]
+			if !ok {
+				format = field.Tag.Get(KEY_FORMAT)
+			}
+			fd.conv = newConverter(field.Type, format)
+		}
 
 		_, fd.isRequired = parsedTags[KEY_REQUIRED]
 		_, hasNonzero := parsedTags[KEY_NONZERO]
@@ -283,6 +360,65 @@ func (paramsAPI *ParamsAPI) addFields(parentIndexPath []int, t reflect.Type, v r
 	return nil
 }
 
+// hasParamFields reports whether the struct type has any field with the `param` tag,
+// including the ones of its struct fields.
+func hasParamFields(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if _, ok := field.Tag.Lookup(TAG_PARAM); ok {
+			return true
+		}
+		if field.Type.Kind() == reflect.Struct && hasParamFields(field.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConflicts verifies that no two params are bound from the same request value,
+// such as the ones of the embedded structs with the same name.
+func (paramsAPI *ParamsAPI) checkConflicts() error {
+	var formData, body *Param
+	var bound = make(map[string]*Param, len(paramsAPI.params))
+	for _, param := range paramsAPI.params {
+		in := param.In()
+		key := in + " " + param.name
+		switch in {
+		case "formData":
+			formData = param
+		case "body":
+			body = param
+			key = in + " " + strings.Join(param.bodyPath, ".")
+		}
+		if formData != nil && body != nil {
+			return NewError(paramsAPI.name, formData.field+", "+body.field, "tags of `in(formData)` and `in(body)` can not exist at the same time")
+		}
+		if p, ok := bound[key]; ok {
+			if in == "body" {
+				return NewError(paramsAPI.name, p.field+", "+param.field, "there should not be more than one tag `in(body)` in the same namespace")
+			}
+			return NewError(paramsAPI.name, p.field+", "+param.field, "the fields are bound to the same `"+in+"` param `"+param.name+"`")
+		}
+		bound[key] = param
+	}
+	return nil
+}
+
+// subBody returns the sub-object of the JSON body at the path.
+func subBody(body []byte, path []string) ([]byte, bool) {
+	for _, key := range path {
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(body, &obj) != nil {
+			return nil, false
+		}
+		var ok bool
+		if body, ok = obj[key]; !ok || string(body) == "null" {
+			return nil, false
+		}
+	}
+	return body, true
+}
+
 // GetParamsAPI gets the `*ParamsAPI` object according to the type name
 func GetParamsAPI(paramsAPIName string) (*ParamsAPI, error) {
 	paramsAPI, ok := defaultSchema.get(paramsAPIName)
@@ -325,6 +461,18 @@ func (paramsAPI *ParamsAPI) Number() int {
 	return len(paramsAPI.params)
 }
 
+// Filter returns a copy of the ParamsAPI that only binds the parameters for which fn returns true.
+func (paramsAPI *ParamsAPI) Filter(fn func(*Param) bool) *ParamsAPI {
+	filtered := *paramsAPI
+	filtered.params = make([]*Param, 0, len(paramsAPI.params))
+	for _, param := range paramsAPI.params {
+		if fn(param) {
+			filtered.params = append(filtered.params, param)
+		}
+	}
+	return &filtered
+}
+
 // Raw returns the ParamsAPI's original value
 func (paramsAPI *ParamsAPI) Raw() interface{} {
 	return paramsAPI.rawStructPointer
@@ -341,6 +489,36 @@ func (paramsAPI *ParamsAPI) SetMaxMemory(maxMemory int64) {
 	paramsAPI.maxMemory = maxMemory
 }
 
+// SetMediaBodydecoder sets the body decoder used when the request Content-Type is `mediaType`,
+// such as `application/x-protobuf`; if `bodydecoder` is nil, the registration is removed.
+// note: it should be called before binding.
+func (paramsAPI *ParamsAPI) SetMediaBodydecoder(mediaType string, bodydecoder Bodydecoder) {
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if bodydecoder == nil {
+		delete(paramsAPI.mediaBodydecoders, mediaType)
+		return
+	}
+	if paramsAPI.mediaBodydecoders == nil {
+		paramsAPI.mediaBodydecoders = make(map[string]Bodydecoder)
+	}
+	paramsAPI.mediaBodydecoders[mediaType] = bodydecoder
+}
+
+// selectBodydecoder returns the body decoder matching the request Content-Type,
+// or the default one.
+func (paramsAPI *ParamsAPI) selectBodydecoder(req *http.Request) Bodydecoder {
+	if len(paramsAPI.mediaBodydecoders) > 0 {
+		mediaType := req.Header.Get("Content-Type")
+		if i := strings.IndexByte(mediaType, ';'); i != -1 {
+			mediaType = mediaType[:i]
+		}
+		if bodydecoder, ok := paramsAPI.mediaBodydecoders[strings.ToLower(strings.TrimSpace(mediaType))]; ok {
+			return bodydecoder
+		}
+	}
+	return paramsAPI.bodydecoder
+}
+
 // NewReceiver creates a new struct pointer and the field's values  for its receive parameterste it.
 func (paramsAPI *ParamsAPI) NewReceiver() (interface{}, []reflect.Value) {
 	object := reflect.New(paramsAPI.structType)
@@ -448,6 +626,7 @@ func (paramsAPI *ParamsAPI) RawBind(
 
 // BindFields binds the net/http request params to a struct and validate it.
 // Must ensure that the param `fields` matches `paramsAPI.params`.
+// All the failures are collected and returned together as BindErrors.
 func (paramsAPI *ParamsAPI) BindFields(
 	fields []reflect.Value,
 	req *http.Request,
@@ -462,23 +641,31 @@ func (paramsAPI *ParamsAPI) BindFields(
 		req.ParseMultipartForm(paramsAPI.maxMemory)
 	}
 	var queryValues url.Values
+	var body []byte
+	var bodyRead bool
+	var bodyErr error
+	var errs BindErrors
 	defer func() {
 		if p := recover(); p != nil {
-			err = NewError(paramsAPI.name, "?", fmt.Sprint(p))
+			err = append(errs, &BindError{Field: "*", Message: fmt.Sprint(p)})
 		}
 	}()
 
 	for i, param := range paramsAPI.params {
 		value := fields[i]
+		var paramValues []string
 		switch param.In() {
 		case "path":
 			paramValue, ok := pathParams.Get(param.name)
 			if !ok {
-				return param.myError("missing path param")
+				errs = append(errs, param.bindError(RuleRequired, nil, "is required"))
+				continue
 			}
+			paramValues = []string{paramValue}
 			// fmt.Printf("paramName:%s\nvalue:%#v\n\n", param.name, paramValue)
-			if err = convertAssign(value, []string{paramValue}); err != nil {
-				return param.myError(err.Error())
+			if reason, ok := param.assign(value, paramValues); !ok {
+				errs = append(errs, param.bindError(RuleType, paramValues, reason))
+				continue
 			}
 
 		case "query":
@@ -488,13 +675,30 @@ func (paramsAPI *ParamsAPI) BindFields(
 					queryValues = make(url.Values)
 				}
 			}
-			paramValues, ok := queryValues[param.name]
+			if param.isQueryMap {
+				m := make(map[string]string, len(queryValues))
+				for k, vs := range queryValues {
+					if !paramsAPI.queryNames[k] && len(vs) > 0 {
+						m[k] = vs[0]
+					}
+				}
+				if len(m) == 0 && param.IsRequired() {
+					errs = append(errs, param.bindError(RuleRequired, nil, "is required"))
+					continue
+				}
+				value.Set(reflect.ValueOf(m))
+				break
+			}
+			var ok bool
+			paramValues, ok = queryValues[param.name]
 			if ok {
-				if err = convertAssign(value, paramValues); err != nil {
-					return param.myError(err.Error())
+				if reason, ok := param.assign(value, paramValues); !ok {
+					errs = append(errs, param.bindError(RuleType, paramValues, reason))
+					continue
 				}
 			} else if param.IsRequired() {
-				return param.myError("missing query param")
+				errs = append(errs, param.bindError(RuleRequired, nil, "is required"))
+				continue
 			}
 
 		case "formData":
@@ -504,10 +708,15 @@ func (paramsAPI *ParamsAPI) BindFields(
 					fhs := req.MultipartForm.File[param.name]
 					if len(fhs) == 0 {
 						if param.IsRequired() {
-							return param.myError("missing formData param")
+							errs = append(errs, param.bindError(RuleRequired, nil, "is required"))
 						}
 						continue
 					}
+					files, rule, reason, ok := param.verifyFiles(fhs)
+					if !ok {
+						errs = append(errs, param.bindError(rule, nil, reason))
+						continue
+					}
 					typ := value.Type()
 					switch typ.String() {
 					case fileTypeString:
@@ -522,49 +731,86 @@ func (paramsAPI *ParamsAPI) BindFields(
 							fhs2[i] = *fh
 						}
 						value.Set(reflect.ValueOf(fhs2))
+					case uploadedFileTypeString:
+						value.Set(reflect.ValueOf(files[0]))
+					case uploadedFilesTypeString:
+						value.Set(reflect.ValueOf(files))
 					default:
-						return param.myError(
-							"the param type is incorrect, reference: " +
-								fileTypeString +
-								"," + filesTypeString,
-						)
+						errs = append(errs, param.bindError(RuleType, nil, "must be a file"))
 					}
 				} else if param.IsRequired() {
-					return param.myError("missing formData param")
+					errs = append(errs, param.bindError(RuleRequired, nil, "is required"))
 				}
 				continue
 			}
 
-			paramValues, ok := req.PostForm[param.name]
+			var ok bool
+			paramValues, ok = req.PostForm[param.name]
 			if ok {
-				if err = convertAssign(value, paramValues); err != nil {
-					return param.myError(err.Error())
+				if reason, ok := param.assign(value, paramValues); !ok {
+					errs = append(errs, param.bindError(RuleType, paramValues, reason))
+					continue
 				}
 			} else if param.IsRequired() {
-				return param.myError("missing formData param")
+				errs = append(errs, param.bindError(RuleRequired, nil, "is required"))
+				continue
 			}
 
 		case "body":
-			// Theoretically there should be at most one `body` param, and can not exist with `formData` at the same time
-			var body []byte
-			body, err = ioutil.ReadAll(req.Body)
-			req.Body.Close()
-			if err == nil {
-				if err = paramsAPI.bodydecoder(value, body); err != nil {
-					return param.myError(err.Error())
+			// There is at most one `body` param in each namespace, and can not exist with `formData` at the same time
+			if !bodyRead {
+				body, bodyErr = ioutil.ReadAll(req.Body)
+				req.Body.Close()
+				bodyRead = true
+			}
+			if bodyErr == nil {
+				data, ok := body, true
+				if len(param.bodyPath) > 0 {
+					data, ok = subBody(body, param.bodyPath)
+				}
+				if !ok {
+					if param.IsRequired() {
+						errs = append(errs, param.bindError(RuleRequired, nil, "is required"))
+					}
+					continue
+				}
+				if paramsAPI.selectBodydecoder(req)(value, data) != nil {
+					errs = append(errs, param.bindError(RuleDecode, nil, "is malformed"))
+					continue
 				}
 			} else if param.IsRequired() {
-				return param.myError("missing body param")
+				errs = append(errs, param.bindError(RuleRequired, nil, "is required"))
+				continue
 			}
 
 		case "header":
-			paramValues, ok := req.Header[param.name]
+			var ok bool
+			paramValues, ok = req.Header[param.name]
 			if ok {
-				if err = convertAssign(value, paramValues); err != nil {
-					return param.myError(err.Error())
+				if reason, ok := param.assign(value, paramValues); !ok {
+					errs = append(errs, param.bindError(RuleType, paramValues, reason))
+					continue
 				}
 			} else if param.IsRequired() {
-				return param.myError("missing header param")
+				errs = append(errs, param.bindError(RuleRequired, nil, "is required"))
+				continue
+			}
+
+		case "jwt":
+			claims := ClaimsFrom(req.Context())
+			if assignClaim(value, claims[param.name]) {
+				break
+			}
+			var ok bool
+			paramValues, ok = claimValues(claims, param.name)
+			if ok {
+				if reason, ok := param.assign(value, paramValues); !ok {
+					errs = append(errs, param.bindError(RuleType, paramValues, reason))
+					continue
+				}
+			} else if param.IsRequired() {
+				errs = append(errs, param.bindError(RuleRequired, nil, "is required"))
+				continue
 			}
 
 		case "cookie":
@@ -576,17 +822,23 @@ func (paramsAPI *ParamsAPI) BindFields(
 				case cookieTypeString2:
 					value.Set(reflect.ValueOf(c).Elem())
 				default:
-					if err = convertAssign(value, []string{c.Value}); err != nil {
-						return param.myError(err.Error())
+					paramValues = []string{c.Value}
+					if reason, ok := param.assign(value, paramValues); !ok {
+						errs = append(errs, param.bindError(RuleType, paramValues, reason))
+						continue
 					}
 				}
 			} else if param.IsRequired() {
-				return param.myError("missing cookie param")
+				errs = append(errs, param.bindError(RuleRequired, nil, "is required"))
+				continue
 			}
 		}
-		if err = param.validate(value); err != nil {
-			return err
+		if rule, e := param.verify(value); e != nil {
+			errs = append(errs, param.bindError(rule, paramValues, e.Error()))
 		}
 	}
-	return
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
 }
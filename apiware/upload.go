@@ -0,0 +1,111 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiware
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// UploadedFile is the uploaded file bound to the `formData` param of the type
+// `*UploadedFile` or `[]*UploadedFile`, whose content type is sniffed from the content
+// instead of trusting the one declared by the client.
+// The temporary file of the upload is removed when the request is done,
+// so it should be saved by SaveTo in the handler if needed.
+type UploadedFile struct {
+	// Filename is the base name of the file declared by the client.
+	Filename string
+	// Size is the size of the file in bytes.
+	Size int64
+	// ContentType is the MIME type sniffed from the first 512 bytes, such as `image/png`.
+	ContentType string
+	// Header is the original multipart file header.
+	Header *multipart.FileHeader
+}
+
+const (
+	uploadedFileTypeString  = "*apiware.UploadedFile"
+	uploadedFilesTypeString = "[]*apiware.UploadedFile"
+)
+
+// newUploadedFile opens the file header to sniff the content type.
+func newUploadedFile(fh *multipart.FileHeader) (*UploadedFile, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var head [512]byte
+	n, err := io.ReadFull(f, head[:])
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	contentType := http.DetectContentType(head[:n])
+	if i := strings.IndexByte(contentType, ';'); i != -1 {
+		contentType = contentType[:i]
+	}
+	return &UploadedFile{
+		Filename:    filepath.Base(strings.Replace(fh.Filename, `\`, "/", -1)),
+		Size:        fh.Size,
+		ContentType: contentType,
+		Header:      fh,
+	}, nil
+}
+
+// Open opens the content of the file, which must be closed by the caller.
+func (f *UploadedFile) Open() (multipart.File, error) {
+	return f.Header.Open()
+}
+
+// SaveTo saves the file to the directory, which is created if not exist,
+// and returns the path of the saved file.
+// The file name is returned by namer, or the base name of Filename if namer is nil,
+// and it is kept inside the directory.
+// An existing file with the same name is not overwritten, and os.ErrExist is returned.
+func (f *UploadedFile) SaveTo(dir string, namer func(*UploadedFile) string) (string, error) {
+	name := filepath.Base(f.Filename)
+	if namer != nil {
+		name = namer(f)
+	}
+	// cleaning from the root removes the `..` elements that leave the directory
+	name = filepath.Clean("/" + filepath.FromSlash(name))
+	if name == string(filepath.Separator) || name == "." {
+		return "", errors.New("apiware: the uploaded file name is empty")
+	}
+	fullname := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(fullname), 0777); err != nil {
+		return "", err
+	}
+	src, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(fullname, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(fullname)
+		return "", err
+	}
+	return fullname, dst.Close()
+}
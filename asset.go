@@ -0,0 +1,279 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// AssetHashKey is the URL query key of the content hash for cache busting.
+// The static file URL with the current content hash is cached by the browsers forever,
+// others must be revalidated, unless the rules of the static route set the Cache-Control,
+// such as StaticCacheControl.
+const AssetHashKey = "v"
+
+const (
+	immutableCacheControl  = "public, max-age=31536000, immutable"
+	revalidateCacheControl = "public, max-age=0, must-revalidate"
+	assetHashTemplateFunc  = "static"
+	assetHashHexLength     = 12
+)
+
+// assetHash is the content hash of a local file.
+type assetHash struct {
+	hash    string
+	size    int64
+	modTime time.Time
+}
+
+// AssetHash returns the content hash of the local file in the underlying file system.
+// The hash is computed lazily, and recomputed when the file is modified
+// or its cache entry is invalidated.
+func (c *FileServerManager) AssetHash(name string) (string, error) {
+	return c.assetHash(c.fs, name)
+}
+
+// assetHash returns the content hash of the file in fsys,
+// which is recorded by the file system and name, unless the identity of fsys is unknown.
+func (c *FileServerManager) assetHash(fsys http.FileSystem, name string) (string, error) {
+	scope, cacheable := c.fsScope(fsys)
+	key := scopedName(scope, name)
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	c.assetsLock.RLock()
+	a, ok := c.assets[key]
+	c.assetsLock.RUnlock()
+	if ok && a.size == info.Size() && a.modTime.Equal(info.ModTime()) {
+		return a.hash, nil
+	}
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	a = assetHash{
+		hash:    hex.EncodeToString(h.Sum(nil))[:assetHashHexLength],
+		size:    info.Size(),
+		modTime: info.ModTime(),
+	}
+	if cacheable {
+		c.assetsLock.Lock()
+		c.assets[key] = a
+		c.assetsLock.Unlock()
+	}
+	return a.hash, nil
+}
+
+// invalidateAssetHash removes the content hash of the file.
+func (c *FileServerManager) invalidateAssetHash(name string) {
+	c.assetsLock.Lock()
+	delete(c.assets, name)
+	c.assetsLock.Unlock()
+}
+
+// StaticURL returns the URL of the file under the static directory with the content hash,
+// such as `/static/js/app.js?v=0123456789ab`.
+// It is registered as the template function `static`:
+//
+//	<script src="{{ static("js/app.js") }}"></script>
+//
+// If the file does not exist, the URL without hash is returned.
+func StaticURL(shortFilename string) string {
+	u := path.Join("/static", "/"+shortFilename)
+	hash, err := global.fsManager.AssetHash(JoinStatic(shortFilename))
+	if err != nil {
+		return u
+	}
+	return u + "?" + AssetHashKey + "=" + hash
+}
+
+func init() {
+	global.render.TemplateVar(assetHashTemplateFunc, StaticURL)
+}
+
+// setAssetCacheControl sets the Cache-Control header for the static file, unless it is already set.
+// Only the URL with the current content hash of the file is immutable,
+// since the old or invalid hash would keep the current content under the wrong URL.
+func (c *FileServerManager) setAssetCacheControl(ctx *Context, fs FileSystem, name string) {
+	if ctx.W.Header().Get(HeaderCacheControl) != "" {
+		return
+	}
+	if v := ctx.QueryParam(AssetHashKey); v != "" {
+		if hash, err := c.assetHash(fs, name); err == nil && v == hash {
+			ctx.W.Header().Set(HeaderCacheControl, immutableCacheControl)
+			return
+		}
+	}
+	ctx.W.Header().Set(HeaderCacheControl, revalidateCacheControl)
+}
+
+// CacheControlRule is the Cache-Control rule of the static files.
+type CacheControlRule struct {
+	// Pattern is a file extension such as ".html",
+	// or a glob pattern of the file path such as "js/*.js",
+	// or a glob pattern of the file name such as "*.min.js".
+	// "**" matches any number of directories, such as "img/**" and "**/vendor/*.js".
+	Pattern string
+	// Value of the Cache-Control header, such as "no-cache".
+	CacheControl string
+	// Optional additional headers, such as the Access-Control-Allow-Origin of the fonts.
+	Header http.Header
+}
+
+// cacheControlRule is the precompiled CacheControlRule.
+type cacheControlRule struct {
+	*CacheControlRule
+	ext  string         // the lower file extension, empty if the pattern is a glob
+	glob *regexp.Regexp // the glob pattern
+	base bool           // whether the file name is also matched, if the pattern has no slash
+}
+
+// StaticCacheControl creates a middleware for the static routes that sets the Cache-Control
+// header and the additional headers by the first matching rule, for example:
+//
+//	faygo.SetStatic("./static/", false, false, faygo.StaticCacheControl(
+//		faygo.CacheControlRule{Pattern: ".html", CacheControl: "no-cache"},
+//		faygo.CacheControlRule{Pattern: "*.*.js", CacheControl: "public, max-age=31536000, immutable"},
+//		faygo.CacheControlRule{Pattern: "fonts/**", CacheControl: "max-age=31536000",
+//			Header: http.Header{"Access-Control-Allow-Origin": {"*"}}},
+//	))
+//
+// If no rule matches, the default rule of the content hash URL is used.
+// The patterns are compiled on creating, and it panics if any of them is invalid.
+func StaticCacheControl(rules ...CacheControlRule) HandlerFunc {
+	compiled, err := compileCacheControl(rules)
+	if err != nil {
+		Panicf("StaticCacheControl: %s", err.Error())
+	}
+	return func(ctx *Context) error {
+		if rule := matchCacheControl(compiled, ctx.PathParam(FilepathKey)); rule != nil {
+			h := ctx.W.Header()
+			if rule.CacheControl != "" {
+				h.Set(HeaderCacheControl, rule.CacheControl)
+			}
+			for k, v := range rule.Header {
+				// copied, so that the handlers changing the header never change the rule
+				h[k] = append([]string(nil), v...)
+			}
+		}
+		return nil
+	}
+}
+
+// compileCacheControl compiles the patterns of the rules.
+func compileCacheControl(rules []CacheControlRule) ([]cacheControlRule, error) {
+	compiled := make([]cacheControlRule, len(rules))
+	for i := range rules {
+		rule := &rules[i]
+		compiled[i].CacheControlRule = rule
+		if strings.HasPrefix(rule.Pattern, ".") && !strings.ContainsAny(rule.Pattern, "*?[") {
+			compiled[i].ext = strings.ToLower(rule.Pattern)
+			continue
+		}
+		glob, err := compileGlob(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %s", rule.Pattern, err.Error())
+		}
+		compiled[i].glob = glob
+		compiled[i].base = !strings.Contains(rule.Pattern, "/")
+	}
+	return compiled, nil
+}
+
+// compileGlob compiles the glob pattern of path.Match, extended with "**"
+// which matches any number of directories, to the regular expression.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	if _, err := path.Match(strings.Replace(pattern, "**", "*", -1), ""); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if !strings.HasPrefix(pattern[i:], "**") {
+				b.WriteString("[^/]*")
+				continue
+			}
+			i++
+			if strings.HasPrefix(pattern[i+1:], "/") {
+				// "**/" matches zero or more directories
+				i++
+				b.WriteString("(?:.*/)?")
+			} else {
+				b.WriteString(".*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '\\':
+			i++
+			if i < len(pattern) {
+				b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		case '[':
+			// the pattern is valid, so the class is closed by the first unescaped ']'
+			end := i + 1
+			for pattern[end] != ']' {
+				if pattern[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			class := pattern[i+1 : end]
+			if strings.HasPrefix(class, "^") {
+				class = "^/" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i = end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// matchCacheControl returns the first rule matching the file path, nil if none.
+func matchCacheControl(rules []cacheControlRule, filepath string) *CacheControlRule {
+	filepath = strings.TrimPrefix(path.Clean("/"+filepath), "/")
+	base := path.Base(filepath)
+	ext := strings.ToLower(path.Ext(filepath))
+	for _, rule := range rules {
+		if rule.glob == nil {
+			if rule.ext == ext {
+				return rule.CacheControlRule
+			}
+			continue
+		}
+		if rule.glob.MatchString(filepath) || rule.base && rule.glob.MatchString(base) {
+			return rule.CacheControlRule
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaticURL(t *testing.T) {
+	name := "faygo_asset_test/app.js"
+	filename := JoinStatic(name)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(filepath.Dir(filename))
+
+	if u := StaticURL(name); u != "/static/"+name {
+		t.Fatalf("missing file: got %q", u)
+	}
+	if err := ioutil.WriteFile(filename, []byte("var a = 1;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	u1 := StaticURL(name)
+	if !strings.HasPrefix(u1, "/static/"+name+"?"+AssetHashKey+"=") {
+		t.Fatalf("unexpected URL: %q", u1)
+	}
+	if u := StaticURL(name); u != u1 {
+		t.Fatalf("unchanged file: got %q, want %q", u, u1)
+	}
+
+	if err := ioutil.WriteFile(filename, []byte("var a = 2;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filename, future, future); err != nil {
+		t.Fatal(err)
+	}
+	u2 := StaticURL(name)
+	if u2 == u1 {
+		t.Fatalf("changed file: URL is still %q", u2)
+	}
+}
+
+func TestMatchCacheControl(t *testing.T) {
+	rules := []CacheControlRule{
+		{Pattern: ".html", CacheControl: "no-cache"},
+		{Pattern: "js/*.js", CacheControl: "max-age=60"},
+		{Pattern: "*.min.css", CacheControl: "immutable"},
+		{Pattern: "img/**", CacheControl: "max-age=86400"},
+		{Pattern: "**/vendor/*.js", CacheControl: "max-age=3600"},
+		{Pattern: "[^_]*.txt", CacheControl: "max-age=1"},
+	}
+	compiled, err := compileCacheControl(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		filepath, want string
+	}{
+		{"/index.HTML", "no-cache"},
+		{"docs/a.html", "no-cache"},
+		{"/js/app.js", "max-age=60"},
+		{"lib/js/app.js", ""},
+		{"/css/site.min.css", "immutable"},
+		{"/css/site.css", ""},
+		{"img/logo.png", "max-age=86400"},
+		{"/img/icons/2x/menu.png", "max-age=86400"},
+		{"lib/img/logo.png", ""},
+		{"vendor/jquery.js", "max-age=3600"},
+		{"a/b/vendor/jquery.js", "max-age=3600"},
+		{"a/vendor/lib/jquery.js", ""},
+		{"docs/readme.txt", "max-age=1"},
+		{"docs/_draft.txt", ""},
+	}
+	for _, c := range cases {
+		var got string
+		if rule := matchCacheControl(compiled, c.filepath); rule != nil {
+			got = rule.CacheControl
+		}
+		if got != c.want {
+			t.Errorf("matchCacheControl(%q) = %q, want %q", c.filepath, got, c.want)
+		}
+	}
+	for _, pattern := range []string{"[a-", "img/\\"} {
+		if _, err := compileCacheControl([]CacheControlRule{{Pattern: pattern}}); err == nil {
+			t.Errorf("no error with the invalid pattern %q", pattern)
+		}
+	}
+}
+
+func TestCacheRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faygo_cache_rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"index.html", "fonts/a.woff2", "img/x/logo.png", "app.js"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+	}
+	frame := newTestFrame(t, "cache_rules_test")
+	fontHeader := http.Header{"Access-Control-Allow-Origin": {"*"}}
+	frame.Static("/static", dir, true, true).CacheRules(
+		"*.html: no-cache",
+		"*.woff2: max-age=31536000, immutable",
+		"img/**: max-age=86400",
+	).Use(StaticCacheControl(CacheControlRule{
+		Pattern: "fonts/**",
+		Header:  fontHeader,
+	}), HandlerFunc(func(ctx *Context) error {
+		// narrows the origin in place
+		if v := ctx.W.Header()["Access-Control-Allow-Origin"]; len(v) > 0 && ctx.HeaderParam("Origin") != "" {
+			v[0] = ctx.HeaderParam("Origin")
+		}
+		return nil
+	}))
+	sum := sha256.Sum256([]byte("app.js"))
+	hash := hex.EncodeToString(sum[:])[:assetHashHexLength]
+	cases := []struct{ path, cacheControl, allowOrigin string }{
+		{"/static/index.html", "no-cache", ""},
+		{"/static/fonts/a.woff2", "max-age=31536000, immutable", "*"},
+		{"/static/img/x/logo.png", "max-age=86400", ""},
+		{"/static/app.js", revalidateCacheControl, ""},
+		{"/static/app.js?" + AssetHashKey + "=" + hash, immutableCacheControl, ""},
+		// the old or invalid hash never makes the current content immutable
+		{"/static/app.js?" + AssetHashKey + "=0123456789ab", revalidateCacheControl, ""},
+	}
+	for _, c := range cases {
+		w := serveTest(frame, httptest.NewRequest("GET", c.path, nil))
+		if w.Code != 200 || w.Header().Get(HeaderCacheControl) != c.cacheControl ||
+			w.Header().Get("Access-Control-Allow-Origin") != c.allowOrigin {
+			t.Errorf("%s: got %d %q %q", c.path, w.Code, w.Header().Get(HeaderCacheControl), w.Header().Get("Access-Control-Allow-Origin"))
+		}
+	}
+	req := httptest.NewRequest("GET", "/static/fonts/a.woff2", nil)
+	req.Header.Set("Origin", "https://example.com")
+	if w := serveTest(frame, req); w.Header().Get("Access-Control-Allow-Origin") != "https://example.com" {
+		t.Fatalf("narrowed origin: got %q", w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if v := fontHeader.Get("Access-Control-Allow-Origin"); v != "*" {
+		t.Fatalf("the header of the rule is changed: %q", v)
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"fmt"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/faygo/apiware"
+)
+
+// AuditRedacted replaces the values of the fields tagged with `audit:"redact"` in the audit entries.
+const AuditRedacted = "[REDACTED]"
+
+type (
+	// AuditEntry is the record of a request written by the audit middleware.
+	AuditEntry struct {
+		Time      time.Time `json:"time"`
+		User      string    `json:"user,omitempty"`
+		Method    string    `json:"method"`
+		Route     string    `json:"route"`
+		Path      string    `json:"path"`
+		IP        string    `json:"ip"`
+		RequestID string    `json:"request_id,omitempty"`
+		// The params bound by the APIHandler by name, nil for the other handlers or if the binding fails.
+		// The fields tagged with `audit:"redact"` are replaced with AuditRedacted,
+		// and the ones tagged with `audit:"-"` are omitted, including the fields of the body structs.
+		Params  map[string]interface{} `json:"params,omitempty"`
+		Status  int                    `json:"status"`
+		Size    int64                  `json:"size"`
+		Latency time.Duration          `json:"latency"`
+	}
+	// AuditSink writes the audit entries, such as to a file, a database or a message queue.
+	// It is called by the requests concurrently.
+	AuditSink interface {
+		WriteAudit(entry *AuditEntry) error
+	}
+	// AuditSinkFunc is an adapter to allow the use of ordinary functions as AuditSink.
+	AuditSinkFunc func(entry *AuditEntry) error
+	// AuditConfig is the config of the audit middleware created by NewAudit.
+	AuditConfig struct {
+		// Returns the user of the request, such as the JWT subject, optional.
+		User PrincipalFunc
+		// Writes the entries, the JSON lines file `audit.log` in the global log folder by default.
+		Sink AuditSink
+	}
+	// audit is the audit middleware state.
+	audit struct {
+		AuditConfig
+	}
+)
+
+// WriteAudit implements AuditSink.
+func (f AuditSinkFunc) WriteAudit(entry *AuditEntry) error {
+	return f(entry)
+}
+
+// NewAudit creates the middleware writing an AuditEntry of each request to the sink,
+// with the user, the route, the bound params, the status and the size of the response.
+// It must be registered as the route or group middleware before the APIHandler,
+// so that the entry has the route and the params.
+// The entry is also written if the handler panics, with the status 500.
+//
+//	e.g. audit := faygo.NewAudit(faygo.AuditConfig{
+//		User: func(ctx *faygo.Context) string { return ctx.HeaderParam("X-User") },
+//	})
+//	frame.POST("/transfers", audit, new(transferAPI))
+func NewAudit(conf AuditConfig) HandlerFunc {
+	if conf.Sink == nil {
+		sink, err := NewFileAuditSink(LogDir() + "audit.log")
+		if err != nil {
+			Fatalf("Audit: %v", err)
+		}
+		conf.Sink = sink
+	}
+	return (&audit{conf}).serve
+}
+
+func (a *audit) serve(ctx *Context) error {
+	defer func() {
+		p := recover()
+		a.write(ctx, p != nil)
+		if p != nil {
+			panic(p)
+		}
+	}()
+	ctx.Next()
+	return nil
+}
+
+func (a *audit) write(ctx *Context, panicked bool) {
+	entry := &AuditEntry{
+		Time:      ctx.start,
+		Method:    ctx.Method(),
+		Route:     ctx.routePattern,
+		Path:      ctx.Path(),
+		IP:        ctx.RealIP(),
+		RequestID: ctx.HeaderParam(HeaderXRequestID),
+		Status:    ctx.Status(),
+		Size:      ctx.Size(),
+		Latency:   time.Since(ctx.start),
+	}
+	if panicked {
+		entry.Status = 500
+	}
+	if a.User != nil {
+		entry.User = a.User(ctx)
+	}
+	if ctx.bound != nil {
+		entry.Params = auditParams(ctx.boundAPI, ctx.bound)
+	}
+	if err := a.Sink.WriteAudit(entry); err != nil {
+		ctx.Log().Errorf("Audit: %v", err)
+	}
+}
+
+// auditParams returns the bound params by name, with the tagged fields redacted or omitted.
+func auditParams(paramsAPI *apiware.ParamsAPI, structPointer interface{}) map[string]interface{} {
+	params := make(map[string]interface{}, paramsAPI.Number())
+	for _, param := range paramsAPI.Params() {
+		switch param.StructTag().Get("audit") {
+		case "-":
+		case "redact":
+			params[param.Name()] = AuditRedacted
+		default:
+			params[param.Name()] = auditValue(param.FieldValue(structPointer), 0)
+		}
+	}
+	return params
+}
+
+// auditMaxDepth limits the nesting of the audited values, which avoids the cyclic pointers.
+const auditMaxDepth = 16
+
+var (
+	uploadedFileType = reflect.TypeOf(apiware.UploadedFile{})
+	fileHeaderType   = reflect.TypeOf(multipart.FileHeader{})
+	timeType         = reflect.TypeOf(time.Time{})
+)
+
+// auditValue converts the value to the JSON value of the audit entry,
+// the struct fields tagged with `audit:"redact"` are replaced with AuditRedacted,
+// the ones tagged with `audit:"-"` are omitted, and the uploaded files are summarized.
+func auditValue(v reflect.Value, depth int) interface{} {
+	if depth > auditMaxDepth {
+		return "..."
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Type() {
+	case uploadedFileType:
+		f := v.Interface().(apiware.UploadedFile)
+		return map[string]interface{}{"filename": f.Filename, "size": f.Size, "content_type": f.ContentType}
+	case fileHeaderType:
+		fh := v.Interface().(multipart.FileHeader)
+		return map[string]interface{}{"filename": fh.Filename, "size": fh.Size}
+	case timeType:
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		m := make(map[string]interface{}, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := field.Name
+			if tag := field.Tag.Get("json"); tag != "" {
+				if tag = strings.Split(tag, ",")[0]; tag == "-" {
+					continue
+				} else if tag != "" {
+					name = tag
+				}
+			}
+			switch field.Tag.Get("audit") {
+			case "-":
+			case "redact":
+				m[name] = AuditRedacted
+			default:
+				m[name] = auditValue(v.Field(i), depth+1)
+			}
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Kind() == reflect.Slice {
+				return string(v.Bytes())
+			}
+			return v.Interface()
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			s[i] = auditValue(v.Index(i), depth+1)
+		}
+		return s
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		m := make(map[string]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			m[fmt.Sprint(k.Interface())] = auditValue(v.MapIndex(k), depth+1)
+		}
+		return m
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return nil
+	}
+	return v.Interface()
+}
+
+// fileAuditSink writes the audit entries as the JSON lines to a file.
+type fileAuditSink struct {
+	file *os.File
+	lock sync.Mutex
+}
+
+// NewFileAuditSink creates the AuditSink appending the entries as the JSON lines to the file,
+// whose folder is created if not exist.
+// The returned sink implements io.Closer.
+func NewFileAuditSink(filename string) (AuditSink, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileAuditSink{file: file}, nil
+}
+
+// WriteAudit implements AuditSink.
+func (s *fileAuditSink) WriteAudit(entry *AuditEntry) error {
+	b, err := global.jsonCodec.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, err = s.file.Write(b)
+	return err
+}
+
+// Close closes the file.
+func (s *fileAuditSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.file.Close()
+}
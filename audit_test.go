@@ -0,0 +1,120 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type auditTransferAPI struct {
+	Account string `param:"<in:query> <required>"`
+	Token   string `param:"<in:header> <name:X-Token>" audit:"redact"`
+	Body    struct {
+		Amount   int    `json:"amount"`
+		Password string `json:"password" audit:"redact"`
+		Note     string `json:"note" audit:"-"`
+	} `param:"<in:body>"`
+}
+
+func (a *auditTransferAPI) Serve(ctx *Context) error {
+	return ctx.String(200, "ok")
+}
+
+func TestAudit(t *testing.T) {
+	var entries []*AuditEntry
+	audit := NewAudit(AuditConfig{
+		User: func(ctx *Context) string { return ctx.HeaderParam("X-User") },
+		Sink: AuditSinkFunc(func(entry *AuditEntry) error {
+			entries = append(entries, entry)
+			return nil
+		}),
+	})
+	frame := newTestFrame(t, "audit_test")
+	frame.POST("/transfers", audit, new(auditTransferAPI))
+	frame.GET("/panic", audit, HandlerFunc(func(ctx *Context) error {
+		panic("handler panic")
+	}))
+	newRequest := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/transfers"+query, strings.NewReader(`{"amount":100,"password":"secret","note":"for rent"}`))
+		req.Header.Set(HeaderContentType, MIMEApplicationJSON)
+		req.Header.Set("X-User", "alice")
+		req.Header.Set("X-Token", "t0ken")
+		return serveTest(frame, req)
+	}
+
+	if rec := newRequest("?account=42"); rec.Code != 200 {
+		t.Fatalf("status: got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(entries) != 1 {
+		t.Fatalf("entries: got %d", len(entries))
+	}
+	b, _ := json.Marshal(entries[0])
+	var entry struct {
+		User   string                 `json:"user"`
+		Route  string                 `json:"route"`
+		Status int                    `json:"status"`
+		Size   int64                  `json:"size"`
+		Params map[string]interface{} `json:"params"`
+	}
+	json.Unmarshal(b, &entry)
+	body, _ := entry.Params["body"].(map[string]interface{})
+	if entry.User != "alice" || entry.Route != "/transfers" || entry.Status != 200 || entry.Size != 2 ||
+		entry.Params["account"] != "42" || entry.Params["X-Token"] != AuditRedacted ||
+		body["amount"] != float64(100) || body["password"] != AuditRedacted || len(body) != 2 {
+		t.Fatalf("entry: got %s", b)
+	}
+	if strings.Contains(string(b), "secret") || strings.Contains(string(b), "t0ken") || strings.Contains(string(b), "for rent") {
+		t.Fatalf("the redacted values are written: %s", b)
+	}
+
+	// the failed binding and the panic are also audited
+	newRequest("")
+	serveTest(frame, httptest.NewRequest("GET", "/panic", nil))
+	if len(entries) != 3 || entries[1].Status != 400 || entries[1].Params != nil || entries[2].Status != 500 || entries[2].Route != "/panic" {
+		t.Fatalf("entries: got %+v %+v", entries[1], entries[2])
+	}
+}
+
+func TestFileAuditSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faygo_audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "log", "audit.log")
+	sink, err := NewFileAuditSink(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []string{"alice", "bob"} {
+		if err = sink.WriteAudit(&AuditEntry{User: user, Status: 200}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sink.(io.Closer).Close()
+	b, _ := ioutil.ReadFile(filename)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	var entry AuditEntry
+	if len(lines) != 2 || json.Unmarshal([]byte(lines[1]), &entry) != nil || entry.User != "bob" {
+		t.Fatalf("audit log: got %q", b)
+	}
+}
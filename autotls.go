@@ -0,0 +1,194 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// LetsEncryptStagingURL is the directory endpoint of the Let's Encrypt staging environment,
+// whose certificates are not trusted but whose rate limits are loose, for the tests and CI.
+const LetsEncryptStagingURL = "https://acme-staging-v02.api.letsencrypt.org/directory"
+
+// AutoTLSConfig is the config of the automatic Let's Encrypt certificates, see SetAutoTLS.
+type AutoTLSConfig struct {
+	// The host names the certificates are issued for, the others are refused.
+	Hosts []string
+	// The directory to persist the certificates and the account key in,
+	// ignored if Cache is set; no cache if both are empty.
+	CacheDir string
+	// Optional certificate cache, such as a shared one for multiple instances.
+	Cache autocert.Cache
+	// Optional contact email of the ACME account, for the expiration notices.
+	Email string
+	// Whether to use the Let's Encrypt staging environment.
+	Staging bool
+}
+
+// autoTLS manages the automatic certificates shared by the TLS listeners.
+type autoTLS struct {
+	*autocert.Manager
+	mu     sync.Mutex
+	orders int           // the in-progress certificate lookups, ACME requests and certificate writes
+	idle   chan struct{} // closed when orders falls to zero
+}
+
+// EnableAutoTLS obtains and renews the certificates of the given hosts from Let's Encrypt automatically,
+// persisting them in cacheDir, see SetAutoTLS.
+func (frame *Framework) EnableAutoTLS(hosts []string, cacheDir string) error {
+	return frame.SetAutoTLS(AutoTLSConfig{Hosts: hosts, CacheDir: cacheDir})
+}
+
+// SetAutoTLS obtains and renews the certificates from Let's Encrypt automatically.
+// The letsencrypt listeners and the https ones without certificate files use the certificates,
+// and the plain HTTP listeners, such as :80, serve the ACME HTTP-01 challenges.
+// The certificates are renewed in the background before expiring, without restart,
+// and Shutdown waits for the in-progress orders within the shutdown timeout,
+// including the requests to the CA and the certificate writes of the background renewals.
+// It returns ErrFrameRunning if the frame is running.
+func (frame *Framework) SetAutoTLS(conf AutoTLSConfig) error {
+	if len(conf.Hosts) == 0 {
+		return errors.New("auto TLS requires at least one host")
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(conf.Hosts...),
+		Cache:      conf.Cache,
+		Email:      conf.Email,
+	}
+	if m.Cache == nil && conf.CacheDir != "" {
+		m.Cache = autocert.DirCache(conf.CacheDir)
+	}
+	a := &autoTLS{Manager: m}
+	// the renewals run in the background of autocert, so they are tracked by their ACME requests
+	// and certificate writes
+	if m.Cache != nil {
+		m.Cache = trackedCache{Cache: m.Cache, a: a}
+	}
+	m.Client = &acme.Client{
+		DirectoryURL: autocert.DefaultACMEDirectory,
+		HTTPClient:   &http.Client{Transport: trackedTransport{a}},
+	}
+	if conf.Staging {
+		m.Client.DirectoryURL = LetsEncryptStagingURL
+	}
+	frame.lock.Lock()
+	defer frame.lock.Unlock()
+	if frame.running {
+		return ErrFrameRunning
+	}
+	frame.autoTLS = a
+	return nil
+}
+
+// track counts an in-progress operation, the returned function ends it.
+func (a *autoTLS) track() func() {
+	a.mu.Lock()
+	a.orders++
+	a.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			a.mu.Lock()
+			a.orders--
+			if a.orders == 0 && a.idle != nil {
+				close(a.idle)
+				a.idle = nil
+			}
+			a.mu.Unlock()
+		})
+	}
+}
+
+// getCertificate returns the certificate of the TLS handshake, counting the in-progress orders.
+func (a *autoTLS) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	defer a.track()()
+	return a.Manager.GetCertificate(hello)
+}
+
+// trackedTransport counts the requests to the CA until their responses are closed.
+type trackedTransport struct {
+	a *autoTLS
+}
+
+func (t trackedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	done := t.a.track()
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		done()
+		return nil, err
+	}
+	resp.Body = &trackedBody{ReadCloser: resp.Body, done: done}
+	return resp, nil
+}
+
+type trackedBody struct {
+	io.ReadCloser
+	done func()
+}
+
+func (b *trackedBody) Close() error {
+	defer b.done()
+	return b.ReadCloser.Close()
+}
+
+// trackedCache counts the certificate writes.
+type trackedCache struct {
+	autocert.Cache
+	a *autoTLS
+}
+
+func (c trackedCache) Put(ctx context.Context, key string, data []byte) error {
+	defer c.a.track()()
+	return c.Cache.Put(ctx, key, data)
+}
+
+// wait waits for the in-progress orders, returns false if the context is done first.
+func (a *autoTLS) wait(ctx context.Context) bool {
+	a.mu.Lock()
+	if a.orders == 0 {
+		a.mu.Unlock()
+		return true
+	}
+	if a.idle == nil {
+		a.idle = make(chan struct{})
+	}
+	idle := a.idle
+	a.mu.Unlock()
+	select {
+	case <-idle:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// withACMEProto adds the protocol of the ACME TLS-ALPN challenges to the TLS config.
+func withACMEProto(tlsConfig *tls.Config) {
+	for _, proto := range tlsConfig.NextProtos {
+		if proto == acme.ALPNProto {
+			return
+		}
+	}
+	tlsConfig.NextProtos = append(tlsConfig.NextProtos, acme.ALPNProto)
+}
@@ -0,0 +1,190 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// memCache is an in-memory autocert.Cache.
+type memCache struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (c *memCache) Get(_ context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if b, ok := c.data[key]; ok {
+		return b, nil
+	}
+	return nil, autocert.ErrCacheMiss
+}
+
+func (c *memCache) Put(_ context.Context, key string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = data
+	return nil
+}
+
+func (c *memCache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.data, key)
+	return nil
+}
+
+func TestAutoTLS(t *testing.T) {
+	frame := newTestFrame(t, "auto_tls_test")
+	if err := frame.EnableAutoTLS(nil, ""); err == nil {
+		t.Fatal("no error without hosts")
+	}
+
+	// the certificate issued before, which is served from the cache without the ACME order
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}, &x509.Certificate{SerialNumber: big.NewInt(1)}, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	cache := &memCache{data: map[string][]byte{
+		"example.com": append(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...),
+		"token+http-01": []byte("token.thumbprint"),
+	}}
+	if err := frame.SetAutoTLS(AutoTLSConfig{
+		Hosts:   []string{"example.com"},
+		Cache:   cache,
+		Staging: true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if url := frame.autoTLS.Client.DirectoryURL; url != LetsEncryptStagingURL {
+		t.Fatalf("directory: got %q, want the staging one", url)
+	}
+	for host, allowed := range map[string]bool{"example.com": true, "evil.com": false} {
+		if err := frame.autoTLS.HostPolicy(context.Background(), host); (err == nil) != allowed {
+			t.Fatalf("host policy of %s: got %v", host, err)
+		}
+	}
+
+	httpAddr, httpsAddr := freeAddr(t), freeAddr(t)
+	frame.config.Addrs = []string{httpAddr}
+	frame.AddListener(Listener{NetType: NETTYPE_HTTPS, Addr: httpsAddr})
+	frame.GET("/", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, "home")
+	}))
+	if err := frame.run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := frame.EnableAutoTLS([]string{"example.com"}, ""); err != ErrFrameRunning {
+		t.Fatalf("got %v, want ErrFrameRunning", err)
+	}
+
+	conn, err := tls.Dial("tcp", httpsAddr, &tls.Config{ServerName: "example.com", InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peer := conn.ConnectionState().PeerCertificates[0]; !bytes.Equal(peer.Raw, der) {
+		t.Fatal("the cached certificate is not served")
+	}
+	conn.Close()
+	if conn, err := tls.Dial("tcp", httpsAddr, &tls.Config{ServerName: "evil.com", InsecureSkipVerify: true}); err == nil {
+		conn.Close()
+		t.Fatal("the certificate is issued for a host not allowed")
+	}
+
+	for _, c := range []struct {
+		host, path string
+		code       int
+		body       string
+	}{
+		{"example.com", "/.well-known/acme-challenge/token", 200, "token.thumbprint"},
+		{"evil.com", "/.well-known/acme-challenge/token", 403, ""},
+		{"example.com", "/", 200, "home"},
+	} {
+		req, _ := http.NewRequest("GET", "http://"+httpAddr+c.path, nil)
+		req.Host = c.host
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != c.code || c.body != "" && string(b) != c.body {
+			t.Fatalf("%s%s: got %d %q", c.host, c.path, resp.StatusCode, b)
+		}
+	}
+	http.DefaultClient.CloseIdleConnections()
+
+	// the requests to the CA, such as the ones of the background renewals, are in progress
+	// until their responses are closed
+	entered, release := make(chan struct{}), make(chan struct{})
+	ca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	}))
+	defer ca.Close()
+	go func() {
+		if resp, err := frame.autoTLS.Client.HTTPClient.Get(ca.URL); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-entered
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if frame.autoTLS.wait(ctx) {
+		t.Fatal("the in-progress request to the CA is not waited for")
+	}
+	close(release)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !frame.autoTLS.wait(ctx) {
+		t.Fatal("the request to the CA is not ended")
+	}
+
+	// Shutdown waits for the in-progress orders
+	done := frame.autoTLS.track()
+	defer done()
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if frame.shutdown(ctx) {
+		t.Fatal("shutdown does not wait for the in-progress order")
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBackgroundTimeout is the default time-out period for the background tasks
+// after the services are closed.
+const DefaultBackgroundTimeout = 5 * time.Second
+
+// taskGroup tracks the running background tasks.
+type taskGroup struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running int32
+}
+
+func newTaskGroup() *taskGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &taskGroup{ctx: ctx, cancel: cancel}
+}
+
+// SetBackgroundTimeout sets the time-out period for the background tasks,
+// which is waited for after the services are closed, separately from the shutdown timeout.
+// If timeout<0, indefinite period.
+func SetBackgroundTimeout(timeout time.Duration) {
+	if timeout < 0 {
+		global.backgroundTimeout = 1<<63 - 1
+	} else {
+		global.backgroundTimeout = timeout
+	}
+}
+
+// Go runs the function in a new goroutine which is tracked by the shutdown lifecycle.
+// The context is canceled after the services are closed, then the function has
+// the background timeout to return before it is abandoned.
+// The panic of the function is recovered and logged.
+func Go(fn func(ctx context.Context)) {
+	global.backgroundLock.RLock()
+	g := global.background
+	g.wg.Add(1)
+	global.backgroundLock.RUnlock()
+	atomic.AddInt32(&g.running, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				Errorf("[background] panic: %v\n%s", p, debug.Stack())
+			}
+			atomic.AddInt32(&g.running, -1)
+			g.wg.Done()
+		}()
+		fn(g.ctx)
+	}()
+}
+
+// Defer runs the function as a background task by Go after the request is done,
+// it is detached from the request, so do not use the Context in the function.
+func (ctx *Context) Defer(fn func(ctx context.Context)) {
+	ctx.deferred = append(ctx.deferred, fn)
+}
+
+// waitBackground cancels the running background tasks and waits for them
+// for the background timeout within ctx, returns false if some tasks are abandoned.
+func waitBackground(ctx context.Context, action string) bool {
+	global.backgroundLock.Lock()
+	g := global.background
+	global.background = newTaskGroup()
+	global.backgroundLock.Unlock()
+
+	g.cancel()
+	ctxTimeout, cancel := context.WithTimeout(ctx, global.backgroundTimeout)
+	defer cancel()
+	if waitGroupContext(ctxTimeout, &g.wg) {
+		return true
+	}
+	Errorf("[%s-background] %d background tasks are abandoned after %s", action, atomic.LoadInt32(&g.running), global.backgroundTimeout)
+	return false
+}
@@ -0,0 +1,53 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackgroundTask(t *testing.T) {
+	frame := newTestFrame(t, "background_task_test")
+	started := make(chan struct{})
+	var completed int32
+	frame.GET("/task", HandlerFunc(func(ctx *Context) error {
+		ctx.Defer(func(taskCtx context.Context) {
+			close(started)
+			<-taskCtx.Done()
+			time.Sleep(10 * time.Millisecond)
+			atomic.StoreInt32(&completed, 1)
+		})
+		return ctx.String(200, "accepted")
+	}))
+	rec := serveTest(frame, httptest.NewRequest("GET", "/task", nil))
+	if rec.Code != 200 || rec.Body.String() != "accepted" {
+		t.Fatalf("got %d %q", rec.Code, rec.Body.String())
+	}
+	<-started
+	if atomic.LoadInt32(&completed) == 1 {
+		t.Fatal("the task should outlive the request")
+	}
+	Go(func(context.Context) { panic("task panic") })
+	if !waitBackground(context.Background(), "test") {
+		t.Fatal("the background tasks should complete within the timeout")
+	}
+	if atomic.LoadInt32(&completed) != 1 {
+		t.Fatal("the task should complete during shutdown")
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// BodyStreamer is implemented by the API handler struct which consumes the JSON request body
+// as a stream, such as a bulk import of a large JSON array, instead of binding it in memory.
+// StreamBody is called after the other params, such as the query and path params, are bound,
+// and before Serve. Each call of decode decodes the next element of the array,
+// or the next value of the body if it is not an array (such as NDJSON),
+// and returns io.EOF after the last one.
+// The config item `max_request_body_mb` limits the whole body.
+// Note: the struct can not have the `in(body)` param.
+type BodyStreamer interface {
+	StreamBody(ctx *Context, decode func(v interface{}) error) error
+}
+
+// ErrBodyStreamerWithBody is returned when the BodyStreamer has the `in(body)` param.
+var ErrBodyStreamerWithBody = errors.New("BodyStreamer handler can not have the `in(body)` param")
+
+// newStreamDecode returns the decode function of BodyStreamer reading from r.
+func newStreamDecode(r io.Reader) func(v interface{}) error {
+	br := bufio.NewReader(r)
+	var (
+		dec     *json.Decoder
+		inArray bool
+		err     error
+	)
+	return func(v interface{}) error {
+		if err != nil {
+			return err
+		}
+		if dec == nil {
+			if inArray, err = peekArray(br); err != nil {
+				return err
+			}
+			dec = json.NewDecoder(br)
+			// consumes '[', then Decode skips the commas between the elements
+			if inArray {
+				if _, err = dec.Token(); err != nil {
+					return err
+				}
+			}
+		}
+		if !inArray {
+			// decodes the values in sequence
+			err = dec.Decode(v)
+			return err
+		}
+		if !dec.More() {
+			// consumes ']'
+			if _, err = dec.Token(); err == nil {
+				err = io.EOF
+			}
+			return err
+		}
+		err = dec.Decode(v)
+		return err
+	}
+}
+
+// peekArray reports whether the next non-space byte is '[', without consuming it.
+func peekArray(br *bufio.Reader) (bool, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return false, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b == '[', br.UnreadByte()
+	}
+}
+
+// streamBodyError responds to the error of StreamBody, which is 413 if the body is too large,
+// or 400 if the body is malformed, otherwise returns it.
+func streamBodyError(ctx *Context, err error) error {
+	var (
+		tooLarge  *http.MaxBytesError
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &tooLarge):
+		ctx.Error(http.StatusRequestEntityTooLarge, err.Error())
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.Is(err, io.ErrUnexpectedEOF):
+		ctx.Error(http.StatusBadRequest, err.Error())
+	default:
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"path"
+)
+
+// BodyTeeConfig is the config of the request body tee middleware created by NewBodyTee.
+type BodyTeeConfig struct {
+	// The maximum bytes of the body kept for ctx.RawBody(), 4KB by default.
+	MaxBytes int
+	// The path patterns not teed, such as the login or the payment routes,
+	// in the syntax of path.Match.
+	ExcludePaths []string
+}
+
+// defaultBodyTeeMaxBytes is the default maximum bytes kept by the body tee.
+const defaultBodyTeeMaxBytes = 4 << 10
+
+// NewBodyTee creates the middleware which tees the request body to a bounded buffer,
+// so that the raw body is available by ctx.RawBody() for logging or debugging,
+// while the binder and the handler still read the whole body.
+// Only the first MaxBytes of the body are kept, the rest is streamed as is,
+// so it does not buffer the large uploads.
+func NewBodyTee(conf BodyTeeConfig) HandlerFunc {
+	if conf.MaxBytes <= 0 {
+		conf.MaxBytes = defaultBodyTeeMaxBytes
+	}
+	for _, pattern := range conf.ExcludePaths {
+		if _, err := path.Match(pattern, "/"); err != nil {
+			Fatalf("NewBodyTee: invalid exclude path %q: %v", pattern, err)
+		}
+	}
+	return func(ctx *Context) error {
+		if ctx.R.Body == nil || ctx.R.Body == http.NoBody || ctx.tee != nil {
+			return nil
+		}
+		p := ctx.Path()
+		for _, pattern := range conf.ExcludePaths {
+			if ok, _ := path.Match(pattern, p); ok {
+				return nil
+			}
+		}
+		ctx.tee = &bodyTee{ReadCloser: ctx.R.Body, max: conf.MaxBytes}
+		ctx.R.Body = ctx.tee
+		return nil
+	}
+}
+
+// RawBody returns the first bytes of the raw request body kept by the middleware of NewBodyTee,
+// and whether the body is longer than them.
+// The unread part of the kept bytes is still read by the binder and the handler.
+// It returns nil if the middleware is not used for the request.
+func (ctx *Context) RawBody() (body []byte, truncated bool) {
+	if ctx.tee == nil {
+		return nil, false
+	}
+	ctx.tee.fill()
+	return ctx.tee.buf.Bytes(), ctx.tee.truncated
+}
+
+// bodyTee is the request body copying the first max bytes to buf.
+type bodyTee struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	max       int
+	pending   []byte // the bytes read by fill but not yet by the reader
+	err       error  // the error of the body returned by fill
+	truncated bool
+}
+
+func (t *bodyTee) Read(p []byte) (int, error) {
+	if len(t.pending) > 0 {
+		n := copy(p, t.pending)
+		t.pending = t.pending[n:]
+		return n, nil
+	}
+	if t.err != nil {
+		return 0, t.err
+	}
+	n, err := t.ReadCloser.Read(p)
+	t.keep(p[:n])
+	return n, err
+}
+
+// keep copies b to buf until it is full.
+func (t *bodyTee) keep(b []byte) {
+	if room := t.max - t.buf.Len(); len(b) > room {
+		b = b[:room]
+		t.truncated = true
+	}
+	t.buf.Write(b)
+}
+
+// fill reads the body until buf is full, keeping the bytes for the reader.
+func (t *bodyTee) fill() {
+	for t.err == nil && t.buf.Len() < t.max {
+		b := make([]byte, t.max-t.buf.Len())
+		n, err := t.ReadCloser.Read(b)
+		t.keep(b[:n])
+		t.pending = append(t.pending, b[:n]...)
+		t.err = err
+	}
+	if t.err == nil && !t.truncated {
+		// peek one byte to know whether the body is longer
+		var b [1]byte
+		n, err := t.ReadCloser.Read(b[:])
+		t.truncated = n > 0
+		t.pending = append(t.pending, b[:n]...)
+		t.err = err
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type bodyTeeHandler struct {
+	Body map[string]interface{} `param:"<in:body>"`
+}
+
+func (h *bodyTeeHandler) Serve(ctx *Context) error {
+	raw, truncated := ctx.RawBody()
+	return ctx.String(200, h.Body["name"].(string)+"|"+string(raw)+"|"+strconv.FormatBool(truncated))
+}
+
+func TestBodyTee(t *testing.T) {
+	frame := newTestFrame(t, "body_tee_test")
+	frame.Use(NewBodyTee(BodyTeeConfig{MaxBytes: 16, ExcludePaths: []string{"/login"}}))
+	frame.POST("/bind", new(bodyTeeHandler))
+	// RawBody before binding does not consume the body
+	frame.POST("/peek", HandlerFunc(func(ctx *Context) error {
+		ctx.RawBody()
+		return nil
+	}), new(bodyTeeHandler))
+	frame.POST("/login", HandlerFunc(func(ctx *Context) error {
+		raw, _ := ctx.RawBody()
+		return ctx.String(200, strconv.FormatBool(raw == nil))
+	}))
+	var size int64
+	frame.POST("/upload", HandlerFunc(func(ctx *Context) error {
+		size, _ = io.Copy(ioutil.Discard, ctx.R.Body)
+		raw, truncated := ctx.RawBody()
+		return ctx.String(200, strconv.Itoa(len(raw))+"|"+strconv.FormatBool(truncated))
+	}))
+
+	for _, c := range []struct{ path, body, want string }{
+		{"/bind", `{"name":"a"}`, `a|{"name":"a"}|false`},
+		{"/peek", `{"name":"a"}`, `a|{"name":"a"}|false`},
+		{"/bind", `{"name":"abcdefgh"}`, `abcdefgh|{"name":"abcdefg|true`},
+		{"/peek", `{"name":"abcdefgh"}`, `abcdefgh|{"name":"abcdefg|true`},
+		{"/peek", `{"name":"abcde"}`, `abcde|{"name":"abcde"}|false`},
+		{"/login", `{"password":"secret"}`, "true"},
+	} {
+		req := httptest.NewRequest("POST", c.path, strings.NewReader(c.body))
+		req.Header.Set(HeaderContentType, MIMEApplicationJSONCharsetUTF8)
+		rec := serveTest(frame, req)
+		if got := rec.Body.String(); got != c.want {
+			t.Fatalf("%s %s: got %q, want %q", c.path, c.body, got, c.want)
+		}
+	}
+
+	body := bytes.Repeat([]byte("x"), 1<<20)
+	rec := serveTest(frame, httptest.NewRequest("POST", "/upload", bytes.NewReader(body)))
+	if got := rec.Body.String(); got != "16|true" || size != int64(len(body)) {
+		t.Fatalf("upload: got %q, read %d bytes", got, size)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// SetBucketKeyFunc sets the function returning the stable client key, such as the user ID
+// or a device cookie, which is hashed by Context.Bucket and Context.Variant.
+// If fn is nil, the default key, the client IP and the User-Agent, is used.
+func SetBucketKeyFunc(fn func(ctx *Context) string) {
+	if fn == nil {
+		global.bucketKeyFunc = defaultBucketKey
+	} else {
+		global.bucketKeyFunc = fn
+	}
+}
+
+func defaultBucketKey(ctx *Context) string {
+	return ctx.RealIP() + "\x00" + ctx.HeaderParam(HeaderUserAgent)
+}
+
+// Bucket returns the bucket of the client in the experiment, from 0 to buckets-1,
+// by the consistent hash of the client key and the experiment name, so that the client
+// stays in the same bucket without the session, across the restarts and the instances.
+// The chosen bucket is added to the access log as `variants=experiment:bucket`.
+// The buckets less than 1 are treated as 1.
+func (ctx *Context) Bucket(experiment string, buckets int) int {
+	if buckets < 1 {
+		buckets = 1
+	}
+	b := int(bucketHash(global.bucketKeyFunc(ctx), experiment) % uint64(buckets))
+	ctx.addVariant(experiment, b)
+	return b
+}
+
+// Variant returns the index of the weights that the client is split into in the experiment,
+// in proportion to the weights, e.g. the weights []int{90, 10} return 1 for 10% of the clients.
+// Like Bucket, it is stable for the client and added to the access log.
+// The negative weights are treated as 0, and it returns 0 if the sum of the weights is 0.
+func (ctx *Context) Variant(experiment string, weights []int) int {
+	var total uint64
+	for _, w := range weights {
+		if w > 0 {
+			total += uint64(w)
+		}
+	}
+	var v int
+	if total > 0 {
+		point := bucketHash(global.bucketKeyFunc(ctx), experiment) % total
+		for i, w := range weights {
+			if w <= 0 {
+				continue
+			}
+			if point < uint64(w) {
+				v = i
+				break
+			}
+			point -= uint64(w)
+		}
+	}
+	ctx.addVariant(experiment, v)
+	return v
+}
+
+// bucketHash returns the FNV-1a hash of the experiment and the key,
+// which is fixed across the processes, unlike the seeded hash of map.
+func bucketHash(key, experiment string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(experiment))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// addVariant records the chosen variant of the experiment for the access log.
+func (ctx *Context) addVariant(experiment string, v int) {
+	field := experiment + ":" + strconv.Itoa(v)
+	for _, f := range ctx.variants {
+		if f == field {
+			return
+		}
+	}
+	ctx.variants = append(ctx.variants, field)
+}
+
+// variantsLog returns the access log field of the chosen variants, empty if none.
+func (ctx *Context) variantsLog() string {
+	if len(ctx.variants) == 0 {
+		return ""
+	}
+	return " | variants=" + strings.Join(ctx.variants, ",")
+}
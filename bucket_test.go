@@ -0,0 +1,75 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBucket(t *testing.T) {
+	frame := newTestFrame(t, "bucket_test")
+	var got string
+	frame.GET("/", HandlerFunc(func(ctx *Context) error {
+		got = fmt.Sprint(
+			ctx.Bucket("checkout", 2),
+			ctx.Bucket("checkout", 10),
+			ctx.Bucket("checkout", 100),
+			ctx.Variant("checkout", []int{90, 10}),
+			ctx.Variant("checkout", []int{50, 30, 20}),
+			ctx.Bucket("checkout", 0),
+			ctx.Variant("checkout", nil),
+		) + ctx.variantsLog()
+		return nil
+	}))
+	get := func(user, ua string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set(HeaderUserAgent, ua)
+		req.Header.Set("X-User", user)
+		serveTest(frame, req)
+		return got
+	}
+
+	// the expected buckets are pinned, so they must not change across the versions
+	if s := get("", "curl/8.0"); s != "0 8 98 1 2 0 0 | variants=checkout:0,checkout:8,checkout:98,checkout:1,checkout:2" {
+		t.Fatalf("default key: got %q", s)
+	}
+	SetBucketKeyFunc(func(ctx *Context) string { return ctx.HeaderParam("X-User") })
+	defer SetBucketKeyFunc(nil)
+	for user, want := range map[string]string{
+		"user-1": "0 6 86 0 2 0 0",
+		"user-2": "1 5 75 0 1 0 0",
+		"user-3": "0 4 64 0 1 0 0",
+	} {
+		for i := 0; i < 2; i++ {
+			if s := get(user, fmt.Sprint("ua-", i)); s[:len(want)] != want {
+				t.Fatalf("%s: got %q, want %q", user, s, want)
+			}
+		}
+	}
+
+	// the split follows the weights
+	var hits [2]int
+	for i := 0; i < 2000; i++ {
+		var b2, b10, b100, v int
+		fmt.Sscan(get(fmt.Sprint("user-", i), ""), &b2, &b10, &b100, &v)
+		hits[v]++
+	}
+	if hits[1] < 150 || hits[1] > 250 {
+		t.Fatalf("weights 90:10: got %v", hits)
+	}
+}
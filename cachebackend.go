@@ -0,0 +1,281 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/faygo/freecache"
+)
+
+// CacheEntry is a cached file variant.
+// The plain content and the compressed content of a file are cached as different entries.
+// An entry got from the backend is shared and must not be modified.
+type CacheEntry struct {
+	Name     string    // base name of the file
+	Size     int64     // size of the original file
+	ModTime  time.Time // modification time of the original file
+	Encoding string    // encoding of the content, such as gzip, empty means not compressed
+	ETag     string    // entity tag of the original file
+	Content  []byte
+}
+
+// CacheBackend is the storage of the file cache,
+// it may be shared across processes, such as memcached.
+// A backend can also implement `EvictionCount() int64` and `ExpiredCount() int64`
+// to report them in the file cache statistics.
+type CacheBackend interface {
+	// Get returns the unexpired entry.
+	Get(key string) (*CacheEntry, bool)
+	// Set stores the entry, ttl <= 0 means no expire, but it can be evicted when the cache is full.
+	Set(key string, entry *CacheEntry, ttl time.Duration) error
+	// Del removes the entry and reports whether it was present.
+	Del(key string) bool
+	// Clear removes all entries.
+	Clear()
+	// Len returns the number of the entries.
+	Len() int64
+	// Bytes returns the bytes occupied by the entries.
+	Bytes() int64
+}
+
+type cacheBackendCounter interface {
+	EvictionCount() int64
+	ExpiredCount() int64
+}
+
+// ErrCacheEntryTooLarge is returned when the entry is larger than the cache backend allows.
+var ErrCacheEntryTooLarge = errors.New("cache entry is too large")
+
+// MarshalBinary encodes the entry, it can be used by the backends storing bytes.
+func (e *CacheEntry) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, len(e.Name)+len(e.Encoding)+len(e.ETag)+len(e.Content)+4*binary.MaxVarintLen64)
+	for _, s := range [...]string{e.Name, e.Encoding, e.ETag} {
+		b = appendUvarint(b, uint64(len(s)))
+		b = append(b, s...)
+	}
+	b = appendUvarint(b, uint64(e.Size))
+	// the zero time is out of the range of UnixNano, 0 means the zero time
+	var modTime int64
+	if !e.ModTime.IsZero() {
+		modTime = e.ModTime.UnixNano()
+	}
+	b = appendUvarint(b, uint64(modTime))
+	return append(b, e.Content...), nil
+}
+
+// UnmarshalBinary decodes the entry encoded by MarshalBinary,
+// the content shares the memory with b.
+func (e *CacheEntry) UnmarshalBinary(b []byte) error {
+	errMalformed := errors.New("CacheEntry: malformed data")
+	var strs [3]string
+	for i := range strs {
+		n, k := binary.Uvarint(b)
+		if k <= 0 || uint64(len(b)-k) < n {
+			return errMalformed
+		}
+		strs[i] = string(b[k : k+int(n)])
+		b = b[k+int(n):]
+	}
+	size, k := binary.Uvarint(b)
+	if k <= 0 {
+		return errMalformed
+	}
+	b = b[k:]
+	modTime, k := binary.Uvarint(b)
+	if k <= 0 {
+		return errMalformed
+	}
+	e.Name, e.Encoding, e.ETag = strs[0], strs[1], strs[2]
+	e.Size = int64(size)
+	e.ModTime = time.Time{}
+	if modTime != 0 {
+		e.ModTime = time.Unix(0, int64(modTime))
+	}
+	e.Content = b[k:]
+	return nil
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+// memoryCacheBackend is the fixed-size ring buffer cache.
+type memoryCacheBackend struct {
+	cache *freecache.Cache
+}
+
+// NewMemoryCacheBackend creates the default cache backend, a fixed-size ring buffer in memory.
+// The size will be set to 512KB at minimum,
+// the evictionPolicy is lru (least recently used) or lfu (least frequently used).
+func NewMemoryCacheBackend(size int64, evictionPolicy string) CacheBackend {
+	policy := freecache.LRU
+	if evictionPolicy == "lfu" {
+		policy = freecache.LFU
+	}
+	return &memoryCacheBackend{cache: freecache.NewCacheWithPolicy(int(size), policy)}
+}
+
+func (m *memoryCacheBackend) Get(key string) (*CacheEntry, bool) {
+	b, err := m.cache.Get([]byte(key))
+	if err != nil {
+		return nil, false
+	}
+	entry := new(CacheEntry)
+	if entry.UnmarshalBinary(b) != nil {
+		return nil, false
+	}
+	return entry, true
+}
+
+func (m *memoryCacheBackend) Set(key string, entry *CacheEntry, ttl time.Duration) error {
+	b, _ := entry.MarshalBinary()
+	return m.cache.Set([]byte(key), b, int(ttl/time.Second))
+}
+
+func (m *memoryCacheBackend) Del(key string) bool  { return m.cache.Del([]byte(key)) }
+func (m *memoryCacheBackend) Clear()               { m.cache.Clear() }
+func (m *memoryCacheBackend) Len() int64           { return m.cache.EntryCount() }
+func (m *memoryCacheBackend) Bytes() int64         { return m.cache.Size() }
+func (m *memoryCacheBackend) EvictionCount() int64 { return m.cache.EvictionCount() }
+func (m *memoryCacheBackend) ExpiredCount() int64  { return m.cache.ExpiredCount() }
+
+// lruCacheBackend is the bounded LRU cache with per-entry expiry.
+type lruCacheBackend struct {
+	maxBytes    int64
+	bytes       int64
+	ll          *list.List
+	items       map[string]*list.Element
+	evictions   int64
+	expirations int64
+	lock        sync.Mutex
+}
+
+type lruItem struct {
+	key    string
+	entry  *CacheEntry
+	size   int64
+	expire time.Time
+}
+
+// lruItemOverhead is the estimated memory of an item besides its strings and content.
+const lruItemOverhead = 128
+
+// NewLRUCacheBackend creates an exact LRU cache backend in memory bounded by maxBytes,
+// the least recently used entries are evicted one by one when it is full,
+// and the expired entries are removed when they are accessed.
+func NewLRUCacheBackend(maxBytes int64) CacheBackend {
+	return &lruCacheBackend{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (l *lruCacheBackend) Get(key string) (*CacheEntry, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	e, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := e.Value.(*lruItem)
+	if !item.expire.IsZero() && time.Now().After(item.expire) {
+		l.remove(e)
+		l.expirations++
+		return nil, false
+	}
+	l.ll.MoveToFront(e)
+	return item.entry, true
+}
+
+func (l *lruCacheBackend) Set(key string, entry *CacheEntry, ttl time.Duration) error {
+	item := &lruItem{
+		key:   key,
+		entry: entry,
+		size:  int64(len(key)+len(entry.Name)+len(entry.Encoding)+len(entry.ETag)+len(entry.Content)) + lruItemOverhead,
+	}
+	if item.size > l.maxBytes {
+		return ErrCacheEntryTooLarge
+	}
+	if ttl > 0 {
+		item.expire = time.Now().Add(ttl)
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if e, ok := l.items[key]; ok {
+		l.remove(e)
+	}
+	for l.bytes+item.size > l.maxBytes {
+		l.remove(l.ll.Back())
+		l.evictions++
+	}
+	l.items[key] = l.ll.PushFront(item)
+	l.bytes += item.size
+	return nil
+}
+
+func (l *lruCacheBackend) remove(e *list.Element) {
+	item := l.ll.Remove(e).(*lruItem)
+	delete(l.items, item.key)
+	l.bytes -= item.size
+}
+
+func (l *lruCacheBackend) Del(key string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	e, ok := l.items[key]
+	if ok {
+		l.remove(e)
+	}
+	return ok
+}
+
+func (l *lruCacheBackend) Clear() {
+	l.lock.Lock()
+	l.ll.Init()
+	l.items = make(map[string]*list.Element)
+	l.bytes = 0
+	l.lock.Unlock()
+}
+
+func (l *lruCacheBackend) Len() int64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return int64(len(l.items))
+}
+
+func (l *lruCacheBackend) Bytes() int64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.bytes
+}
+
+func (l *lruCacheBackend) EvictionCount() int64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.evictions
+}
+
+func (l *lruCacheBackend) ExpiredCount() int64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.expirations
+}
@@ -0,0 +1,120 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheEntryBinary(t *testing.T) {
+	e := &CacheEntry{
+		Name:     "app.js",
+		Size:     10,
+		ModTime:  time.Unix(1500000000, 123),
+		Encoding: "gzip",
+		ETag:     `W/"1-a"`,
+		Content:  []byte("content"),
+	}
+	b, _ := e.MarshalBinary()
+	var got CacheEntry
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != e.Name || got.Size != e.Size || !got.ModTime.Equal(e.ModTime) ||
+		got.Encoding != e.Encoding || got.ETag != e.ETag || !bytes.Equal(got.Content, e.Content) {
+		t.Fatalf("got %+v, want %+v", got, e)
+	}
+	// the zero time is kept, and the time before 1970 too
+	for _, modTime := range []time.Time{{}, time.Date(1960, 1, 2, 3, 4, 5, 6, time.UTC)} {
+		e.ModTime = modTime
+		b, _ := e.MarshalBinary()
+		if err := got.UnmarshalBinary(b); err != nil || !got.ModTime.Equal(modTime) {
+			t.Fatalf("got %v %v, want %v", got.ModTime, err, modTime)
+		}
+	}
+	if err := got.UnmarshalBinary(b[:3]); err == nil {
+		t.Fatal("expected an error for the truncated data")
+	}
+}
+
+func TestLRUCacheBackend(t *testing.T) {
+	entry := func(n int) *CacheEntry { return &CacheEntry{Content: make([]byte, n)} }
+	l := NewLRUCacheBackend(3 * (100 + lruItemOverhead + 1))
+	for _, k := range []string{"a", "b", "c"} {
+		if err := l.Set(k, entry(100), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Get("a")
+	l.Set("d", entry(100), 0)
+	if _, ok := l.Get("b"); ok {
+		t.Fatal("the least recently used entry b should be evicted")
+	}
+	for _, k := range []string{"a", "c", "d"} {
+		if _, ok := l.Get(k); !ok {
+			t.Fatalf("entry %s should be cached", k)
+		}
+	}
+	if err := l.Set("e", entry(1000), 0); err != ErrCacheEntryTooLarge {
+		t.Fatalf("got %v, want ErrCacheEntryTooLarge", err)
+	}
+	l.Set("f", entry(1), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := l.Get("f"); ok {
+		t.Fatal("the entry f should be expired")
+	}
+	counter := l.(cacheBackendCounter)
+	if counter.EvictionCount() != 2 || counter.ExpiredCount() != 1 {
+		t.Fatalf("evictions %d, expirations %d", counter.EvictionCount(), counter.ExpiredCount())
+	}
+}
+
+func TestLRUCacheBackendConcurrent(t *testing.T) {
+	const maxBytes = 64 << 10
+	l := NewLRUCacheBackend(maxBytes)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				key := strconv.Itoa((i*2000 + j) % 1000)
+				l.Set(key, &CacheEntry{Name: key, Content: bytes.Repeat([]byte(key), 100)}, 0)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				key := strconv.Itoa((i + j) % 1000)
+				if e, ok := l.Get(key); ok && (e.Name != key || !bytes.Equal(e.Content, bytes.Repeat([]byte(key), 100))) {
+					t.Errorf("entry %s is corrupted", key)
+					return
+				}
+				if b := l.Bytes(); b > maxBytes {
+					t.Errorf("bytes %d exceed the bound %d", b, maxBytes)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if l.(cacheBackendCounter).EvictionCount() == 0 {
+		t.Fatal("expected evictions")
+	}
+}
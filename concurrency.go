@@ -0,0 +1,171 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ConcurrencyStats is the snapshot of a limit of the concurrent requests.
+type ConcurrencyStats struct {
+	Limit    int   // the maximum number of the requests handled concurrently, 0 means unlimited
+	InFlight int   // the number of the requests being handled
+	Queued   int   // the number of the requests waiting in the queue
+	MaxQueue int   // the maximum number of the requests waiting in the queue
+	Rejected int64 // the total number of the requests responded with 503
+}
+
+// concurrencyLimiter limits the requests handled concurrently,
+// and makes the exceeding ones wait in a bounded queue.
+type concurrencyLimiter struct {
+	sem      chan struct{}
+	maxQueue int32
+	queued   int32
+	timeout  time.Duration // 0 means waiting until the request is canceled
+	rejected int64
+}
+
+// newConcurrencyLimiter returns nil if max<=0, which means unlimited.
+func newConcurrencyLimiter(max, maxQueue int, queueTimeout time.Duration) *concurrencyLimiter {
+	if max <= 0 {
+		return nil
+	}
+	if maxQueue < 0 {
+		maxQueue = 0
+	}
+	if queueTimeout < 0 {
+		queueTimeout = 0
+	}
+	return &concurrencyLimiter{
+		sem:      make(chan struct{}, max),
+		maxQueue: int32(maxQueue),
+		timeout:  queueTimeout,
+	}
+}
+
+// acquire takes a slot, waiting in the queue if there is room,
+// and reports false if the request should be rejected.
+func (l *concurrencyLimiter) acquire(ctx context.Context) bool {
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	default:
+	}
+	if atomic.AddInt32(&l.queued, 1) > l.maxQueue {
+		atomic.AddInt32(&l.queued, -1)
+		atomic.AddInt64(&l.rejected, 1)
+		return false
+	}
+	defer atomic.AddInt32(&l.queued, -1)
+	var timeout <-chan time.Time
+	if l.timeout > 0 {
+		timer := time.NewTimer(l.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	case <-timeout:
+	case <-ctx.Done():
+	}
+	atomic.AddInt64(&l.rejected, 1)
+	return false
+}
+
+// release frees the slot taken by acquire.
+func (l *concurrencyLimiter) release() {
+	<-l.sem
+}
+
+// retryAfter returns the value of the Retry-After header of the rejected requests, in seconds.
+func (l *concurrencyLimiter) retryAfter() string {
+	secs := int64(math.Ceil(l.timeout.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	return strconv.FormatInt(secs, 10)
+}
+
+func (l *concurrencyLimiter) stats() ConcurrencyStats {
+	if l == nil {
+		return ConcurrencyStats{}
+	}
+	return ConcurrencyStats{
+		Limit:    cap(l.sem),
+		InFlight: len(l.sem),
+		Queued:   int(atomic.LoadInt32(&l.queued)),
+		MaxQueue: int(l.maxQueue),
+		Rejected: atomic.LoadInt64(&l.rejected),
+	}
+}
+
+// SetMaxConcurrentRequests limits the requests handled concurrently by all the frame services of the process,
+// in addition to the config item `max_concurrent_requests` of each frame.
+// At most maxQueue exceeding requests wait for up to queueTimeout (0 means until the request is canceled),
+// the others are responded with 503 and Retry-After.
+// If max<=0, unlimited.
+// note: it should be called before Run()
+func SetMaxConcurrentRequests(max, maxQueue int, queueTimeout time.Duration) {
+	global.limiter = newConcurrencyLimiter(max, maxQueue, queueTimeout)
+}
+
+// GlobalConcurrencyStats returns the snapshot of the limit set by SetMaxConcurrentRequests.
+func GlobalConcurrencyStats() ConcurrencyStats {
+	return global.limiter.stats()
+}
+
+// ConcurrencyStats returns the snapshot of the limit set by the config item `max_concurrent_requests`.
+func (frame *Framework) ConcurrencyStats() ConcurrencyStats {
+	return frame.limiter.stats()
+}
+
+// acquireConcurrency takes the slots of the global and frame limits,
+// and returns the function releasing them, or nil if the request is rejected with 503.
+func (frame *Framework) acquireConcurrency(ctx *Context) (release func()) {
+	globalLimiter, frameLimiter := global.limiter, frame.limiter
+	if globalLimiter == nil && frameLimiter == nil {
+		return func() {}
+	}
+	if globalLimiter != nil && !globalLimiter.acquire(ctx.R.Context()) {
+		rejectConcurrency(ctx, globalLimiter)
+		return nil
+	}
+	if frameLimiter != nil && !frameLimiter.acquire(ctx.R.Context()) {
+		if globalLimiter != nil {
+			globalLimiter.release()
+		}
+		rejectConcurrency(ctx, frameLimiter)
+		return nil
+	}
+	return func() {
+		if frameLimiter != nil {
+			frameLimiter.release()
+		}
+		if globalLimiter != nil {
+			globalLimiter.release()
+		}
+	}
+}
+
+func rejectConcurrency(ctx *Context, l *concurrencyLimiter) {
+	ctx.SetHeader(HeaderRetryAfter, l.retryAfter())
+	global.errorFunc(ctx, "Too many requests in flight", http.StatusServiceUnavailable)
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMaxConcurrentRequests(t *testing.T) {
+	frame := newTestFrame(t, "concurrency_test")
+	frame.config.MaxConcurrentRequests = 1
+	frame.config.MaxQueue = 1
+	frame.config.QueueTimeout = 50 * time.Millisecond
+	unblock := make(chan struct{})
+	frame.GET("/block", HandlerFunc(func(ctx *Context) error {
+		<-unblock
+		return ctx.String(200, "done")
+	}))
+	frame.GET("/panic", HandlerFunc(func(ctx *Context) error {
+		panic("handler panic")
+	}))
+	frame.GET("/ok", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, "ok")
+	}))
+	serve := func(path string) <-chan *httptest.ResponseRecorder {
+		c := make(chan *httptest.ResponseRecorder, 1)
+		go func() { c <- serveTest(frame, httptest.NewRequest("GET", path, nil)) }()
+		return c
+	}
+	waitStats := func(inFlight, queued int) {
+		for i := 0; i < 200; i++ {
+			s := frame.ConcurrencyStats()
+			if s.InFlight == inFlight && s.Queued == queued {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("expected %d in flight and %d queued, got %+v", inFlight, queued, frame.ConcurrencyStats())
+	}
+
+	if rec := serveTest(frame, httptest.NewRequest("GET", "/panic", nil)); rec.Code != 500 {
+		t.Fatalf("panic: got %d", rec.Code)
+	}
+	waitStats(0, 0)
+
+	blocked := serve("/block")
+	waitStats(1, 0)
+	queued := serve("/ok")
+	waitStats(1, 1)
+
+	// the queue is full
+	rec := serveTest(frame, httptest.NewRequest("GET", "/ok", nil))
+	if rec.Code != 503 || rec.Header().Get(HeaderRetryAfter) != "1" {
+		t.Fatalf("overflow: got %d, Retry-After %q", rec.Code, rec.Header().Get(HeaderRetryAfter))
+	}
+	// the queued one times out
+	if rec := <-queued; rec.Code != 503 {
+		t.Fatalf("queue timeout: got %d", rec.Code)
+	}
+	if s := frame.ConcurrencyStats(); s.Rejected != 2 || s.Limit != 1 || s.MaxQueue != 1 {
+		t.Fatalf("stats: got %+v", s)
+	}
+
+	// the queued one proceeds after the slot is released
+	queued = serve("/ok")
+	waitStats(1, 1)
+	close(unblock)
+	if rec := <-blocked; rec.Code != 200 || rec.Body.String() != "done" {
+		t.Fatalf("blocked: got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := <-queued; rec.Code != 200 || rec.Body.String() != "ok" {
+		t.Fatalf("queued: got %d %q", rec.Code, rec.Body.String())
+	}
+	waitStats(0, 0)
+}
@@ -24,28 +24,37 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/henrylee2cn/faygo/logging"
 )
 
 type (
 	// GlobalConfig is global config
 	GlobalConfig struct {
-		Cache   CacheConfig `ini:"cache" comment:"Cache section"`
-		Gzip    GzipConfig  `ini:"gzip" comment:"Gzip section"`
-		Log     LogConfig   `ini:"log" comment:"Log section"`
-		warnMsg string      `int:"-"`
+		Cache    CacheConfig    `ini:"cache" comment:"Cache section"`
+		Gzip     GzipConfig     `ini:"gzip" comment:"Gzip section"`
+		Log      LogConfig      `ini:"log" comment:"Log section"`
+		Template TemplateConfig `ini:"template" comment:"Template section"`
+		warnMsg  string         `int:"-"`
 	}
 	// Config is the config information for each web instance
 	Config struct {
 		// RunMode         string      `ini:"run_mode" comment:"run mode: dev|prod"`
 		NetTypes          []string    `ini:"net_types" delim:"|" comment:"List of network type: http|https|unix_http|unix_https|letsencrypt|unix_letsencrypt"`
-		Addrs             []string    `ini:"addrs" delim:"|" comment:"List of multiple listening addresses"`
+		Addrs             []string    `ini:"addrs" delim:"|" comment:"List of multiple listening addresses; the prefix 'unix:' means the Unix domain socket, e.g. unix:/run/app.sock"`
 		TLSCertFile       string      `ini:"tls_certfile" comment:"TLS certificate file path"`
 		TLSKeyFile        string      `ini:"tls_keyfile" comment:"TLS key file path"`
+		TLSClientCAFile   string      `ini:"tls_client_cafile" comment:"PEM file of the CA certificates to verify the TLS client certificates (mTLS); empty means no client certificate is requested"`
+		TLSClientAuth     string      `ini:"tls_client_auth" comment:"Policy of the TLS client certificates if tls_client_cafile is set: require_and_verify|verify_if_given|require|request; empty means require_and_verify"`
 		LetsencryptDir    string      `ini:"letsencrypt_dir" comment:"Let's Encrypt TLS certificate cache directory"`
 		UNIXFileMode      string      `ini:"unix_filemode" comment:"File permissions for UNIX listener, requires octal number"`
 		unixFileMode      os.FileMode `ini:"-"`
 		HttpRedirectHttps bool        `ini:"http_redirect_https" comment:"Redirect from 'http://hostname:port1' to 'https://hostname:port2'"`
+		HTTP3             bool        `ini:"http3" comment:"Experimental: also serve HTTP/3 (QUIC) on the UDP ports of the https listeners, advertised by Alt-Svc; requires frame.SetHTTP3"`
+		CookieSecret      string      `ini:"cookie_secret" comment:"Secret key for signed and encrypted cookies; if empty, a random key is generated at startup"`
+		RedirectHosts     []string    `ini:"redirect_hosts" delim:"|" comment:"List of hosts allowed for the absolute-URL redirects besides the request host; empty means not limited"`
 		// Maximum duration for reading the full request (including body).
 		//
 		// This also limits the maximum duration for idle keep-alive
@@ -54,17 +63,48 @@ type (
 		// By default request read timeout is unlimited.
 		ReadTimeout time.Duration `ini:"read_timeout" comment:"Maximum duration for reading the full request (including body); ns|µs|ms|s|m|h"`
 		// Maximum duration for writing the full response (including body).
+		// It is also the deadline of the request context, see Context.Context.
 		//
 		// By default response write timeout is unlimited.
-		WriteTimeout          time.Duration `ini:"write_timeout" comment:"Maximum duration for writing the full response (including body); ns|µs|ms|s|m|h"`
+		WriteTimeout time.Duration `ini:"write_timeout" comment:"Maximum duration for writing the full response (including body); ns|µs|ms|s|m|h"`
+		// Maximum duration for reading the request headers, which protects
+		// against the slow clients holding the connections, e.g. slowloris.
+		// 0 means unlimited.
+		ReadHeaderTimeout time.Duration `ini:"read_header_timeout" comment:"Maximum duration for reading the request headers; 0 means unlimited; ns|µs|ms|s|m|h"`
+		// Maximum duration to wait for the next request on the keep-alive connections.
+		// 0 means using read_timeout.
+		IdleTimeout time.Duration `ini:"idle_timeout" comment:"Maximum duration to wait for the next request on the keep-alive connections; 0 means using read_timeout; ns|µs|ms|s|m|h"`
+		// Maximum size of the request headers, 0 means 1MB.
+		MaxHeaderKB int `ini:"max_header_kb" comment:"Maximum size of the request headers; 0 means 1MB"`
+		// How the WebSocket and streaming (Server-Sent Events) requests are drained on shutdown:
+		// 'wait' waits for them to finish until streaming_drain_timeout expires, then closes them;
+		// 'close' closes them at once, after sending a close frame (WebSocket) or a comment event (SSE).
+		ShutdownPolicy string `ini:"shutdown_policy" comment:"How the WebSocket and streaming requests are drained on shutdown: wait | close"`
+		// Maximum duration to wait for the WebSocket and streaming requests on shutdown
+		// with the 'wait' policy, 0 means waiting until the shutdown timeout.
+		StreamingDrainTimeout time.Duration `ini:"streaming_drain_timeout" comment:"Maximum duration to wait for the WebSocket and streaming requests on shutdown with the 'wait' policy; 0 means until the shutdown timeout; ns|µs|ms|s|m|h"`
+		// Duration to wait before the listeners are closed on shutdown,
+		// so that the load balancers can stop routing new requests to this service.
+		PreStopDelay          time.Duration `ini:"pre_stop_delay" comment:"Duration to wait before closing the listeners on shutdown, so that load balancers can drain; ns|µs|ms|s|m|h"`
 		MultipartMaxMemoryMB  int64         `ini:"multipart_maxmemory_mb" comment:"Maximum size of memory that can be used when receiving uploaded files"`
 		multipartMaxMemory    int64         `ini:"-"`
+		MaxRequestBodyMB      int64         `ini:"max_request_body_mb" comment:"Maximum size of the request body, the request exceeding it is responded with 413; 0 means unlimited"`
+		maxRequestBody        int64         `ini:"-"`
+		MaxDrainBodyKB        int64         `ini:"max_drain_body_kb" comment:"Maximum size of the unread request body to discard before an error response to keep the connection alive; if exceeded, the connection is closed; 0 means not discarding"`
+		maxDrainBody          int64         `ini:"-"`
+		DecompressRequest     bool          `ini:"decompress_request" comment:"Whether to decompress the request body by the Content-Encoding gzip or deflate before the filters and handlers, the other encodings are responded with 415"`
+		MaxDecompressedMB     int64         `ini:"max_decompressed_mb" comment:"Maximum size of the decompressed request body, the request exceeding it is responded with 413 by the body streamers, or fails binding; 0 means unlimited"`
+		maxDecompressedBody   int64         `ini:"-"`
+		MaxConcurrentRequests int           `ini:"max_concurrent_requests" comment:"Maximum number of the requests handled concurrently, the exceeding ones are queued or responded with 503; 0 means unlimited"`
+		MaxQueue              int           `ini:"max_queue" comment:"Maximum number of the requests waiting for max_concurrent_requests, the exceeding ones are responded with 503; 0 means no queue"`
+		QueueTimeout          time.Duration `ini:"queue_timeout" comment:"Maximum duration for a request to wait in the queue, then it is responded with 503; 0 means until the request is canceled; ns|µs|ms|s|m|h"`
 		Router                RouterConfig  `ini:"router" comment:"Routing config section"`
 		XSRF                  XSRFConfig    `ini:"xsrf" comment:"XSRF security section"`
 		Session               SessionConfig `ini:"session" comment:"Session section"`
 		SlowResponseThreshold time.Duration `ini:"slow_response_threshold" comment:"When response time > slow_response_threshold, log level = 'WARNING'; 0 means not limited; ns|µs|ms|s|m|h"`
 		slowResponseThreshold time.Duration `ini:"-"`
 		PrintBody             bool          `ini:"print_body" comment:"Form requests are printed in JSON format, but other types are printed as-is"`
+		LogLevel              string        `ini:"log_level" comment:"Level of the frame's bizlog, overriding the global console_level and file_level: critical|error|warning|notice|info|debug; empty means the global ones"`
 		APIdoc                APIdocConfig  `ini:"apidoc" comment:"API documentation section"`
 	}
 	// RouterConfig is the config about router
@@ -75,6 +115,18 @@ type (
 		// client is redirected to /foo with http status code 301 for GET requests
 		// and 307 for all other request methods.
 		RedirectTrailingSlash bool `ini:"redirect_trailing_slash" comment:"Automatic redirection (for example, '/foo/' -> '/foo')"`
+		// If enabled, the path with (without) the trailing slash is served by the
+		// route without (with) it directly, instead of a redirection.
+		// For example if /foo/ is requested but a route only exists for /foo,
+		// the handler of /foo is called.
+		// It takes priority over RedirectTrailingSlash.
+		TrailingSlashEquivalent bool `ini:"trailing_slash_equivalent" comment:"Treat the paths with and without the trailing slash as equivalent instead of redirecting (for example, '/foo/' is served by '/foo')"`
+		// If enabled, the request path is cleaned before the filters and matching:
+		// multiple slashes are collapsed and the . and .. elements are resolved,
+		// while .. never goes above the root, so that the filters, handlers and
+		// static files only see the canonical path.
+		// For example /a//b/../c is served as /a/c.
+		CleanPath bool `ini:"clean_path" comment:"Clean the request path before matching: collapse '//' and resolve '.' and '..' (for example, '/a//b/../c' -> '/a/c')"`
 		// If enabled, the router tries to fix the current request path, if no
 		// handle is registered for it.
 		// First superfluous path elements like ../ or // are removed.
@@ -88,16 +140,25 @@ type (
 		// If enabled, the router checks if another method is allowed for the
 		// current route, if the current request can not be routed.
 		// If this is the case, the request is answered with 'Method Not Allowed'
-		// and HTTP status code 405.
+		// and HTTP status code 405 by the ErrorFunc, with the Allow header listing
+		// the methods registered for the path.
 		// If no other Method is allowed, the request is delegated to the NotFound
 		// handler.
 		HandleMethodNotAllowed bool `ini:"handle_method_not_allowed" comment:"Returns 405 if the requested method does not exist, otherwise returns 404"`
 		// If enabled, the router automatically replies to OPTIONS requests.
 		// Custom OPTIONS handlers take priority over automatic replies.
-		HandleOPTIONS   bool `ini:"handle_options" comment:"Automatic response OPTIONS request, you can set the default Handler in faygo"`
+		HandleOPTIONS bool `ini:"handle_options" comment:"Automatic response OPTIONS request, you can set the default Handler in faygo"`
+		// If enabled, the HEAD requests of the paths without HEAD routes are served by the
+		// GET handlers, discarding the body while preserving the headers and Content-Length.
+		HandleHEAD      bool `ini:"handle_head" comment:"Automatically answer HEAD requests with the GET handlers, discarding the body"`
 		NoDefaultParams bool `ini:"no_default_params" comment:"If true, don't assign default request parameter values based on initial parameter values of the routing handler"`
 		DefaultUpload   bool `ini:"default_upload" comment:"Automatically register the default router: /upload/*filepath"`
 		DefaultStatic   bool `ini:"default_static" comment:"Automatically register the default router: /static/*filepath"`
+		// If enabled, the route table with the handler names and flags is printed in aligned columns at startup.
+		PrintRoutes bool `ini:"print_routes" comment:"Print the route table with the handler names and flags in aligned columns at startup"`
+		// If enabled, the route inspection endpoint '/debug/routes' is registered,
+		// it is restricted by the same IP whitelist as the apidoc.
+		DebugRoutes bool `ini:"debug_routes" comment:"Automatically register the route inspection router: /debug/routes, restricted by the apidoc whitelist"`
 	}
 	// GzipConfig is the config about gzip
 	GzipConfig struct {
@@ -111,6 +172,9 @@ type (
 		CompressLevel int `ini:"compress_level" comment:"Non-file response Body's compression level is 0-9, but the files' always 9"`
 		//List of HTTP methods to compress. If not set, only GET requests are compressed.
 		Methods []string `ini:"methods" delim:"|" comment:"List of HTTP methods to compress. If not set, only GET requests are compressed."`
+		//List of content types that are not compressed, such as the already-compressed images and videos.
+		//The wildcard subtype such as 'video/*' is supported.
+		ExcludedContentTypes []string `ini:"excluded_content_types" delim:"|" comment:"List of content types that are not compressed, such as already-compressed images; supports wildcard subtype like 'video/*'"`
 		// StaticExtensionsToGzip []string
 	}
 	// CacheConfig is the config about cache
@@ -126,6 +190,11 @@ type (
 		// expire in xxx seconds for file cache.
 		// ExpireSecond <= 0 (second) means no expire, but it can be evicted when cache is full.
 		ExpireSecond int `ini:"expire_second" comment:"Maximum duration for caching"`
+		// Which entry is removed when the cache is full: lru (least recently used) or lfu (least frequently used).
+		EvictionPolicy string `ini:"eviction_policy" comment:"Which entry is removed when the cache is full: lru|lfu"`
+		// Storage of the file cache: memory (the fixed-size ring buffer) or lru (the exact LRU with per-entry expiry).
+		// It can be replaced by a custom backend, such as memcached, with `faygo.SetFileCacheBackend`.
+		Backend string `ini:"backend" comment:"Storage of the file cache: memory|lru"`
 	}
 	// XSRFConfig is the config about XSRF filter
 	XSRFConfig struct {
@@ -150,11 +219,29 @@ type (
 	}
 	// LogConfig is the config about log
 	LogConfig struct {
-		ConsoleEnable bool   `ini:"console_enable" comment:"Whether enabled or not console logger"`
-		ConsoleLevel  string `ini:"console_level" comment:"Console logger level: critical|error|warning|notice|info|debug"`
-		FileEnable    bool   `ini:"file_enable" comment:"Whether enabled or not file logger"`
-		FileLevel     string `ini:"file_level" comment:"File logger level: critical|error|warning|notice|info|debug"`
-		AsyncLen      int    `ini:"async_len" comment:"The length of asynchronous buffer, 0 means synchronization"`
+		ConsoleEnable   bool   `ini:"console_enable" comment:"Whether enabled or not console logger"`
+		ConsoleLevel    string `ini:"console_level" comment:"Console logger level: critical|error|warning|notice|info|debug"`
+		FileEnable      bool   `ini:"file_enable" comment:"Whether enabled or not file logger"`
+		FileLevel       string `ini:"file_level" comment:"File logger level: critical|error|warning|notice|info|debug"`
+		FileJSON        bool   `ini:"file_json" comment:"Write the file logs as JSON objects, with the fields of ctx.LogWith as keys"`
+		AsyncLen        int    `ini:"async_len" comment:"The length of asynchronous buffer, 0 means synchronization"`
+		MaxSizeMB       int    `ini:"max_size_mb" comment:"Rotate the log file when the next line would exceed the size in MB, 0 means not limited"`
+		MaxAgeDays      int    `ini:"max_age_days" comment:"Remove the rotated log files older than the days, 0 means not limited"`
+		MaxBackups      int    `ini:"max_backups" comment:"The maximum number of the rotated log files to retain, 0 means not limited"`
+		CompressRotated bool   `ini:"compress_rotated" comment:"Whether to compress the rotated log files with gzip"`
+	}
+	// TemplateConfig is the config about the templates
+	TemplateConfig struct {
+		// If true, all the templates under the Dir are parsed before running,
+		// and the services fail to run if any of them fails.
+		Precompile bool `ini:"precompile" comment:"Parse all the templates under the dir before running, and fail to run if any fails"`
+		// Directory of the templates
+		Dir string `ini:"dir" comment:"Directory of the templates"`
+		// File extensions of the templates
+		Extensions []string `ini:"extensions" delim:"|" comment:"File extensions of the templates"`
+		// If true, the templates outputting the variables into the script or URL context
+		// without the `safe_js` or `safe_url` filter are refused to render.
+		StrictEscaping bool `ini:"strict_escaping" comment:"Refuse the templates outputting the variables into the script or URL context without the safe_js or safe_url filter"`
 	}
 	// APIdocConfig is the config about API doc
 	APIdocConfig struct {
@@ -175,9 +262,14 @@ type (
 const (
 	// RUNMODE_DEV                 = "dev"
 	// RUNMODE_PROD                = "prod"
+	KB                          = 1 << 10 // 1KB
 	MB                          = 1 << 20 // 1MB
 	defaultMultipartMaxMemory   = 32 * MB // 32 MB
 	defaultMultipartMaxMemoryMB = 32
+	defaultMaxDrainBodyKB       = 256
+	defaultMaxDecompressedMB    = 32
+	defaultReadHeaderTimeout    = 10 * time.Second
+	defaultIdleTimeout          = 2 * time.Minute
 	defaultPort                 = 8080
 )
 
@@ -186,10 +278,13 @@ var (
 	configDir = "./config/"
 	// globalConfigFile global config file name
 	globalConfigFile = "__global___.ini"
+	// configDirOnce parses the flag of the config files directory once
+	configDirOnce sync.Once
 )
 
 // ConfigDir returns the config files directory
 func ConfigDir() string {
+	parseConfigDir()
 	return configDir
 }
 
@@ -205,41 +300,63 @@ func resetFlag() {
 	}
 }
 
-// global config
-var globalConfig = func() GlobalConfig {
-	// get config dir
-	flag.CommandLine.Init(os.Args[0], -1) // ignore error
-	flag.CommandLine.SetOutput(ioutil.Discard)
-	flag.CommandLine.StringVar(&configDir, "cfg_dir", configDir, "Configuration files directory")
-	flag.CommandLine.Parse(os.Args[1:])
+// parseConfigDir parses the command line flag `cfg_dir` of the config files directory once.
+func parseConfigDir() {
+	configDirOnce.Do(func() {
+		flag.CommandLine.Init(os.Args[0], -1) // ignore error
+		flag.CommandLine.SetOutput(ioutil.Discard)
+		flag.CommandLine.StringVar(&configDir, "cfg_dir", configDir, "Configuration files directory")
+		flag.CommandLine.Parse(os.Args[1:])
+	})
+}
 
-	var background = &GlobalConfig{
+// NewDefaultGlobalConfig creates a new default global config,
+// such as the base of the one passed to Configure.
+func NewDefaultGlobalConfig() GlobalConfig {
+	return GlobalConfig{
 		Cache: CacheConfig{
-			Enable:       false,
-			SizeMB:       32,
-			ExpireSecond: 60,
+			Enable:         false,
+			SizeMB:         32,
+			ExpireSecond:   60,
+			EvictionPolicy: "lru",
+			Backend:        "memory",
 		},
 		Gzip: GzipConfig{
 			Enable:        false,
 			MinLength:     20,
 			CompressLevel: 1,
 			Methods:       []string{"GET"},
+			ExcludedContentTypes: []string{
+				"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif",
+				"video/*", "audio/*", "font/woff", "font/woff2",
+				"application/zip", "application/gzip", "application/x-gzip",
+				"application/x-bzip2", "application/x-7z-compressed", "application/x-rar-compressed",
+			},
 		},
 		Log: LogConfig{
 			ConsoleEnable: true,
 			ConsoleLevel:  "debug",
 			FileEnable:    false,
 			FileLevel:     "debug",
+			MaxSizeMB:     256,
+			MaxAgeDays:    7,
+		},
+		Template: TemplateConfig{
+			Dir:        "view",
+			Extensions: []string{".html", ".tpl"},
 		},
 	}
+}
+
+// loadGlobalConfig loads the global config from the file, which is created if it does not exist.
+func loadGlobalConfig() GlobalConfig {
+	parseConfigDir()
+	var background = NewDefaultGlobalConfig()
 	filename := filepath.Join(configDir, globalConfigFile)
 	err := SyncINI(
-		background,
+		&background,
 		func(onceUpdateFunc func() error) error {
-			if !(background.Log.ConsoleEnable || background.Log.FileEnable) {
-				background.Log.ConsoleEnable = true
-				background.warnMsg = "config: log::enable_console and log::enable_file can not be disabled at the same time, so automatically open console log."
-			}
+			background.check()
 			return onceUpdateFunc()
 		},
 		filename,
@@ -249,8 +366,28 @@ var globalConfig = func() GlobalConfig {
 		panic(err)
 	}
 
-	return *background
-}()
+	return background
+}
+
+// check corrects the invalid global config items, and records the warning.
+func (c *GlobalConfig) check() {
+	if !(c.Log.ConsoleEnable || c.Log.FileEnable) {
+		c.Log.ConsoleEnable = true
+		c.warnMsg = "config: log::enable_console and log::enable_file can not be disabled at the same time, so automatically open console log."
+	}
+	switch c.Cache.EvictionPolicy = strings.ToLower(c.Cache.EvictionPolicy); c.Cache.EvictionPolicy {
+	case "lru", "lfu":
+	default:
+		c.Cache.EvictionPolicy = "lru"
+		c.warnMsg = "config: cache::eviction_policy must be lru or lfu, so automatically use lru."
+	}
+	switch c.Cache.Backend = strings.ToLower(c.Cache.Backend); c.Cache.Backend {
+	case "memory", "lru":
+	default:
+		c.Cache.Backend = "memory"
+		c.warnMsg = "config: cache::backend must be memory or lru, so automatically use memory."
+	}
+}
 
 // NewDefaultConfig creates a new default framework config.
 func NewDefaultConfig() *Config {
@@ -260,11 +397,17 @@ func NewDefaultConfig() *Config {
 		Addrs:                []string{fmt.Sprintf("0.0.0.0:%d", defaultPort+len(AllFrames()))},
 		UNIXFileMode:         "0666",
 		MultipartMaxMemoryMB: defaultMultipartMaxMemoryMB,
+		MaxDrainBodyKB:       defaultMaxDrainBodyKB,
+		MaxDecompressedMB:    defaultMaxDecompressedMB,
+		ReadHeaderTimeout:    defaultReadHeaderTimeout,
+		IdleTimeout:          defaultIdleTimeout,
+		ShutdownPolicy:       ShutdownPolicyWait,
 		Router: RouterConfig{
 			RedirectTrailingSlash:  true,
 			RedirectFixedPath:      true,
 			HandleMethodNotAllowed: true,
 			HandleOPTIONS:          true,
+			HandleHEAD:             true,
 			DefaultUpload:          true,
 			DefaultStatic:          true,
 		},
@@ -326,7 +469,34 @@ func (c *Config) check() {
 	}
 	c.unixFileMode = os.FileMode(fileMode)
 	c.UNIXFileMode = fmt.Sprintf("%#o", fileMode)
+	switch c.ShutdownPolicy {
+	case "":
+		c.ShutdownPolicy = ShutdownPolicyWait
+	case ShutdownPolicyWait, ShutdownPolicyClose:
+	default:
+		panic("Please set a valid config item `shutdown_policy`, refer to the following: wait | close")
+	}
+	if _, ok := clientAuthTypes[c.TLSClientAuth]; !ok {
+		panic("Please set a valid config item `tls_client_auth`, refer to the following: " + __clientAuthTypes__)
+	}
+	if c.LogLevel != "" {
+		if _, err := logging.LogLevel(c.LogLevel); err != nil {
+			panic("Please set a valid config item `log_level`, refer to the following: critical|error|warning|notice|info|debug")
+		}
+	}
 	c.multipartMaxMemory = c.MultipartMaxMemoryMB * MB
+	c.maxDrainBody = c.MaxDrainBodyKB * KB
+	c.maxRequestBody = c.MaxRequestBodyMB * MB
+	c.maxDecompressedBody = c.MaxDecompressedMB * MB
+	if c.MaxConcurrentRequests < 0 {
+		c.MaxConcurrentRequests = 0
+	}
+	if c.MaxQueue < 0 {
+		c.MaxQueue = 0
+	}
+	if c.QueueTimeout < 0 {
+		c.QueueTimeout = 0
+	}
 	if c.SlowResponseThreshold <= 0 {
 		c.slowResponseThreshold = time.Duration(math.MaxInt64)
 	} else {
@@ -15,9 +15,71 @@
 package faygo
 
 import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 )
 
 func TestNewConfig(t *testing.T) {
 	t.Logf("%#v", newConfigFromFileAndCheck("test/faygo.ini"))
 }
+
+func TestConfigure(t *testing.T) {
+	if os.Getenv("FAYGO_CONFIGURE_TEST") == "" {
+		// run in a new process in an empty directory, since the global config is applied once
+		dir, err := ioutil.TempDir("", "faygo_configure_test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		cmd := exec.Command(os.Args[0], "-test.run=^TestConfigure$")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "FAYGO_CONFIGURE_TEST=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		return
+	}
+
+	// importing the package creates nothing
+	if names, _ := filepath.Glob("*"); len(names) != 0 {
+		t.Fatalf("files are created on importing: %v", names)
+	}
+	config := NewDefaultGlobalConfig()
+	config.Log.ConsoleLevel = "verbose"
+	if err := Configure(config); err == nil {
+		t.Fatal("no error with the invalid log level")
+	}
+	config.Log.ConsoleLevel = "info"
+	config.Template.StrictEscaping = true
+	config.Cache.Enable = true
+	if err := Configure(config); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := filepath.Glob("*"); len(names) != 0 {
+		t.Fatalf("files are created on configuring: %v", names)
+	}
+
+	// the settings of the file server manager made before New are kept
+	fsys := http.Dir(".")
+	SetFileSystem(fsys)
+	backend := NewLRUCacheBackend(1 << 20)
+	SetFileCacheBackend(backend)
+
+	newTestFrame(t, "configure_test")
+	if !global.config.Template.StrictEscaping || !global.render.strictEscaping {
+		t.Fatal("the global config is not applied")
+	}
+	if global.fsManager.fs != fsys || global.fsManager.backend != backend {
+		t.Fatal("the file system or the cache backend set before New is lost")
+	}
+	if _, err := os.Stat(filepath.Join(configDir, globalConfigFile)); !os.IsNotExist(err) {
+		t.Fatalf("the global config file is loaded: %v", err)
+	}
+	if err := Configure(NewDefaultGlobalConfig()); err != ErrGlobalConfigured {
+		t.Fatalf("got %v, want ErrGlobalConfigured", err)
+	}
+}
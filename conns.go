@@ -0,0 +1,307 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnStats is a snapshot of the connections of the frame service.
+type ConnStats struct {
+	// Active is the number of the connections that are reading or serving a request.
+	Active int
+	// Idle is the number of the keep-alive connections waiting for the next request.
+	Idle int
+	// Requests is the number of the requests being served, including the ones
+	// on the hijacked connections (such as WebSocket) until the handlers return.
+	Requests int
+}
+
+// connTracker counts the connections of all the listeners by their states.
+// The hijacked connections are no longer tracked, since http.Server does not report
+// their closing.
+type connTracker struct {
+	mu     sync.Mutex
+	states map[net.Conn]http.ConnState
+	active int
+	idle   int
+}
+
+// track is used as the http.Server.ConnState hook.
+func (t *connTracker) track(c net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.states == nil {
+		t.states = make(map[net.Conn]http.ConnState)
+	}
+	if old, ok := t.states[c]; ok {
+		t.add(old, -1)
+	}
+	switch state {
+	case http.StateHijacked, http.StateClosed:
+		delete(t.states, c)
+	default:
+		t.states[c] = state
+		t.add(state, 1)
+	}
+}
+
+func (t *connTracker) add(state http.ConnState, n int) {
+	switch state {
+	case http.StateNew, http.StateActive:
+		t.active += n
+	case http.StateIdle:
+		t.idle += n
+	}
+}
+
+// ActiveConnections returns the numbers of the active and idle connections,
+// and the in-flight requests of the frame service.
+func (frame *Framework) ActiveConnections() ConnStats {
+	frame.conns.mu.Lock()
+	defer frame.conns.mu.Unlock()
+	return ConnStats{
+		Active:   frame.conns.active,
+		Idle:     frame.conns.idle,
+		Requests: int(atomic.LoadInt32(&frame.requests)),
+	}
+}
+
+// drainLogInterval is the interval of logging the connections during the shutdown.
+var drainLogInterval = time.Second
+
+// logDraining logs the connections periodically until the done channel is closed
+// or the shutdown timeout expires, for diagnosing the stuck requests.
+func (frame *Framework) logDraining(ctxTimeout context.Context, done <-chan struct{}) {
+	ticker := time.NewTicker(drainLogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctxTimeout.Done():
+			stats := frame.ActiveConnections()
+			frame.syslog.Warningf("[shutdown-%s] timeout with %d active and %d idle connections, %d requests in flight",
+				frame.NameWithVersion(), stats.Active, stats.Idle, stats.Requests)
+			return
+		case <-ticker.C:
+			stats := frame.ActiveConnections()
+			frame.syslog.Infof("[shutdown-%s] draining %d active and %d idle connections, %d requests in flight",
+				frame.NameWithVersion(), stats.Active, stats.Idle, stats.Requests)
+		}
+	}
+}
+
+const (
+	// ShutdownPolicyWait waits for the WebSocket and streaming requests to finish on shutdown,
+	// until the config item `streaming_drain_timeout` expires.
+	ShutdownPolicyWait = "wait"
+	// ShutdownPolicyClose closes the WebSocket and streaming requests at once on shutdown.
+	ShutdownPolicyClose = "close"
+)
+
+// the kinds of the streams
+const (
+	streamWebsocket = "websocket"
+	streamSSE       = "sse"
+)
+
+var (
+	// wsGoingAway is the WebSocket close frame with the status code 1001 (going away).
+	wsGoingAway = []byte{0x88, 0x02, 0x03, 0xE9}
+	// sseGoodbye is the comment event sent to the Server-Sent Events clients on shutdown.
+	sseGoodbye = []byte(": server shutting down\n\n")
+)
+
+// stream is a long-lived request, such as WebSocket or Server-Sent Events,
+// which is drained separately from the other requests on shutdown.
+type stream struct {
+	kind    string
+	cancel  context.CancelFunc // cancels the request context
+	mu      sync.Mutex
+	conn    net.Conn // the hijacked connection of WebSocket
+	closing bool
+}
+
+// streamKind classifies the request by its headers, returns "" if it is not a stream.
+func streamKind(r *http.Request) string {
+	if strings.EqualFold(r.Header.Get(HeaderUpgrade), "websocket") {
+		return streamWebsocket
+	}
+	if strings.Contains(r.Header.Get(HeaderAccept), MIMEEventStream) {
+		return streamSSE
+	}
+	return ""
+}
+
+// hijacked records the hijacked connection of the stream,
+// and closes it at once if the stream is closing.
+func (s *stream) hijacked(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		conn.Close()
+		return
+	}
+	s.conn = conn
+}
+
+// close says goodbye and ends the stream: the WebSocket connection is closed
+// after the close frame 1001 (going away); the request context of the Server-Sent Events
+// is canceled, and the comment event is sent after the handler returns.
+// Note: the close frame may interleave with a frame being written by the handler
+// in several writes, the client sees the connection closing either way.
+func (s *stream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return
+	}
+	s.closing = true
+	if s.conn != nil {
+		s.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		s.conn.Write(wsGoingAway)
+		s.conn.Close()
+	}
+	s.cancel()
+}
+
+// streamTracker tracks the streams being served.
+type streamTracker struct {
+	mu      sync.Mutex
+	streams map[*stream]struct{}
+	changed chan struct{} // closed when a stream is removed
+}
+
+func (t *streamTracker) add(s *stream) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.streams == nil {
+		t.streams = make(map[*stream]struct{})
+	}
+	t.streams[s] = struct{}{}
+}
+
+func (t *streamTracker) remove(s *stream) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.streams, s)
+	if t.changed != nil {
+		close(t.changed)
+		t.changed = nil
+	}
+}
+
+func (t *streamTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.streams)
+}
+
+// closeAll closes all of the streams, returns the number of them.
+func (t *streamTracker) closeAll() int {
+	t.mu.Lock()
+	streams := make([]*stream, 0, len(t.streams))
+	for s := range t.streams {
+		streams = append(streams, s)
+	}
+	t.mu.Unlock()
+	for _, s := range streams {
+		s.close()
+	}
+	return len(streams)
+}
+
+// wait waits until no stream is left, returns false if the context is done first.
+func (t *streamTracker) wait(ctx context.Context) bool {
+	for {
+		t.mu.Lock()
+		if len(t.streams) == 0 {
+			t.mu.Unlock()
+			return true
+		}
+		if t.changed == nil {
+			t.changed = make(chan struct{})
+		}
+		changed := t.changed
+		t.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// ActiveStreams returns the number of the WebSocket and streaming (Server-Sent Events)
+// requests being served, which are drained by the config item `shutdown_policy` on shutdown.
+func (frame *Framework) ActiveStreams() int {
+	return frame.streams.count()
+}
+
+// startStream classifies the request, and tracks it with a cancelable request context
+// if it is a stream.
+func (frame *Framework) startStream(ctx *Context) {
+	kind := streamKind(ctx.R)
+	if kind == "" {
+		return
+	}
+	c, cancel := context.WithCancel(ctx.R.Context())
+	ctx.R = ctx.R.WithContext(c)
+	ctx.stream = &stream{kind: kind, cancel: cancel}
+	frame.streams.add(ctx.stream)
+}
+
+// endStream stops tracking the stream after the handler returns,
+// and sends the comment event to the Server-Sent Events client if it is closed on shutdown.
+func (frame *Framework) endStream(ctx *Context) {
+	s := ctx.stream
+	s.mu.Lock()
+	goodbye := s.closing && s.kind == streamSSE && s.conn == nil
+	s.closing = true
+	s.mu.Unlock()
+	if goodbye && ctx.W.Committed() {
+		ctx.W.Write(sseGoodbye)
+		ctx.W.Flush()
+	}
+	s.cancel()
+	frame.streams.remove(s)
+}
+
+// drainStreams drains the streams by the config item `shutdown_policy`,
+// and reports whether all of them finish before the shutdown timeout.
+func (frame *Framework) drainStreams(ctxTimeout context.Context) bool {
+	if frame.config.ShutdownPolicy != ShutdownPolicyClose {
+		c := ctxTimeout
+		if timeout := frame.config.StreamingDrainTimeout; timeout > 0 {
+			var cancel context.CancelFunc
+			c, cancel = context.WithTimeout(ctxTimeout, timeout)
+			defer cancel()
+		}
+		if frame.streams.wait(c) {
+			return true
+		}
+	}
+	if n := frame.streams.closeAll(); n > 0 {
+		frame.syslog.Infof("[shutdown-%s] closing %d streams", frame.NameWithVersion(), n)
+	}
+	return frame.streams.wait(ctxTimeout)
+}
@@ -15,17 +15,22 @@
 package faygo
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
 	"mime/multipart"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"path"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/henrylee2cn/faygo/apiware"
 	"github.com/henrylee2cn/faygo/logging"
 	"github.com/henrylee2cn/faygo/session"
 )
@@ -34,19 +39,27 @@ import (
 const (
 	HeaderAccept                        = "Accept"
 	HeaderAcceptEncoding                = "Accept-Encoding"
+	HeaderAcceptLanguage                = "Accept-Language"
+	HeaderAllow                         = "Allow"
+	HeaderAltSvc                        = "Alt-Svc"
 	HeaderAuthorization                 = "Authorization"
 	HeaderContentDisposition            = "Content-Disposition"
 	HeaderContentEncoding               = "Content-Encoding"
+	HeaderContentLanguage               = "Content-Language"
 	HeaderContentLength                 = "Content-Length"
 	HeaderContentType                   = "Content-Type"
 	HeaderContentDescription            = "Content-Description"
 	HeaderContentTransferEncoding       = "Content-Transfer-Encoding"
+	HeaderConnection                    = "Connection"
 	HeaderCookie                        = "Cookie"
+	HeaderExpect                        = "Expect"
 	HeaderSetCookie                     = "Set-Cookie"
 	HeaderIfModifiedSince               = "If-Modified-Since"
 	HeaderLastModified                  = "Last-Modified"
 	HeaderLocation                      = "Location"
+	HeaderRange                         = "Range"
 	HeaderReferer                       = "Referer"
+	HeaderRetryAfter                    = "Retry-After"
 	HeaderUserAgent                     = "User-Agent"
 	HeaderUpgrade                       = "Upgrade"
 	HeaderVary                          = "Vary"
@@ -56,6 +69,7 @@ const (
 	HeaderXForwardedFor                 = "X-Forwarded-For"
 	HeaderXRealIP                       = "X-Real-IP"
 	HeaderXRequestedWith                = "X-Requested-With"
+	HeaderXRequestID                    = "X-Request-Id"
 	HeaderServer                        = "Server"
 	HeaderOrigin                        = "Origin"
 	HeaderAccessControlRequestMethod    = "Access-Control-Request-Method"
@@ -68,6 +82,8 @@ const (
 	HeaderAccessControlMaxAge           = "Access-Control-Max-Age"
 	HeaderExpires                       = "Expires"
 	HeaderCacheControl                  = "Cache-Control"
+	HeaderETag                          = "Etag"
+	HeaderIfNoneMatch                   = "If-None-Match"
 	HeaderPragma                        = "Pragma"
 
 	// Security
@@ -98,6 +114,7 @@ const (
 	MIMETextPlainCharsetUTF8             = MIMETextPlain + "; " + charsetUTF8
 	MIMEMultipartForm                    = "multipart/form-data"
 	MIMEOctetStream                      = "application/octet-stream"
+	MIMEEventStream                      = "text/event-stream"
 )
 
 const (
@@ -136,14 +153,122 @@ type (
 		xsrfExpire         int
 		_xsrfToken         string
 		_xsrfTokenReset    bool
+		csrf               *csrf         // the CSRF middleware
+		csrfToken          string        // the CSRF token of the CSRF middleware
+		i18n               *i18n         // the i18n middleware
+		lang               string        // the locale chosen by the i18n middleware
+		upstreamLatency    time.Duration // the latency of the upstream, used by reverse proxy
+		gzipLevel          int           // the compression level of the response, valid if hasGzipLevel
+		hasGzipLevel       bool
+		gzipMinLength      int // the minimum length of the compressed body, valid if hasGzipMinLength
+		hasGzipMinLength   bool
+		deferred           []func(context.Context) // the background tasks started after the request
+		routePattern       string                  // the pattern of the matched route
+		staticRoute        bool                    // whether the matched route is a static file server
+		apiVersion         string                  // the API version of the matched versioned route
+		cancel             context.CancelFunc      // cancels the request context with the deadline
+		span               Span                    // the server span, nil if tracing is disabled
+		log                *logging.Logger         // the logger with the trace ID or the fields of LogWith
+		originalMethod     string                  // the request method before overridden, empty if not overridden
+		stream             *stream                 // the WebSocket or streaming request, nil if it is not
+		flashes            []string                // the flash messages of the previous request
+		flashRead          bool                    // whether the flash cookie is read
+		flashOut           []string                // the flash messages for the next request
+		noAccessLog        bool                    // whether the request is excluded from the access log
+		accessLogSampler   *accessLogSampler       // samples the successful requests of the route for the access log
+		start              time.Time               // the time the request is received
+		noCompress         bool                    // whether the response is excluded from gzip
+		tee                *bodyTee                // the request body tee, nil if not used
+		variants           []string                // the chosen variants of the experiments, as `experiment:variant`
+		bound              interface{}             // the struct pointer bound by the APIHandler, used by the audit middleware
+		boundAPI           *apiware.ParamsAPI      // the ParamsAPI of bound
 	}
 )
 
+// Context returns the context of the request, which is canceled when the client's connection closes.
+// If `write_timeout` is set, it carries the deadline of the server's write timeout,
+// after which the response can not be written, so that the database queries and the
+// outbound calls are abandoned instead of wasting work.
+// `read_timeout` is not used, since it starts when the connection is accepted and
+// only limits reading the request.
+// If tracing is enabled, it also carries the server span.
+//
+// A per-route timeout middleware can only shorten the deadline by replacing the request,
+// the earlier deadline of the two takes effect:
+//
+//	c, cancel := context.WithTimeout(ctx.Context(), 3*time.Second)
+//	defer cancel()
+//	ctx.R = ctx.R.WithContext(c)
+//	ctx.Next()
+//	return nil
+func (ctx *Context) Context() context.Context {
+	return ctx.R.Context()
+}
+
+// Deadline returns the deadline of the request context, see Context.
+func (ctx *Context) Deadline() (deadline time.Time, ok bool) {
+	return ctx.R.Context().Deadline()
+}
+
+// Done returns a channel that is closed when the request context is done,
+// that is the client disconnects, the deadline expires, or the request ends.
+// The long-running handler can select on it to stop early:
+//
+//	select {
+//	case result := <-resultCh:
+//		return ctx.JSON(200, result)
+//	case <-ctx.Done():
+//		return ctx.Err()
+//	}
+//
+// If the client disconnects, returning ctx.Err() stops the handler chain without writing any response,
+// and a panic after that is still logged by the recovery, but no error page is written.
+func (ctx *Context) Done() <-chan struct{} {
+	return ctx.R.Context().Done()
+}
+
+// Err returns the error of the request context, context.Canceled if the client disconnects,
+// context.DeadlineExceeded if the deadline expires, or nil if it is not done yet.
+func (ctx *Context) Err() error {
+	return ctx.R.Context().Err()
+}
+
+// Canceled reports whether the request context is canceled, usually by the client disconnection.
+func (ctx *Context) Canceled() bool {
+	return ctx.R.Context().Err() == context.Canceled
+}
+
 // Log used by the user bissness
+// If tracing is enabled, the trace ID is added to the module name.
+// The fields added by LogWith are carried by the returned logger.
 func (ctx *Context) Log() *logging.Logger {
+	if log := ctx.traceLog(); log != nil {
+		return log
+	}
 	return ctx.frame.bizlog
 }
 
+// LogWith adds the alternating keys and values to the fields of the request logger,
+// and returns it, such as `ctx.LogWith("order_id", id).Info("charged")`.
+// The fields are rendered as `key=value` in the text logs or as keys in the JSON logs,
+// and are inherited by ctx.Log() and LogWith later in the handler chain.
+// The request_id (from the X-Request-Id header) and route fields are preset.
+func (ctx *Context) LogWith(keyvals ...interface{}) *logging.Logger {
+	log := ctx.Log()
+	if len(log.Fields()) == 0 {
+		var preset []interface{}
+		if id := ctx.HeaderParam(HeaderXRequestID); id != "" {
+			preset = append(preset, "request_id", id)
+		}
+		if ctx.routePattern != "" {
+			preset = append(preset, "route", ctx.routePattern)
+		}
+		keyvals = append(preset, keyvals...)
+	}
+	ctx.log = log.WithFields(keyvals...)
+	return ctx.log
+}
+
 // XSRFToken creates a xsrf token string and returns.
 // If specifiedExpiration is empty, the value in the configuration is used.
 func (ctx *Context) XSRFToken(specifiedExpiration ...int) string {
@@ -275,13 +400,22 @@ func (ctx *Context) DestroySession() {
 
 // Redirect replies to the request with a redirect to url,
 // which may be a path relative to the request path.
+// The optional flash messages are carried to the next request, see ctx.AddFlash.
 //
 // The provided status code should be in the 3xx range and is usually
 // StatusMovedPermanently, StatusFound or StatusSeeOther.
-func (ctx *Context) Redirect(status int, urlStr string) error {
+// If the config item `redirect_hosts` is set, the absolute url must be
+// on the request host or one of the hosts, which prevents the open redirects.
+func (ctx *Context) Redirect(status int, urlStr string, flashes ...string) error {
 	if status < http.StatusMultipleChoices || status > http.StatusPermanentRedirect {
 		return fmt.Errorf("The provided status code should be in the 3xx range and is usually 301, 302 or 303, yours: %d", status)
 	}
+	if err := ctx.checkRedirectHost(urlStr); err != nil {
+		return err
+	}
+	if len(flashes) > 0 {
+		ctx.AddFlash(flashes...)
+	}
 	http.Redirect(ctx.W, ctx.R, urlStr, status)
 	return nil
 }
@@ -394,7 +528,14 @@ func (ctx *Context) Next() {
 	//run the next
 	if ctx.pos < ctx.handlerChainLen {
 		if err := ctx.handlerChain[ctx.pos].Serve(ctx); err != nil {
-			global.errorFunc(ctx, err.Error(), http.StatusInternalServerError)
+			if err == ErrClientClosed || (err == context.Canceled && ctx.Canceled()) {
+				// the client is gone, so nothing is written
+				ctx.Stop()
+				return
+			}
+			// the committed response is not rendered again by the ErrorFunc
+			status, msg := handlerErrorResponse(ctx, err)
+			global.errorFunc(ctx, msg, status)
 			ctx.Stop()
 			return
 		}
@@ -406,9 +547,13 @@ func (ctx *Context) Next() {
 }
 
 func (ctx *Context) beforeWriteHeader() {
+	if ctx.W.status >= 400 {
+		ctx.discardBody()
+	}
 	if ctx._xsrfTokenReset {
 		ctx.SetSecureCookie(ctx.frame.config.XSRF.Key, "_xsrf", ctx._xsrfToken, ctx.xsrfExpire)
 	}
+	ctx.writeFlash()
 	if ctx.enableSession {
 		if ctx.curSession != nil {
 			ctx.curSession.SessionRelease(ctx.W)
@@ -417,6 +562,26 @@ func (ctx *Context) beforeWriteHeader() {
 	}
 }
 
+// discardBody discards the unread request body before an error response, such as the
+// rejection of a middleware, so that the body left on the wire does not poison the
+// keep-alive connection. If the body is larger than the config `max_drain_body_kb`,
+// the connection is closed after the response.
+// The body of the request with `Expect: 100-continue` is not read, so that 100 Continue
+// is never sent for the rejected request, and net/http closes the connection if needed.
+func (ctx *Context) discardBody() {
+	limit := ctx.frame.config.maxDrainBody
+	if limit <= 0 || ctx.R.ProtoMajor != 1 || ctx.R.Body == nil || ctx.R.Body == http.NoBody || ctx.R.ContentLength == 0 {
+		return
+	}
+	if strings.EqualFold(ctx.R.Header.Get(HeaderExpect), "100-continue") {
+		return
+	}
+	n, _ := io.CopyN(ioutil.Discard, ctx.R.Body, limit+1)
+	if n > limit {
+		ctx.W.Header().Set(HeaderConnection, "close")
+	}
+}
+
 // Stop just sets the .pos to 32766 in order to  not move to the next handlers(if any)
 func (ctx *Context) Stop() {
 	ctx.pos = stopExecutionposition
@@ -445,7 +610,7 @@ func (ctx *Context) recordBody() []byte {
 		if ctx.R.MultipartForm != nil {
 			v.File = ctx.R.MultipartForm.File
 		}
-		b, _ = json.Marshal(v)
+		b, _ = global.jsonCodec.Marshal(v)
 	} else {
 		b = ctx.LimitedBodyBytes()
 	}
@@ -461,7 +626,16 @@ func (ctx *Context) recordBody() []byte {
 
 func (frame *Framework) getContext(w http.ResponseWriter, r *http.Request) *Context {
 	ctx := frame.contextPool.Get().(*Context)
+	if limit := frame.config.maxRequestBody; limit > 0 && r.Body != nil && r.Body != http.NoBody {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
 	ctx.R = r
+	if frame.config.WriteTimeout > 0 {
+		var c context.Context
+		c, ctx.cancel = context.WithTimeout(r.Context(), frame.config.WriteTimeout)
+		ctx.R = r.WithContext(c)
+	}
+	frame.startStream(ctx)
 	ctx.W.reset(w)
 	ctx.data = make(map[interface{}]interface{})
 	if frame.config.PrintBody && !ctx.IsUpload() {
@@ -471,9 +645,17 @@ func (frame *Framework) getContext(w http.ResponseWriter, r *http.Request) *Cont
 }
 
 func (frame *Framework) putContext(ctx *Context) {
+	if ctx.stream != nil {
+		frame.endStream(ctx)
+		ctx.stream = nil
+	}
 	if ctx.R.Body != nil {
 		ctx.R.Body.Close()
 	}
+	// the temporary files of the uploads, even if not saved by the handler
+	if ctx.R.MultipartForm != nil {
+		ctx.R.MultipartForm.RemoveAll()
+	}
 	ctx.R = nil
 	ctx.W.writer = nil
 	ctx.limitedRequestBody = nil
@@ -481,5 +663,33 @@ func (frame *Framework) putContext(ctx *Context) {
 	ctx.queryParams = nil
 	ctx._xsrfToken = ""
 	ctx._xsrfTokenReset = false
+	ctx.csrf = nil
+	ctx.csrfToken = ""
+	ctx.i18n = nil
+	ctx.lang = ""
+	ctx.upstreamLatency = 0
+	ctx.hasGzipLevel = false
+	ctx.hasGzipMinLength = false
+	ctx.deferred = nil
+	ctx.routePattern = ""
+	ctx.staticRoute = false
+	ctx.apiVersion = ""
+	if ctx.cancel != nil {
+		ctx.cancel()
+		ctx.cancel = nil
+	}
+	ctx.span = nil
+	ctx.log = nil
+	ctx.originalMethod = ""
+	ctx.flashes = nil
+	ctx.flashRead = false
+	ctx.flashOut = nil
+	ctx.noAccessLog = false
+	ctx.accessLogSampler = nil
+	ctx.noCompress = false
+	ctx.tee = nil
+	ctx.variants = nil
+	ctx.bound = nil
+	ctx.boundAPI = nil
 	frame.contextPool.Put(ctx)
 }
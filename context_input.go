@@ -19,7 +19,6 @@ import (
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/base64"
-	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -66,6 +65,17 @@ func (ctx *Context) Path() string {
 	return ctx.R.URL.Path
 }
 
+// RoutePattern returns the pattern of the matched route, such as `/users/:id`,
+// whose constrained path parameters are written as `:name`.
+// Unlike the request path, it keeps the cardinality of the logging and metrics labels bounded.
+// It returns "" if no route is matched, or the route is a static file server.
+func (ctx *Context) RoutePattern() string {
+	if ctx.staticRoute {
+		return ""
+	}
+	return ctx.routePattern
+}
+
 // ModifyPath modifies the access path for the request.
 func (ctx *Context) ModifyPath(p string) {
 	ctx.R.URL.Path = p
@@ -185,6 +195,31 @@ func (ctx *Context) Method() string {
 	return ctx.R.Method
 }
 
+// OverrideMethod changes the request method, such as tunneling DELETE through POST.
+// It must be called in the filter before routing, and the original method is kept
+// for the access log.
+func (ctx *Context) OverrideMethod(method string) {
+	method = strings.ToUpper(method)
+	if method == ctx.R.Method {
+		return
+	}
+	if ctx.originalMethod == "" {
+		ctx.originalMethod = ctx.R.Method
+	} else if ctx.originalMethod == method {
+		ctx.originalMethod = ""
+	}
+	ctx.R.Method = method
+}
+
+// OriginalMethod returns the request method before overridden,
+// or the current one if it is not overridden.
+func (ctx *Context) OriginalMethod() string {
+	if ctx.originalMethod != "" {
+		return ctx.originalMethod
+	}
+	return ctx.R.Method
+}
+
 // Is returns boolean of this request is on given method, such as Is("POST").
 func (ctx *Context) Is(method string) bool {
 	return ctx.Method() == method
@@ -295,6 +330,17 @@ func (ctx *Context) Del(key interface{}) {
 	delete(ctx.data, key)
 }
 
+// SetClaims stores the verified claims of the request, such as the JWT claims,
+// which are bound to the fields of the handler tagged `in:jwt`.
+func (ctx *Context) SetClaims(claims map[string]interface{}) {
+	ctx.R = ctx.R.WithContext(apiware.WithClaims(ctx.R.Context(), claims))
+}
+
+// Claims returns the verified claims of the request, or nil.
+func (ctx *Context) Claims() map[string]interface{} {
+	return apiware.ClaimsFrom(ctx.R.Context())
+}
+
 // Param returns the first value for the kinds of parameters.
 // priority:
 // path parameters > POST and PUT body parameters > URL query string values > header > cookie.Value.
@@ -497,6 +543,20 @@ func (ctx *Context) SecureCookieParam(secret, key string) (string, bool) {
 	return BytesToString(res), true
 }
 
+// SignedCookie returns the value of the cookie set by SetSignedCookie.
+// If the cookie is missing or its signature is invalid, returns false.
+func (ctx *Context) SignedCookie(name string) (string, bool) {
+	val := ctx.CookieParam(name)
+	if val == "" {
+		return "", false
+	}
+	v, err := decodeSignedCookie(ctx.frame.config.CookieSecret, name, val)
+	if err != nil {
+		return "", false
+	}
+	return v, true
+}
+
 // FormFile returns the first file for the provided form key.
 // FormFile calls ParseMultipartForm and ParseForm if necessary.
 func (ctx *Context) FormFile(key string) (multipart.File, *multipart.FileHeader, error) {
@@ -527,9 +587,9 @@ type SavedFileInfo struct {
 	Size int64
 }
 
-// SaveFile saves the uploaded file to global.UploadDir(),
+// SaveFile saves the uploaded file to frame.UploadDir(),
 // character "?" indicates that the original file name.
-// for example newfname="a/?" -> global.UploadDir()/a/fname.
+// for example newfname="a/?" -> frame.UploadDir()/a/fname.
 func (ctx *Context) SaveFile(key string, cover bool, newfname ...string) (savedFileInfo SavedFileInfo, err error) {
 	f, fh, err := ctx.R.FormFile(key)
 	if err != nil {
@@ -548,16 +608,16 @@ func (ctx *Context) SaveFile(key string, cover bool, newfname ...string) (savedF
 	// Sets the full file name
 	var fullname string
 	if len(newfname) == 0 {
-		fullname = filepath.Join(UploadDir(), filename)
+		fullname = filepath.Join(ctx.frame.UploadDir(), filename)
 	} else {
 		if strings.Contains(newfname[0], "?") {
-			fullname = filepath.Join(UploadDir(), strings.Replace(newfname[0], "?", filename, -1))
+			fullname = filepath.Join(ctx.frame.UploadDir(), strings.Replace(newfname[0], "?", filename, -1))
 		} else {
 			fname := strings.TrimRight(newfname[0], ".")
 			if filepath.Ext(fname) == "" {
-				fullname = filepath.Join(UploadDir(), fname+filepath.Ext(filename))
+				fullname = filepath.Join(ctx.frame.UploadDir(), fname+filepath.Ext(filename))
 			} else {
-				fullname = filepath.Join(UploadDir(), fname)
+				fullname = filepath.Join(ctx.frame.UploadDir(), fname)
 			}
 		}
 	}
@@ -593,7 +653,7 @@ func (ctx *Context) SaveFile(key string, cover bool, newfname ...string) (savedF
 	return
 }
 
-// SaveFiles saves the uploaded files to global.UploadDir(),
+// SaveFiles saves the uploaded files to frame.UploadDir(),
 // it's similar to SaveFile, but for saving multiple files.
 func (ctx *Context) SaveFiles(key string, cover bool, newfname ...string) (savedFileInfos []SavedFileInfo, err error) {
 	if !ctx.HasFormFile(key) {
@@ -622,16 +682,16 @@ func (ctx *Context) SaveFiles(key string, cover bool, newfname ...string) (saved
 		// Sets the full file name
 		var fullname string
 		if !hasFilename {
-			fullname = filepath.Join(UploadDir(), filename)
+			fullname = filepath.Join(ctx.frame.UploadDir(), filename)
 		} else {
 			if strings.Contains(newfname[0], "?") {
-				fullname = filepath.Join(UploadDir(), strings.Replace(newfname[0], "?", filename, -1))
+				fullname = filepath.Join(ctx.frame.UploadDir(), strings.Replace(newfname[0], "?", filename, -1))
 			} else {
 				fname := strings.TrimRight(newfname[0], ".")
 				if filepath.Ext(fname) == "" {
-					fullname = filepath.Join(UploadDir(), fname+filepath.Ext(filename))
+					fullname = filepath.Join(ctx.frame.UploadDir(), fname+filepath.Ext(filename))
 				} else {
-					fullname = filepath.Join(UploadDir(), fname)
+					fullname = filepath.Join(ctx.frame.UploadDir(), fname)
 				}
 			}
 		}
@@ -711,13 +771,13 @@ func (ctx *Context) BindJSON(jsonObject interface{}) error {
 	rawData, _ := ioutil.ReadAll(ctx.R.Body)
 	// check if jsonObject is already a pointer, if yes then pass as it's
 	if reflect.TypeOf(jsonObject).Kind() == reflect.Ptr {
-		err := json.Unmarshal(rawData, jsonObject)
+		err := global.jsonCodec.Unmarshal(rawData, jsonObject)
 		if err != nil {
 			return err
 		}
 	}
 	// finally, if the jsonObject is not a pointer
-	return json.Unmarshal(rawData, &jsonObject)
+	return global.jsonCodec.Unmarshal(rawData, &jsonObject)
 }
 
 // BindXML reads XML from request's body
@@ -734,6 +794,50 @@ func (ctx *Context) BindXML(xmlObject interface{}) error {
 	return xml.Unmarshal(rawData, &xmlObject)
 }
 
+// BindInto binds the request params to the struct pointer `dest` and validates them,
+// just like the APIHandler does, using the same param tags, body decoders and validators.
+// Unlike the APIHandler, it does not respond with the BinderrorFunc,
+// but returns the error, which is usually BindErrors, for the caller to handle in its own way.
+// note: if `dest` implements Bodydecoder, its Decode method decodes the request body.
+func (ctx *Context) BindInto(dest interface{}) error {
+	paramsAPI, err := ctx.frame.bindingParamsAPI(dest)
+	if err != nil {
+		return err
+	}
+	return paramsAPI.BindAt(dest, ctx.R, ctx.pathParams)
+}
+
+// bindingParamsAPI returns the params API of the type of the struct pointer,
+// parsing and caching it in the frame on the first use, apart from the ones of the API handlers.
+func (frame *Framework) bindingParamsAPI(structPointer interface{}) (*apiware.ParamsAPI, error) {
+	t := reflect.TypeOf(structPointer)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("`*Context.BindInto` accepts only parameter of struct pointer type")
+	}
+	if paramsAPI, ok := frame.bindingAPIs.Load(t); ok {
+		return paramsAPI.(*apiware.ParamsAPI), nil
+	}
+	// parses a new object to keep the caller's one out of the cache
+	var obj = reflect.New(t.Elem()).Interface()
+	var bodydecoder = global.bodydecoder
+	d, hasDecoder := obj.(Bodydecoder)
+	if hasDecoder {
+		bodydecoder = d.Decode
+	}
+	paramsAPI, err := apiware.ParseParamsAPI(obj, global.paramNameMapper, bodydecoder, false)
+	if err != nil {
+		return nil, err
+	}
+	if !hasDecoder {
+		setProtobufBodydecoders(paramsAPI)
+	}
+	if paramsAPI.MaxMemory() == defaultMultipartMaxMemory {
+		paramsAPI.SetMaxMemory(frame.config.multipartMaxMemory)
+	}
+	actual, _ := frame.bindingAPIs.LoadOrStore(t, paramsAPI)
+	return actual.(*apiware.ParamsAPI), nil
+}
+
 // LimitedBodyBytes returns the raw request body data as bytes.
 // Note:
 //  1.limited by maximum length;
@@ -19,11 +19,15 @@ import (
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/base64"
-	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"html/template"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -204,6 +208,33 @@ func (ctx *Context) SetSecureCookie(secret, name, value string, others ...interf
 	ctx.SetCookie(name, cookie, others...)
 }
 
+// SetSignedCookie sets a cookie signed by the frame's cookie secret.
+// If opts.Encrypt is true, the value is also encrypted with AES-GCM.
+func (ctx *Context) SetSignedCookie(name, value string, opts ...CookieOptions) error {
+	var opt CookieOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	v, err := encodeSignedCookie(ctx.frame.config.CookieSecret, name, value, opt.Encrypt)
+	if err != nil {
+		return err
+	}
+	if opt.Path == "" {
+		opt.Path = "/"
+	}
+	ctx.W.AddCookie(&http.Cookie{
+		Name:     name,
+		Value:    v,
+		Path:     opt.Path,
+		Domain:   opt.Domain,
+		MaxAge:   opt.MaxAge,
+		Secure:   opt.Secure,
+		HttpOnly: opt.HttpOnly,
+		SameSite: opt.SameSite,
+	})
+	return nil
+}
+
 // NoContent sends a response with no body and a status code.
 func (ctx *Context) NoContent(status int) {
 	ctx.W.WriteHeader(status)
@@ -215,6 +246,49 @@ func (ctx *Context) Error(status int, errStr string) {
 	ctx.Stop()
 }
 
+// SetGzipLevel sets the compression level of the response, which overrides
+// the 'Gzip.CompressLevel' config for the body and the best compression for the files.
+// The level is from -2 (huffman only) to 9 (best compression).
+func (ctx *Context) SetGzipLevel(level int) {
+	if !acceptencoder.ValidLevel(level) {
+		ctx.Log().Warningf("SetGzipLevel: invalid compression level %d", level)
+		return
+	}
+	ctx.gzipLevel = level
+	ctx.hasGzipLevel = true
+}
+
+// SetGzipMinLength sets the minimum length of the response body to be compressed,
+// which overrides the 'Gzip.MinLength' config.
+func (ctx *Context) SetGzipMinLength(minLength int) {
+	ctx.gzipMinLength = minLength
+	ctx.hasGzipMinLength = true
+}
+
+// Compression creates the middleware overriding the gzip config of the route,
+// the compression level of the body and the files, and the minimum length of the body to be compressed,
+// such as the level 1 for the large JSON payloads to reduce CPU.
+// The level 0 disables the compression of the route, like the nocompress of the static routes.
+// The minLength < 0 means the 'Gzip.MinLength' config.
+//
+//	e.g. frame.GET("/export", faygo.Compression(1, 1024), exportHandler)
+func Compression(level int, minLength int) HandlerFunc {
+	if level != 0 && !acceptencoder.ValidLevel(level) {
+		Fatalf("Compression: invalid compression level %d", level)
+	}
+	return func(ctx *Context) error {
+		if level == 0 {
+			ctx.noCompress = true
+			return nil
+		}
+		ctx.SetGzipLevel(level)
+		if minLength >= 0 {
+			ctx.SetGzipMinLength(minLength)
+		}
+		return nil
+	}
+}
+
 // Bytes writes the data bytes to the connection as part of an HTTP reply.
 func (ctx *Context) Bytes(status int, contentType string, content []byte) error {
 	if ctx.W.committed {
@@ -222,22 +296,53 @@ func (ctx *Context) Bytes(status int, contentType string, content []byte) error
 		return nil
 	}
 	ctx.W.Header().Set(HeaderContentType, contentType)
-	if ctx.enableGzip && len(ctx.W.Header()[HeaderContentEncoding]) == 0 {
-		buf := &bytes.Buffer{}
-		ok, encoding, _ := acceptencoder.WriteBody(acceptencoder.ParseEncoding(ctx.R), buf, content)
-		if ok {
-			ctx.W.Header().Set(HeaderContentEncoding, encoding)
-			content = buf.Bytes()
-		}
-	}
+	content = ctx.compressBody(contentType, content)
 	ctx.W.Header().Set(HeaderContentLength, strconv.Itoa(len(content)))
 	ctx.W.WriteHeader(status)
 	_, err := ctx.W.Write(content)
 	return err
 }
 
-// String writes a string to the client, something like fmt.Fprintf
+// compressBody compresses the content and sets the Content-Encoding header
+// if the gzip is enabled and the client accepts it, otherwise returns the content as is.
+func (ctx *Context) compressBody(contentType string, content []byte) []byte {
+	if !ctx.enableGzip || ctx.noCompress || len(ctx.W.Header()[HeaderContentEncoding]) > 0 || !acceptencoder.Compressible(contentType) {
+		return content
+	}
+	buf := &bytes.Buffer{}
+	ok, encoding := ctx.writeBody(acceptencoder.ParseEncoding(ctx.R), buf, content)
+	if !ok {
+		return content
+	}
+	ctx.W.Header().Set(HeaderContentEncoding, encoding)
+	return buf.Bytes()
+}
+
+// writeBody compresses the content to buf by the encoding,
+// with the compression level and the minimum length of the route if they are set.
+func (ctx *Context) writeBody(encoding string, buf *bytes.Buffer, content []byte) (bool, string) {
+	level, minLength := acceptencoder.CompressLevel(), -1
+	if ctx.hasGzipLevel {
+		level = ctx.gzipLevel
+	}
+	if ctx.hasGzipMinLength {
+		minLength = ctx.gzipMinLength
+	}
+	ok, encoding, _ := acceptencoder.WriteBodyLevelMin(encoding, buf, content, level, minLength)
+	return ok, encoding
+}
+
+// ErrClientClosed is returned by the methods such as Context.JSON, Context.HTML and Context.String
+// instead of writing the response, when the client has disconnected.
+// If a handler returns it, the handler chain is stopped without writing an error page.
+var ErrClientClosed = errors.New("client closed the request")
+
+// String writes a string to the client, something like fmt.Fprintf.
+// Returns ErrClientClosed if the client has disconnected.
 func (ctx *Context) String(status int, format string, s ...interface{}) error {
+	if ctx.Canceled() {
+		return ErrClientClosed
+	}
 	if len(s) == 0 {
 		return ctx.Bytes(status, MIMETextPlainCharsetUTF8, []byte(format))
 	}
@@ -245,23 +350,23 @@ func (ctx *Context) String(status int, format string, s ...interface{}) error {
 }
 
 // HTML sends an HTTP response with status code.
+// Returns ErrClientClosed if the client has disconnected.
 func (ctx *Context) HTML(status int, html string) error {
+	if ctx.Canceled() {
+		return ErrClientClosed
+	}
 	x := (*[2]uintptr)(unsafe.Pointer(&html))
 	h := [3]uintptr{x[0], x[1], x[1]}
 	return ctx.Bytes(status, MIMETextHTMLCharsetUTF8, *(*[]byte)(unsafe.Pointer(&h)))
 }
 
 // JSON sends a JSON response with status code.
+// Returns ErrClientClosed without marshalling if the client has disconnected.
 func (ctx *Context) JSON(status int, data interface{}, isIndent ...bool) error {
-	var (
-		b   []byte
-		err error
-	)
-	if len(isIndent) > 0 && isIndent[0] {
-		b, err = json.MarshalIndent(data, "", "  ")
-	} else {
-		b, err = json.Marshal(data)
+	if ctx.Canceled() {
+		return ErrClientClosed
 	}
+	b, err := marshalJSON(data, isIndent)
 	if err != nil {
 		return err
 	}
@@ -273,44 +378,156 @@ func (ctx *Context) JSONBlob(status int, b []byte) error {
 	return ctx.Bytes(status, MIMEApplicationJSONCharsetUTF8, b)
 }
 
+// JSONStream sends a JSON array response with status code, whose elements are received from ch
+// and written incrementally, so that the large result set is never held in memory.
+// The pending elements are flushed whenever ch has none ready, and are compressed in streaming
+// if gzip is enabled and the client accepts it.
+// It returns when ch is closed, or with the context error when the client disconnects,
+// so the producer should also stop on ctx.Context().Done().
+// If an element fails to be encoded, the error is returned and the array is left unterminated,
+// so that the client can tell the response is truncated.
+//
+//	ch := make(chan interface{})
+//	go func() {
+//		defer close(ch)
+//		for rows.Next() {
+//			select {
+//			case ch <- scanRow(rows):
+//			case <-ctx.Context().Done():
+//				return
+//			}
+//		}
+//	}()
+//	return ctx.JSONStream(200, ch)
+func (ctx *Context) JSONStream(status int, ch <-chan interface{}) error {
+	if ctx.W.committed {
+		ctx.W.multiCommitted()
+		return nil
+	}
+	ctx.W.Header().Set(HeaderContentType, MIMEApplicationJSONCharsetUTF8)
+	ctx.W.Header().Del(HeaderContentLength)
+	var (
+		w     io.Writer = ctx.W
+		flush           = ctx.W.Flush
+	)
+	if sw := ctx.newStreamWriter(MIMEApplicationJSONCharsetUTF8); sw != nil {
+		defer sw.Close()
+		w = sw
+		flush = func() {
+			sw.Flush()
+			ctx.W.Flush()
+		}
+	}
+	ctx.W.WriteHeader(status)
+	done := ctx.R.Context().Done()
+	if _, err := w.Write([]byte{'['}); err != nil {
+		return err
+	}
+	for n := 0; ; n++ {
+		var (
+			v  interface{}
+			ok bool
+		)
+		select {
+		case v, ok = <-ch:
+		case <-done:
+			return ctx.R.Context().Err()
+		default:
+			// flushes the pending elements before waiting for the next one
+			flush()
+			select {
+			case v, ok = <-ch:
+			case <-done:
+				return ctx.R.Context().Err()
+			}
+		}
+		if !ok {
+			break
+		}
+		b, err := global.jsonCodec.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			if _, err = w.Write([]byte{','}); err != nil {
+				return err
+			}
+		}
+		if _, err = w.Write(b); err != nil {
+			return err
+		}
+	}
+	if _, err := w.Write([]byte{']'}); err != nil {
+		return err
+	}
+	if sw, ok := w.(acceptencoder.StreamWriter); ok {
+		if err := sw.Close(); err != nil {
+			return err
+		}
+	}
+	ctx.W.Flush()
+	return nil
+}
+
+// newStreamWriter returns the compressing writer of the response and sets the Content-Encoding header,
+// if the gzip is enabled and the client accepts it, otherwise returns nil.
+func (ctx *Context) newStreamWriter(contentType string) acceptencoder.StreamWriter {
+	if !ctx.enableGzip || ctx.noCompress || len(ctx.W.Header()[HeaderContentEncoding]) > 0 || !acceptencoder.Compressible(contentType) {
+		return nil
+	}
+	encoding := acceptencoder.ParseEncoding(ctx.R)
+	if encoding == "" {
+		return nil
+	}
+	level := acceptencoder.CompressLevel()
+	if ctx.hasGzipLevel {
+		level = ctx.gzipLevel
+	}
+	sw, ok := acceptencoder.NewStreamWriter(encoding, ctx.W, level)
+	if !ok {
+		return nil
+	}
+	ctx.W.Header().Set(HeaderContentEncoding, encoding)
+	ctx.W.Header().Add(HeaderVary, HeaderAcceptEncoding)
+	return sw
+}
+
+// ErrInvalidJSONPCallback is returned by JSONP if the callback is not a valid JavaScript identifier.
+var ErrInvalidJSONPCallback = errors.New("invalid JSONP callback")
+
+// jsonpCallback matches the JavaScript identifiers separated by dots, such as `jQuery123.cb`.
+var jsonpCallback = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$]*(\.[a-zA-Z_$][a-zA-Z0-9_$]*)*$`)
+
 // JSONP sends a JSONP response with status code. It uses `callback` to construct
 // the JSONP payload.
+// The callback must be the JavaScript identifiers separated by dots, such as `jQuery123.cb`,
+// otherwise ErrInvalidJSONPCallback is returned without sending anything,
+// so that the callback from the query can not inject the script.
 func (ctx *Context) JSONP(status int, callback string, data interface{}, isIndent ...bool) error {
-	var (
-		b   []byte
-		err error
-	)
-	if len(isIndent) > 0 && isIndent[0] {
-		b, err = json.MarshalIndent(data, "", "  ")
-	} else {
-		b, err = json.Marshal(data)
+	if len(callback) > 128 || !jsonpCallback.MatchString(callback) {
+		return ErrInvalidJSONPCallback
 	}
+	b, err := marshalJSON(data, isIndent)
 	if err != nil {
 		return err
 	}
-	callback = template.JSEscapeString(callback)
-	callbackContent := bytes.NewBufferString(" if(window." + callback + ")" + callback)
+	// U+2028 and U+2029 are valid in JSON but terminate the line in old JavaScript engines
+	b = bytes.Replace(b, []byte("\u2028"), []byte("\\u2028"), -1)
+	b = bytes.Replace(b, []byte("\u2029"), []byte("\\u2029"), -1)
+	callbackContent := bytes.NewBufferString("/**/ if(window." + callback + ")" + callback)
 	callbackContent.WriteString("(")
 	callbackContent.Write(b)
 	callbackContent.WriteString(");\r\n")
+	ctx.W.Header().Set(HeaderXContentTypeOptions, nosniff)
 	return ctx.Bytes(status, MIMEApplicationJavaScriptCharsetUTF8, callbackContent.Bytes())
 }
 
 // JSONMsg sends a JSON with JSONMsg format.
 func (ctx *Context) JSONMsg(status int, msgcode int, info interface{}, isIndent ...bool) error {
-	var (
-		b    []byte
-		err  error
-		data = JSONMsg{
-			Code: msgcode,
-			Info: info,
-		}
-	)
-	if len(isIndent) > 0 && isIndent[0] {
-		b, err = json.MarshalIndent(data, "", "  ")
-	} else {
-		b, err = json.Marshal(data)
-	}
+	b, err := marshalJSON(JSONMsg{
+		Code: msgcode,
+		Info: info,
+	}, isIndent)
 	if err != nil {
 		return err
 	}
@@ -355,9 +572,9 @@ func (ctx *Context) File(localFilename string, showFilename ...string) {
 	ctx.W.Header().Set(HeaderContentDescription, "File Transfer")
 	ctx.W.Header().Set(HeaderContentType, MIMEOctetStream)
 	if len(showFilename) > 0 && showFilename[0] != "" {
-		ctx.W.Header().Set(HeaderContentDisposition, "attachment; filename="+showFilename[0])
+		ctx.W.Header().Set(HeaderContentDisposition, contentDisposition("attachment", showFilename[0]))
 	} else {
-		ctx.W.Header().Set(HeaderContentDisposition, "attachment; filename="+filepath.Base(localFilename))
+		ctx.W.Header().Set(HeaderContentDisposition, contentDisposition("attachment", filepath.Base(localFilename)))
 	}
 	ctx.W.Header().Set(HeaderContentTransferEncoding, "binary")
 	ctx.W.Header().Set(HeaderExpires, "0")
@@ -366,9 +583,199 @@ func (ctx *Context) File(localFilename string, showFilename ...string) {
 	global.fsManager.ServeFile(ctx, localFilename)
 }
 
+// Attachment sends the local file as an attachment to be downloaded and saved locally,
+// with range support. If downloadName is empty, the base name of the file is used.
+func (ctx *Context) Attachment(localFilename, downloadName string) {
+	ctx.serveDisposition("attachment", localFilename, downloadName)
+}
+
+// Inline sends the local file to be displayed inline in the browser,
+// with range support. If name is empty, the base name of the file is used.
+func (ctx *Context) Inline(localFilename, name string) {
+	ctx.serveDisposition("inline", localFilename, name)
+}
+
+// AttachmentReader streams the content of the reader as an attachment to be downloaded and saved locally,
+// such as a generated CSV export, without buffering it. If contentType is empty,
+// it is deduced from the extension of the filename.
+// The io.ReadSeeker, such as *os.File, is served with the length and range support like ServeContent,
+// and the Content-Length of the other readers is set if they have the Len method, such as *bytes.Buffer.
+// Returns ErrClientClosed if the client has disconnected.
+// To send the local file, use Attachment instead.
+func (ctx *Context) AttachmentReader(r io.Reader, filename, contentType string) error {
+	if ctx.Canceled() {
+		return ErrClientClosed
+	}
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(filename))
+		if contentType == "" {
+			contentType = MIMEOctetStream
+		}
+	}
+	h := ctx.W.Header()
+	h.Set(HeaderContentDisposition, contentDisposition("attachment", filename))
+	h.Set(HeaderContentType, contentType)
+	if rs, ok := r.(io.ReadSeeker); ok {
+		global.fsManager.ServeContent(ctx, filename, time.Time{}, rs)
+		return nil
+	}
+	if l, ok := r.(interface{ Len() int }); ok {
+		h.Set(HeaderContentLength, strconv.Itoa(l.Len()))
+	}
+	ctx.W.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(ctx.W, contextReader{Reader: r, ctx: ctx.R.Context()}); err != nil {
+		if ctx.Canceled() {
+			return ErrClientClosed
+		}
+		return err
+	}
+	return nil
+}
+
+func (ctx *Context) serveDisposition(typ, localFilename, name string) {
+	if name == "" {
+		name = filepath.Base(localFilename)
+	}
+	ctx.W.Header().Set(HeaderContentDisposition, contentDisposition(typ, name))
+	global.fsManager.ServeFile(ctx, localFilename)
+}
+
+// ServeContent replies to the request using the content in the provided ReadSeeker,
+// like http.ServeContent, it handles Range, If-Match, If-Unmodified-Since,
+// If-None-Match, If-Modified-Since and If-Range requests.
+// The name is only used to deduce the Content-Type.
+// If the gzip is enabled and it is not a range request, the content is compressed.
+func (ctx *Context) ServeContent(name string, modtime time.Time, content io.ReadSeeker) {
+	encoding := acceptencoder.ParseEncoding(ctx.R)
+	if !ctx.enableGzip || ctx.noCompress || encoding == "" || ctx.R.Header.Get(HeaderRange) != "" ||
+		len(ctx.W.Header()[HeaderContentEncoding]) > 0 {
+		global.fsManager.ServeContent(ctx, name, modtime, content)
+		return
+	}
+	b, err := ioutil.ReadAll(content)
+	if err != nil {
+		global.errorFunc(ctx, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, haveType := ctx.W.Header()[HeaderContentType]; !haveType {
+		ctype := mime.TypeByExtension(filepath.Ext(name))
+		if ctype == "" {
+			ctype = http.DetectContentType(b)
+		}
+		ctx.W.Header().Set(HeaderContentType, ctype)
+	}
+	if !acceptencoder.Compressible(ctx.W.Header().Get(HeaderContentType)) {
+		global.fsManager.ServeContent(ctx, name, modtime, bytes.NewReader(b))
+		return
+	}
+	buf := &bytes.Buffer{}
+	var ok bool
+	ok, encoding = ctx.writeBody(encoding, buf, b)
+	if ok {
+		ctx.W.Header().Set(HeaderContentEncoding, encoding)
+		ctx.W.Header().Add(HeaderVary, HeaderAcceptEncoding)
+		b = buf.Bytes()
+	}
+	global.fsManager.ServeContent(ctx, name, modtime, bytes.NewReader(b))
+}
+
+// contentDisposition returns the Content-Disposition header value,
+// the non-ASCII filename is encoded as RFC 5987.
+func contentDisposition(typ, filename string) string {
+	var ascii = true
+	for i := 0; i < len(filename); i++ {
+		if c := filename[i]; c < 0x20 || c > 0x7e {
+			ascii = false
+			break
+		}
+	}
+	quoted := strings.NewReplacer("\\", "\\\\", `"`, `\"`).Replace(filename)
+	if ascii {
+		return typ + `; filename="` + quoted + `"`
+	}
+	var fallback, encoded bytes.Buffer
+	for _, r := range quoted {
+		if r < 0x20 || r > 0x7e {
+			fallback.WriteByte('_')
+		} else {
+			fallback.WriteRune(r)
+		}
+	}
+	for i := 0; i < len(filename); i++ {
+		c := filename[i]
+		if isRFC5987AttrChar(c) {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return typ + `; filename="` + fallback.String() + `"; filename*=UTF-8''` + encoded.String()
+}
+
+func isRFC5987AttrChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) != -1
+}
+
+// renderData returns a copy of the data with the request-scoped template functions and variables,
+// which are url_for and flashes, csrf_token and csrf_field if the CSRF middleware is used,
+// and lang and tr if the i18n middleware is used.
+// The ones with the same names in the data are not overridden, and the data is not modified.
+func (ctx *Context) renderData(src Map) Map {
+	data := make(Map, len(src)+6)
+	for k, v := range src {
+		data[k] = v
+	}
+	if _, ok := data["url_for"]; !ok {
+		data["url_for"] = ctx.URLFor
+	}
+	if _, ok := data["flashes"]; !ok {
+		data["flashes"] = ctx.Flash
+	}
+	if ctx.csrf != nil {
+		if _, ok := data["csrf_token"]; !ok {
+			data["csrf_token"] = ctx.csrfToken
+		}
+		if _, ok := data["csrf_field"]; !ok {
+			data["csrf_field"] = ctx.CSRFFieldHTML
+		}
+	}
+	if ctx.i18n != nil {
+		if _, ok := data["lang"]; !ok {
+			data["lang"] = ctx.lang
+		}
+		if _, ok := data["tr"]; !ok {
+			data["tr"] = ctx.Tr
+		}
+	}
+	return data
+}
+
 // Render renders a template with data and sends a text/html response with status code.
 func (ctx *Context) Render(status int, name string, data Map) error {
-	b, err := global.render.Render(name, data)
+	b, err := global.render.Render(name, ctx.renderData(data))
+	if err != nil {
+		return err
+	}
+	return ctx.Bytes(status, MIMETextHTMLCharsetUTF8, b)
+}
+
+// Fragment renders the template without the layout and sends a text/html response with status code,
+// such as the HTML fragment returned to HTMX.
+// It is the same as Render, which never applies the default layout set by SetLayout
+// nor sets the caching headers, and only names the intent of the handlers of the partial pages.
+// The template error is returned with the file and line, and nothing is written.
+func (ctx *Context) Fragment(status int, name string, data Map) error {
+	return ctx.Render(status, name, data)
+}
+
+// RenderWithLayout renders the template into the layout with data and sends a text/html response with status code.
+// If the layout is empty, the default layout set by `faygo.GetRender().SetLayout` is used.
+func (ctx *Context) RenderWithLayout(status int, layout, name string, data Map) error {
+	b, err := global.render.RenderWithLayout(layout, name, ctx.renderData(data))
 	if err != nil {
 		return err
 	}
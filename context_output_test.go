@@ -0,0 +1,237 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContentDisposition(t *testing.T) {
+	cases := []struct{ typ, name, want string }{
+		{"attachment", "report.pdf", `attachment; filename="report.pdf"`},
+		{"inline", `a "b".txt`, `inline; filename="a \"b\".txt"`},
+		{"attachment", "résumé.pdf", `attachment; filename="r_sum_.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf`},
+	}
+	for _, c := range cases {
+		if got := contentDisposition(c.typ, c.name); got != c.want {
+			t.Errorf("contentDisposition(%q, %q) = %q, want %q", c.typ, c.name, got, c.want)
+		}
+	}
+}
+
+func TestAttachmentRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faygo_attachment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "data.bin")
+	if err = ioutil.WriteFile(filename, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	frame := newTestFrame(t, "attachment_range_test")
+	var size int64
+	frame.GET("/download", HandlerFunc(func(ctx *Context) error {
+		ctx.Attachment(filename, "数据.bin")
+		size = ctx.Size()
+		return nil
+	}))
+	req := httptest.NewRequest("GET", "/download", nil)
+	req.Header.Set(HeaderRange, "bytes=2-5")
+	rec := serveTest(frame, req)
+	if rec.Code != 206 || rec.Body.String() != "2345" {
+		t.Fatalf("got %d %q, want 206 \"2345\"", rec.Code, rec.Body.String())
+	}
+	if size != 4 {
+		t.Fatalf("sent size: got %d, want 4", size)
+	}
+	if want := `attachment; filename="__.bin"; filename*=UTF-8''%E6%95%B0%E6%8D%AE.bin`; rec.Header().Get(HeaderContentDisposition) != want {
+		t.Fatalf("Content-Disposition: got %q, want %q", rec.Header().Get(HeaderContentDisposition), want)
+	}
+}
+
+func TestAttachmentReader(t *testing.T) {
+	frame := newTestFrame(t, "attachment_reader_test")
+	frame.GET("/export", HandlerFunc(func(ctx *Context) error {
+		// a pipe has neither the length nor the seeker
+		pr, pw := io.Pipe()
+		go func() {
+			for i := 0; i < 3; i++ {
+				fmt.Fprintf(pw, "row%d\n", i)
+			}
+			pw.Close()
+		}()
+		return ctx.AttachmentReader(pr, "報表.csv", "")
+	}))
+	frame.GET("/buffer", HandlerFunc(func(ctx *Context) error {
+		return ctx.AttachmentReader(bytes.NewBufferString("a,b\n"), "data.csv", "text/csv; charset=utf-8")
+	}))
+	frame.GET("/seeker", HandlerFunc(func(ctx *Context) error {
+		return ctx.AttachmentReader(strings.NewReader("0123456789"), "data.bin", "")
+	}))
+
+	rec := serveTest(frame, httptest.NewRequest("GET", "/export", nil))
+	if rec.Code != 200 || rec.Body.String() != "row0\nrow1\nrow2\n" {
+		t.Fatalf("export: got %d %q", rec.Code, rec.Body.String())
+	}
+	if want := `attachment; filename="__.csv"; filename*=UTF-8''%E5%A0%B1%E8%A1%A8.csv`; rec.Header().Get(HeaderContentDisposition) != want {
+		t.Fatalf("Content-Disposition: got %q, want %q", rec.Header().Get(HeaderContentDisposition), want)
+	}
+	if ct := rec.Header().Get(HeaderContentType); !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("Content-Type: got %q", ct)
+	}
+
+	rec = serveTest(frame, httptest.NewRequest("GET", "/buffer", nil))
+	if rec.Body.String() != "a,b\n" || rec.Header().Get(HeaderContentLength) != "4" ||
+		rec.Header().Get(HeaderContentType) != "text/csv; charset=utf-8" {
+		t.Fatalf("buffer: got %q %v", rec.Body.String(), rec.Header())
+	}
+
+	req := httptest.NewRequest("GET", "/seeker", nil)
+	req.Header.Set(HeaderRange, "bytes=2-5")
+	rec = serveTest(frame, req)
+	if rec.Code != 206 || rec.Body.String() != "2345" {
+		t.Fatalf("seeker: got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCompression(t *testing.T) {
+	enableGzip := global.config.Gzip.Enable
+	global.config.Gzip.Enable = true
+	defer func() { global.config.Gzip.Enable = enableGzip }()
+	frame := newTestFrame(t, "compression_test")
+	body := strings.Repeat("faygo compression ", 10)
+	handler := HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, body)
+	})
+	frame.GET("/default", handler)
+	frame.GET("/off", Compression(0, -1), handler)
+	frame.GET("/min", Compression(1, len(body)+1), handler)
+	frame.GET("/fast", Compression(1, 1), handler)
+	cases := map[string]string{
+		"/default": "gzip",
+		"/off":     "",
+		"/min":     "",
+		"/fast":    "gzip",
+	}
+	for path, want := range cases {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(HeaderAcceptEncoding, "gzip")
+		rec := serveTest(frame, req)
+		if got := rec.Header().Get(HeaderContentEncoding); got != want {
+			t.Errorf("%s: Content-Encoding = %q, want %q", path, got, want)
+		}
+		if want == "" && rec.Body.String() != body {
+			t.Errorf("%s: body = %q, want %q", path, rec.Body.String(), body)
+		}
+	}
+}
+
+func TestJSONStream(t *testing.T) {
+	enableGzip := global.config.Gzip.Enable
+	global.config.Gzip.Enable = true
+	defer func() { global.config.Gzip.Enable = enableGzip }()
+	frame := newTestFrame(t, "json_stream_test")
+	frame.GET("/items", HandlerFunc(func(ctx *Context) error {
+		ch := make(chan interface{})
+		go func() {
+			defer close(ch)
+			for i := 0; i < 1000; i++ {
+				select {
+				case ch <- Map{"id": i}:
+				case <-ctx.Context().Done():
+					return
+				}
+			}
+		}()
+		return ctx.JSONStream(200, ch)
+	}))
+	c, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	frame.GET("/blocked", HandlerFunc(func(ctx *Context) error {
+		ch := make(chan interface{})
+		go func() {
+			ch <- 1
+			cancel()
+		}()
+		err := ctx.JSONStream(200, ch)
+		errCh <- err
+		return err
+	}))
+	for _, encoding := range []string{"", "gzip"} {
+		req := httptest.NewRequest("GET", "/items", nil)
+		req.Header.Set(HeaderAcceptEncoding, encoding)
+		rec := serveTest(frame, req)
+		if rec.Code != 200 || rec.Header().Get(HeaderContentEncoding) != encoding || rec.Header().Get(HeaderContentLength) != "" {
+			t.Fatalf("%q: got %d %v", encoding, rec.Code, rec.Header())
+		}
+		var body io.Reader = rec.Body
+		if encoding == "gzip" {
+			r, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = r
+		}
+		var items []struct{ ID int }
+		if err := json.NewDecoder(body).Decode(&items); err != nil {
+			t.Fatalf("%q: %v", encoding, err)
+		}
+		if len(items) != 1000 || items[999].ID != 999 {
+			t.Fatalf("%q: got %d items", encoding, len(items))
+		}
+	}
+
+	// the client disconnects while the producer is blocked
+	rec := serveTest(frame, httptest.NewRequest("GET", "/blocked", nil).WithContext(c))
+	if err := <-errCh; err != context.Canceled || rec.Body.String() != "[1" {
+		t.Fatalf("got %v %q, want the context error and the unterminated array", err, rec.Body.String())
+	}
+}
+
+func TestJSONP(t *testing.T) {
+	frame := newTestFrame(t, "jsonp_test")
+	var err error
+	frame.GET("/jsonp", HandlerFunc(func(ctx *Context) error {
+		err = ctx.JSONP(200, ctx.QueryParam("callback"), Map{"a": "<\u2028>"})
+		return nil
+	}))
+	rec := serveTest(frame, httptest.NewRequest("GET", "/jsonp?callback=jQuery_1.cb$", nil))
+	want := "/**/ if(window.jQuery_1.cb$)jQuery_1.cb$({\"a\":\"\\u003c\\u2028\\u003e\"});\r\n"
+	if err != nil || rec.Body.String() != want {
+		t.Fatalf("got %v %q, want %q", err, rec.Body.String(), want)
+	}
+	if rec.Header().Get(HeaderContentType) != MIMEApplicationJavaScriptCharsetUTF8 || rec.Header().Get(HeaderXContentTypeOptions) != "nosniff" {
+		t.Fatalf("headers: %v", rec.Header())
+	}
+	for _, callback := range []string{"", "alert(1)//", "a..b", "1a", "a.b;c", strings.Repeat("a", 129)} {
+		rec = serveTest(frame, httptest.NewRequest("GET", "/jsonp?callback="+url.QueryEscape(callback), nil))
+		if err != ErrInvalidJSONPCallback || rec.Body.Len() != 0 {
+			t.Fatalf("%q: got %v %q", callback, err, rec.Body.String())
+		}
+	}
+}
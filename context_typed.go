@@ -0,0 +1,204 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// ErrParamMissing is returned by the typed param getters with the `E` suffix,
+// when the param is not present or empty.
+var ErrParamMissing = errors.New("param is missing")
+
+// QueryInt returns the first query value associated with the given key as int,
+// or def if it is not present or not a valid integer.
+func (ctx *Context) QueryInt(key string, def int) int {
+	if i, err := ctx.QueryIntE(key); err == nil {
+		return i
+	}
+	return def
+}
+
+// QueryIntE returns the first query value associated with the given key as int,
+// or ErrParamMissing if it is not present, or the parsing error.
+func (ctx *Context) QueryIntE(key string) (int, error) {
+	return parseIntParam(ctx.QueryParam(key))
+}
+
+// QueryBool returns the first query value associated with the given key as bool,
+// or def if it is not present or not a valid boolean.
+// It accepts 1, t, T, TRUE, true, True, on, yes, 0, f, F, FALSE, false, False, off and no.
+func (ctx *Context) QueryBool(key string, def bool) bool {
+	if b, err := ctx.QueryBoolE(key); err == nil {
+		return b
+	}
+	return def
+}
+
+// QueryBoolE returns the first query value associated with the given key as bool,
+// or ErrParamMissing if it is not present, or the parsing error.
+func (ctx *Context) QueryBoolE(key string) (bool, error) {
+	return parseBoolParam(ctx.QueryParam(key))
+}
+
+// QueryFloat returns the first query value associated with the given key as float64,
+// or def if it is not present or not a valid number.
+func (ctx *Context) QueryFloat(key string, def float64) float64 {
+	if f, err := ctx.QueryFloatE(key); err == nil {
+		return f
+	}
+	return def
+}
+
+// QueryFloatE returns the first query value associated with the given key as float64,
+// or ErrParamMissing if it is not present, or the parsing error.
+func (ctx *Context) QueryFloatE(key string) (float64, error) {
+	return parseFloatParam(ctx.QueryParam(key))
+}
+
+// QueryTime returns the first query value associated with the given key as time.Time parsed by the layout,
+// or def if it is not present or not a valid time.
+// If layout is empty, time.RFC3339 is used.
+func (ctx *Context) QueryTime(key, layout string, def time.Time) time.Time {
+	if t, err := ctx.QueryTimeE(key, layout); err == nil {
+		return t
+	}
+	return def
+}
+
+// QueryTimeE returns the first query value associated with the given key as time.Time parsed by the layout,
+// or ErrParamMissing if it is not present, or the parsing error.
+// If layout is empty, time.RFC3339 is used.
+func (ctx *Context) QueryTimeE(key, layout string) (time.Time, error) {
+	return parseTimeParam(ctx.QueryParam(key), layout)
+}
+
+// QueryStrings returns all the query values of the repeated key, e.g. ?tag=a&tag=b,
+// or def if there is none.
+func (ctx *Context) QueryStrings(key string, def ...string) []string {
+	if values := ctx.QueryParams(key); len(values) > 0 {
+		return values
+	}
+	return def
+}
+
+// FormInt returns the first form value associated with the given key as int,
+// or def if it is not present or not a valid integer.
+func (ctx *Context) FormInt(key string, def int) int {
+	if i, err := ctx.FormIntE(key); err == nil {
+		return i
+	}
+	return def
+}
+
+// FormIntE returns the first form value associated with the given key as int,
+// or ErrParamMissing if it is not present, or the parsing error.
+func (ctx *Context) FormIntE(key string) (int, error) {
+	return parseIntParam(ctx.FormParam(key))
+}
+
+// FormBool returns the first form value associated with the given key as bool,
+// or def if it is not present or not a valid boolean.
+// It accepts the same values as QueryBool, such as `on` sent by the checkboxes.
+func (ctx *Context) FormBool(key string, def bool) bool {
+	if b, err := ctx.FormBoolE(key); err == nil {
+		return b
+	}
+	return def
+}
+
+// FormBoolE returns the first form value associated with the given key as bool,
+// or ErrParamMissing if it is not present, or the parsing error.
+func (ctx *Context) FormBoolE(key string) (bool, error) {
+	return parseBoolParam(ctx.FormParam(key))
+}
+
+// FormFloat returns the first form value associated with the given key as float64,
+// or def if it is not present or not a valid number.
+func (ctx *Context) FormFloat(key string, def float64) float64 {
+	if f, err := ctx.FormFloatE(key); err == nil {
+		return f
+	}
+	return def
+}
+
+// FormFloatE returns the first form value associated with the given key as float64,
+// or ErrParamMissing if it is not present, or the parsing error.
+func (ctx *Context) FormFloatE(key string) (float64, error) {
+	return parseFloatParam(ctx.FormParam(key))
+}
+
+// FormTime returns the first form value associated with the given key as time.Time parsed by the layout,
+// or def if it is not present or not a valid time.
+// If layout is empty, time.RFC3339 is used.
+func (ctx *Context) FormTime(key, layout string, def time.Time) time.Time {
+	if t, err := ctx.FormTimeE(key, layout); err == nil {
+		return t
+	}
+	return def
+}
+
+// FormTimeE returns the first form value associated with the given key as time.Time parsed by the layout,
+// or ErrParamMissing if it is not present, or the parsing error.
+// If layout is empty, time.RFC3339 is used.
+func (ctx *Context) FormTimeE(key, layout string) (time.Time, error) {
+	return parseTimeParam(ctx.FormParam(key), layout)
+}
+
+// FormStrings returns all the form values of the repeated key, or def if there is none.
+func (ctx *Context) FormStrings(key string, def ...string) []string {
+	if values := ctx.FormParams(key); len(values) > 0 {
+		return values
+	}
+	return def
+}
+
+func parseIntParam(s string) (int, error) {
+	if s == "" {
+		return 0, ErrParamMissing
+	}
+	return strconv.Atoi(s)
+}
+
+func parseBoolParam(s string) (bool, error) {
+	switch s {
+	case "":
+		return false, ErrParamMissing
+	case "on", "yes":
+		return true, nil
+	case "off", "no":
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
+
+func parseFloatParam(s string) (float64, error) {
+	if s == "" {
+		return 0, ErrParamMissing
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func parseTimeParam(s, layout string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, ErrParamMissing
+	}
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	return time.Parse(layout, s)
+}
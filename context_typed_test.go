@@ -0,0 +1,64 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTypedParams(t *testing.T) {
+	req := httptest.NewRequest("POST", "/?page=3&size=x&debug=on&ratio=0.5&since=2020-01-02&tag=a&tag=b",
+		strings.NewReader("limit=10&agree=true&price=9.9&at=2021-03-04T05:06:07Z&id=1&id=2"))
+	req.Header.Set(HeaderContentType, MIMEApplicationForm)
+	frame := newTestFrame(t, "typed_params_test")
+	ctx := frame.getContext(httptest.NewRecorder(), req)
+	defer frame.putContext(ctx)
+
+	if ctx.QueryInt("page", 1) != 3 || ctx.QueryInt("size", 20) != 20 || ctx.QueryInt("none", 5) != 5 {
+		t.Fatal("QueryInt")
+	}
+	if _, err := ctx.QueryIntE("none"); err != ErrParamMissing {
+		t.Fatalf("QueryIntE: got %v", err)
+	}
+	if _, err := ctx.QueryIntE("size"); err == nil || err == ErrParamMissing {
+		t.Fatalf("QueryIntE: got %v", err)
+	}
+	if !ctx.QueryBool("debug", false) || ctx.QueryFloat("ratio", 0) != 0.5 {
+		t.Fatal("QueryBool or QueryFloat")
+	}
+	if got := ctx.QueryTime("since", "2006-01-02", time.Time{}); !got.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("QueryTime: got %v", got)
+	}
+	if got := ctx.QueryStrings("tag"); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("QueryStrings: got %v", got)
+	}
+	if got := ctx.QueryStrings("none", "x"); !reflect.DeepEqual(got, []string{"x"}) {
+		t.Fatalf("QueryStrings default: got %v", got)
+	}
+
+	if ctx.FormInt("limit", 0) != 10 || ctx.FormInt("page", 7) != 7 || !ctx.FormBool("agree", false) || ctx.FormFloat("price", 0) != 9.9 {
+		t.Fatal("FormInt, FormBool or FormFloat")
+	}
+	if got, err := ctx.FormTimeE("at", ""); err != nil || !got.Equal(time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)) {
+		t.Fatalf("FormTimeE: got %v %v", got, err)
+	}
+	if got := ctx.FormStrings("id"); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Fatalf("FormStrings: got %v", got)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/henrylee2cn/faygo/apiware"
+)
+
+// Controller is the embedded marker of the controller, the `route` tag of which
+// specifies the routes of the action methods, separated by semicolons,
+// each is the method name, the HTTP method and the path relative to the controller prefix, e.g.
+//
+//	type UserController struct {
+//		faygo.Controller `route:"GetOne=GET /:id; PutOne=PUT /:id"`
+//		ID int64 `param:"<in:path> <name:id>"`
+//	}
+type Controller struct{}
+
+// controllerRouteTag is the struct tag of the controller action routes.
+const controllerRouteTag = "route"
+
+// controllerAction is the handler of a controller action method,
+// the controller value is bound per request, so its fields act as the bound params.
+type controllerAction struct {
+	paramsAPI *apiware.ParamsAPI
+	method    int
+}
+
+var (
+	_ Handler = new(controllerAction)
+	_ APIDoc  = new(controllerAction)
+)
+
+var controllerMethodPrefixes = []string{"Get", "Post", "Put", "Patch", "Delete", "Head", "Options"}
+
+// RouteController registers the exported action methods of the controller under the prefix.
+// The ctrl must be a struct pointer, and the action methods must be `func(*faygo.Context) error`.
+// The HTTP method and path are derived from the method name, e.g. GetUser is `GET /user`,
+// PostUserInfo is `POST /user_info`, Get is `GET /`,
+// or from the `route` tag of the embedded Controller marker.
+// The fields of the controller with `param` tags are bound per request like APIHandler,
+// but the path params are bound only for the routes containing them,
+// and the body and formData params are bound only for POST, PUT and PATCH.
+// Conflicting routes return an error, and nothing is registered.
+func (mux *MuxAPI) RouteController(prefix string, ctrl interface{}) (*MuxAPI, error) {
+	v := reflect.ValueOf(ctrl)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("RouteController: %T must be a struct pointer", ctrl)
+	}
+	structType := v.Elem().Type()
+	var bodydecoder = global.bodydecoder
+	h, hasDecoder := ctrl.(Bodydecoder)
+	if hasDecoder {
+		bodydecoder = h.Decode
+	}
+	paramsAPI, err := apiware.NewParamsAPI(ctrl, global.paramNameMapper, bodydecoder, !mux.frame.config.Router.NoDefaultParams)
+	if err != nil {
+		return nil, fmt.Errorf("RouteController: %s", err.Error())
+	}
+	if !hasDecoder {
+		setProtobufBodydecoders(paramsAPI)
+	}
+	if paramsAPI.MaxMemory() == defaultMultipartMaxMemory {
+		paramsAPI.SetMaxMemory(mux.frame.config.multipartMaxMemory)
+	}
+
+	tagRoutes, err := controllerRoutes(structType)
+	if err != nil {
+		return nil, fmt.Errorf("RouteController: %s: %s", structType.Name(), err.Error())
+	}
+
+	type action struct {
+		name, httpMethod, pattern string
+		handler                   *controllerAction
+	}
+	var (
+		actions []action
+		routes  = map[string]string{}
+		ctxType = reflect.TypeOf((*Context)(nil))
+		errType = reflect.TypeOf((*error)(nil)).Elem()
+	)
+	for i := 0; i < v.NumMethod(); i++ {
+		m := v.Type().Method(i)
+		if m.Type.NumIn() != 2 || m.Type.In(1) != ctxType || m.Type.NumOut() != 1 || m.Type.Out(0) != errType {
+			continue
+		}
+		var httpMethod, pattern string
+		if route, ok := tagRoutes[m.Name]; ok {
+			httpMethod, pattern = route[0], route[1]
+			delete(tagRoutes, m.Name)
+		} else if httpMethod, pattern, ok = controllerRoute(m.Name); !ok {
+			continue
+		}
+		key := httpMethod + " " + path2Key(joinPattern(prefix, pattern))
+		if other, ok := routes[key]; ok {
+			return nil, fmt.Errorf("RouteController: %s.%s and %s.%s conflict on route `%s %s`",
+				structType.Name(), other, structType.Name(), m.Name, httpMethod, joinPattern(prefix, pattern))
+		}
+		routes[key] = m.Name
+		fullPattern := joinPattern(mux.pattern, joinPattern(prefix, pattern))
+		actions = append(actions, action{
+			name:       m.Name,
+			httpMethod: httpMethod,
+			pattern:    pattern,
+			handler: &controllerAction{
+				paramsAPI: paramsAPI.Filter(func(param *apiware.Param) bool {
+					switch param.In() {
+					case "path":
+						return strings.Contains(fullPattern, "/:"+param.Name()) ||
+							strings.Contains(fullPattern, "/*"+param.Name())
+					case "body", "formData":
+						return httpMethod == "POST" || httpMethod == "PUT" || httpMethod == "PATCH"
+					}
+					return true
+				}),
+				method: i,
+			},
+		})
+	}
+	for name := range tagRoutes {
+		return nil, fmt.Errorf("RouteController: %s.%s in the route tag is not an action method", structType.Name(), name)
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i].name < actions[j].name })
+
+	group := mux.NamedGroup(structType.Name(), prefix)
+	for _, a := range actions {
+		group.NamedAPI(a.name, Methodset(a.httpMethod), a.pattern, a.handler)
+	}
+	return group, nil
+}
+
+// controllerRoutes parses the `route` tag of the embedded Controller marker.
+func controllerRoutes(structType reflect.Type) (map[string][2]string, error) {
+	routes := map[string][2]string{}
+	field, found := structType.FieldByName("Controller")
+	if !found || !field.Anonymous || field.Type != reflect.TypeOf(Controller{}) {
+		return routes, nil
+	}
+	for _, item := range strings.Split(field.Tag.Get(controllerRouteTag), ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		idx := strings.IndexByte(item, '=')
+		fields := strings.Fields(item[idx+1:])
+		if idx <= 0 || len(fields) != 2 {
+			return nil, fmt.Errorf("the route must be like `GetOne=GET /:id`, but got %q", item)
+		}
+		httpMethod := strings.ToUpper(fields[0])
+		if !isRESTfulMethod(httpMethod) {
+			return nil, fmt.Errorf("invalid HTTP method %q in route %q", fields[0], item)
+		}
+		routes[strings.TrimSpace(item[:idx])] = [2]string{httpMethod, fields[1]}
+	}
+	return routes, nil
+}
+
+// controllerRoute returns the HTTP method and the path derived from the action method name.
+func controllerRoute(methodName string) (httpMethod, pattern string, ok bool) {
+	for _, prefix := range controllerMethodPrefixes {
+		if !strings.HasPrefix(methodName, prefix) {
+			continue
+		}
+		rest := methodName[len(prefix):]
+		if rest != "" && !(rest[0] >= 'A' && rest[0] <= 'Z') {
+			// such as `Getaway`
+			continue
+		}
+		return strings.ToUpper(prefix), "/" + SnakeString(rest), true
+	}
+	return "", "", false
+}
+
+func isRESTfulMethod(method string) bool {
+	for _, m := range RESTfulMethodList {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// joinPattern joins the route patterns, keeping the trailing slash of the last one.
+func joinPattern(a, b string) string {
+	p := path.Join("/", a, b)
+	if strings.HasSuffix(b, "/") && p != "/" {
+		p += "/"
+	}
+	return p
+}
+
+// path2Key replaces the param names of the pattern, so that `/:id` and `/:uid` are the same route.
+func path2Key(pattern string) string {
+	segs := strings.Split(pattern, "/")
+	for i, seg := range segs {
+		if strings.HasPrefix(seg, ":") {
+			segs[i] = ":"
+		} else if strings.HasPrefix(seg, "*") {
+			segs[i] = "*"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// Serve binds a new controller and calls the action method.
+func (a *controllerAction) Serve(ctx *Context) error {
+	obj, err := a.paramsAPI.BindNew(ctx.R, ctx.pathParams)
+	if err != nil {
+		HandleBinderror(ctx, err)
+		ctx.Stop()
+		return nil
+	}
+	out := reflect.ValueOf(obj).Method(a.method).Call([]reflect.Value{reflect.ValueOf(ctx)})
+	err, _ = out[0].Interface().(error)
+	return err
+}
+
+// Doc returns the API's note, result or parameters information.
+func (a *controllerAction) Doc() Doc {
+	return (&apiHandler{paramsAPI: a.paramsAPI}).Doc()
+}
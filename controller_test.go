@@ -0,0 +1,80 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testController struct {
+	Controller `route:"GetOne=GET /:id"`
+	ID         int    `param:"<in:path> <name:id>"`
+	Name       string `param:"<in:query>"`
+	Body       string `param:"<in:body>"`
+}
+
+func (c *testController) Get(ctx *Context) error {
+	return ctx.String(200, "list "+c.Name)
+}
+
+func (c *testController) GetOne(ctx *Context) error {
+	return ctx.String(200, "one "+ctx.PathParam("id")+" "+c.Name)
+}
+
+func (c *testController) PostItemInfo(ctx *Context) error {
+	return ctx.String(200, "post "+c.Body)
+}
+
+// Helper is not an action.
+func (c *testController) Helper() {}
+
+func TestRouteController(t *testing.T) {
+	frame := newTestFrame(t, "route_controller_test")
+	if _, err := frame.RouteController("/items", &testController{Name: "default"}); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct{ method, url, body, want string }{
+		{"GET", "/items", "", "list default"},
+		{"GET", "/items/7?name=x", "", "one 7 x"},
+		{"POST", "/items/item_info", `"hello"`, "post hello"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.url, strings.NewReader(c.body))
+		if c.body != "" {
+			req.Header.Set(HeaderContentType, MIMEApplicationJSONCharsetUTF8)
+		}
+		w := serveTest(frame, req)
+		if got := w.Body.String(); got != c.want {
+			t.Errorf("%s %s: got %q (%d), want %q", c.method, c.url, got, w.Code, c.want)
+		}
+	}
+}
+
+type conflictController struct {
+	Controller `route:"GetByID=GET /:id; GetByUID=GET /:uid"`
+}
+
+func (c *conflictController) GetByID(ctx *Context) error  { return nil }
+func (c *conflictController) GetByUID(ctx *Context) error { return nil }
+
+func TestRouteControllerConflict(t *testing.T) {
+	frame := newTestFrame(t, "route_controller_conflict_test")
+	_, err := frame.RouteController("/", &conflictController{})
+	if err == nil || !strings.Contains(err.Error(), "GetByID") || !strings.Contains(err.Error(), "GetByUID") {
+		t.Fatalf("expected a conflict error naming both methods, got %v", err)
+	}
+}
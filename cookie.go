@@ -0,0 +1,140 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// CookieOptions is the attributes of the cookie.
+type CookieOptions struct {
+	// Path of the cookie, default "/".
+	Path   string
+	Domain string
+	// MaxAge=0 means no 'Max-Age' attribute specified.
+	// MaxAge<0 means delete cookie now, equivalently 'Max-Age: 0'.
+	// MaxAge>0 means Max-Age attribute present and given in seconds.
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+	// If true, the value is encrypted with AES-GCM before signing.
+	Encrypt bool
+}
+
+// signed cookie value flags
+const (
+	cookiePlain     byte = '0'
+	cookieEncrypted byte = '1'
+)
+
+var errInvalidSignedCookie = errors.New("invalid signed cookie")
+
+// randomCookieSecret is shared by the frames without the config item `cookie_secret`,
+// so that the signed cookies, such as the flash messages, are valid across the frames.
+var randomCookieSecret = RandomString(32)
+
+// cookieKeys derives the signing key and the encryption key from the secret.
+func cookieKeys(secret string) (signKey, encKey []byte) {
+	h := sha256.Sum256([]byte("faygo-cookie-sign:" + secret))
+	e := sha256.Sum256([]byte("faygo-cookie-encrypt:" + secret))
+	return h[:], e[:]
+}
+
+// encodeSignedCookie returns `base64(flag+payload).base64(hmac(name+flag+payload))`.
+func encodeSignedCookie(secret, name, value string, encrypt bool) (string, error) {
+	signKey, encKey := cookieKeys(secret)
+	payload := []byte(value)
+	flag := cookiePlain
+	if encrypt {
+		gcm, err := newCookieGCM(encKey)
+		if err != nil {
+			return "", err
+		}
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+			return "", err
+		}
+		payload = gcm.Seal(nonce, nonce, payload, []byte(name))
+		flag = cookieEncrypted
+	}
+	data := append([]byte{flag}, payload...)
+	return base64.RawURLEncoding.EncodeToString(data) + "." +
+		base64.RawURLEncoding.EncodeToString(cookieMAC(signKey, name, data)), nil
+}
+
+// decodeSignedCookie verifies and decodes the value created by encodeSignedCookie.
+func decodeSignedCookie(secret, name, cookie string) (string, error) {
+	idx := strings.LastIndexByte(cookie, '.')
+	if idx == -1 {
+		return "", errInvalidSignedCookie
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cookie[:idx])
+	if err != nil || len(data) == 0 {
+		return "", errInvalidSignedCookie
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(cookie[idx+1:])
+	if err != nil {
+		return "", errInvalidSignedCookie
+	}
+	signKey, encKey := cookieKeys(secret)
+	if !hmac.Equal(sig, cookieMAC(signKey, name, data)) {
+		return "", errInvalidSignedCookie
+	}
+	switch data[0] {
+	case cookiePlain:
+		return string(data[1:]), nil
+	case cookieEncrypted:
+		gcm, err := newCookieGCM(encKey)
+		if err != nil {
+			return "", err
+		}
+		payload := data[1:]
+		if len(payload) < gcm.NonceSize() {
+			return "", errInvalidSignedCookie
+		}
+		plain, err := gcm.Open(nil, payload[:gcm.NonceSize()], payload[gcm.NonceSize():], []byte(name))
+		if err != nil {
+			return "", errInvalidSignedCookie
+		}
+		return string(plain), nil
+	}
+	return "", errInvalidSignedCookie
+}
+
+func cookieMAC(signKey []byte, name string, data []byte) []byte {
+	h := hmac.New(sha256.New, signKey)
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func newCookieGCM(encKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSignedCookie(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		v, err := encodeSignedCookie("secret", "uid", "a|b;c=d", encrypt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := decodeSignedCookie("secret", "uid", v)
+		if err != nil || got != "a|b;c=d" {
+			t.Fatalf("encrypt=%v: got %q, %v; want %q", encrypt, got, err, "a|b;c=d")
+		}
+		if _, err = decodeSignedCookie("other", "uid", v); err == nil {
+			t.Fatalf("encrypt=%v: expected an error with the wrong secret", encrypt)
+		}
+		if _, err = decodeSignedCookie("secret", "sid", v); err == nil {
+			t.Fatalf("encrypt=%v: expected an error with the wrong name", encrypt)
+		}
+		if _, err = decodeSignedCookie("secret", "uid", "x"+v); err == nil {
+			t.Fatalf("encrypt=%v: expected an error with the tampered value", encrypt)
+		}
+	}
+}
+
+func TestRedirectFlash(t *testing.T) {
+	login := newTestFrame(t, "redirect_flash_test")
+	login.config.RedirectHosts = []string{"accounts.example.com"}
+	login.POST("/login", HandlerFunc(func(ctx *Context) error {
+		return ctx.Redirect(303, ctx.QueryParam("next"), "signed in")
+	}))
+	home := newTestFrame(t, "redirect_flash_home_test")
+	home.GET("/home", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, strings.Join(ctx.Flash(), ","))
+	}))
+
+	rec := serveTest(login, httptest.NewRequest("POST", "/login?next=home", nil))
+	if rec.Code != 303 || rec.Header().Get(HeaderLocation) != "/home" {
+		t.Fatalf("redirect: got %d %q", rec.Code, rec.Header().Get(HeaderLocation))
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != flashCookieName {
+		t.Fatalf("flash cookie: got %v", cookies)
+	}
+
+	req := httptest.NewRequest("GET", "/home", nil)
+	req.AddCookie(cookies[0])
+	rec = serveTest(home, req)
+	if rec.Body.String() != "signed in" {
+		t.Fatalf("flash: got %q", rec.Body.String())
+	}
+	cookies = rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Fatalf("flash cookie is not cleared: %v", cookies)
+	}
+
+	for next, code := range map[string]int{
+		"https://accounts.example.com/x": 303,
+		"http://example.com/x":           303, // the request host
+		"https://evil.com/x":             500,
+		"//evil.com/x":                   500,
+		`/\evil.com/x`:                   500,
+	} {
+		rec = serveTest(login, httptest.NewRequest("POST", "/login?next="+url.QueryEscape(next), nil))
+		if rec.Code != code {
+			t.Errorf("redirect to %q: got %d, want %d", next, rec.Code, code)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"html"
+	"net/http"
+	"path"
+)
+
+// CSRFConfig is the config of the CSRF middleware created by NewCSRF.
+type CSRFConfig struct {
+	// If true, the token is stored in the session which must be enabled,
+	// otherwise it is stored in the cookie and submitted again (double-submit cookie).
+	Session bool
+	// The name of the cookie or session key of the token, "_csrf" by default.
+	Key string
+	// The max age of the token cookie in seconds, 0 means the browser session.
+	CookieMaxAge int
+	// Whether the token cookie is only sent over HTTPS.
+	CookieSecure bool
+	// The form field name of the submitted token, "_csrf" by default.
+	FieldName string
+	// The header name of the submitted token, "X-CSRF-Token" by default.
+	HeaderName string
+	// The path patterns skipping the check, such as "/webhooks/*",
+	// in the syntax of path.Match.
+	ExemptPaths []string
+}
+
+// csrf is the CSRF middleware state shared by the contexts.
+type csrf struct {
+	CSRFConfig
+}
+
+// NewCSRF creates the CSRF protection middleware.
+// It issues a token per session, and verifies it on the unsafe methods
+// (other than GET, HEAD, OPTIONS and TRACE) from the form field or the header,
+// replying 403 through the ErrorFunc if it is missing or does not match.
+// The token is available by ctx.CSRFToken() for AJAX, and in the templates
+// rendered by ctx.Render as `{{ csrf_token }}` and `{{ csrf_field() }}`,
+// which emits the hidden input.
+// Call ctx.RotateCSRFToken() after login to issue a new token.
+func NewCSRF(conf CSRFConfig) HandlerFunc {
+	if conf.Key == "" {
+		conf.Key = "_csrf"
+	}
+	if conf.FieldName == "" {
+		conf.FieldName = "_csrf"
+	}
+	if conf.HeaderName == "" {
+		conf.HeaderName = HeaderXCSRFToken
+	}
+	for _, pattern := range conf.ExemptPaths {
+		if _, err := path.Match(pattern, "/"); err != nil {
+			Fatalf("NewCSRF: invalid exempt path %q: %v", pattern, err)
+		}
+	}
+	c := &csrf{CSRFConfig: conf}
+	return func(ctx *Context) error {
+		ctx.csrf = c
+		ctx.csrfToken = c.stored(ctx)
+		if ctx.csrfToken == "" {
+			ctx.RotateCSRFToken()
+		}
+		if c.exempt(ctx) {
+			return nil
+		}
+		submitted := ctx.HeaderParam(c.HeaderName)
+		if submitted == "" {
+			submitted = ctx.BizParam(c.FieldName)
+		}
+		if submitted == "" {
+			ctx.Error(http.StatusForbidden, "CSRF token missing")
+			return nil
+		}
+		if subtle.ConstantTimeCompare([]byte(submitted), []byte(ctx.csrfToken)) != 1 {
+			ctx.Error(http.StatusForbidden, "CSRF token mismatch")
+			return nil
+		}
+		return nil
+	}
+}
+
+func (c *csrf) exempt(ctx *Context) bool {
+	switch ctx.Method() {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	p := ctx.Path()
+	for _, pattern := range c.ExemptPaths {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *csrf) stored(ctx *Context) string {
+	if c.Session {
+		token, _ := ctx.GetSession(c.Key).(string)
+		return token
+	}
+	return ctx.CookieParam(c.Key)
+}
+
+func (c *csrf) store(ctx *Context, token string) {
+	if c.Session {
+		ctx.SetSession(c.Key, token)
+		return
+	}
+	ctx.W.AddCookie(&http.Cookie{
+		Name:     c.Key,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   c.CookieMaxAge,
+		Secure:   c.CookieSecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// CSRFToken returns the CSRF token issued by the CSRF middleware,
+// which can be submitted by the X-CSRF-Token header for AJAX.
+// It returns empty if the middleware is not used.
+func (ctx *Context) CSRFToken() string {
+	return ctx.csrfToken
+}
+
+// RotateCSRFToken issues a new CSRF token and returns it,
+// which should be called after login to prevent the session fixation.
+// It returns empty if the CSRF middleware is not used.
+func (ctx *Context) RotateCSRFToken() string {
+	if ctx.csrf == nil {
+		return ""
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	ctx.csrfToken = base64.RawURLEncoding.EncodeToString(b)
+	ctx.csrf.store(ctx, ctx.csrfToken)
+	return ctx.csrfToken
+}
+
+// CSRFFieldHTML returns the hidden input of the CSRF token.
+func (ctx *Context) CSRFFieldHTML() SafeHTML {
+	if ctx.csrf == nil {
+		return ""
+	}
+	return SafeHTML(`<input type="hidden" name="` + html.EscapeString(ctx.csrf.FieldName) +
+		`" value="` + ctx.csrfToken + `" />`)
+}
@@ -0,0 +1,94 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCSRF(t *testing.T) {
+	frame := newTestFrame(t, "csrf_test")
+	frame.Filter(NewCSRF(CSRFConfig{ExemptPaths: []string{"/webhooks/*"}}))
+	render := newRender(nil)
+	render.SetFS(http.FS(fstest.MapFS{
+		"form.html": {Data: []byte(`<form>{{ csrf_field() }}</form>`)},
+	}))
+	frame.GET("/form", HandlerFunc(func(ctx *Context) error {
+		b, err := render.Render("form.html", ctx.renderData(nil))
+		if err != nil {
+			return err
+		}
+		return ctx.Bytes(200, MIMETextHTMLCharsetUTF8, b)
+	}))
+	frame.POST("/login", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, ctx.RotateCSRFToken())
+	}))
+	frame.POST("/submit", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, "ok")
+	}))
+	frame.POST("/webhooks/github", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, "hook")
+	}))
+
+	rec := serveTest(frame, httptest.NewRequest("GET", "/form", nil))
+	cookies := rec.Result().Cookies()
+	if rec.Code != 200 || len(cookies) != 1 || cookies[0].Name != "_csrf" || !cookies[0].HttpOnly {
+		t.Fatalf("GET /form: got %d, cookies %v", rec.Code, cookies)
+	}
+	token := cookies[0].Value
+	if want := `<form><input type="hidden" name="_csrf" value="` + token + `" /></form>`; rec.Body.String() != want {
+		t.Fatalf("GET /form: got %q, want %q", rec.Body.String(), want)
+	}
+
+	post := func(path, formToken, headerToken string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(url.Values{"_csrf": {formToken}}.Encode()))
+		req.Header.Set(HeaderContentType, MIMEApplicationForm)
+		if headerToken != "" {
+			req.Header.Set(HeaderXCSRFToken, headerToken)
+		}
+		req.AddCookie(&http.Cookie{Name: "_csrf", Value: token})
+		return serveTest(frame, req)
+	}
+	if rec = post("/submit", "", ""); rec.Code != 403 || !strings.Contains(rec.Body.String(), "missing") {
+		t.Fatalf("missing token: got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec = post("/submit", token, ""); rec.Code != 200 {
+		t.Fatalf("form token: got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec = post("/submit", "", token); rec.Code != 200 {
+		t.Fatalf("header token: got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec = post("/webhooks/github", "", ""); rec.Code != 200 || rec.Body.String() != "hook" {
+		t.Fatalf("exempt path: got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = post("/login", token, "")
+	if rec.Code != 200 || rec.Body.String() == token {
+		t.Fatalf("login: got %d %q", rec.Code, rec.Body.String())
+	}
+	stale := token
+	token = rec.Body.String()
+	if rec = post("/submit", stale, ""); rec.Code != 403 || !strings.Contains(rec.Body.String(), "mismatch") {
+		t.Fatalf("stale token: got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec = post("/submit", "", token); rec.Code != 200 {
+		t.Fatalf("rotated token: got %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// decompressedBody is the decompressed request body, which closes the original one.
+type decompressedBody struct {
+	io.Reader
+	body io.Closer
+}
+
+func (b *decompressedBody) Close() error {
+	if c, ok := b.Reader.(io.Closer); ok {
+		c.Close()
+	}
+	return b.body.Close()
+}
+
+// decompressBody replaces the request body compressed by the Content-Encoding with the decompressed one,
+// which is limited by the config item `max_decompressed_mb`, so the body decoders and the binder get the raw content.
+// It responds with 415 if the encoding is not supported, or 400 if the body is malformed, and reports false.
+func (frame *Framework) decompressBody(ctx *Context) bool {
+	contentEncoding := ctx.R.Header.Get(HeaderContentEncoding)
+	if contentEncoding == "" || ctx.R.Body == nil || ctx.R.Body == http.NoBody {
+		return true
+	}
+	var reader io.Reader = ctx.R.Body
+	codings := strings.Split(contentEncoding, ",")
+	// the codings are listed in the order in which they were applied
+	for i := len(codings) - 1; i >= 0; i-- {
+		var err error
+		switch strings.ToLower(strings.TrimSpace(codings[i])) {
+		case "gzip", "x-gzip":
+			reader, err = gzip.NewReader(reader)
+		case "deflate":
+			reader, err = newDeflateReader(reader)
+		case "identity", "":
+			continue
+		default:
+			ctx.SetHeader(HeaderAcceptEncoding, "gzip, deflate")
+			global.errorFunc(ctx, "Unsupported Content-Encoding: "+codings[i], http.StatusUnsupportedMediaType)
+			return false
+		}
+		if err == io.EOF {
+			// empty body
+			reader = http.NoBody
+			break
+		}
+		if err != nil {
+			global.errorFunc(ctx, "Malformed request body: "+err.Error(), http.StatusBadRequest)
+			return false
+		}
+	}
+	var body io.ReadCloser = &decompressedBody{Reader: reader, body: ctx.R.Body}
+	if limit := frame.config.maxDecompressedBody; limit > 0 {
+		body = http.MaxBytesReader(ctx.W, body, limit)
+	}
+	ctx.R.Body = body
+	ctx.R.Header.Del(HeaderContentEncoding)
+	ctx.R.Header.Del(HeaderContentLength)
+	ctx.R.ContentLength = -1
+	if ctx.limitedRequestBody != nil {
+		// it is the compressed one read for the access log
+		ctx.limitedRequestBody = nil
+		ctx.LimitedBodyBytes()
+	}
+	return true
+}
+
+// newDeflateReader returns the reader of the zlib format specified by HTTP,
+// or the raw deflate format sent by some clients.
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		if len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	// the zlib header: the compression method 8 and the check bits
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
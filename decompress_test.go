@@ -0,0 +1,112 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type decompressAPI struct {
+	User struct {
+		Name string `json:"name"`
+	} `param:"<in:body>"`
+}
+
+func (d *decompressAPI) Serve(ctx *Context) error {
+	return ctx.String(200, d.User.Name)
+}
+
+func TestDecompressRequest(t *testing.T) {
+	frame := newTestFrame(t, "decompress_test")
+	frame.config.DecompressRequest = true
+	frame.config.maxDecompressedBody = 4 * KB
+	frame.POST("/user", new(decompressAPI))
+	frame.POST("/raw", HandlerFunc(func(ctx *Context) error {
+		b, err := ioutil.ReadAll(ctx.R.Body)
+		// http.MaxBytesError requires Go 1.19, see go.mod
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			if tooLarge.Limit != 4*KB {
+				t.Errorf("limit: got %d, want %d", tooLarge.Limit, 4*KB)
+			}
+			return ctx.String(413, "too large")
+		}
+		return ctx.String(200, "%d", len(b))
+	}))
+
+	compress := func(encoding string, b []byte) []byte {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		switch encoding {
+		case "gzip":
+			w = gzip.NewWriter(&buf)
+		case "deflate":
+			w = zlib.NewWriter(&buf)
+		case "raw deflate":
+			w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+		}
+		w.Write(b)
+		w.Close()
+		return buf.Bytes()
+	}
+	post := func(path, encoding string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+		req.Header.Set(HeaderContentType, MIMEApplicationJSON)
+		if encoding != "" {
+			req.Header.Set(HeaderContentEncoding, encoding)
+		}
+		return serveTest(frame, req)
+	}
+
+	user := []byte(`{"name":"henry"}`)
+	for _, encoding := range []string{"gzip", "deflate", "raw deflate"} {
+		header := encoding
+		if encoding == "raw deflate" {
+			header = "deflate"
+		}
+		if rec := post("/user", header, compress(encoding, user)); rec.Code != 200 || rec.Body.String() != "henry" {
+			t.Fatalf("%s: got %d %q", encoding, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := post("/user", "deflate, gzip", compress("gzip", compress("deflate", user))); rec.Code != 200 || rec.Body.String() != "henry" {
+		t.Fatalf("multiple codings: got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := post("/user", "", user); rec.Code != 200 || rec.Body.String() != "henry" {
+		t.Fatalf("identity: got %d %q", rec.Code, rec.Body.String())
+	}
+	rec := post("/user", "br", user)
+	if rec.Code != 415 || rec.Header().Get(HeaderAcceptEncoding) != "gzip, deflate" {
+		t.Fatalf("unsupported: got %d %v", rec.Code, rec.Header())
+	}
+	if rec := post("/user", "gzip", user); rec.Code != 400 {
+		t.Fatalf("malformed: got %d", rec.Code)
+	}
+	// decompression bomb
+	if rec := post("/raw", "gzip", compress("gzip", make([]byte, MB))); rec.Code != 413 {
+		t.Fatalf("too large: got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := post("/raw", "gzip", compress("gzip", make([]byte, 4*KB))); rec.Code != 200 || rec.Body.String() != "4096" {
+		t.Fatalf("within the limit: got %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DirListing is the options of the directory listing of a static route.
+type DirListing struct {
+	// Deny is the glob patterns of `path.Match`, such as `*.key`,
+	// the files or directories whose names or paths relative to the root match one of them
+	// are neither listed nor served.
+	Deny []string
+	// Template is the template file rendering the HTML index with the global render,
+	// the built-in one is used if empty. The data is:
+	//  Path: the request path
+	//  Breadcrumbs: []DirCrumb
+	//  Entries: []DirEntry
+	Template string
+}
+
+// DirEntry is an entry of the directory listing.
+type DirEntry struct {
+	Name    string    `json:"name"`
+	URL     string    `json:"url"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	IsDir   bool      `json:"is_dir"`
+}
+
+// DirCrumb is a breadcrumb of the directory listing.
+type DirCrumb struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// ListingDirFS is similar to DirFS, but the directories without index.html are listed
+// as HTML, or JSON when the request accepts application/json.
+// Directory listing is off for the other file systems.
+// The hidden files (dotfiles) and the denied ones are neither listed nor served,
+// and the symbolic links pointing outside the root are not followed.
+func ListingDirFS(root string, listing DirListing, nocompressAndNocache ...bool) FileSystem {
+	return &listingFS{
+		FileSystem: FS(&dirFS{
+			dir:     root,
+			manager: global.fsManager,
+		}, nocompressAndNocache...),
+		dir:     root,
+		manager: global.fsManager,
+		listing: listing,
+	}
+}
+
+type listingFS struct {
+	FileSystem
+	dir     string
+	manager *FileServerManager
+	listing DirListing
+}
+
+func (fs *listingFS) Open(name string) (http.File, error) {
+	name = path.Clean("/" + name)
+	if fs.hidden(name) || !fs.inRoot(name) {
+		return nil, os.ErrNotExist
+	}
+	return fs.FileSystem.Open(name)
+}
+
+// hidden tests if the path contains a dotfile or a denied name.
+func (fs *listingFS) hidden(name string) bool {
+	rel := strings.TrimPrefix(name, "/")
+	if rel == "" {
+		return false
+	}
+	for _, seg := range strings.Split(rel, "/") {
+		if strings.HasPrefix(seg, ".") || fs.denied(seg) {
+			return true
+		}
+	}
+	return fs.denied(rel)
+}
+
+func (fs *listingFS) denied(name string) bool {
+	for _, pattern := range fs.listing.Deny {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// inRoot tests if the path is still under the root after the symbolic links are resolved.
+// The path that does not exist is left to Open.
+func (fs *listingFS) inRoot(name string) bool {
+	if _, ok := fs.manager.fs.(diskFS); !ok {
+		return true
+	}
+	dir := fs.dir
+	if dir == "" {
+		dir = "."
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return true
+	}
+	target, err := filepath.EvalSymlinks(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	rel, err := filepath.Rel(root, target)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// entries returns the visible entries of the directory, the directories come first.
+func (fs *listingFS) entries(f http.File, name string) ([]DirEntry, error) {
+	infos, err := f.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]DirEntry, 0, len(infos))
+	for _, info := range infos {
+		p := path.Join(name, info.Name())
+		if fs.hidden(p) {
+			continue
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if !fs.inRoot(p) {
+				continue
+			}
+			target, err := fs.FileSystem.Open(p)
+			if err != nil {
+				continue
+			}
+			info, err = target.Stat()
+			target.Close()
+			if err != nil {
+				continue
+			}
+		}
+		entry := DirEntry{
+			Name:    info.Name(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			IsDir:   info.IsDir(),
+		}
+		if entry.IsDir {
+			entry.Name += "/"
+			entry.Size = 0
+		}
+		// the name may contain '?' or '#', which must be escaped to remain part of the URL path.
+		entry.URL = (&url.URL{Path: entry.Name}).String()
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// dirCrumbs returns the breadcrumbs from the route prefix to the directory.
+func dirCrumbs(prefix, name string) []DirCrumb {
+	u := strings.TrimSuffix(prefix, "/") + "/"
+	crumbs := []DirCrumb{{Name: u, URL: u}}
+	for _, seg := range strings.Split(strings.Trim(name, "/"), "/") {
+		if seg == "" {
+			continue
+		}
+		u += seg + "/"
+		crumbs = append(crumbs, DirCrumb{Name: seg, URL: (&url.URL{Path: u}).String()})
+	}
+	return crumbs
+}
+
+// listDir replies the directory listing.
+func (fs *listingFS) listDir(ctx *Context, f http.File, name string) {
+	entries, err := fs.entries(f, name)
+	if err != nil {
+		global.errorFunc(ctx, "Error reading directory", http.StatusInternalServerError)
+		return
+	}
+	prefix := strings.TrimSuffix(ctx.routePattern, "/*"+FilepathKey)
+	crumbs := dirCrumbs(prefix, name)
+	ctx.W.Header().Add(HeaderVary, HeaderAccept)
+	if ctx.Accepts(MIMETextHTML, MIMEApplicationJSON) == MIMEApplicationJSON {
+		ctx.JSON(http.StatusOK, Map{
+			"path":        crumbs[len(crumbs)-1].URL,
+			"breadcrumbs": crumbs,
+			"entries":     entries,
+		})
+		return
+	}
+	data := Map{
+		"Path":        crumbs[len(crumbs)-1].URL,
+		"Breadcrumbs": crumbs,
+		"Entries":     entries,
+	}
+	var b []byte
+	if fs.listing.Template != "" {
+		b, err = global.render.Render(fs.listing.Template, data)
+	} else {
+		b, err = global.render.RenderFromBytesWithName("dirlisting.html", dirListingTemplate, data)
+	}
+	if err != nil {
+		global.errorFunc(ctx, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx.Bytes(http.StatusOK, MIMETextHTMLCharsetUTF8, b)
+}
+
+var dirListingTemplate = []byte(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Index of {{ Path }}</title></head>
+<body>
+<h1>{% for c in Breadcrumbs %}<a href="{{ c.URL }}">{{ c.Name }}</a>{% if not forloop.First %}/{% endif %}{% endfor %}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th></tr>
+{% for e in Entries %}<tr><td><a href="{{ e.URL }}">{{ e.Name }}</a></td><td>{% if not e.IsDir %}{{ e.Size }}{% endif %}</td><td>{{ e.ModTime|date:"2006-01-02 15:04:05" }}</td></tr>
+{% endfor %}</table>
+</body>
+</html>
+`)
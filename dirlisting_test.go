@@ -0,0 +1,111 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListingDirFS(t *testing.T) {
+	base, err := ioutil.TempDir("", "faygo_dirlisting_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(root, "sub"), outside} {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range map[string]string{
+		filepath.Join(root, "a.txt"):       "a",
+		filepath.Join(root, ".secret"):     "secret",
+		filepath.Join(root, "b.key"):       "key",
+		filepath.Join(root, "sub", "c.md"): "c",
+		filepath.Join(outside, "passwd"):   "root",
+	} {
+		if err = ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.Symlink(outside, filepath.Join(root, "out")); err != nil {
+		t.Skip("symlink is not supported:", err)
+	}
+	if err = os.Symlink(filepath.Join(root, "sub", "c.md"), filepath.Join(root, "in.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	frame := newTestFrame(t, "dirlisting_test")
+	frame.StaticFS("/share", ListingDirFS(root, DirListing{Deny: []string{"*.key"}}, true, true))
+	frame.StaticFS("/plain", DirFS(root, true, true))
+
+	rec := serveTest(frame, httptest.NewRequest("GET", "/share/", nil))
+	body := rec.Body.String()
+	if rec.Code != 200 || !strings.Contains(body, `href="a.txt"`) || !strings.Contains(body, `href="sub/"`) || !strings.Contains(body, `href="in.md"`) {
+		t.Fatalf("html: got %d %s", rec.Code, body)
+	}
+	for _, hidden := range []string{".secret", "b.key", "out"} {
+		if strings.Contains(body, `href="`+hidden) {
+			t.Fatalf("html: %s is listed: %s", hidden, body)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/share/sub/", nil)
+	req.Header.Set("Accept", "application/json")
+	rec = serveTest(frame, req)
+	var listing struct {
+		Breadcrumbs []DirCrumb `json:"breadcrumbs"`
+		Entries     []DirEntry `json:"entries"`
+	}
+	if err = json.Unmarshal(rec.Body.Bytes(), &listing); err != nil {
+		t.Fatal(err, rec.Body.String())
+	}
+	if len(listing.Entries) != 1 || listing.Entries[0].Name != "c.md" || listing.Entries[0].Size != 1 {
+		t.Fatalf("json: got %+v", listing.Entries)
+	}
+	if len(listing.Breadcrumbs) != 2 || listing.Breadcrumbs[0].URL != "/share/" || listing.Breadcrumbs[1].URL != "/share/sub/" {
+		t.Fatalf("json: got %+v", listing.Breadcrumbs)
+	}
+
+	req = httptest.NewRequest("GET", "/share/", nil)
+	req.Header.Set("Accept", "application/json")
+	rec = serveTest(frame, req)
+	listing.Entries = nil
+	json.Unmarshal(rec.Body.Bytes(), &listing)
+	var names []string
+	for _, e := range listing.Entries {
+		names = append(names, e.Name)
+	}
+	if strings.Join(names, ",") != "sub/,a.txt,in.md" {
+		t.Fatalf("json: got %v", names)
+	}
+
+	for _, p := range []string{"/share/.secret", "/share/b.key", "/share/out/passwd", "/share/out/", "/plain/"} {
+		if rec = serveTest(frame, httptest.NewRequest("GET", p, nil)); rec.Code != 404 {
+			t.Fatalf("%s: got %d, want 404", p, rec.Code)
+		}
+	}
+	if rec = serveTest(frame, httptest.NewRequest("GET", "/share/in.md", nil)); rec.Code != 200 || rec.Body.String() != "c" {
+		t.Fatalf("in.md: got %d %q", rec.Code, rec.Body.String())
+	}
+}
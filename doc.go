@@ -80,6 +80,7 @@ StructHandler tag value description:
     param |    in    | only one |     body      | (position of param) request body can be any content
     param |    in    | only one |     header    | (position of param) request header info
     param |    in    | only one |     cookie    | (position of param) request cookie info, support: `*http.Cookie`,`http.Cookie`,`string`,`[]byte`
+    param |    in    | only one |     jwt       | (position of param) the verified JWT claim stored by the JWT middleware
     param |   name   |    no    |   (e.g.`id`)   | specify request param`s name
     param | required |    no    |               | request param is required
     param |   desc   |    no    |   (e.g.`id`)   | request param description
@@ -89,16 +90,20 @@ StructHandler tag value description:
     param |   maxmb  |    no    |   (e.g.`32`)   | when request Content-Type is multipart/form-data, the max memory for body.(multi-param, whichever is greater)
     param |  regexp  |    no    | (e.g.`^\\w+$`) | verify the value of the param with a regular expression(param value can not be null)
     param |   err    |    no    |(e.g.`incorrect password format`)| the custom error for binding or validating
+    param |  format  |    no    |(e.g.`2006-01-02` `uuid`)| the layout of time.Time, or `uuid` to verify a string
 
     NOTES:
         1. the binding object must be a struct pointer
-        2. in addition to `*multipart.FileHeader`, the binding struct's field can not be a pointer
+        2. in addition to `*multipart.FileHeader` and `*faygo.UploadedFile`, the binding struct's field can not be a pointer
         3. `regexp` or `param` tag is only usable when `param:"type(xxx)"` is exist
-        4. if the `param` tag is not exist, anonymous field will be parsed
-        5. when the param's position(`in`) is `formData` and the field's type is `*multipart.FileHeader`, `multipart.FileHeader`, `[]*multipart.FileHeader` or `[]multipart.FileHeader`, the param receives file uploaded
+        4. if the `param` tag is not exist, anonymous field will be parsed, and its params are flattened into the parent's;
+           the named struct field with params is parsed as a nested group, e.g. the field `Filter` nests the `query` and `formData`
+           params named `filter.xxx`, and the `body` param decoded from the sub-object `filter` of the JSON body
+        5. when the param's position(`in`) is `formData` and the field's type is `*multipart.FileHeader`, `multipart.FileHeader`, `[]*multipart.FileHeader`, `[]multipart.FileHeader`, `*faygo.UploadedFile` or `[]*faygo.UploadedFile`, the param receives file uploaded
         6. if param's position(`in`) is `cookie`, field's type must be `*http.Cookie` or `http.Cookie`
         7. param tags `in(formData)` and `in(body)` can not exist at the same time
-        8. there should not be more than one `in(body)` param tag
+        8. there should not be more than one `in(body)` param tag in the same struct or group
+        9. two fields can not be bound to the same param, e.g. the `page` query params of two anonymous fields
 
 List of supported param value types:
     base    |   slice    | special
@@ -110,10 +115,10 @@ List of supported param value types:
     int     |  []int     | *http.Cookie (only for `net/http`'s `cookie` param)
     int8    |  []int8    | http.Cookie (only for `net/http`'s `cookie` param)
     int16   |  []int16   | struct (struct type only for `body` param or as an anonymous field to extend params)
-    int32   |  []int32   |
-    int64   |  []int64   |
-    uint8   |  []uint8   |
-    uint16  |  []uint16  |
+    int32   |  []int32   | time.Time, time.Duration, net.IP and their slices (`format` sets the time layout, RFC3339 by default)
+    int64   |  []int64   | [16]byte UUID types, encoding.TextUnmarshaler types
+    uint8   |  []uint8   | map[string]string (only for `query` param, receives the remaining query params)
+    uint16  |  []uint16  | custom types registered by RegisterTypeConverter
     uint32  |  []uint32  |
     uint64  |  []uint64  |
     float32 |  []float32 |
@@ -0,0 +1,77 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// define common middlewares.
+
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+
+	"github.com/henrylee2cn/faygo"
+)
+
+// BasicAuthUserKey is the context data key of the authenticated username.
+const BasicAuthUserKey = "faygo.basic_auth.user"
+
+// BasicAuth creates HTTP Basic authentication middleware.
+// If the validation fails, it replies 401 with the `WWW-Authenticate` header,
+// otherwise it stores the username in the context data by BasicAuthUserKey.
+func BasicAuth(realm string, validator func(user, pass string) bool) faygo.HandlerFunc {
+	if validator == nil {
+		faygo.Fatalf("BasicAuth: validator cannot be nil")
+	}
+	if realm == "" {
+		realm = "Authorization Required"
+	}
+	challenge := "Basic realm=" + strconv.Quote(realm)
+	return func(ctx *faygo.Context) error {
+		user, pass, ok := ctx.R.BasicAuth()
+		if !ok || !validator(user, pass) {
+			ctx.SetHeader(faygo.HeaderWWWAuthenticate, challenge)
+			ctx.Error(http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+			return nil
+		}
+		ctx.SetData(BasicAuthUserKey, user)
+		return nil
+	}
+}
+
+// BasicAuthUser returns the username authenticated by the BasicAuth middleware.
+func BasicAuthUser(ctx *faygo.Context) string {
+	user, _ := ctx.Data(BasicAuthUserKey).(string)
+	return user
+}
+
+// BasicAuthAccounts creates a BasicAuth validator from the username-password pairs.
+// Both the username and the password are compared in constant time.
+func BasicAuthAccounts(accounts map[string]string) func(user, pass string) bool {
+	type digest [sha256.Size]byte
+	hashed := make([][2]digest, 0, len(accounts))
+	for user, pass := range accounts {
+		hashed = append(hashed, [2]digest{sha256.Sum256([]byte(user)), sha256.Sum256([]byte(pass))})
+	}
+	return func(user, pass string) bool {
+		u, p := sha256.Sum256([]byte(user)), sha256.Sum256([]byte(pass))
+		var matched int
+		// check every account so that the time taken does not reveal the username.
+		for _, a := range hashed {
+			matched |= subtle.ConstantTimeCompare(u[:], a[0][:]) & subtle.ConstantTimeCompare(p[:], a[1][:])
+		}
+		return matched == 1
+	}
+}
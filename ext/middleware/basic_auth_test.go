@@ -0,0 +1,67 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/henrylee2cn/faygo"
+)
+
+func TestBasicAuth(t *testing.T) {
+	base := runFrame(t, "basic_auth_test", func(frame *faygo.Framework) {
+		validator := BasicAuthAccounts(map[string]string{"henry": "secret"})
+		user := faygo.HandlerFunc(func(ctx *faygo.Context) error {
+			return ctx.String(200, "user "+BasicAuthUser(ctx))
+		})
+		frame.GET("/realm", BasicAuth("admin area", validator), user)
+		frame.GET("/default", BasicAuth("", validator), user)
+	})
+	get := func(path, user, pass string) *http.Response {
+		req, _ := http.NewRequest("GET", base+path, nil)
+		if user != "" || pass != "" {
+			req.SetBasicAuth(user, pass)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	req, _ := http.NewRequest("GET", base+"/realm", nil)
+	req.SetBasicAuth("henry", "secret")
+	if got := do(t, req); got != "user henry" {
+		t.Fatalf("success: got %q", got)
+	}
+	for _, c := range []struct {
+		name, path, user, pass, challenge string
+	}{
+		{"no credentials", "/realm", "", "", `Basic realm="admin area"`},
+		{"wrong password", "/realm", "henry", "wrong", `Basic realm="admin area"`},
+		{"unknown user", "/realm", "admin", "secret", `Basic realm="admin area"`},
+		{"default realm", "/default", "", "", `Basic realm="Authorization Required"`},
+	} {
+		resp := get(c.path, c.user, c.pass)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: got %s, want 401", c.name, resp.Status)
+		}
+		if got := resp.Header.Get(faygo.HeaderWWWAuthenticate); got != c.challenge {
+			t.Errorf("%s: WWW-Authenticate: got %q, want %q", c.name, got, c.challenge)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// define common middlewares.
+
+package middleware
+
+import (
+	"github.com/henrylee2cn/faygo"
+)
+
+// GzipLevel sets the compression level of the responses of the route,
+// for example, the lower level for the large payloads to reduce CPU,
+// or the best compression for the rarely-changing assets.
+// It is the same as faygo.Compression(level, -1): the level 0 disables the compression,
+// the others are from -2 (huffman only) to 9 (best compression).
+func GzipLevel(level int) faygo.HandlerFunc {
+	return faygo.Compression(level, -1)
+}
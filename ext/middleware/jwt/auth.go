@@ -0,0 +1,449 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/faygo"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+// Config is the configuration of the JWT authentication handler created by JWT.
+type Config struct {
+	// Algorithms lists the accepted signing algorithms, such as HS256, RS256 and ES256.
+	// Optional, default is HS256.
+	Algorithms []string
+
+	// Key is the verification key used when KeyFunc is nil:
+	// []byte for HMAC, *rsa.PublicKey for RSA and *ecdsa.PublicKey for ECDSA.
+	Key interface{}
+
+	// KeyFunc looks up the verification key by the `kid` header of the token,
+	// which is empty if the token has no `kid`.
+	// Optional, use (*KeySet).KeyFunc to refresh the keys on an interval, e.g. from a JWKS endpoint.
+	KeyFunc func(kid string) (interface{}, error)
+
+	// TokenLookup lists the sources of the token in the order of trying,
+	// each in the form of "<source>:<name>":
+	// - "header:<name>"
+	// - "cookie:<name>"
+	// - "query:<name>"
+	// Optional, default is "header:Authorization".
+	TokenLookup []string
+
+	// TokenHeadName is the scheme of the token in the header. Optional, default is "Bearer".
+	TokenHeadName string
+
+	// Audience is the expected `aud` claim. Optional, not checked if empty.
+	Audience string
+
+	// Issuer is the expected `iss` claim. Optional, not checked if empty.
+	Issuer string
+
+	// Leeway is the tolerance of the clock skew when checking `exp` and `nbf`.
+	Leeway time.Duration
+
+	// TimeFunc provides the current time. Optional, default is time.Now.
+	TimeFunc func() time.Time
+
+	// ErrorFunc replies to the request whose token is invalid.
+	// Optional, by default it replies 401 in JSON.
+	ErrorFunc func(ctx *faygo.Context, err *AuthError)
+}
+
+// Reason is the reason why the token is rejected.
+type Reason int
+
+// The reasons why the token is rejected.
+const (
+	ReasonMissing     Reason = iota + 1 // no token is found in the request
+	ReasonMalformed                     // the token or its claims can not be parsed
+	ReasonUnknownKey                    // no key is found for the `kid`
+	ReasonSignature                     // the algorithm is not accepted or the signature is wrong
+	ReasonExpired                       // the `exp` claim is passed
+	ReasonNotValidYet                   // the `nbf` claim is not reached
+	ReasonAudience                      // the `aud` claim does not match
+	ReasonIssuer                        // the `iss` claim does not match
+)
+
+var reasonTexts = map[Reason]string{
+	ReasonMissing:     "token is missing",
+	ReasonMalformed:   "token is malformed",
+	ReasonUnknownKey:  "token key is unknown",
+	ReasonSignature:   "token signature is invalid",
+	ReasonExpired:     "token is expired",
+	ReasonNotValidYet: "token is not valid yet",
+	ReasonAudience:    "token audience is invalid",
+	ReasonIssuer:      "token issuer is invalid",
+}
+
+// String returns the text of the reason.
+func (r Reason) String() string {
+	return reasonTexts[r]
+}
+
+// AuthError is the failure of the JWT authentication.
+type AuthError struct {
+	Reason Reason
+	Err    error // the underlying error, may be nil
+}
+
+// Error implements the error interface.
+func (e *AuthError) Error() string {
+	if e.Err == nil {
+		return e.Reason.String()
+	}
+	return e.Reason.String() + ": " + e.Err.Error()
+}
+
+// ErrUnknownKey is returned by the KeyFunc when no key is found for the `kid`.
+var ErrUnknownKey = errors.New("unknown key")
+
+// JWT creates the authentication handler, which verifies the token of the request and
+// stores the claims on the Context, so that the APIHandler fields tagged `in:jwt`
+// are bound with the claims, e.g.
+//
+//	type Profile struct {
+//	    UserID string   `param:"<in:jwt> <name:sub>"`
+//	    Roles  []string `param:"<in:jwt> <name:roles>"`
+//	}
+//
+// The claims are also available by ctx.Claims() and ExtractClaims(ctx).
+func JWT(cfg Config) faygo.HandlerFunc {
+	a := newAuth(cfg)
+	return func(ctx *faygo.Context) error {
+		claims, err := a.verify(ctx.R)
+		if err != nil {
+			ctx.Stop()
+			a.errorFunc(ctx, err)
+			return nil
+		}
+		ctx.SetClaims(claims)
+		ctx.SetData("JWT_PAYLOAD", claims)
+		ctx.Next()
+		return nil
+	}
+}
+
+type auth struct {
+	Config
+	parser *jwt.Parser
+}
+
+func newAuth(cfg Config) *auth {
+	a := &auth{Config: cfg}
+	if len(a.Algorithms) == 0 {
+		a.Algorithms = []string{"HS256"}
+	}
+	if a.KeyFunc == nil {
+		key := a.Key
+		a.KeyFunc = func(string) (interface{}, error) { return key, nil }
+	}
+	if len(a.TokenLookup) == 0 {
+		a.TokenLookup = []string{"header:Authorization"}
+	}
+	a.TokenHeadName = strings.TrimSpace(a.TokenHeadName)
+	if a.TokenHeadName == "" {
+		a.TokenHeadName = "Bearer"
+	}
+	if a.TimeFunc == nil {
+		a.TimeFunc = time.Now
+	}
+	if a.ErrorFunc == nil {
+		a.ErrorFunc = func(ctx *faygo.Context, err *AuthError) {
+			ctx.JSON(http.StatusUnauthorized, faygo.Map{
+				"code":    http.StatusUnauthorized,
+				"message": err.Error(),
+			})
+		}
+	}
+	a.parser = &jwt.Parser{ValidMethods: a.Algorithms, SkipClaimsValidation: true}
+	return a
+}
+
+func (a *auth) errorFunc(ctx *faygo.Context, err *AuthError) {
+	ctx.SetHeader(faygo.HeaderWWWAuthenticate, a.TokenHeadName+` error="invalid_token"`)
+	a.ErrorFunc(ctx, err)
+}
+
+// verify extracts the token from the request, then checks its signature and claims.
+func (a *auth) verify(r *http.Request) (jwt.MapClaims, *AuthError) {
+	tokenString := a.extract(r)
+	if tokenString == "" {
+		return nil, &AuthError{Reason: ReasonMissing}
+	}
+	token, err := a.parser.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return a.KeyFunc(kid)
+	})
+	if err != nil {
+		ve, ok := err.(*jwt.ValidationError)
+		switch {
+		case !ok || ve.Errors&jwt.ValidationErrorMalformed != 0:
+			return nil, &AuthError{Reason: ReasonMalformed, Err: err}
+		case ve.Inner == ErrUnknownKey:
+			return nil, &AuthError{Reason: ReasonUnknownKey, Err: ve.Inner}
+		default:
+			return nil, &AuthError{Reason: ReasonSignature, Err: err}
+		}
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, &AuthError{Reason: ReasonMalformed}
+	}
+	return claims, a.validate(claims)
+}
+
+func (a *auth) extract(r *http.Request) string {
+	for _, lookup := range a.TokenLookup {
+		parts := strings.SplitN(lookup, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		var token string
+		switch parts[0] {
+		case "header":
+			token = r.Header.Get(parts[1])
+			if p := strings.SplitN(token, " ", 2); len(p) == 2 && p[0] == a.TokenHeadName {
+				token = strings.TrimSpace(p[1])
+			} else {
+				token = ""
+			}
+		case "cookie":
+			if c, err := r.Cookie(parts[1]); err == nil {
+				token = c.Value
+			}
+		case "query":
+			token = r.URL.Query().Get(parts[1])
+		}
+		if token != "" {
+			return token
+		}
+	}
+	return ""
+}
+
+// validate checks the standard claims exp, nbf, aud and iss.
+func (a *auth) validate(claims jwt.MapClaims) *AuthError {
+	now := a.TimeFunc()
+	if exp, ok, err := timeClaim(claims, "exp"); err != nil {
+		return &AuthError{Reason: ReasonMalformed, Err: err}
+	} else if ok && now.After(exp.Add(a.Leeway)) {
+		return &AuthError{Reason: ReasonExpired}
+	}
+	if nbf, ok, err := timeClaim(claims, "nbf"); err != nil {
+		return &AuthError{Reason: ReasonMalformed, Err: err}
+	} else if ok && now.Add(a.Leeway).Before(nbf) {
+		return &AuthError{Reason: ReasonNotValidYet}
+	}
+	if a.Audience != "" && !hasAudience(claims["aud"], a.Audience) {
+		return &AuthError{Reason: ReasonAudience}
+	}
+	if a.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != a.Issuer {
+			return &AuthError{Reason: ReasonIssuer}
+		}
+	}
+	return nil
+}
+
+func timeClaim(claims jwt.MapClaims, name string) (time.Time, bool, error) {
+	switch v := claims[name].(type) {
+	case nil:
+		return time.Time{}, false, nil
+	case float64:
+		return time.Unix(int64(v), 0), true, nil
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %s claim", name)
+		}
+		return time.Unix(n, 0), true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("invalid %s claim", name)
+}
+
+func hasAudience(aud interface{}, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for _, a := range v {
+			if s, _ := a.(string); s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// KeySet caches the verification keys by `kid`, and refreshes them on an interval,
+// so that the rotated keys are picked up, e.g.
+//
+//	keys, err := jwt.NewKeySet(jwt.FetchJWKS(jwksURL, nil), 10*time.Minute)
+//	frame.Use(jwt.JWT(jwt.Config{Algorithms: []string{"RS256"}, KeyFunc: keys.KeyFunc}))
+type KeySet struct {
+	fetch func() (map[string]interface{}, error)
+	keys  map[string]interface{}
+	lock  sync.RWMutex
+	stop  chan struct{}
+	once  sync.Once
+}
+
+// NewKeySet fetches the keys, and then refreshes them on the interval if it is positive.
+func NewKeySet(fetch func() (map[string]interface{}, error), interval time.Duration) (*KeySet, error) {
+	ks := &KeySet{fetch: fetch, stop: make(chan struct{})}
+	if err := ks.Refresh(); err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if err := ks.Refresh(); err != nil {
+						faygo.Warningf("jwt: failed to refresh keys: %s", err.Error())
+					}
+				case <-ks.stop:
+					return
+				}
+			}
+		}()
+	}
+	return ks, nil
+}
+
+// Refresh fetches the keys immediately, the old keys are kept on failure.
+func (ks *KeySet) Refresh() error {
+	keys, err := ks.fetch()
+	if err != nil {
+		return err
+	}
+	ks.lock.Lock()
+	ks.keys = keys
+	ks.lock.Unlock()
+	return nil
+}
+
+// KeyFunc returns the key of the kid, or ErrUnknownKey.
+func (ks *KeySet) KeyFunc(kid string) (interface{}, error) {
+	ks.lock.RLock()
+	key, ok := ks.keys[kid]
+	ks.lock.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// Stop stops refreshing the keys.
+func (ks *KeySet) Stop() {
+	ks.once.Do(func() { close(ks.stop) })
+}
+
+// FetchJWKS returns the function fetching the keys from the JWKS endpoint, for NewKeySet.
+// If client is nil, http.DefaultClient is used.
+func FetchJWKS(url string, client *http.Client) func() (map[string]interface{}, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func() (map[string]interface{}, error) {
+		resp, err := client.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("jwt: fetch JWKS: %s", resp.Status)
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return ParseJWKS(b)
+	}
+}
+
+// ParseJWKS parses the JSON Web Key Set into the keys by `kid`.
+// The key types RSA, EC (P-256, P-384 and P-521) and oct are supported, others are skipped.
+func ParseJWKS(data []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		var err error
+		switch k.Kty {
+		case "RSA":
+			var n, e []byte
+			if n, err = decodeSegment(k.N); err == nil {
+				if e, err = decodeSegment(k.E); err == nil {
+					keys[k.Kid] = &rsa.PublicKey{
+						N: new(big.Int).SetBytes(n),
+						E: int(new(big.Int).SetBytes(e).Int64()),
+					}
+				}
+			}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			var x, y []byte
+			if x, err = decodeSegment(k.X); err == nil {
+				if y, err = decodeSegment(k.Y); err == nil {
+					keys[k.Kid] = &ecdsa.PublicKey{
+						Curve: curve,
+						X:     new(big.Int).SetBytes(x),
+						Y:     new(big.Int).SetBytes(y),
+					}
+				}
+			}
+		case "oct":
+			var secret []byte
+			if secret, err = decodeSegment(k.K); err == nil {
+				keys[k.Kid] = secret
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("jwt: invalid key %q: %s", k.Kid, err.Error())
+		}
+	}
+	return keys, nil
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,143 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func bearer(token string) *http.Request {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestVerifyReasons(t *testing.T) {
+	now := time.Now()
+	secret := []byte("secret")
+	a := newAuth(Config{
+		Key:      secret,
+		Audience: "api",
+		Issuer:   "faygo",
+		Leeway:   time.Minute,
+		TimeFunc: func() time.Time { return now },
+	})
+	claims := func(exp time.Time) jwt.MapClaims {
+		return jwt.MapClaims{"sub": "42", "aud": []interface{}{"web", "api"}, "iss": "faygo", "exp": exp.Unix()}
+	}
+	for name, c := range map[string]struct {
+		req    *http.Request
+		reason Reason
+	}{
+		"valid":         {bearer(sign(t, jwt.SigningMethodHS256, secret, "", claims(now.Add(time.Hour)))), 0},
+		"in leeway":     {bearer(sign(t, jwt.SigningMethodHS256, secret, "", claims(now.Add(-30*time.Second)))), 0},
+		"expired":       {bearer(sign(t, jwt.SigningMethodHS256, secret, "", claims(now.Add(-time.Hour)))), ReasonExpired},
+		"missing":       {httptest.NewRequest("GET", "/", nil), ReasonMissing},
+		"malformed":     {bearer("not.a.token"), ReasonMalformed},
+		"wrong secret":  {bearer(sign(t, jwt.SigningMethodHS256, []byte("other"), "", claims(now.Add(time.Hour)))), ReasonSignature},
+		"wrong alg":     {bearer(sign(t, jwt.SigningMethodHS512, secret, "", claims(now.Add(time.Hour)))), ReasonSignature},
+		"not valid yet": {bearer(sign(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"aud": "api", "iss": "faygo", "nbf": now.Add(time.Hour).Unix()})), ReasonNotValidYet},
+		"wrong aud":     {bearer(sign(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"aud": "web", "iss": "faygo"})), ReasonAudience},
+		"wrong iss":     {bearer(sign(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"aud": "api", "iss": "other"})), ReasonIssuer},
+	} {
+		got, err := a.verify(c.req)
+		switch {
+		case c.reason == 0 && err != nil:
+			t.Errorf("%s: unexpected error: %v", name, err)
+		case c.reason == 0 && got["sub"] != "42":
+			t.Errorf("%s: unexpected claims: %v", name, got)
+		case c.reason != 0 && (err == nil || err.Reason != c.reason):
+			t.Errorf("%s: expect reason %q, got %v", name, c.reason, err)
+		}
+	}
+}
+
+func TestTokenLookup(t *testing.T) {
+	secret := []byte("secret")
+	token := sign(t, jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"sub": "42"})
+	a := newAuth(Config{
+		Key:         secret,
+		TokenLookup: []string{"header:Authorization", "cookie:token", "query:token"},
+	})
+	req := httptest.NewRequest("GET", "/?token="+token, nil)
+	if _, err := a.verify(req); err != nil {
+		t.Fatalf("query token: %v", err)
+	}
+	req.AddCookie(&http.Cookie{Name: "token", Value: "bad"})
+	if _, err := a.verify(req); err == nil || err.Reason != ReasonMalformed {
+		t.Fatalf("the cookie should be tried before the query, got %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if _, err := a.verify(req); err != nil {
+		t.Fatalf("header token: %v", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"k1","n":%q,"e":%q}]}`,
+		b64(rsaKey.N), b64(big.NewInt(int64(rsaKey.E))))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(jwks))
+	}))
+	defer srv.Close()
+
+	keys, err := NewKeySet(FetchJWKS(srv.URL, nil), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keys.Stop()
+	a := newAuth(Config{Algorithms: []string{"RS256", "ES256"}, KeyFunc: keys.KeyFunc})
+
+	oldToken := sign(t, jwt.SigningMethodRS256, rsaKey, "k1", jwt.MapClaims{"sub": "42"})
+	newToken := sign(t, jwt.SigningMethodES256, ecKey, "k2", jwt.MapClaims{"sub": "42"})
+	if _, err := a.verify(bearer(oldToken)); err != nil {
+		t.Fatalf("RS256 token: %v", err)
+	}
+	if _, err := a.verify(bearer(newToken)); err == nil || err.Reason != ReasonUnknownKey {
+		t.Fatalf("token of the key not published yet: %v", err)
+	}
+
+	// rotate: publish k2 and retire k1
+	jwks = fmt.Sprintf(`{"keys":[{"kty":"EC","kid":"k2","crv":"P-256","x":%q,"y":%q}]}`,
+		b64(ecKey.X), b64(ecKey.Y))
+	if err = keys.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.verify(bearer(newToken)); err != nil {
+		t.Fatalf("ES256 token after rotation: %v", err)
+	}
+	if _, err := a.verify(bearer(oldToken)); err == nil || err.Reason != ReasonUnknownKey {
+		t.Fatalf("token of the retired key: %v", err)
+	}
+}
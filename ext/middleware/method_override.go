@@ -0,0 +1,57 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// define common middlewares.
+
+package middleware
+
+import (
+	"strings"
+
+	"github.com/henrylee2cn/faygo"
+)
+
+// MethodOverrideField is the form field carrying the overridden method.
+const MethodOverrideField = "_method"
+
+// NewMethodOverride creates a filter that rewrites the method of the POST request from
+// the X-HTTP-Method-Override header or the _method form field, for the clients behind
+// the POST-only proxies.
+// Only the methods in the allow-list are accepted, which defaults to PUT, PATCH and DELETE.
+// Note: It must be registered by frame.Filter, since the routing depends on the method.
+func NewMethodOverride(allowed ...string) faygo.HandlerFunc {
+	if len(allowed) == 0 {
+		allowed = []string{"PUT", "PATCH", "DELETE"}
+	}
+	var allowMap = make(map[string]bool, len(allowed))
+	for _, method := range allowed {
+		allowMap[strings.ToUpper(method)] = true
+	}
+	return func(ctx *faygo.Context) error {
+		if ctx.Method() != "POST" {
+			return nil
+		}
+		method := ctx.HeaderParam(faygo.HeaderXHTTPMethodOverride)
+		if method == "" {
+			switch strings.TrimSpace(strings.SplitN(ctx.HeaderParam(faygo.HeaderContentType), ";", 2)[0]) {
+			case faygo.MIMEApplicationForm, faygo.MIMEMultipartForm:
+				method = ctx.FormParam(MethodOverrideField)
+			}
+		}
+		if method = strings.ToUpper(strings.TrimSpace(method)); allowMap[method] {
+			ctx.OverrideMethod(method)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/faygo"
+)
+
+// runFrame serves the routes on a free local address and returns its base URL,
+// the frame keeps running until the test process exits.
+func runFrame(t *testing.T, name string, routes func(frame *faygo.Framework)) string {
+	faygo.Configure(faygo.NewDefaultGlobalConfig())
+	faygo.DisableBanner()
+	faygo.SetPidFile("")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	config := faygo.NewDefaultConfig()
+	config.Addrs = []string{addr}
+	config.APIdoc.Enable = false
+	config.Router.DefaultUpload = false
+	config.Router.DefaultStatic = false
+	frame := faygo.NewWithConfig(config, name)
+	routes(frame)
+	go frame.RunE()
+	for i := 0; !frame.Running(); i++ {
+		if i == 100 {
+			t.Fatalf("%s is not running", name)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return "http://" + addr
+}
+
+func TestMethodOverride(t *testing.T) {
+	base := runFrame(t, "method_override_test", func(frame *faygo.Framework) {
+		frame.Filter(NewMethodOverride())
+		echo := faygo.HandlerFunc(func(ctx *faygo.Context) error {
+			return ctx.String(200, ctx.Method()+" "+ctx.OriginalMethod())
+		})
+		frame.POST("/item", echo)
+		frame.PUT("/item", echo)
+		frame.DELETE("/item", echo)
+		frame.API("TRACE", "/item", echo)
+	})
+	for _, c := range []struct {
+		name, header, field, contentType, want string
+	}{
+		{"header", "put", "", "", "PUT POST"},
+		{"form field", "", "delete", faygo.MIMEApplicationForm, "DELETE POST"},
+		{"header first", "PUT", "delete", faygo.MIMEApplicationForm, "PUT POST"},
+		{"not allowed", "TRACE", "", "", "POST POST"},
+		{"field of JSON body", "", "delete", faygo.MIMEApplicationJSON, "POST POST"},
+	} {
+		var body string
+		if c.field != "" {
+			body = url.Values{MethodOverrideField: {c.field}}.Encode()
+		}
+		req, _ := http.NewRequest("POST", base+"/item", strings.NewReader(body))
+		if c.header != "" {
+			req.Header.Set(faygo.HeaderXHTTPMethodOverride, c.header)
+		}
+		if c.contentType != "" {
+			req.Header.Set(faygo.HeaderContentType, c.contentType)
+		}
+		if got := do(t, req); got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+	// only the POST requests are overridden
+	req, _ := http.NewRequest("PUT", base+"/item", nil)
+	req.Header.Set(faygo.HeaderXHTTPMethodOverride, "DELETE")
+	if got := do(t, req); got != "PUT PUT" {
+		t.Errorf("PUT: got %q", got)
+	}
+}
+
+// do sends the request, and returns the body of the 200 response.
+func do(t *testing.T, req *http.Request) string {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return resp.Status
+	}
+	return string(b)
+}
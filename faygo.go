@@ -16,11 +16,14 @@ package faygo
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
 	"net/http"
 	"os"
 	"reflect"
+	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -79,16 +82,31 @@ func GetFrame(name string, version ...string) (*Framework, bool) {
 }
 
 // Run starts all web services.
+// It panics with the aggregated errors if any of the services fails to listen.
 func Run() {
-	global.beforeRun()
+	if err := RunE(); err != nil {
+		Panic(err.Error())
+	}
+}
+
+// RunE is similar to Run, but returns the aggregated errors if any of the services fails to listen.
+// The services are started in the order of creation, and RunE blocks after all of them are listening.
+// Note: the services that have been started are not closed when an error is returned.
+func RunE() error {
+	if err := global.beforeRun(); err != nil {
+		return err
+	}
 	global.framesLock.Lock()
+	var errs []string
 	for _, frame := range global.frames {
-		if !frame.Running() {
-			go frame.run()
-			time.Sleep(time.Second)
+		if err := frame.run(); err != nil {
+			errs = append(errs, err.Error())
 		}
 	}
 	global.framesLock.Unlock()
+	if len(errs) > 0 {
+		return errors.New("failed to start services:\n" + strings.Join(errs, "\n"))
+	}
 	select {}
 }
 
@@ -122,37 +140,168 @@ func SetShutdown(timeout time.Duration, preCloseFunc, postCloseFunc func() error
 	global.postCloseFunc = postCloseFunc
 }
 
+// finalizer is a function called by order of priority after the services are closed.
+type finalizer struct {
+	priority int
+	fn       func() error
+}
+
+// AddFinalizer registers a function to be called after the services are closed and the postCloseFunc is called,
+// such as flushing the metrics or closing the database.
+// The finalizers are called one by one in ascending order of priority, and in the order of registration for the same priority,
+// all within the time-out period for the services shutdown.
+// The error or panic of one finalizer is logged and makes the shutdown not graceful, but does not prevent the others.
+func AddFinalizer(priority int, fn func() error) {
+	if fn == nil {
+		return
+	}
+	global.finalizersLock.Lock()
+	defer global.finalizersLock.Unlock()
+	i := sort.Search(len(global.finalizers), func(i int) bool {
+		return global.finalizers[i].priority > priority
+	})
+	global.finalizers = append(global.finalizers, finalizer{})
+	copy(global.finalizers[i+1:], global.finalizers[i:])
+	global.finalizers[i] = finalizer{priority: priority, fn: fn}
+}
+
+// runFinalizers calls the finalizers in order within ctx, returns false if any fails, panics or times out.
+func runFinalizers(ctx context.Context, action string) bool {
+	global.finalizersLock.Lock()
+	finalizers := make([]finalizer, len(global.finalizers))
+	copy(finalizers, global.finalizers)
+	global.finalizersLock.Unlock()
+
+	graceful := true
+	for _, f := range finalizers {
+		err := callSafe(ctx, f.fn)
+		if err == nil {
+			continue
+		}
+		graceful = false
+		Errorf("[%s-finalizer] priority %d: %s", action, f.priority, err.Error())
+		if ctx.Err() != nil {
+			// the rest can not be called within the time-out period
+			break
+		}
+	}
+	return graceful
+}
+
+// ErrShutdownNotGraceful is returned by ShutdownContext if the services are shut down,
+// but some requests, hooks or background tasks are abandoned, or the close functions fail.
+var ErrShutdownNotGraceful = errors.New("services are shut down, but not gracefully")
+
 // Shutdown closes all the frame services gracefully.
-// Parameter timeout is used to reset time-out period for the services shutdown.
+// Parameter timeout is used to reset time-out period for the services shutdown,
+// and the background tasks are waited for the background timeout after it.
+// It is a wrapper of ShutdownContext.
 func Shutdown(timeout ...time.Duration) {
+	if len(timeout) > 0 {
+		SetShutdown(timeout[0], global.preCloseFunc, global.postCloseFunc)
+	}
+	ctxTimeout, cancel := context.WithTimeout(context.Background(), totalShutdownTimeout())
+	defer cancel()
+	shutdownOnce(ctxTimeout, global.shutdownTimeout)
+}
+
+// ShutdownContext closes all the frame services gracefully, and then waits for the background tasks
+// for the background timeout, all within the ctx.
+// The loggers are closed at last, after all the frames are drained.
+// It returns nil only if every frame, hook, background task and close function completes
+// before ctx is done, otherwise ctx.Err() or ErrShutdownNotGraceful.
+// It is safe to call it repeatedly, the later calls wait for the first one and return its result.
+func ShutdownContext(ctx context.Context) error {
+	return shutdownOnce(ctx, 0)
+}
+
+// shutdownOnce shuts down the services once, the frames are limited to frameTimeout if it is positive.
+func shutdownOnce(ctx context.Context, frameTimeout time.Duration) error {
+	global.shutdownLock.Lock()
+	if done := global.shutdownDone; done != nil {
+		global.shutdownLock.Unlock()
+		select {
+		case <-done:
+			return global.shutdownErr
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	done := make(chan struct{})
+	global.shutdownDone = done
+	global.shutdownLock.Unlock()
+
+	global.shutdownErr = shutdownServices(ctx, frameTimeout)
+	close(done)
+	return global.shutdownErr
+}
+
+func shutdownServices(ctx context.Context, frameTimeout time.Duration) error {
+	graceful := closeServices(ctx, frameTimeout)
+	// all the frames are drained, so no more logs are written
+	CloseLog()
+	if graceful {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ErrShutdownNotGraceful
+}
+
+func closeServices(ctx context.Context, frameTimeout time.Duration) bool {
 	global.framesLock.Lock()
 	defer global.framesLock.Unlock()
-	defer CloseLog()
 	Print("\x1b[46m[SYS]\x1b[0m shutting down services...")
 
-	contextExec(timeout, "shutdown", func(ctxTimeout context.Context) <-chan struct{} {
-		endCh := make(chan struct{})
-		go func() {
-			defer close(endCh)
-
-			var graceful = true
+	var graceful = true
+	if global.preCloseFunc != nil {
+		if err := callContext(ctx, global.preCloseFunc); err != nil {
+			Errorf("[shutdown-preClose] %s", err.Error())
+			graceful = false
+		}
+	}
+	graceful = shutdown(ctx, frameTimeout, "shutdown") && graceful
+	if graceful {
+		Print("\x1b[46m[SYS]\x1b[0m services are shutted down gracefully!")
+	} else {
+		Print("\x1b[46m[SYS]\x1b[0m services are shutted down, but not gracefully!")
+	}
+	return graceful
+}
 
-			if global.preCloseFunc != nil {
-				if err := global.preCloseFunc(); err != nil {
-					Errorf("[shutdown-preClose] %s", err.Error())
-					graceful = false
-				}
-			}
+// totalShutdownTimeout returns the shutdown timeout plus the background timeout.
+func totalShutdownTimeout() time.Duration {
+	total := global.shutdownTimeout + global.backgroundTimeout
+	if total < global.shutdownTimeout {
+		total = 1<<63 - 1
+	}
+	return total
+}
 
-			graceful = shutdown(ctxTimeout, "shutdown") && graceful
+// callContext calls fn, but returns ctx.Err() if ctx is done first.
+func callContext(ctx context.Context, fn func() error) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- fn()
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-			if graceful {
-				Print("\x1b[46m[SYS]\x1b[0m services are shutted down gracefully!")
-			} else {
-				Print("\x1b[46m[SYS]\x1b[0m services are shutted down, but not gracefully!")
+// callSafe is similar to callContext, but converts the panic of fn to an error with the stack.
+func callSafe(ctx context.Context, fn func() error) error {
+	return callContext(ctx, func() (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("panic: %v\n%s", p, debug.Stack())
 			}
 		}()
-		return endCh
+		return fn()
 	})
 }
 
@@ -160,24 +309,32 @@ func contextExec(timeout []time.Duration, action string, deferCallback func(ctxT
 	if len(timeout) > 0 {
 		SetShutdown(timeout[0], global.preCloseFunc, global.postCloseFunc)
 	}
-	ctxTimeout, _ := context.WithTimeout(context.Background(), global.shutdownTimeout)
+	// the background tasks are waited for separately after the services are closed.
+	ctxTimeout, cancel := context.WithTimeout(context.Background(), totalShutdownTimeout())
+	defer cancel()
 	select {
 	case <-ctxTimeout.Done():
-		if err := ctxTimeout.Err(); err != nil {
-			Errorf("[%s-timeout] %s", action, err.Error())
-		}
+		Errorf("[%s-timeout] %s", action, context.DeadlineExceeded.Error())
 	case <-deferCallback(ctxTimeout):
 	}
 }
 
-func shutdown(ctxTimeout context.Context, action string) bool {
+// shutdown closes the frames, limited to frameTimeout if it is positive,
+// and then waits for the background tasks and calls the postCloseFunc within ctx.
+func shutdown(ctx context.Context, frameTimeout time.Duration, action string) bool {
 	var flag int32 = 1
 
+	ctxFrames := ctx
+	if frameTimeout > 0 {
+		var cancel context.CancelFunc
+		ctxFrames, cancel = context.WithTimeout(ctx, frameTimeout)
+		defer cancel()
+	}
 	count := new(sync.WaitGroup)
 	for _, frame := range global.frames {
 		count.Add(1)
 		go func(fm *Framework) {
-			graceful := fm.shutdown(ctxTimeout)
+			graceful := fm.shutdown(ctxFrames)
 			if !graceful {
 				atomic.StoreInt32(&flag, 0)
 			}
@@ -186,13 +343,21 @@ func shutdown(ctxTimeout context.Context, action string) bool {
 	}
 	count.Wait()
 
+	if !waitBackground(ctx, action) {
+		atomic.StoreInt32(&flag, 0)
+	}
+
 	if global.postCloseFunc != nil {
-		if err := global.postCloseFunc(); err != nil {
+		if err := callContext(ctx, global.postCloseFunc); err != nil {
 			atomic.StoreInt32(&flag, 0)
 			Errorf("[%s-postClose] %s", action, err.Error())
 		}
 	}
 
+	if !runFinalizers(ctx, action) {
+		atomic.StoreInt32(&flag, 0)
+	}
+
 	return flag == 1
 }
 
@@ -210,6 +375,52 @@ func SetErrorFunc(errorFunc ErrorFunc) {
 	}
 }
 
+// SetErrorTemplate sets the pongo2 template of the default error page of the status code,
+// such as the branded 404, 500 and 503 pages, an empty templatePath removes it.
+// The template gets the variables `status`, `status_text`, `error`, `method`, `path`, `url`,
+// `ip` and `trace_id`, besides the global ones.
+// The unmapped status codes, and the template failing to render, fall back to the generic page.
+// It does not work if the default `ErrorFunc` is replaced by SetErrorFunc.
+func SetErrorTemplate(status int, templatePath string) {
+	global.errorTemplatesLock.Lock()
+	defer global.errorTemplatesLock.Unlock()
+	if templatePath == "" {
+		delete(global.errorTemplates, status)
+		return
+	}
+	if global.errorTemplates == nil {
+		global.errorTemplates = make(map[int]string)
+	}
+	global.errorTemplates[status] = templatePath
+}
+
+// renderErrorTemplate renders the error page template of the status code, returns false if it is not mapped or fails.
+func renderErrorTemplate(ctx *Context, errStr string, status int) bool {
+	global.errorTemplatesLock.RLock()
+	templatePath, ok := global.errorTemplates[status]
+	global.errorTemplatesLock.RUnlock()
+	if !ok {
+		return false
+	}
+	b, err := global.render.Render(templatePath, ctx.renderData(Map{
+		"status":      status,
+		"status_text": http.StatusText(status),
+		"error":       errStr,
+		"method":      ctx.Method(),
+		"path":        ctx.Path(),
+		"url":         ctx.URI(),
+		"ip":          ctx.RealIP(),
+		"trace_id":    ctx.TraceID(),
+	}))
+	if err != nil {
+		ctx.Log().Errorf("error template %s: %s", templatePath, err.Error())
+		return false
+	}
+	ctx.W.Header().Set(HeaderXContentTypeOptions, nosniff)
+	ctx.Bytes(status, MIMETextHTMLCharsetUTF8, b)
+	return true
+}
+
 // DecodeBody decodes params from request body.
 func DecodeBody(dest reflect.Value, body []byte) error {
 	return global.bodydecoder(dest, body)
@@ -225,8 +436,9 @@ func SetBodydecoder(bodydecoder apiware.Bodydecoder) {
 }
 
 // HandleBinderror calls the default parameter binding failure handler.
+// The error which is not BindErrors is converted by apiware.AsBindErrors.
 func HandleBinderror(ctx *Context, err error) {
-	global.binderrorFunc(ctx, err)
+	global.binderrorFunc(ctx, apiware.AsBindErrors(err))
 }
 
 // SetBinderrorFunc sets the global default `BinderrorFunc` function.
@@ -270,19 +482,33 @@ func LogDir() string {
 	return global.logDir
 }
 
+// SetBanner sets the banner printed to stdout when the services are run for the first time,
+// the empty string disables it.
+// note: it should be called before Run()
+func SetBanner(s string) {
+	global.banner = s
+}
+
+// DisableBanner disables the banner printed to stdout when the services are run for the first time.
+// note: it should be called before Run()
+func DisableBanner() {
+	global.banner = ""
+}
+
+// SetPidFile sets the file to which the PID of the current process is written
+// when the services are run for the first time, the default is `LogDir()+"app.pid"`,
+// and the empty string disables it.
+// note: it should be called before Run()
+func SetPidFile(filename string) {
+	global.pidFile = filename
+	global.pidFileSet = true
+}
+
 // SetUpload sets upload folder path such as `./upload/`
 // with a slash `/` at the end.
 // note: it should be called before Run()
 func SetUpload(dir string, nocompress bool, nocache bool, handlers ...Handler) {
-	if !strings.HasSuffix(dir, "/") {
-		dir += "/"
-	}
-	global.upload = PresetStatic{
-		root:       dir,
-		nocompress: nocompress,
-		nocache:    nocache,
-		handlers:   handlers,
-	}
+	global.upload = newPresetStatic(dir, nocompress, nocache, handlers)
 }
 
 // UploadDir returns upload folder path with a slash at the end
@@ -292,12 +518,18 @@ func UploadDir() string {
 
 // SetStatic sets static folder path, such as `./staic/`
 // with a slash `/` at the end.
+// The handlers are the middlewares of the static route, such as StaticCacheControl.
 // note: it should be called before Run()
 func SetStatic(dir string, nocompress bool, nocache bool, handlers ...Handler) {
+	global.static = newPresetStatic(dir, nocompress, nocache, handlers)
+}
+
+// newPresetStatic creates a PresetStatic with the dir ending with a slash.
+func newPresetStatic(dir string, nocompress bool, nocache bool, handlers []Handler) PresetStatic {
 	if !strings.HasSuffix(dir, "/") {
 		dir += "/"
 	}
-	global.static = PresetStatic{
+	return PresetStatic{
 		root:       dir,
 		nocompress: nocompress,
 		nocache:    nocache,
@@ -305,13 +537,77 @@ func SetStatic(dir string, nocompress bool, nocache bool, handlers ...Handler) {
 	}
 }
 
+// SetStaticFS sets the file system of the static files, such as `http.FS(embedFS)`,
+// so that the static files can be embedded in the binary, for example:
+//
+//	//go:embed static
+//	var assets embed.FS
+//
+//	sub, _ := fs.Sub(assets, "static")
+//	faygo.SetStaticFS(http.FS(sub), false, false)
+//
+// The content hash of StaticURL is only available for the static files on the disk.
+// note: it should be called before Run()
+func SetStaticFS(fsys http.FileSystem, nocompress bool, nocache bool, handlers ...Handler) {
+	global.static = PresetStatic{
+		root:       global.static.root,
+		fs:         fsys,
+		nocompress: nocompress,
+		nocache:    nocache,
+		handlers:   handlers,
+	}
+}
+
+// SetTemplateFS sets the file system of the templates, such as `http.FS(embedFS)`,
+// so that the templates can be embedded in the binary.
+// The template names are the slash-separated paths in the file system, such as `view/index.html`.
+// note: it should be called before Run()
+func SetTemplateFS(fsys http.FileSystem) {
+	global.render.SetFS(fsys)
+}
+
 // StaticDir returns static folder path with a slash at the end
 func StaticDir() string {
 	return global.static.root
 }
 
-// CloseLog closes global loggers.
+// FileCacheStats returns the statistics of the global file cache,
+// which can be used to tune 'cache::size_mb'.
+// It is also published as the expvar `faygo_file_cache`, such as GET <prefix>/debug/vars of EnableAdmin.
+func FileCacheStats() CacheStats {
+	return global.fsManager.Stats()
+}
+
+// SetFileCacheBackend replaces the backend of the global file cache, such as the one shared across processes.
+// It must be called before Run, and takes effect only when 'cache::enable' is true.
+func SetFileCacheBackend(backend CacheBackend) {
+	global.fsManager.SetBackend(backend)
+}
+
+// SetFileSystem replaces the file system under the global file server manager, such as a cloud storage,
+// which is used by the static routes of the local directories, ctx.File and the template function `static`.
+// The names passed to it are the local file paths. If fsys is nil, the local disk is used.
+// It must be called before Run.
+func SetFileSystem(fsys http.FileSystem) {
+	global.fsManager.SetFileSystem(fsys)
+}
+
+// InvalidateFileCache removes the cached entries of the file from the global file cache,
+// such as after deploying the new static assets, and returns the number of the removed entries.
+func InvalidateFileCache(name string) int {
+	return global.fsManager.Invalidate(name)
+}
+
+// InvalidateAllFileCache removes all the entries from the global file cache.
+func InvalidateAllFileCache() {
+	global.fsManager.InvalidateAll()
+}
+
+// CloseLog closes global loggers and the loggers of all the frames.
 func CloseLog() {
+	for _, frame := range AllFrames() {
+		frame.CloseLog()
+	}
 	global.bizlog.Close()
 	global.syslog.Close()
 }
@@ -414,11 +710,20 @@ type (
 		framesLock sync.RWMutex
 		// global config
 		config GlobalConfig
+		// the global config set by Configure, and whether it has been applied, see initGlobal
+		configured  *GlobalConfig
+		initialized bool
+		initLock    sync.Mutex
 		// Error replies to the request with the specified error message and HTTP code.
 		// It does not otherwise end the request; the caller should ensure no further
 		// writes are done to response.
 		// The error message should be plain text.
 		errorFunc ErrorFunc
+		// the pongo2 templates of the default error pages by the status code
+		errorTemplates     map[int]string
+		errorTemplatesLock sync.RWMutex
+		// translates the errors returned by the handlers, see SetErrorMapper
+		errorMapper ErrorMapper
 		// The following is only for the APIHandler
 		binderrorFunc BinderrorFunc
 		// Decode params from request body.
@@ -443,6 +748,11 @@ type (
 
 		// The path for the log files
 		logDir string
+		// the banner printed and the PID file written by the first run,
+		// the PID file is `LogDir()+"app.pid"` unless pidFileSet.
+		banner     string
+		pidFile    string
+		pidFileSet bool
 
 		syslog *logging.Logger
 		bizlog *logging.Logger
@@ -453,12 +763,37 @@ type (
 		preCloseFunc func() error
 		// executed after services are closed, but not guaranteed to be completed.
 		postCloseFunc func() error
+		// the functions called by order of priority after the postCloseFunc
+		finalizers     []finalizer
+		finalizersLock sync.Mutex
+		// the background tasks started by Go and Context.Defer
+		background     *taskGroup
+		backgroundLock sync.RWMutex
+		// the time-out period for the background tasks after the services are closed.
+		backgroundTimeout time.Duration
+		// the stable client key hashed by Context.Bucket and Context.Variant.
+		bucketKeyFunc func(ctx *Context) string
+		// the predicate excluding the requests from the access log.
+		skipAccessLog func(ctx *Context) bool
+		// the JSON encoder and decoder, such as jsoniter.
+		jsonCodec JSONCodec
+		// the protobuf encoder and decoder, nil means the protobuf support is disabled.
+		protobufCodec ProtobufCodec
+		// limits the requests handled concurrently by all the frames, nil means unlimited.
+		limiter *concurrencyLimiter
+
+		// the first shutdown, which the later calls of ShutdownContext wait for.
+		shutdownLock sync.Mutex
+		shutdownDone chan struct{}
+		shutdownErr  error
 
 		beforeRunOnce sync.Once
+		beforeRunErr  error
 	}
 	// PresetStatic is the system default static file routing information
 	PresetStatic struct {
 		root       string
+		fs         http.FileSystem // if not nil, the files are served from it instead of the root directory
 		nocompress bool
 		nocache    bool
 		handlers   []Handler
@@ -468,31 +803,24 @@ type (
 var (
 	// global is the global configuration, functions and so on.
 	global = func() *GlobalVariables {
+		config := NewDefaultGlobalConfig()
 		global := &GlobalVariables{
-			frames:          []*Framework{},
-			config:          globalConfig,
-			errorFunc:       defaultErrorFunc,
-			bodydecoder:     defaultBodydecoder,
-			binderrorFunc:   defaultBinderrorFunc,
-			paramNameMapper: defaultParamNameMapper,
-			fsManager: newFileServerManager(
-				globalConfig.Cache.SizeMB*1024*1024,
-				globalConfig.Cache.ExpireSecond,
-				globalConfig.Cache.Enable,
-				globalConfig.Gzip.Enable,
-			),
-			upload:          defaultUpload,
-			static:          defaultStatic,
-			logDir:          defaultLogDir,
-			shutdownTimeout: MinShutdownTimeout,
-		}
-		if globalConfig.Cache.Enable {
-			global.render = newRender(func(name string) (http.File, error) {
-				return global.fsManager.Open(name, "", false)
-			})
-		} else {
-			global.render = newRender(nil)
+			frames:            []*Framework{},
+			config:            config,
+			paramNameMapper:   defaultParamNameMapper,
+			fsManager:         newGlobalFileServerManager(config),
+			render:            newRender(nil),
+			upload:            defaultUpload,
+			static:            defaultStatic,
+			logDir:            defaultLogDir,
+			banner:            banner[1:],
+			shutdownTimeout:   MinShutdownTimeout,
+			background:        newTaskGroup(),
+			backgroundTimeout: DefaultBackgroundTimeout,
+			bucketKeyFunc:     defaultBucketKey,
+			jsonCodec:         StdJSONCodec,
 		}
+		// the console logger only, the config is applied on creating the first frame
 		global.initLogger()
 		return global
 	}()
@@ -506,6 +834,9 @@ var (
 		if status >= 500 {
 			ctx.Log().Error(errStr)
 		}
+		if renderErrorTemplate(ctx, errStr, status) {
+			return
+		}
 		statusText := http.StatusText(status)
 		if len(errStr) > 0 {
 			errStr = `<br><p><b style="color:red;">[ERROR]</b> <pre>` + errStr + `</pre></p>`
@@ -519,18 +850,18 @@ var (
 			status, statusText, status, statusText, VERSION, errStr),
 		)
 	}
-	// The default body decoder is json format decoding
+	// The default body decoder is json format decoding by the global JSONCodec
 	defaultBodydecoder = func(dest reflect.Value, body []byte) error {
 		var err error
 		if dest.Kind() == reflect.Ptr {
-			err = json.Unmarshal(body, dest.Interface())
+			err = global.jsonCodec.Unmarshal(body, dest.Interface())
 		} else {
-			err = json.Unmarshal(body, dest.Addr().Interface())
+			err = global.jsonCodec.Unmarshal(body, dest.Addr().Interface())
 		}
 		return err
 	}
-	defaultBinderrorFunc = func(ctx *Context, err error) {
-		ctx.String(http.StatusBadRequest, "%v", err)
+	defaultBinderrorFunc = func(ctx *Context, errs BindErrors) {
+		ctx.String(http.StatusBadRequest, "%v", errs)
 	}
 	defaultParamNameMapper = SnakeString
 	// The default path for the upload files
@@ -546,14 +877,98 @@ var (
 )
 
 func init() {
-	fmt.Println(banner[1:])
-	global.syslog.Criticalf("The PID of the current process is %d", os.Getpid())
-	if global.config.warnMsg != "" {
-		Warning(global.config.warnMsg)
-		global.config.warnMsg = ""
+	// set here, since the default body decoder and error functions refer to global
+	global.bodydecoder = defaultBodydecoder
+	global.errorFunc = defaultErrorFunc
+	global.binderrorFunc = defaultBinderrorFunc
+	// the statistics of the file cache for the metrics, see FileCacheStats
+	expvar.Publish("faygo_file_cache", expvar.Func(func() interface{} { return FileCacheStats() }))
+}
+
+// ErrGlobalConfigured is returned by Configure if the global config has been applied.
+var ErrGlobalConfigured = errors.New("the global config has been applied, Configure must be called before creating the first frame")
+
+// Configure sets the global config instead of loading the config file `__global___.ini`,
+// such as for the tools and tests, starting from NewDefaultGlobalConfig.
+// It is applied on creating the first frame or running, and must be called before that,
+// otherwise ErrGlobalConfigured is returned.
+func Configure(config GlobalConfig) error {
+	for _, level := range []string{config.Log.ConsoleLevel, config.Log.FileLevel} {
+		if _, err := logging.LogLevel(level); err != nil {
+			return err
+		}
+	}
+	config.check()
+	global.initLock.Lock()
+	defer global.initLock.Unlock()
+	if global.initialized {
+		return ErrGlobalConfigured
+	}
+	global.configured = &config
+	return nil
+}
+
+// initGlobal applies the global config once, which is set by Configure or loaded from the file.
+// It is called on creating the first frame or running, so that importing the package
+// creates no file or directory.
+func initGlobal() {
+	global.initLock.Lock()
+	defer global.initLock.Unlock()
+	if global.initialized {
+		return
+	}
+	global.initialized = true
+	if global.configured != nil {
+		global.applyConfig(*global.configured)
+	} else {
+		global.applyConfig(loadGlobalConfig())
+	}
+}
+
+// applyConfig applies the global config, such as the file cache, the loggers and the gzip.
+func (g *GlobalVariables) applyConfig(config GlobalConfig) {
+	g.config = config
+	// keep the settings of the manager made before, such as SetFileSystem
+	g.fsManager.applyGlobalConfig(config)
+	g.render.Lock()
+	if config.Cache.Enable {
+		g.render.openCacheFile = func(name string) (http.File, error) {
+			return g.fsManager.OpenFile(g.render.fs, name, "", false)
+		}
+		g.render.caching = true
+	}
+	g.render.strictEscaping = config.Template.StrictEscaping
+	g.render.Unlock()
+	if !config.Log.FileEnable {
+		os.MkdirAll(g.logDir, 0777)
+	}
+	g.initLogger()
+	if g.config.warnMsg != "" {
+		Warning(g.config.warnMsg)
+		g.config.warnMsg = ""
 	}
 	// init file cache
-	acceptencoder.InitGzip(global.config.Gzip.MinLength, global.config.Gzip.CompressLevel, global.config.Gzip.Methods)
+	acceptencoder.InitGzip(config.Gzip.MinLength, config.Gzip.CompressLevel, config.Gzip.Methods)
+	acceptencoder.SetExcludedContentTypes(config.Gzip.ExcludedContentTypes)
+}
+
+// newGlobalFileServerManager creates the global file cache system manager with the config.
+func newGlobalFileServerManager(config GlobalConfig) *FileServerManager {
+	manager := newFileServerManager(0, 0, "", "", false, false)
+	manager.applyGlobalConfig(config)
+	return manager
+}
+
+// applyGlobalConfig applies the cache and gzip options of the global config to the manager.
+func (c *FileServerManager) applyGlobalConfig(config GlobalConfig) {
+	c.configure(
+		config.Cache.SizeMB*1024*1024,
+		config.Cache.ExpireSecond,
+		config.Cache.Backend,
+		config.Cache.EvictionPolicy,
+		config.Cache.Enable,
+		config.Gzip.Enable,
+	)
 }
 
 func addFrame(frame *Framework) {
@@ -568,10 +983,38 @@ func addFrame(frame *Framework) {
 	global.frames = append(global.frames, frame)
 }
 
-func (g *GlobalVariables) beforeRun() {
+// printBanner prints the banner to stdout, and logs the PID of the current process.
+func (g *GlobalVariables) printBanner() {
+	if g.banner != "" {
+		fmt.Fprintln(os.Stdout, g.banner)
+	}
+	g.syslog.Noticef("The PID of the current process is %d", os.Getpid())
+}
+
+// pidFilename returns the PID file set by SetPidFile, or the one in the log folder by default.
+func (g *GlobalVariables) pidFilename() string {
+	if g.pidFileSet {
+		return g.pidFile
+	}
+	return g.logDir + "app.pid"
+}
+
+func (g *GlobalVariables) beforeRun() error {
+	initGlobal()
 	g.beforeRunOnce.Do(func() {
 		resetFlag()
-		WritePid(LogDir() + "app.pid")
+		if conf := g.config.Template; conf.Precompile {
+			if g.beforeRunErr = g.render.Precompile(conf.Dir, conf.Extensions...); g.beforeRunErr != nil {
+				return
+			}
+		}
+		g.printBanner()
+		if pidFile := g.pidFilename(); pidFile != "" {
+			if err := WritePid(pidFile); err != nil {
+				g.syslog.Warningf("Failed to write the PID file %s: %v", pidFile, err)
+			}
+		}
 		go graceSignal()
 	})
+	return g.beforeRunErr
 }
@@ -13,3 +13,1057 @@
 // limitations under the License.
 
 package faygo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestFrame creates a frame that does not touch the config, static or upload directories.
+func newTestFrame(t *testing.T, name string) *Framework {
+	config := NewDefaultConfig()
+	config.APIdoc.Enable = false
+	config.Router.DefaultUpload = false
+	config.Router.DefaultStatic = false
+	return NewWithConfig(config, name)
+}
+
+// serveTest builds the frame and serves the request.
+func serveTest(frame *Framework, req *http.Request) *httptest.ResponseRecorder {
+	frame.build()
+	rec := httptest.NewRecorder()
+	frame.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRunListenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	frame := newTestFrame(t, "run_listen_error_test")
+	frame.config.Addrs = []string{ln.Addr().String()}
+	if err = frame.run(); err == nil {
+		t.Fatal("expected an error when the address is already in use")
+	}
+	if frame.Running() {
+		t.Fatal("the frame should not be running after a listen error")
+	}
+}
+
+func TestOnShutdown(t *testing.T) {
+	frame := newTestFrame(t, "on_shutdown_test")
+	frame.config.Addrs = []string{"127.0.0.1:0"}
+	frame.config.PreStopDelay = 10 * time.Millisecond
+	var calls []int
+	frame.OnShutdown(func() {
+		if !frame.ShuttingDown() {
+			t.Error("ShuttingDown should be true in the OnShutdown functions")
+		}
+		calls = append(calls, 1)
+	})
+	frame.OnShutdown(func() { panic("hook panic") })
+	frame.OnShutdown(func() { calls = append(calls, 3) })
+	if err := frame.run(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if frame.shutdown(ctx) {
+		t.Fatal("the panic of OnShutdown function should be reported")
+	}
+	if len(calls) != 2 || calls[0] != 1 || calls[1] != 3 {
+		t.Fatalf("OnShutdown calls: got %v, want [1 3]", calls)
+	}
+	if frame.Running() || frame.ShuttingDown() {
+		t.Fatal("the frame should be stopped")
+	}
+}
+
+func TestAddFinalizer(t *testing.T) {
+	saved := global.finalizers
+	global.finalizers = nil
+	defer func() { global.finalizers = saved }()
+
+	var calls []int
+	AddFinalizer(2, func() error { calls = append(calls, 3); return nil })
+	AddFinalizer(0, func() error { calls = append(calls, 1); return errors.New("flush failed") })
+	AddFinalizer(2, func() error { calls = append(calls, 4); panic("close panic") })
+	AddFinalizer(1, func() error { calls = append(calls, 2); return nil })
+	AddFinalizer(3, nil)
+	if runFinalizers(context.Background(), "shutdown") {
+		t.Fatal("the error and panic of the finalizers should be reported")
+	}
+	if fmt.Sprint(calls) != "[1 2 3 4]" {
+		t.Fatalf("finalizer calls: got %v, want [1 2 3 4]", calls)
+	}
+
+	// the rest are abandoned after the time-out period
+	global.finalizers = nil
+	var called int32
+	AddFinalizer(0, func() error { time.Sleep(100 * time.Millisecond); return nil })
+	AddFinalizer(1, func() error { atomic.AddInt32(&called, 1); return nil })
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if runFinalizers(ctx, "shutdown") {
+		t.Fatal("the timeout of the finalizers should be reported")
+	}
+	if atomic.LoadInt32(&called) != 0 {
+		t.Fatal("the finalizers after the timeout should not be called")
+	}
+}
+
+func TestContextDeadline(t *testing.T) {
+	frame := newTestFrame(t, "context_deadline_test")
+	frame.config.WriteTimeout = time.Minute
+	var deadline time.Time
+	var hasDeadline bool
+	var reqCtx context.Context
+	frame.GET("/", HandlerFunc(func(ctx *Context) error {
+		deadline, hasDeadline = ctx.Context().Deadline()
+		reqCtx = ctx.Context()
+		return ctx.String(200, "ok")
+	}))
+	start := time.Now()
+	serveTest(frame, httptest.NewRequest("GET", "/", nil))
+	if !hasDeadline || deadline.Before(start.Add(time.Minute)) || deadline.After(time.Now().Add(time.Minute)) {
+		t.Fatalf("deadline: got %v, %v", deadline, hasDeadline)
+	}
+	if reqCtx.Err() != context.Canceled {
+		t.Fatalf("the context is not canceled after the request: %v", reqCtx.Err())
+	}
+
+	frame.config.WriteTimeout = 0
+	serveTest(frame, httptest.NewRequest("GET", "/", nil))
+	if hasDeadline {
+		t.Fatal("unexpected deadline without write timeout")
+	}
+}
+
+func TestContextCanceled(t *testing.T) {
+	frame := newTestFrame(t, "context_canceled_test")
+	frame.config.WriteTimeout = time.Minute
+	started := make(chan struct{})
+	var deadlineOK bool
+	var renderErr error
+	frame.GET("/wait", HandlerFunc(func(ctx *Context) error {
+		_, deadlineOK = ctx.Deadline()
+		close(started)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return ctx.String(200, "late")
+		}
+	}))
+	frame.GET("/render", HandlerFunc(func(ctx *Context) error {
+		renderErr = ctx.JSON(200, Map{"a": 1})
+		return renderErr
+	}))
+	frame.GET("/panic", HandlerFunc(func(ctx *Context) error {
+		<-ctx.Done()
+		panic("panic after the client is gone")
+	}))
+
+	c, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	rec := serveTest(frame, httptest.NewRequest("GET", "/wait", nil).WithContext(c))
+	if !deadlineOK {
+		t.Fatal("Deadline should report the write timeout")
+	}
+	if rec.Body.Len() != 0 {
+		t.Fatalf("nothing should be written after the client is gone: got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = serveTest(frame, httptest.NewRequest("GET", "/render", nil).WithContext(c))
+	if renderErr != ErrClientClosed || rec.Body.Len() != 0 {
+		t.Fatalf("render: got %v %q, want ErrClientClosed", renderErr, rec.Body.String())
+	}
+
+	// the panic is recovered, but no error page is written
+	rec = serveTest(frame, httptest.NewRequest("GET", "/panic", nil).WithContext(c))
+	if rec.Body.Len() != 0 {
+		t.Fatalf("panic: got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = serveTest(frame, httptest.NewRequest("GET", "/render", nil))
+	if renderErr != nil || rec.Body.String() != `{"a":1}` {
+		t.Fatalf("render: got %v %q", renderErr, rec.Body.String())
+	}
+}
+
+func TestRunUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faygo_unix_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "app.sock")
+	// leave a stale socket file
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skip("unix socket is not supported:", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	frame := newTestFrame(t, "unix_socket_test")
+	frame.config.Addrs = []string{"unix:" + sock}
+	frame.config.unixFileMode = 0600
+	frame.GET("/", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, "ok")
+	}))
+	if err = frame.run(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(sock); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("socket file: got %v, %v", info, err)
+	}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return new(net.Dialer).DialContext(ctx, "unix", sock)
+		},
+	}}
+	resp, err := client.Get("http://unix/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "ok" {
+		t.Fatalf("got %q", b)
+	}
+	client.CloseIdleConnections()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	frame.shutdown(ctx)
+	if _, err = os.Stat(sock); !os.IsNotExist(err) {
+		t.Fatalf("the socket file is not removed on shutdown: %v", err)
+	}
+}
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestAddListener(t *testing.T) {
+	// borrow the self-signed certificate of httptest
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	defer ts.Close()
+
+	frame := newTestFrame(t, "add_listener_test")
+	internalAddr, publicAddr := freeAddr(t), freeAddr(t)
+	frame.config.Addrs = []string{internalAddr}
+	frame.AddListener(Listener{
+		NetType:   NETTYPE_HTTPS,
+		Addr:      publicAddr,
+		TLSConfig: &tls.Config{Certificates: ts.TLS.Certificates},
+	})
+	frame.GET("/", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, strconv.FormatBool(ctx.IsSecure()))
+	}))
+	if err := frame.run(); err != nil {
+		t.Fatal(err)
+	}
+	client := ts.Client()
+	for url, want := range map[string]string{
+		"http://" + internalAddr + "/": "false",
+		"https://" + publicAddr + "/":  "true",
+	} {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(b) != want {
+			t.Fatalf("%s: got %q, want %q", url, b, want)
+		}
+	}
+	client.CloseIdleConnections()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if !frame.shutdown(ctx) {
+		t.Fatal("shutdown is not graceful")
+	}
+	for _, addr := range []string{internalAddr, publicAddr} {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			t.Fatalf("%s is still listening after shutdown", addr)
+		}
+	}
+}
+
+func TestRedirectHTTP(t *testing.T) {
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	defer ts.Close()
+
+	frame := newTestFrame(t, "redirect_http_test")
+	httpAddr, httpsAddr := freeAddr(t), freeAddr(t)
+	frame.config.Addrs = []string{httpAddr}
+	frame.AddListener(Listener{
+		NetType:   NETTYPE_HTTPS,
+		Addr:      httpsAddr,
+		TLSConfig: &tls.Config{Certificates: ts.TLS.Certificates},
+	})
+	if err := frame.RedirectHTTP(true); err != nil {
+		t.Fatal(err)
+	}
+	frame.API("GET POST", "/*path", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, ctx.Method()+" "+ctx.URI())
+	}))
+	if err := frame.run(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		frame.shutdown(ctx)
+	}()
+	if !frame.Running() {
+		t.Fatal("the frame should be running with both listeners up")
+	}
+	if err := frame.RedirectHTTP(false); err != ErrFrameRunning {
+		t.Fatalf("RedirectHTTP while running: got %v", err)
+	}
+
+	client := ts.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	_, httpsPort, _ := net.SplitHostPort(httpsAddr)
+	for method, code := range map[string]int{"GET": 301, "POST": 308} {
+		req, _ := http.NewRequest(method, "http://"+httpAddr+"/a/b?x=1&y=2", nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want := "https://127.0.0.1:" + httpsPort + "/a/b?x=1&y=2"; resp.StatusCode != code || resp.Header.Get("Location") != want {
+			t.Fatalf("%s: got %d %q, want %d %q", method, resp.StatusCode, resp.Header.Get("Location"), code, want)
+		}
+	}
+	resp, err := client.Post("https://"+httpsAddr+"/a/b?x=1", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(b) != "POST /a/b?x=1" {
+		t.Fatalf("https: got %d %q", resp.StatusCode, b)
+	}
+	client.CloseIdleConnections()
+
+	// the default port is omitted, and the ACME HTTP-01 challenges are served with letsencrypt
+	frame = newTestFrame(t, "redirect_http_acme_test")
+	frame.GET("/*path", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, ctx.Path())
+	}))
+	frame.httpRedirectHttps, frame.httpsPort, frame.acmeChallenge = true, "443", true
+	if rec := serveTest(frame, httptest.NewRequest("GET", "http://example.com/x", nil)); rec.Code != 301 || rec.Header().Get("Location") != "https://example.com/x" {
+		t.Fatalf("default port: got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := serveTest(frame, httptest.NewRequest("GET", "http://example.com/.well-known/acme-challenge/token", nil)); rec.Code != 200 {
+		t.Fatalf("ACME challenge: got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestActiveConnections(t *testing.T) {
+	frame := newTestFrame(t, "active_connections_test")
+	addr := freeAddr(t)
+	frame.config.Addrs = []string{addr}
+	release := make(chan struct{})
+	frame.GET("/wait", HandlerFunc(func(ctx *Context) error {
+		<-release
+		return ctx.String(200, "ok")
+	}))
+	frame.GET("/hijack", HandlerFunc(func(ctx *Context) error {
+		conn, _, err := ctx.W.Hijack()
+		if err != nil {
+			return err
+		}
+		conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"))
+		return conn.Close()
+	}))
+	if err := frame.run(); err != nil {
+		t.Fatal(err)
+	}
+	waitStats := func(want ConnStats) {
+		deadline := time.Now().Add(time.Second)
+		for frame.ActiveConnections() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("connections: got %+v, want %+v", frame.ActiveConnections(), want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	client := &http.Client{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := client.Get("http://" + addr + "/wait")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}()
+	waitStats(ConnStats{Active: 1, Requests: 1})
+	close(release)
+	<-done
+	waitStats(ConnStats{Idle: 1})
+
+	client.CloseIdleConnections()
+	waitStats(ConnStats{})
+	resp, err := http.Get("http://" + addr + "/hijack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	waitStats(ConnStats{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if !frame.shutdown(ctx) {
+		t.Fatal("shutdown is not graceful")
+	}
+}
+
+func TestShutdownStreams(t *testing.T) {
+	frame := newTestFrame(t, "shutdown_streams_test")
+	addr := freeAddr(t)
+	frame.config.Addrs = []string{addr}
+	frame.config.ShutdownPolicy = ShutdownPolicyClose
+	frame.GET("/ws", HandlerFunc(func(ctx *Context) error {
+		conn, rw, err := ctx.W.Hijack()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+		// block until the connection is closed
+		rw.ReadByte()
+		return nil
+	}))
+	frame.GET("/sse", HandlerFunc(func(ctx *Context) error {
+		ctx.SetHeader(HeaderContentType, MIMEEventStream)
+		ctx.W.WriteHeader(200)
+		ctx.W.Write([]byte("data: hello\n\n"))
+		ctx.W.Flush()
+		<-ctx.R.Context().Done()
+		return nil
+	}))
+	if err := frame.run(); err != nil {
+		t.Fatal(err)
+	}
+
+	ws, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	fmt.Fprintf(ws, "GET /ws HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n", addr)
+	wsr := bufio.NewReader(ws)
+	resp, err := http.ReadResponse(wsr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 101 {
+		t.Fatalf("websocket status: got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest("GET", "http://"+addr+"/sse", nil)
+	req.Header.Set(HeaderAccept, MIMEEventStream)
+	sse, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sse.Body.Close()
+	sser := bufio.NewReader(sse.Body)
+	if line, _ := sser.ReadString('\n'); line != "data: hello\n" {
+		t.Fatalf("sse event: got %q", line)
+	}
+	if n := frame.ActiveStreams(); n != 2 {
+		t.Fatalf("active streams: got %d, want 2", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	graceful := make(chan bool, 1)
+	go func() { graceful <- frame.shutdown(ctx) }()
+
+	ws.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	closeFrame := make([]byte, 4)
+	if _, err := io.ReadFull(wsr, closeFrame); err != nil {
+		t.Fatalf("websocket close frame: %v", err)
+	}
+	if !bytes.Equal(closeFrame, []byte{0x88, 0x02, 0x03, 0xE9}) {
+		t.Fatalf("websocket close frame: got %x", closeFrame)
+	}
+	rest, _ := ioutil.ReadAll(sser)
+	if !strings.Contains(string(rest), ": server shutting down\n\n") {
+		t.Fatalf("sse goodbye: got %q", rest)
+	}
+	select {
+	case ok := <-graceful:
+		if !ok {
+			t.Fatal("shutdown is not graceful")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("shutdown is not finished")
+	}
+	if n := frame.ActiveStreams(); n != 0 {
+		t.Fatalf("active streams after shutdown: got %d", n)
+	}
+}
+
+func TestDiscardBodyOnEarlyError(t *testing.T) {
+	frame := newTestFrame(t, "discard_body_test")
+	addr := freeAddr(t)
+	frame.config.Addrs = []string{addr}
+	frame.config.maxDrainBody = 64
+	frame.POST("/reject", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(401, "unauthorized")
+	}))
+	frame.GET("/ok", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, "ok")
+	}))
+	if err := frame.run(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		frame.shutdown(ctx)
+	}()
+	pipeline := func(reqs string) (*bufio.Reader, net.Conn) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(3 * time.Second))
+		if _, err = conn.Write([]byte(reqs)); err != nil {
+			t.Fatal(err)
+		}
+		return bufio.NewReader(conn), conn
+	}
+	readResponse := func(br *bufio.Reader, wantStatus int) *http.Response {
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			t.Fatalf("status: got %d, want %d", resp.StatusCode, wantStatus)
+		}
+		return resp
+	}
+
+	// the unread body of the rejected request is discarded, and the next request is served
+	br, conn := pipeline("POST /reject HTTP/1.1\r\nHost: x\r\nContent-Length: 11\r\n\r\nhello world" +
+		"GET /ok HTTP/1.1\r\nHost: x\r\n\r\n")
+	if resp := readResponse(br, 401); resp.Close {
+		t.Fatal("the connection should be kept alive")
+	}
+	readResponse(br, 200)
+	conn.Close()
+
+	// the connection is closed if the body is too large
+	br, conn = pipeline("POST /reject HTTP/1.1\r\nHost: x\r\nContent-Length: 100\r\n\r\n" + strings.Repeat("x", 100) +
+		"GET /ok HTTP/1.1\r\nHost: x\r\n\r\n")
+	if resp := readResponse(br, 401); !resp.Close {
+		t.Fatal("the connection should be closed")
+	}
+	conn.Close()
+
+	// no 100 Continue for the rejected request
+	br, conn = pipeline("POST /reject HTTP/1.1\r\nHost: x\r\nContent-Length: 11\r\nExpect: 100-continue\r\n\r\n")
+	if resp := readResponse(br, 401); !resp.Close {
+		t.Fatal("the connection should be closed without the body")
+	}
+	conn.Close()
+}
+
+func TestConfigureServer(t *testing.T) {
+	frame := newTestFrame(t, "configure_server_test")
+	addr := freeAddr(t)
+	frame.config.Addrs = []string{addr}
+	frame.config.ReadHeaderTimeout = 100 * time.Millisecond
+	frame.GET("/", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, "ok")
+	}))
+	var newConns int32
+	err := frame.ConfigureServer(func(srv *http.Server) {
+		srv.MaxHeaderBytes = 4 * KB
+		srv.ConnState = func(_ net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				atomic.AddInt32(&newConns, 1)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = frame.run(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		frame.shutdown(ctx)
+	}()
+	if err = frame.ConfigureServer(func(*http.Server) {}); err != ErrFrameRunning {
+		t.Fatalf("ConfigureServer after running: got %v", err)
+	}
+
+	// a slow client never finishes the headers
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	start := time.Now()
+	conn.SetDeadline(start.Add(3 * time.Second))
+	if _, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: x\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(conn)
+	if cost := time.Since(start); cost > time.Second {
+		t.Fatalf("the slow connection is not closed by read_header_timeout, cost %s", cost)
+	}
+	if n := atomic.LoadInt32(&newConns); n != 1 {
+		t.Fatalf("the custom ConnState hook: got %d new connections, want 1", n)
+	}
+
+	req, _ := http.NewRequest("GET", "http://"+addr+"/", nil)
+	req.Header.Set("X-Large", strings.Repeat("x", 8*KB))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Fatalf("large headers: got %d", resp.StatusCode)
+	}
+}
+
+type baseContextKey struct{}
+
+func TestConfigureServerTLS(t *testing.T) {
+	// borrow the self-signed certificate of httptest
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	defer ts.Close()
+
+	frame := newTestFrame(t, "configure_server_tls_test")
+	httpAddr, httpsAddr := freeAddr(t), freeAddr(t)
+	frame.config.NetTypes = []string{NETTYPE_HTTP, NETTYPE_HTTPS}
+	frame.config.Addrs = []string{httpAddr, httpsAddr}
+	frame.GET("/", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, "%v", ctx.R.Context().Value(baseContextKey{}))
+	}))
+	frame.ConfigureServer(func(srv *http.Server) {
+		srv.TLSConfig = &tls.Config{Certificates: ts.TLS.Certificates}
+		srv.BaseContext = func(net.Listener) context.Context {
+			return context.WithValue(context.Background(), baseContextKey{}, "base")
+		}
+	})
+	if err := frame.run(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		frame.shutdown(ctx)
+	}()
+	client := ts.Client()
+	defer client.CloseIdleConnections()
+	for _, url := range []string{"http://" + httpAddr + "/", "https://" + httpsAddr + "/"} {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(b) != "base" {
+			t.Fatalf("%s: got %q", url, b)
+		}
+	}
+}
+
+func TestPerFrameDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faygo_frame_dirs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	newFrame := func(name string) *Framework {
+		frame := newTestFrame(t, name)
+		frame.config.Router.DefaultUpload = true
+		frame.config.Router.DefaultStatic = true
+		for _, sub := range []string{"upload", "static"} {
+			root := filepath.Join(dir, name, sub)
+			os.MkdirAll(root, 0777)
+			ioutil.WriteFile(filepath.Join(root, "a.txt"), []byte(name+" "+sub), 0644)
+		}
+		frame.SetUpload(filepath.Join(dir, name, "upload"), true, true)
+		frame.SetStatic(filepath.Join(dir, name, "static"), true, true)
+		return frame
+	}
+	for _, name := range []string{"frame_dirs_a", "frame_dirs_b"} {
+		frame := newFrame(name)
+		if want := filepath.Join(dir, name, "upload") + "/"; frame.UploadDir() != want {
+			t.Fatalf("%s upload dir: got %q, want %q", name, frame.UploadDir(), want)
+		}
+		for _, sub := range []string{"upload", "static"} {
+			rec := serveTest(frame, httptest.NewRequest("GET", "/"+sub+"/a.txt", nil))
+			if rec.Body.String() != name+" "+sub {
+				t.Fatalf("%s GET /%s/a.txt: got %d %q", name, sub, rec.Code, rec.Body.String())
+			}
+		}
+	}
+	if frame := newTestFrame(t, "frame_dirs_default"); frame.UploadDir() != UploadDir() || frame.StaticDir() != StaticDir() || frame.LogDir() != LogDir() {
+		t.Fatal("the frame without settings should use the global dirs")
+	}
+
+	// each frame has its own bizlog file
+	global.config.Log.FileEnable = true
+	fileBackend = global.newFileBackend(filepath.Join(dir, "faygo.log"))
+	defer func() {
+		fileBackend.Close()
+		global.config.Log.FileEnable = false
+		fileBackend = nil
+	}()
+	frame := newTestFrame(t, "frame/dirs_log")
+	frame.SetLogDir(filepath.Join(dir, "log"))
+	if _, err = os.Stat(LogDir() + "frame_dirs_log.log"); !os.IsNotExist(err) {
+		t.Fatalf("the empty bizlog file in the default folder should be removed: %v", err)
+	}
+	frame.Log().Warning("tenant log")
+	// the shutdown closes the loggers of the frame, flushing the bizlog file
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	frame.shutdown(ctx)
+	frame.Log().Warning("after shutdown")
+	b, err := ioutil.ReadFile(filepath.Join(dir, "log", "frame_dirs_log.log"))
+	if err != nil || !strings.Contains(string(b), "tenant log") || strings.Contains(string(b), "after shutdown") {
+		t.Fatalf("bizlog file: got %q, %v", b, err)
+	}
+}
+
+func TestFrameLogLevel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faygo_frame_log_level")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	global.config.Log.FileEnable = true
+	global.config.Log.FileLevel = "info"
+	fileBackend = global.newFileBackend(filepath.Join(dir, "faygo.log"))
+	defer func() {
+		fileBackend.Close()
+		fileBackend = nil
+		global.config.Log.FileEnable = false
+		global.config.Log.FileLevel = "debug"
+	}()
+	newFrame := func(name, level string) *Framework {
+		config := NewDefaultConfig()
+		config.APIdoc.Enable = false
+		config.Router.DefaultUpload = false
+		config.Router.DefaultStatic = false
+		config.LogLevel = level
+		frame := NewWithConfig(config, name)
+		frame.SetLogDir(dir)
+		return frame
+	}
+	admin := newFrame("log_level_admin", "debug")
+	api := newFrame("log_level_api", "")
+	for _, frame := range []*Framework{admin, api} {
+		frame.Log().Debug("debug line")
+		frame.Log().Info("info line")
+		frame.fileBackend.Close()
+	}
+	read := func(frame *Framework) string {
+		b, err := ioutil.ReadFile(filepath.Join(dir, frame.logFileName()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	if s := read(admin); !strings.Contains(s, "[D] [log_level_admin] debug line") || !strings.Contains(s, "[I] [log_level_admin] info line") {
+		t.Fatalf("admin bizlog: got %q", s)
+	}
+	if s := read(api); strings.Contains(s, "debug line") || !strings.Contains(s, "[I] [log_level_api] info line") {
+		t.Fatalf("api bizlog: got %q", s)
+	}
+}
+
+func TestRestartTimeouts(t *testing.T) {
+	frame := newTestFrame(t, "restart_timeouts_test")
+	addr := freeAddr(t)
+	frame.config.Addrs = []string{addr}
+	frame.config.ReadTimeout = 5 * time.Second
+	frame.GET("/", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, "ok")
+	}))
+	if err := frame.run(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		frame.shutdown(ctx)
+	}()
+	check := func(want Config) {
+		srv := frame.servers[0].Server
+		if srv.ReadTimeout != want.ReadTimeout || srv.WriteTimeout != want.WriteTimeout ||
+			srv.ReadHeaderTimeout != want.ReadHeaderTimeout || srv.IdleTimeout != want.IdleTimeout {
+			t.Fatalf("server timeouts: got %v %v %v %v", srv.ReadTimeout, srv.WriteTimeout, srv.ReadHeaderTimeout, srv.IdleTimeout)
+		}
+		resp, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Fatalf("GET /: got %d", resp.StatusCode)
+		}
+	}
+	check(frame.config)
+
+	frame.config.ReadHeaderTimeout = 3 * time.Second
+	frame.config.IdleTimeout = 30 * time.Second
+	if err := frame.Restart(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	check(frame.config)
+}
+
+type fakeHTTP3Server struct {
+	addr      string
+	handler   http.Handler
+	tlsConfig *tls.Config
+	closed    chan struct{}
+}
+
+func (s *fakeHTTP3Server) ListenAndServe() error {
+	<-s.closed
+	return http.ErrServerClosed
+}
+
+func (s *fakeHTTP3Server) Close() error {
+	close(s.closed)
+	return nil
+}
+
+func TestHTTP3(t *testing.T) {
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	defer ts.Close()
+
+	frame := newTestFrame(t, "http3_test")
+	addr := freeAddr(t)
+	frame.config.Addrs = []string{}
+	frame.config.NetTypes = []string{}
+	frame.config.HTTP3 = true
+	frame.AddListener(Listener{
+		NetType:   NETTYPE_HTTPS,
+		Addr:      addr,
+		TLSConfig: &tls.Config{Certificates: ts.TLS.Certificates},
+	})
+	frame.GET("/", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, "ok")
+	}))
+	if err := frame.run(); err == nil || !strings.Contains(err.Error(), "SetHTTP3") {
+		t.Fatalf("run without SetHTTP3: got %v", err)
+	}
+	var h3 *fakeHTTP3Server
+	frame.SetHTTP3(func(addr string, handler http.Handler, tlsConfig *tls.Config) HTTP3Server {
+		h3 = &fakeHTTP3Server{addr: addr, handler: handler, tlsConfig: tlsConfig, closed: make(chan struct{})}
+		return h3
+	})
+	if err := frame.run(); err != nil {
+		t.Fatal(err)
+	}
+	if h3 == nil || h3.addr != addr || h3.tlsConfig == nil || len(h3.tlsConfig.Certificates) == 0 {
+		t.Fatalf("the HTTP/3 server is not created with the https listener: %+v", h3)
+	}
+	if err := frame.SetHTTP3(nil); err != ErrFrameRunning {
+		t.Fatalf("SetHTTP3 while running: got %v", err)
+	}
+
+	client := ts.Client()
+	resp, err := client.Get("https://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	_, port, _ := net.SplitHostPort(addr)
+	if got, want := resp.Header.Get(HeaderAltSvc), `h3=":`+port+`"; ma=86400`; got != want {
+		t.Fatalf("Alt-Svc: got %q, want %q", got, want)
+	}
+	client.CloseIdleConnections()
+
+	rec := httptest.NewRecorder()
+	h3.handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != 200 || rec.Body.String() != "ok" {
+		t.Fatalf("HTTP/3 handler: got %d %q", rec.Code, rec.Body.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if !frame.shutdown(ctx) {
+		t.Fatal("shutdown is not graceful")
+	}
+	select {
+	case <-h3.closed:
+	default:
+		t.Fatal("the HTTP/3 server is not closed on shutdown")
+	}
+}
+
+func TestShutdownContext(t *testing.T) {
+	frame := newTestFrame(t, "shutdown_context_test")
+	frame.config.Addrs = []string{freeAddr(t)}
+	release := make(chan struct{})
+	started := make(chan struct{})
+	frame.GET("/wait", HandlerFunc(func(ctx *Context) error {
+		close(started)
+		<-release
+		return ctx.String(200, "ok")
+	}))
+
+	// shut down only the test frame, with the loggers which can be closed
+	global.framesLock.Lock()
+	frames, bizlog, syslog := global.frames, global.bizlog, global.syslog
+	global.frames = []*Framework{frame}
+	global.bizlog = global.newLogger("shutdown_context_test", "%{message}", "%{message}", nil)
+	global.syslog = global.newLogger("shutdown_context_test", "%{message}", "%{message}", nil)
+	global.framesLock.Unlock()
+	reset := func() {
+		global.shutdownLock.Lock()
+		global.shutdownDone = nil
+		global.shutdownErr = nil
+		global.shutdownLock.Unlock()
+	}
+	defer func() {
+		global.framesLock.Lock()
+		global.frames, global.bizlog, global.syslog = frames, bizlog, syslog
+		global.framesLock.Unlock()
+		reset()
+	}()
+
+	if err := frame.run(); err != nil {
+		t.Fatal(err)
+	}
+	go http.Get("http://" + frame.config.Addrs[0] + "/wait")
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { errs <- ShutdownContext(ctx) }()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != context.DeadlineExceeded {
+			t.Fatalf("shutdown with the in-flight request: got %v", err)
+		}
+	}
+	close(release)
+	// the later call returns the result of the first one
+	if err := ShutdownContext(context.Background()); err != context.DeadlineExceeded {
+		t.Fatalf("repeated shutdown: got %v", err)
+	}
+
+	reset()
+	if err := frame.run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ShutdownContext(context.Background()); err != nil {
+		t.Fatalf("graceful shutdown: got %v", err)
+	}
+}
+
+func TestBanner(t *testing.T) {
+	// importing the package prints nothing, the test binary running no test prints only its result
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if out, err := cmd.Output(); err != nil || string(out) != "PASS\n" {
+		t.Fatalf("import: stdout = %q, %v", out, err)
+	}
+
+	defer SetBanner(global.banner)
+	capture := func() string {
+		stdout := os.Stdout
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Stdout = w
+		defer func() { os.Stdout = stdout }()
+		global.printBanner()
+		w.Close()
+		b, _ := ioutil.ReadAll(r)
+		r.Close()
+		return string(b)
+	}
+	DisableBanner()
+	if out := capture(); out != "" {
+		t.Fatalf("stdout = %q, want empty", out)
+	}
+	SetBanner("custom banner")
+	if out := capture(); out != "custom banner\n" {
+		t.Fatalf("stdout = %q, want %q", out, "custom banner\n")
+	}
+}
+
+func TestPidFile(t *testing.T) {
+	defer func(pidFile string, pidFileSet bool, logDir string) {
+		global.pidFile, global.pidFileSet, global.logDir = pidFile, pidFileSet, logDir
+	}(global.pidFile, global.pidFileSet, global.logDir)
+	global.pidFile, global.pidFileSet = "", false
+	global.logDir = "./custom_log/"
+	if got := global.pidFilename(); got != "./custom_log/app.pid" {
+		t.Fatalf("default: got %q", got)
+	}
+	SetPidFile("")
+	if got := global.pidFilename(); got != "" {
+		t.Fatalf("disabled: got %q", got)
+	}
+	SetPidFile("./run/app.pid")
+	if got := global.pidFilename(); got != "./run/app.pid" {
+		t.Fatalf("set: got %q", got)
+	}
+}
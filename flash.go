@@ -0,0 +1,109 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// flashCookieName is the name of the cookie carrying the flash messages.
+	flashCookieName = "faygo_flash"
+	// flashMaxAge is the lifetime of the flash cookie in seconds.
+	flashMaxAge = 300
+	// flashMaxBytes caps the encoded flash messages, the oldest ones are dropped if exceeded.
+	flashMaxBytes = 2048
+)
+
+// AddFlash adds the one-time messages for the next request, such as the result
+// of a form submission before redirecting, which are read by ctx.Flash.
+// They are stored in a short-lived signed cookie when the response header is written,
+// so the frames on the same domain sharing the config item `cookie_secret` can read them.
+func (ctx *Context) AddFlash(messages ...string) {
+	ctx.flashOut = append(ctx.flashOut, messages...)
+}
+
+// Flash returns the flash messages added by the previous request,
+// and clears them so that they are shown only once.
+// It is also available in the templates as `flashes()`.
+func (ctx *Context) Flash() []string {
+	if !ctx.flashRead {
+		ctx.flashRead = true
+		if v, ok := ctx.SignedCookie(flashCookieName); ok {
+			global.jsonCodec.Unmarshal([]byte(v), &ctx.flashes)
+		}
+	}
+	return ctx.flashes
+}
+
+// writeFlash sets the flash cookie with the messages for the next request,
+// or deletes it after the messages are read.
+func (ctx *Context) writeFlash() {
+	if len(ctx.flashOut) == 0 {
+		if ctx.flashRead && ctx.CookieParam(flashCookieName) != "" {
+			ctx.W.AddCookie(&http.Cookie{Name: flashCookieName, Path: "/", MaxAge: -1})
+		}
+		return
+	}
+	messages := ctx.flashOut
+	b, _ := global.jsonCodec.Marshal(messages)
+	for len(b) > flashMaxBytes && len(messages) > 0 {
+		messages = messages[1:]
+		b, _ = global.jsonCodec.Marshal(messages)
+	}
+	if dropped := len(ctx.flashOut) - len(messages); dropped > 0 {
+		ctx.Log().Warningf("%d flash messages are dropped, since they exceed %d bytes", dropped, flashMaxBytes)
+	}
+	ctx.SetSignedCookie(flashCookieName, string(b), CookieOptions{
+		MaxAge:   flashMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// checkRedirectHost returns an error if the redirect url is absolute and its host
+// is neither the request host nor one of the config item `redirect_hosts`.
+func (ctx *Context) checkRedirectHost(urlStr string) error {
+	hosts := ctx.frame.config.RedirectHosts
+	if len(hosts) == 0 {
+		return nil
+	}
+	// the browsers treat the backslashes as slashes, e.g. `/\evil.com`
+	u, err := url.Parse(strings.Replace(urlStr, `\`, "/", -1))
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" && u.Host == "" {
+		return nil
+	}
+	host := u.Hostname()
+	if reqHost, _, err := net.SplitHostPort(ctx.R.Host); err == nil {
+		if strings.EqualFold(host, reqHost) {
+			return nil
+		}
+	} else if strings.EqualFold(host, ctx.R.Host) {
+		return nil
+	}
+	for _, h := range hosts {
+		if strings.EqualFold(host, h) || strings.EqualFold(u.Host, h) {
+			return nil
+		}
+	}
+	return fmt.Errorf("redirect to the host %q is not allowed", u.Host)
+}
@@ -0,0 +1,129 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/henrylee2cn/faygo/apiware"
+)
+
+// TAG_FORM is the struct tag of the field used by RenderForm,
+// `form:"password"` excludes the field from re-population.
+const TAG_FORM = "form"
+
+// RenderForm renders the template of the form with the submitted values and the binding errors,
+// so that the form is redisplayed after the binding or validation failure.
+// The formStruct is the struct pointer with the `param` tags, such as the APIHandler,
+// whose `formData` and `query` params are re-populated from the request,
+// or from the struct fields if they are not submitted, e.g. when the form is displayed for editing.
+// The fields tagged `form:"password"` and the files are never re-populated.
+// Besides the ones of Render, the template gets `form` and `errors`, the maps of the param name
+// to the value and to the message of its first BindError, and the functions reading them:
+//
+//	<input name="email" value="{{ field_value("email") }}"> {{ field_error("email") }}
+func (ctx *Context) RenderForm(status int, name string, formStruct interface{}, bindErrs BindErrors) error {
+	form := ctx.formValues(formStruct)
+	errs := make(map[string]string, len(bindErrs))
+	for _, e := range bindErrs {
+		if _, ok := errs[e.Field]; !ok {
+			errs[e.Field] = e.Message
+		}
+	}
+	return ctx.Render(status, name, Map{
+		"form":        form,
+		"errors":      errs,
+		"field_value": func(name string) string { return form[name] },
+		"field_error": func(name string) string { return errs[name] },
+	})
+}
+
+// formValues returns the values of the `formData` and `query` params of the struct,
+// keyed by the param name.
+func (ctx *Context) formValues(formStruct interface{}) map[string]string {
+	form := map[string]string{}
+	if formStruct == nil {
+		return form
+	}
+	v := reflect.Indirect(reflect.ValueOf(formStruct))
+	if v.Kind() == reflect.Struct {
+		ctx.addFormValues(form, v)
+	}
+	return form
+}
+
+func (ctx *Context) addFormValues(form map[string]string, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup(TAG_PARAM)
+		if !ok {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				ctx.addFormValues(form, v.Field(i))
+			}
+			continue
+		}
+		if tag == apiware.TAG_IGNORE_PARAM || field.Tag.Get(TAG_FORM) == "password" {
+			continue
+		}
+		tags := apiware.ParseTags(tag)
+		var values []string
+		switch tags[apiware.KEY_IN] {
+		case "formData":
+			if isFileField(field.Type) {
+				continue
+			}
+			name := formParamName(field, tags)
+			if values = ctx.FormParams(name); len(values) == 0 {
+				values = ctx.QueryParams(name)
+			}
+			form[name] = fieldString(v.Field(i), values)
+		case "query":
+			name := formParamName(field, tags)
+			form[name] = fieldString(v.Field(i), ctx.QueryParams(name))
+		}
+	}
+}
+
+func formParamName(field reflect.StructField, tags map[string]string) string {
+	if name, ok := tags[apiware.KEY_NAME]; ok {
+		return name
+	}
+	return global.paramNameMapper(field.Name)
+}
+
+func isFileField(t reflect.Type) bool {
+	switch t.String() {
+	case "*multipart.FileHeader", "multipart.FileHeader", "[]*multipart.FileHeader", "[]multipart.FileHeader",
+		"*apiware.UploadedFile", "[]*apiware.UploadedFile":
+		return true
+	}
+	return false
+}
+
+// fieldString returns the first submitted value, or the non-zero value of the field.
+func fieldString(v reflect.Value, values []string) string {
+	if len(values) > 0 {
+		return values[0]
+	}
+	if !v.IsValid() || reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface()) {
+		return ""
+	}
+	if v.Kind() == reflect.Slice && v.Len() > 0 && v.Type().Elem().Kind() != reflect.Uint8 {
+		v = v.Index(0)
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,76 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type registerForm struct {
+	Email    string `param:"<in:formData> <required> <regexp:^[^@]+@[^@]+$> <err:invalid email>"`
+	Age      int    `param:"<in:formData> <range:18:150>"`
+	Nickname string `param:"<in:formData>"`
+	Password string `param:"<in:formData> <required>" form:"password"`
+}
+
+func (r *registerForm) Serve(ctx *Context) error {
+	return ctx.String(200, "registered")
+}
+
+func TestRenderForm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faygo_form_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tmpl := filepath.Join(dir, "register.html")
+	var content string
+	for _, name := range []string{"email", "age", "nickname", "password"} {
+		content += name + `=[{{ field_value("` + name + `") }}|{{ field_error("` + name + `") }}]`
+	}
+	if err = ioutil.WriteFile(tmpl, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	frame := newTestFrame(t, "render_form_test")
+	frame.POST("/register", new(registerForm))
+	SetBinderrorFunc(func(ctx *Context, errs BindErrors) {
+		if err := ctx.RenderForm(400, tmpl, new(registerForm), errs); err != nil {
+			t.Error(err)
+		}
+	})
+	defer SetBinderrorFunc(nil)
+
+	form := "email=henry&age=abc&nickname=%3Cb%3Ehl%3C%2Fb%3E&password=secret"
+	req := httptest.NewRequest("POST", "/register", strings.NewReader(form))
+	req.Header.Set(HeaderContentType, MIMEApplicationForm)
+	rec := serveTest(frame, req)
+	want := "email=[henry|invalid email]age=[abc|must be an integer]" +
+		"nickname=[&lt;b&gt;hl&lt;/b&gt;|]password=[|]"
+	if rec.Code != 400 || rec.Body.String() != want {
+		t.Fatalf("got %d %q, want 400 %q", rec.Code, rec.Body.String(), want)
+	}
+
+	form = "email=henry@example.com&age=20&password=secret"
+	req = httptest.NewRequest("POST", "/register", strings.NewReader(form))
+	req.Header.Set(HeaderContentType, MIMEApplicationForm)
+	if rec = serveTest(frame, req); rec.Code != 200 {
+		t.Fatalf("got %d %q, want 200", rec.Code, rec.Body.String())
+	}
+}
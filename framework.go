@@ -17,9 +17,16 @@ package faygo
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
 	"runtime"
+	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -41,13 +48,48 @@ type Framework struct {
 	// root muxAPI node
 	*MuxAPI
 	muxesForRouter MuxAPIs
+	namedRoutes    map[string][]*MuxAPI // the routes by name, for URLFor
 	// called before the route is matched
 	filter         HandlerChain
+	notFound       Handler // called when no route is matched
 	servers        []*Server
+	listeners      []Listener
+	configurers    []func(*http.Server) // called before the servers start listening
+	http3          HTTP3ServerFunc      // creates the HTTP/3 servers if the config item `http3` is true
+	clientCAs      *x509.CertPool       // verifies the TLS client certificates, set by SetClientCAs
+	clientAuth     tls.ClientAuthType   // the policy of the TLS client certificates, set by SetClientCAs
 	running        bool
+	shuttingDown   int32
+	conns          connTracker
+	streams        streamTracker
+	requests       int32               // the number of the in-flight requests
+	limiter        *concurrencyLimiter // limits the in-flight requests by the config, nil means unlimited
+	shutdownHooks  []func()
+	startHooks     []LifecycleFunc
+	stopHooks      []LifecycleFunc
+	instance       *ServiceInstance // the running service passed to the OnStop functions
 	buildOnce      sync.Once
 	lock           sync.RWMutex
 	sessionManager *session.Manager
+	// starts the server span of each request, nil if tracing is disabled
+	tracer Tracer
+	// the outbound HTTP client, created by SetHTTPClient or on the first use
+	httpClient *http.Client
+	// extracts the requested API version of the versioned routes, and the version used when none is requested
+	versionExtractor VersionExtractor
+	defaultVersion   string
+	// the params APIs of BindInto by the struct pointer types, apart from the ones of the API handlers
+	bindingAPIs sync.Map
+	// the health checks of the dependencies, reported by ReadinessHandler
+	healthChecks       []healthCheck
+	healthCheckTimeout time.Duration
+	// the file backend of the bizlog, nil if the file logger is disabled
+	fileBackend *logging.FileBackend
+	// the preset upload and static routes and the log folder of the frame,
+	// nil or empty means the global ones
+	upload *PresetStatic
+	static *PresetStatic
+	logDir string
 	// for framework
 	syslog *logging.Logger
 	// for user bissness
@@ -59,12 +101,24 @@ type Framework struct {
 	httpRedirectHttps bool
 	// One of the https ports to be listened
 	httpsPort string
+	// Whether a letsencrypt listener exists, whose ACME HTTP-01 challenge paths are not redirected
+	acmeChallenge bool
+	// the automatic certificates set by SetAutoTLS, nil if not enabled
+	autoTLS *autoTLS
 	// Enables automatic redirection if the current route can't be matched but a
 	// handler for the path with (without) the trailing slash exists.
 	// For example if /foo/ is requested but a route only exists for /foo, the
 	// client is redirected to /foo with http status code 301 for GET requests
 	// and 307 for all other request methods.
 	redirectTrailingSlash bool
+	// If enabled, the path with (without) the trailing slash is served by the
+	// route without (with) it directly, instead of a redirection.
+	// It takes priority over redirectTrailingSlash.
+	trailingSlashEquivalent bool
+	// If enabled, the request path is cleaned before the filters and matching,
+	// collapsing multiple slashes and resolving the . and .. elements,
+	// which never go above the root.
+	cleanPath bool
 	// If enabled, the router tries to fix the current request path, if no
 	// handle is registered for it.
 	// First superfluous path elements like ../ or // are removed.
@@ -85,7 +139,10 @@ type Framework struct {
 	// If enabled, the router automatically replies to OPTIONS requests.
 	// Custom OPTIONS handlers take priority over automatic replies.
 	handleOPTIONS bool
-	contextPool   sync.Pool
+	// If enabled, the HEAD requests of the paths without HEAD routes are served
+	// by the GET handlers, discarding the body.
+	handleHEAD  bool
+	contextPool sync.Pool
 }
 
 // Make sure the Framework conforms with the http.Handler interface
@@ -93,6 +150,7 @@ var _ http.Handler = new(Framework)
 
 // newFramework uses the faygo web framework to create a new application.
 func newFramework(config *Config, name string, version []string) *Framework {
+	initGlobal()
 	mutexNewApp.Lock()
 	defer mutexNewApp.Unlock()
 	var frame = new(Framework)
@@ -116,8 +174,11 @@ func newFramework(config *Config, name string, version []string) *Framework {
 
 	frame.redirectTrailingSlash = frame.config.Router.RedirectTrailingSlash
 	frame.redirectFixedPath = frame.config.Router.RedirectFixedPath
+	frame.trailingSlashEquivalent = frame.config.Router.TrailingSlashEquivalent
+	frame.cleanPath = frame.config.Router.CleanPath
 	frame.handleMethodNotAllowed = frame.config.Router.HandleMethodNotAllowed
 	frame.handleOPTIONS = frame.config.Router.HandleOPTIONS
+	frame.handleHEAD = frame.config.Router.HandleHEAD
 	frame.contextPool = sync.Pool{
 		New: func() interface{} {
 			ctx := &Context{
@@ -132,6 +193,10 @@ func newFramework(config *Config, name string, version []string) *Framework {
 	}
 	frame.initSysLogger()
 	frame.initBizLogger()
+	if frame.config.CookieSecret == "" {
+		frame.config.CookieSecret = randomCookieSecret
+		frame.syslog.Warningf("config: cookie_secret is empty, so a random key is used and signed cookies will be invalid after restart.")
+	}
 	frame.MuxAPI = newMuxAPI(frame, "root", "", "/")
 	addFrame(frame)
 	return frame
@@ -175,12 +240,25 @@ func (frame *Framework) ConfigFilename() string {
 }
 
 // Run starts the web service.
+// It panics if the service fails to listen.
 func (frame *Framework) Run() {
+	if err := frame.RunE(); err != nil {
+		frame.Log().Panicf("%s\n", err.Error())
+	}
+}
+
+// RunE is similar to Run, but returns the error if the service fails to listen.
+// It blocks after the service is listening.
+func (frame *Framework) RunE() error {
 	if frame.Running() {
-		return
+		return nil
+	}
+	if err := global.beforeRun(); err != nil {
+		return err
+	}
+	if err := frame.run(); err != nil {
+		return err
 	}
-	global.beforeRun()
-	go frame.run()
 	select {}
 }
 
@@ -191,15 +269,128 @@ func (frame *Framework) Running() bool {
 	return frame.running
 }
 
-func (frame *Framework) run() {
+// run binds all the listeners of the frame, serves them, and then calls the OnStart functions.
+// If any of the listeners fails, the bound ones are closed and the error is returned.
+func (frame *Framework) run() error {
+	instance, err := frame.start()
+	if err != nil || instance == nil {
+		return err
+	}
+	return frame.runStartHooks(instance)
+}
+
+// start binds and serves all the listeners of the frame,
+// returns nil instance if the frame is already running.
+func (frame *Framework) start() (*ServiceInstance, error) {
 	frame.lock.Lock()
+	defer frame.lock.Unlock()
+	if frame.running {
+		return nil, nil
+	}
 	frame.build()
+	if frame.config.HTTP3 && frame.http3 == nil {
+		return nil, fmt.Errorf("[%s] the config item `http3` requires frame.SetHTTP3", frame.NameWithVersion())
+	}
+	frame.servers = frame.newServers()
+	lns := make([]net.Listener, 0, len(frame.servers))
+	for _, srv := range frame.servers {
+		ln, err := srv.listen()
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return nil, fmt.Errorf("[%s] listen %s on %s: %s", frame.NameWithVersion(), srv.netType, srv.Addr, err.Error())
+		}
+		lns = append(lns, ln)
+	}
+	for i, srv := range frame.servers {
+		if frame.config.HTTP3 && srv.isHttps() && srv.net == "tcp" {
+			srv.serveHTTP3(frame.http3)
+		}
+		srv.serve(lns[i])
+	}
 	frame.running = true
-	count := len(frame.servers)
-	for i := 0; i < count; i++ {
-		go frame.servers[i].run()
+	frame.instance = frame.newServiceInstance(lns)
+	return frame.instance, nil
+}
+
+// newServers creates the servers of all the listeners with the current config,
+// such as the timeouts, so that each run uses the new servers, which is required
+// since http.Server can not be reused after being shut down.
+func (frame *Framework) newServers() []*Server {
+	var servers []*Server
+	frame.httpRedirectHttps, frame.acmeChallenge = false, false
+	nameWithVersion := frame.NameWithVersion()
+	listeners := make([]Listener, 0, len(frame.config.NetTypes)+len(frame.listeners))
+	for i, netType := range frame.config.NetTypes {
+		listeners = append(listeners, Listener{NetType: netType, Addr: frame.config.Addrs[i]})
 	}
-	frame.lock.Unlock()
+	listeners = append(listeners, frame.listeners...)
+	for _, ln := range listeners {
+		if ln.TLSCertFile == "" && ln.TLSKeyFile == "" {
+			ln.TLSCertFile, ln.TLSKeyFile = frame.config.TLSCertFile, frame.config.TLSKeyFile
+		}
+		if ln.LetsencryptDir == "" {
+			ln.LetsencryptDir = frame.config.LetsencryptDir
+		}
+		srv := &Server{
+			nameWithVersion: nameWithVersion,
+			netType:         ln.NetType,
+			tlsCertFile:     ln.TLSCertFile,
+			tlsKeyFile:      ln.TLSKeyFile,
+			letsencryptDir:  ln.LetsencryptDir,
+			tlsConfig:       ln.TLSConfig,
+			clientCAFile:    frame.config.TLSClientCAFile,
+			clientCAs:       frame.clientCAs,
+			clientAuth:      frame.clientAuthType(),
+			autoTLS:         frame.autoTLS,
+			unixFileMode:    frame.config.unixFileMode,
+			Server: &http.Server{
+				Addr:              ln.Addr,
+				Handler:           frame,
+				ReadTimeout:       frame.config.ReadTimeout,
+				ReadHeaderTimeout: frame.config.ReadHeaderTimeout,
+				WriteTimeout:      frame.config.WriteTimeout,
+				IdleTimeout:       frame.config.IdleTimeout,
+				MaxHeaderBytes:    frame.config.MaxHeaderKB * KB,
+			},
+			log: frame.syslog,
+		}
+		if frame.autoTLS != nil && !srv.isHttps() {
+			// serve the ACME HTTP-01 challenges before the routes and the redirect
+			srv.Server.Handler = frame.autoTLS.HTTPHandler(frame)
+		}
+		for _, fn := range frame.configurers {
+			fn(srv.Server)
+		}
+		// the custom TLS config is the base of the https listener's, with the certificates
+		// and the client certificate authentication applied on listening
+		if tlsConfig := srv.Server.TLSConfig; tlsConfig != nil {
+			srv.Server.TLSConfig = nil
+			if srv.isHttps() {
+				srv.tlsConfig = tlsConfig
+			}
+		}
+		// keep counting the connections with the custom hook
+		if connState := srv.Server.ConnState; connState != nil {
+			srv.Server.ConnState = func(c net.Conn, state http.ConnState) {
+				frame.conns.track(c, state)
+				connState(c, state)
+			}
+		} else {
+			srv.Server.ConnState = frame.conns.track
+		}
+		srv.resolveUnixAddr()
+		if frame.config.HttpRedirectHttps && srv.isHttps() {
+			frame.httpRedirectHttps = true
+			frame.httpsPort = srv.port()
+		}
+		if srv.netType == NETTYPE_LETSENCRYPT || srv.netType == NETTYPE_UNIX_LETSENCRYPT {
+			frame.acmeChallenge = true
+		}
+		servers = append(servers, srv)
+	}
+	return servers
 }
 
 func (frame *Framework) build() {
@@ -214,6 +405,10 @@ func (frame *Framework) build() {
 			if frame.config.APIdoc.Enable {
 				frame.regAPIdoc()
 			}
+			// route inspection
+			if frame.config.Router.DebugRoutes {
+				frame.regDebugRoutes()
+			}
 			// static
 			frame.presetSystemMuxes()
 		}
@@ -225,12 +420,33 @@ func (frame *Framework) build() {
 		if frame.staticSrcTree == nil {
 			frame.staticSrcTree = make(map[string]*node)
 		}
+		// the handles of the versioned routes by method and path
+		versioned := make(map[string]*versionedRoute)
 		for _, api := range frame.MuxAPIsForRouter() {
-			handle := frame.makeHandle(api.handlers)
+			handle := frame.makeHandle(api.path, api.handlers, api.fs != nil)
+			check := checkPathConstraints(api.constraints)
+			version := api.apiVersion()
 			for _, method := range api.methods {
 				if api.path[0] != '/' {
 					Panic("path must begin with '/' in path '" + api.path + "'")
 				}
+				h := handle
+				if version != "" {
+					key := method + " " + api.path
+					vr := versioned[key]
+					if vr != nil {
+						// the dispatching handle is registered already
+						vr.add(version, handle)
+						if !frame.config.Router.PrintRoutes {
+							frame.syslog.Criticalf("\x1b[46m[SYS]\x1b[0m %7s | %-30s (v%s)", method, api.path, version)
+						}
+						continue
+					}
+					vr = &versionedRoute{pattern: key, handles: make(map[string]Handle)}
+					vr.add(version, handle)
+					versioned[key] = vr
+					h = frame.makeVersionedHandle(vr)
+				}
 				var root *node
 				if strings.HasSuffix(api.path, "/*"+FilepathKey) &&
 					api.path != "/apidoc/*"+FilepathKey &&
@@ -250,53 +466,96 @@ func (frame *Framework) build() {
 						frame.dynamicSrcTree[method] = root
 					}
 				}
-				root.addRoute(api.path, handle)
-				frame.syslog.Criticalf("\x1b[46m[SYS]\x1b[0m %7s | %-30s", method, api.path)
+				root.addCheckedRoute(api.path, h, check)
+				if !frame.config.Router.PrintRoutes {
+					if version != "" {
+						frame.syslog.Criticalf("\x1b[46m[SYS]\x1b[0m %7s | %-30s (v%s)", method, api.path, version)
+					} else {
+						frame.syslog.Criticalf("\x1b[46m[SYS]\x1b[0m %7s | %-30s", method, api.path)
+					}
+				}
 			}
 		}
-
-		// new server
-		nameWithVersion := frame.NameWithVersion()
-		for i, netType := range frame.config.NetTypes {
-			srv := &Server{
-				nameWithVersion: nameWithVersion,
-				netType:         netType,
-				tlsCertFile:     frame.config.TLSCertFile,
-				tlsKeyFile:      frame.config.TLSKeyFile,
-				letsencryptDir:  frame.config.LetsencryptDir,
-				unixFileMode:    frame.config.unixFileMode,
-				Server: &http.Server{
-					Addr:         frame.config.Addrs[i],
-					Handler:      frame,
-					ReadTimeout:  frame.config.ReadTimeout,
-					WriteTimeout: frame.config.WriteTimeout,
-				},
-				log: frame.syslog,
-			}
-			if frame.config.HttpRedirectHttps && srv.isHttps() {
-				frame.httpRedirectHttps = true
-				frame.httpsPort = srv.port()
+		frame.namedRoutes = make(map[string][]*MuxAPI)
+		for _, api := range frame.MuxAPIsForRouter() {
+			if api.name != "" {
+				frame.namedRoutes[api.name] = append(frame.namedRoutes[api.name], api)
 			}
-			frame.servers = append(frame.servers, srv)
+		}
+		if frame.config.Router.PrintRoutes {
+			frame.printRoutes()
 		}
 
 		// register session
 		frame.registerSession()
+
+		frame.limiter = newConcurrencyLimiter(frame.config.MaxConcurrentRequests, frame.config.MaxQueue, frame.config.QueueTimeout)
 	})
 }
 
 // shutdown closes the frame service gracefully.
 func (frame *Framework) shutdown(ctxTimeout context.Context) (graceful bool) {
+	return frame.stop(ctxTimeout, true)
+}
+
+// Restart gracefully shuts down the frame service and runs it again with the new servers,
+// which apply the current config, such as the timeouts. The routes are kept,
+// and the OnShutdown hooks are not called.
+// The timeout defaults to the one set by SetShutdown.
+// Notes: the connections are refused during the restart;
+// to replace the process without downtime, use Reboot instead.
+func (frame *Framework) Restart(timeout ...time.Duration) error {
+	d := global.shutdownTimeout
+	if len(timeout) > 0 {
+		d = timeout[0]
+	}
+	ctxTimeout, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	if !frame.stop(ctxTimeout, false) {
+		frame.syslog.Warningf("[restart-%s] the service is not shut down gracefully", frame.NameWithVersion())
+	}
+	return frame.run()
+}
+
+// stop calls the OnStop functions first, then closes the frame service gracefully,
+// and calls the OnShutdown hooks and closes the loggers if hooks is true,
+// otherwise the frame keeps logging to run again, such as Restart.
+func (frame *Framework) stop(ctxTimeout context.Context, hooks bool) (graceful bool) {
+	frame.lock.Lock()
+	instance := frame.instance
+	frame.instance = nil
+	frame.lock.Unlock()
+	// deregister before closing the listeners, so that the traffic stops arriving;
+	// called without the lock, since they may use the frame.
+	stopped := instance == nil || frame.runStopHooks(ctxTimeout, instance)
+
 	frame.lock.Lock()
 	defer frame.lock.Unlock()
+	if hooks {
+		defer frame.CloseLog()
+	}
 	if !frame.running {
-		return true
+		return stopped
+	}
+	atomic.StoreInt32(&frame.shuttingDown, 1)
+	defer atomic.StoreInt32(&frame.shuttingDown, 0)
+	if delay := frame.config.PreStopDelay; delay > 0 {
+		frame.syslog.Infof("[shutdown-%s] waiting %s before closing listeners", frame.NameWithVersion(), delay)
+		select {
+		case <-time.After(delay):
+		case <-ctxTimeout.Done():
+		}
 	}
 	var flag int32 = 1
 	count := new(sync.WaitGroup)
+	// closed is done when all the listeners stop accepting.
+	closed := new(sync.WaitGroup)
 	for _, server := range frame.servers {
 		count.Add(1)
+		closed.Add(1)
+		server.RegisterOnShutdown(closed.Done)
 		go func(srv *Server) {
+			srv.shutdownHTTP3(ctxTimeout)
 			if err := srv.Shutdown(ctxTimeout); err != nil {
 				atomic.StoreInt32(&flag, 0)
 				frame.Log().Errorf("[shutdown-%s] %s", frame.NameWithVersion(), err.Error())
@@ -304,12 +563,171 @@ func (frame *Framework) shutdown(ctxTimeout context.Context) (graceful bool) {
 			count.Done()
 		}(server)
 	}
+	count.Add(1)
+	go func() {
+		if !frame.drainStreams(ctxTimeout) {
+			atomic.StoreInt32(&flag, 0)
+		}
+		count.Done()
+	}()
+	if frame.autoTLS != nil {
+		count.Add(1)
+		go func() {
+			if !frame.autoTLS.wait(ctxTimeout) {
+				atomic.StoreInt32(&flag, 0)
+				frame.syslog.Errorf("[shutdown-%s] ACME certificate orders timeout: %s", frame.NameWithVersion(), ctxTimeout.Err())
+			}
+			count.Done()
+		}()
+	}
+	drained := make(chan struct{})
+	go frame.logDraining(ctxTimeout, drained)
+	if !waitGroupContext(ctxTimeout, closed) || hooks && !frame.runShutdownHooks(ctxTimeout) {
+		atomic.StoreInt32(&flag, 0)
+	}
 	count.Wait()
+	close(drained)
 	frame.running = false
-	frame.CloseLog()
+	return flag == 1 && stopped
+}
+
+// AddListener adds a listener with its own TLS settings, which serves the same routes
+// in addition to the ones of the config items `net_types` and `addrs`,
+// e.g. an internal plaintext port beside the public TLS one.
+// It must be called before running, and Shutdown drains all of the listeners.
+func (frame *Framework) AddListener(ln Listener) {
+	switch ln.NetType {
+	case NETTYPE_HTTP, NETTYPE_UNIX_HTTP, NETTYPE_HTTPS, NETTYPE_UNIX_HTTPS, NETTYPE_LETSENCRYPT, NETTYPE_UNIX_LETSENCRYPT:
+	default:
+		Panicf("[%s] invalid listener net type %q, refer to the following: %s", frame.NameWithVersion(), ln.NetType, __netTypes__)
+	}
+	frame.lock.Lock()
+	defer frame.lock.Unlock()
+	if frame.running {
+		Panicf("[%s] AddListener must be called before running", frame.NameWithVersion())
+	}
+	frame.listeners = append(frame.listeners, ln)
+}
+
+// ErrFrameRunning is returned when changing the settings which take effect only before running.
+var ErrFrameRunning = errors.New("the frame is running")
+
+// ConfigureServer registers a function to tune the *http.Server of each listener,
+// such as ReadHeaderTimeout, IdleTimeout, MaxHeaderBytes, ConnState, BaseContext and TLSConfig,
+// which is called after the config is applied and right before listening, on every run.
+// The ConnState hook is called after the connections are counted.
+// The TLSConfig replaces the one of the Listener, which is used by the https listeners only;
+// the certificate files are loaded only if it provides no certificate.
+// It returns ErrFrameRunning if the frame is running.
+func (frame *Framework) ConfigureServer(fn func(*http.Server)) error {
+	frame.lock.Lock()
+	defer frame.lock.Unlock()
+	if frame.running {
+		return ErrFrameRunning
+	}
+	frame.configurers = append(frame.configurers, fn)
+	return nil
+}
+
+// RedirectHTTP sets whether the plain HTTP listeners only redirect the requests to the https listener,
+// overriding the config item `http_redirect_https`, e.g. listening on :80 for the redirect beside :443.
+// The path and query are preserved, GET and HEAD are redirected with 301, the other methods with 308
+// to keep the method and body. The ACME HTTP-01 challenge paths are not redirected if
+// a letsencrypt listener exists.
+// It returns ErrFrameRunning if the frame is running.
+func (frame *Framework) RedirectHTTP(toHTTPS bool) error {
+	frame.lock.Lock()
+	defer frame.lock.Unlock()
+	if frame.running {
+		return ErrFrameRunning
+	}
+	frame.config.HttpRedirectHttps = toHTTPS
+	return nil
+}
+
+// acmeChallengePath is the path prefix of the ACME HTTP-01 challenges.
+const acmeChallengePath = "/.well-known/acme-challenge/"
+
+// redirectHTTPS redirects the plain HTTP request to the https listener, preserving the path and query.
+func (frame *Framework) redirectHTTPS(ctx *Context) {
+	u := *ctx.URL()
+	u.Scheme = "https"
+	u.Host = ctx.Domain()
+	if frame.httpsPort != "443" {
+		u.Host = net.JoinHostPort(u.Host, frame.httpsPort)
+	} else if strings.Contains(u.Host, ":") {
+		u.Host = "[" + u.Host + "]"
+	}
+	code := http.StatusMovedPermanently
+	if method := ctx.Method(); method != "GET" && method != "HEAD" {
+		code = http.StatusPermanentRedirect
+	}
+	http.Redirect(ctx.W, ctx.R, u.String(), code)
+}
+
+// OnShutdown registers a function to be called when the frame service shuts down.
+// It can be called multiple times, and the functions are called in the registration order
+// after the listeners stop accepting, while the in-flight requests are still being drained.
+// The functions should return within the shutdown timeout.
+func (frame *Framework) OnShutdown(fn func()) {
+	if fn == nil {
+		return
+	}
+	frame.lock.Lock()
+	frame.shutdownHooks = append(frame.shutdownHooks, fn)
+	frame.lock.Unlock()
+}
+
+// ShuttingDown returns whether the frame service is shutting down.
+// It can be used by the readiness check during the 'PreStopDelay'.
+func (frame *Framework) ShuttingDown() bool {
+	return atomic.LoadInt32(&frame.shuttingDown) == 1
+}
+
+// runShutdownHooks calls the OnShutdown functions, returns false if they time out or panic.
+func (frame *Framework) runShutdownHooks(ctxTimeout context.Context) bool {
+	if len(frame.shutdownHooks) == 0 {
+		return true
+	}
+	var flag int32 = 1
+	done := new(sync.WaitGroup)
+	done.Add(1)
+	go func() {
+		defer done.Done()
+		for _, fn := range frame.shutdownHooks {
+			func() {
+				defer func() {
+					if p := recover(); p != nil {
+						atomic.StoreInt32(&flag, 0)
+						frame.syslog.Errorf("[shutdown-%s] OnShutdown panic: %v\n%s", frame.NameWithVersion(), p, debug.Stack())
+					}
+				}()
+				fn()
+			}()
+		}
+	}()
+	if !waitGroupContext(ctxTimeout, done) {
+		frame.syslog.Errorf("[shutdown-%s] OnShutdown functions timeout: %s", frame.NameWithVersion(), ctxTimeout.Err())
+		return false
+	}
 	return flag == 1
 }
 
+// waitGroupContext waits for the WaitGroup, returns false if the context is done first.
+func waitGroupContext(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
 // Log returns the logger used by the user bissness.
 func (frame *Framework) Log() *logging.Logger {
 	return frame.bizlog
@@ -319,6 +737,90 @@ func (frame *Framework) Log() *logging.Logger {
 func (frame *Framework) CloseLog() {
 	frame.bizlog.Close()
 	frame.syslog.Close()
+	if frame.fileBackend != nil {
+		frame.fileBackend.Close()
+	}
+}
+
+// SetLogDir sets the folder path of the frame's bizlog file, such as `./log/app1/`,
+// overriding the global one.
+// note: it should be called before logging, since the bizlog file is reopened
+func (frame *Framework) SetLogDir(dir string) {
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	frame.lock.Lock()
+	defer frame.lock.Unlock()
+	frame.logDir = dir
+	if frame.fileBackend != nil {
+		frame.fileBackend.Close()
+		// the file created by New in the default folder is removed if nothing is logged
+		if info, err := os.Stat(frame.fileBackend.Filename); err == nil && info.Size() == 0 {
+			os.Remove(frame.fileBackend.Filename)
+		}
+		frame.fileBackend = nil
+		frame.initBizLogger()
+	}
+}
+
+// LogDir returns the folder path of the frame's bizlog file with a slash at the end,
+// which is the global one if not set by SetLogDir.
+func (frame *Framework) LogDir() string {
+	if frame.logDir != "" {
+		return frame.logDir
+	}
+	return LogDir()
+}
+
+// SetUpload sets the upload folder path of the frame, such as `./upload/app1/`,
+// overriding the global one set by faygo.SetUpload.
+// note: it should be called before Run()
+func (frame *Framework) SetUpload(dir string, nocompress bool, nocache bool, handlers ...Handler) {
+	upload := newPresetStatic(dir, nocompress, nocache, handlers)
+	frame.upload = &upload
+}
+
+// UploadDir returns the upload folder path of the frame with a slash at the end,
+// which is the global one if not set by SetUpload.
+func (frame *Framework) UploadDir() string {
+	return frame.uploadPreset().root
+}
+
+// SetStatic sets the static folder path of the frame, such as `./static/app1/`,
+// overriding the global one set by faygo.SetStatic.
+// note: it should be called before Run()
+func (frame *Framework) SetStatic(dir string, nocompress bool, nocache bool, handlers ...Handler) {
+	static := newPresetStatic(dir, nocompress, nocache, handlers)
+	frame.static = &static
+}
+
+// SetStaticFS sets the file system of the frame's static files,
+// overriding the global one set by faygo.SetStaticFS.
+// note: it should be called before Run()
+func (frame *Framework) SetStaticFS(fsys http.FileSystem, nocompress bool, nocache bool, handlers ...Handler) {
+	static := newPresetStatic(frame.StaticDir(), nocompress, nocache, handlers)
+	static.fs = fsys
+	frame.static = &static
+}
+
+// StaticDir returns the static folder path of the frame with a slash at the end,
+// which is the global one if not set by SetStatic.
+func (frame *Framework) StaticDir() string {
+	return frame.staticPreset().root
+}
+
+func (frame *Framework) uploadPreset() PresetStatic {
+	if frame.upload != nil {
+		return *frame.upload
+	}
+	return global.upload
+}
+
+func (frame *Framework) staticPreset() PresetStatic {
+	if frame.static != nil {
+		return *frame.static
+	}
+	return global.static
 }
 
 // MuxAPIsForRouter get an ordered list of nodes used to register router.
@@ -342,6 +844,14 @@ func (frame *Framework) Filter(fn ...HandlerFunc) *Framework {
 	return frame
 }
 
+// SetNotFound sets the handler called when no route is matched, e.g. to render
+// a branded 404 page by ctx.Render(404, "404.html", data).
+// The ErrorFunc replies 404 if the handler is nil or writes nothing.
+func (frame *Framework) SetNotFound(handler Handler) *Framework {
+	frame.notFound = handler
+	return frame
+}
+
 // Route append middlewares of function type to root muxAPI.
 // Used to register router in tree style.
 func (frame *Framework) Route(children ...*MuxAPI) *MuxAPI {
@@ -377,6 +887,19 @@ func (frame *Framework) NewNamedAPI(name string, methodset Methodset, pattern st
 	return newMuxAPI(frame, name, methodset, pattern, handlers...)
 }
 
+// NewHandle creates an isolated muxAPI node of the single method, which can be nonstandard such as PURGE.
+func (frame *Framework) NewHandle(method string, pattern string, handlers ...Handler) *MuxAPI {
+	return frame.NewNamedHandle("", method, pattern, handlers...)
+}
+
+// NewNamedHandle creates an isolated muxAPI node of the single method with the name.
+func (frame *Framework) NewNamedHandle(name string, method string, pattern string, handlers ...Handler) *MuxAPI {
+	if !isValidMethod(method) {
+		frame.Log().Panicf("invalid method: %q\n", method)
+	}
+	return frame.NewNamedAPI(name, Methodset(method), pattern, handlers...)
+}
+
 // NewGET is a shortcut for frame.NewAPI("GET", pattern, handlers...)
 func (frame *Framework) NewGET(pattern string, handlers ...Handler) *MuxAPI {
 	return frame.NewAPI("GET", pattern, handlers...)
@@ -478,23 +1001,30 @@ func (frame *Framework) presetSystemMuxes() {
 		}
 	}
 	// When does not have a custom route, the route is automatically created.
+	upload, static := frame.uploadPreset(), frame.staticPreset()
 	if !hadUpload && frame.config.Router.DefaultUpload {
 		frame.MuxAPI.NamedStatic(
 			"Directory for uploading files",
 			"/upload/",
-			global.upload.root,
-			global.upload.nocompress,
-			global.upload.nocache,
-		).Use(global.upload.handlers...)
+			upload.root,
+			upload.nocompress,
+			upload.nocache,
+		).Use(upload.handlers...)
 	}
-	if !hadStatic && frame.config.Router.DefaultStatic {
+	if !hadStatic && frame.config.Router.DefaultStatic && static.fs != nil {
+		frame.MuxAPI.NamedStaticFS(
+			"Directory for public static files",
+			"/static/",
+			FS(static.fs, static.nocompress, static.nocache),
+		).Use(static.handlers...)
+	} else if !hadStatic && frame.config.Router.DefaultStatic {
 		frame.MuxAPI.NamedStatic(
 			"Directory for public static files",
 			"/static/",
-			global.static.root,
-			global.static.nocompress,
-			global.static.nocache,
-		).Use(global.static.handlers...)
+			static.root,
+			static.nocompress,
+			static.nocache,
+		).Use(static.handlers...)
 	}
 }
 
@@ -526,11 +1056,26 @@ func (frame *Framework) registerSession() {
 // ServeHTTP makes the router implement the http.Handler interface.
 func (frame *Framework) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	var start = time.Now()
+	atomic.AddInt32(&frame.requests, 1)
 	var ctx = frame.getContext(w, req)
+	ctx.start = start
+	ctx.startSpan()
+	var release func()
 	defer func() {
+		atomic.AddInt32(&frame.requests, -1)
 		if rcv := recover(); rcv != nil {
+			if w, ok := ctx.W.writer.(*headResponseWriter); ok {
+				w.restore()
+			}
 			panicHandler(ctx, rcv)
 		}
+		if release != nil {
+			release()
+		}
+		ctx.endSpan()
+		for _, fn := range ctx.deferred {
+			Go(fn)
+		}
 		frame.putContext(ctx)
 	}()
 	var method = ctx.Method()
@@ -539,7 +1084,15 @@ func (frame *Framework) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		u = "/"
 	}
 
-	frame.serveHTTP(ctx)
+	if release = frame.acquireConcurrency(ctx); release != nil {
+		frame.serveHTTP(ctx)
+	}
+	if ctx.skipAccessLog() {
+		return
+	}
+	if ctx.originalMethod != "" {
+		method = ctx.Method() + "(" + ctx.originalMethod + ")"
+	}
 	var n = ctx.Status()
 	var code string
 	switch {
@@ -553,19 +1106,33 @@ func (frame *Framework) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		code = color.Green(n)
 	}
 	cost := time.Since(start)
+	var upstream string
+	if ctx.upstreamLatency > 0 {
+		upstream = " | upstream " + ctx.upstreamLatency.String()
+	}
+	if traceID := ctx.TraceID(); traceID != "" {
+		upstream += " | trace_id=" + traceID
+	}
+	upstream += ctx.variantsLog()
 	if cost < frame.config.slowResponseThreshold {
-		frame.syslog.Infof("[I] %15s %7s  %3s %10d %12s %-30s | %s", ctx.RealIP(), method, code, ctx.Size(), cost, u, ctx.recordBody())
+		frame.syslog.Infof("[I] %15s %7s  %3s %10d %12s %-30s%s | %s", ctx.RealIP(), method, code, ctx.Size(), cost, u, upstream, ctx.recordBody())
 	} else {
-		frame.syslog.Warningf(color.Yellow("[W]")+" %15s %7s  %3s %10d %12s(slow) %-30s | %s", ctx.RealIP(), method, code, ctx.Size(), cost, u, ctx.recordBody())
+		frame.syslog.Warningf(color.Yellow("[W]")+" %15s %7s  %3s %10d %12s(slow) %-30s%s | %s", ctx.RealIP(), method, code, ctx.Size(), cost, u, upstream, ctx.recordBody())
 	}
 }
 
 func (frame *Framework) serveHTTP(ctx *Context) {
-	if frame.httpRedirectHttps && !ctx.IsSecure() {
-		u := ctx.URL()
-		u.Scheme = "https"
-		u.Host = ctx.Domain() + ":" + frame.httpsPort
-		http.Redirect(ctx.W, ctx.R, u.String(), 307)
+	if frame.httpRedirectHttps && !ctx.IsSecure() &&
+		!(frame.acmeChallenge && strings.HasPrefix(ctx.Path(), acmeChallengePath)) {
+		frame.redirectHTTPS(ctx)
+		return
+	}
+	if frame.cleanPath {
+		if p := CleanToURL(ctx.Path()); p != ctx.Path() {
+			ctx.ModifyPath(p)
+		}
+	}
+	if frame.config.DecompressRequest && !frame.decompressBody(ctx) {
 		return
 	}
 	if !ctx.doFilter() {
@@ -573,6 +1140,17 @@ func (frame *Framework) serveHTTP(ctx *Context) {
 	}
 	var path = ctx.Path()
 	var method = ctx.Method()
+	if method == "HEAD" && frame.handleHEAD && !frame.hasHandle(path, method) {
+		// serve with the GET handler, discarding the body
+		w := ctx.W.discardHeadBody()
+		frame.route(ctx, path, "GET")
+		w.finish()
+		return
+	}
+	frame.route(ctx, path, method)
+}
+
+func (frame *Framework) route(ctx *Context, path, method string) {
 	// find dynamic resource or default static resource
 	if frame.tryHandle(ctx, path, method, frame.dynamicSrcTree) {
 		return
@@ -581,10 +1159,31 @@ func (frame *Framework) serveHTTP(ctx *Context) {
 	if frame.tryHandle(ctx, path, method, frame.staticSrcTree) {
 		return
 	}
+	if frame.handleAllowed(ctx, path, method) {
+		return
+	}
 	// Handle 404
+	if frame.notFound != nil {
+		ctx.doHandler(HandlerChain{frame.notFound}, nil)
+		if ctx.W.Committed() {
+			return
+		}
+	}
 	global.errorFunc(ctx, "Not Found", 404)
 }
 
+// hasHandle returns whether the path has a route of the method.
+func (frame *Framework) hasHandle(path, method string) bool {
+	for _, tree := range []map[string]*node{frame.dynamicSrcTree, frame.staticSrcTree} {
+		if root := tree[method]; root != nil {
+			if handle, _, _ := root.getValue(path); handle != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (frame *Framework) tryHandle(ctx *Context, path, method string, tree map[string]*node) bool {
 	if root := tree[method]; root != nil {
 		if handle, ps, tsr := root.getValue(path); handle != nil {
@@ -598,6 +1197,19 @@ func (frame *Framework) tryHandle(ctx *Context, path, method string, tree map[st
 				code = 307
 			}
 
+			if tsr && frame.trailingSlashEquivalent {
+				var equivalent string
+				if len(path) > 1 && path[len(path)-1] == '/' {
+					equivalent = path[:len(path)-1]
+				} else {
+					equivalent = path + "/"
+				}
+				if handle, ps, _ = root.getValue(equivalent); handle != nil {
+					handle(ctx, ps)
+					return true
+				}
+			}
+
 			if tsr && frame.redirectTrailingSlash {
 				if len(path) > 1 && path[len(path)-1] == '/' {
 					ctx.ModifyPath(path[:len(path)-1])
@@ -614,6 +1226,12 @@ func (frame *Framework) tryHandle(ctx *Context, path, method string, tree map[st
 					CleanToURL(path),
 					frame.redirectTrailingSlash,
 				)
+				// the fixed path may not satisfy the constraints of the path params
+				if found {
+					if handle, _, _ := root.getValue(string(fixedPath)); handle == nil {
+						found = false
+					}
+				}
 				if found {
 					ctx.ModifyPath(BytesToString(fixedPath))
 					http.Redirect(ctx.W, ctx.R, ctx.URL().String(), code)
@@ -623,11 +1241,17 @@ func (frame *Framework) tryHandle(ctx *Context, path, method string, tree map[st
 		}
 	}
 
+	return false
+}
+
+// handleAllowed replies to the OPTIONS request or the request of the method not allowed
+// with the Allow header.
+func (frame *Framework) handleAllowed(ctx *Context, path, method string) bool {
 	if method == "OPTIONS" {
 		// Handle OPTIONS requests
 		if frame.handleOPTIONS {
 			if allow := frame.allowed(path, method); len(allow) > 0 {
-				ctx.SetHeader("Allow", allow)
+				ctx.SetHeader(HeaderAllow, allow)
 				ctx.W.WriteHeader(204)
 				return true
 			}
@@ -636,7 +1260,7 @@ func (frame *Framework) tryHandle(ctx *Context, path, method string, tree map[st
 		// Handle 405
 		if frame.handleMethodNotAllowed {
 			if allow := frame.allowed(path, method); len(allow) > 0 {
-				ctx.SetHeader("Allow", allow)
+				ctx.SetHeader(HeaderAllow, allow)
 				global.errorFunc(ctx, "Method Not Allowed", 405)
 				return true
 			}
@@ -645,47 +1269,55 @@ func (frame *Framework) tryHandle(ctx *Context, path, method string, tree map[st
 	return false
 }
 
+// allowed returns the sorted methods registered for the path except the requested one,
+// including HEAD if it is answered by GET and OPTIONS if it is answered automatically.
 func (frame *Framework) allowed(path, reqMethod string) (allow string) {
-	if path == "*" { // server-wide
-		for method := range frame.dynamicSrcTree {
-			if method == "OPTIONS" {
-				continue
-			}
-
-			// add request method to list of allowed methods
-			if len(allow) == 0 {
-				allow = method
-			} else {
-				allow += ", " + method
+	var methods []string
+	var add = func(method string) {
+		for _, m := range methods {
+			if m == method {
+				return
 			}
 		}
-	} else { // specific path
-		for method := range frame.dynamicSrcTree {
+		methods = append(methods, method)
+	}
+	for _, tree := range []map[string]*node{frame.dynamicSrcTree, frame.staticSrcTree} {
+		for method, root := range tree {
 			// Skip the requested method - we already tried this one
-			if method == reqMethod || method == "OPTIONS" {
+			if method == reqMethod {
 				continue
 			}
-
-			handle, _, _ := frame.dynamicSrcTree[method].getValue(path)
-			if handle != nil {
-				// add request method to list of allowed methods
-				if len(allow) == 0 {
-					allow = method
-				} else {
-					allow += ", " + method
+			if path != "*" { // specific path
+				if handle, _, _ := root.getValue(path); handle == nil {
+					continue
 				}
 			}
+			add(method)
+		}
+	}
+	if len(methods) == 0 {
+		return
+	}
+	if frame.handleHEAD && reqMethod != "HEAD" {
+		for _, m := range methods {
+			if m == "GET" {
+				add("HEAD")
+				break
+			}
 		}
 	}
-	if len(allow) > 0 {
-		allow += ", OPTIONS"
+	if frame.handleOPTIONS {
+		add("OPTIONS")
 	}
-	return
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
 }
 
 // makeHandle makes an *apiware.ParamsAPI implements the Handle interface.
-func (frame *Framework) makeHandle(handlerChain HandlerChain) Handle {
+func (frame *Framework) makeHandle(pattern string, handlerChain HandlerChain, static bool) Handle {
 	return func(ctx *Context, pathParams PathParams) {
+		ctx.routePattern = pattern
+		ctx.staticRoute = static
 		ctx.doHandler(handlerChain, pathParams)
 	}
 }
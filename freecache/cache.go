@@ -8,6 +8,16 @@ import (
 	"github.com/henrylee2cn/faygo/freecache/murmur3"
 )
 
+// EvictionPolicy decides which entry is removed when the cache is full.
+type EvictionPolicy uint8
+
+const (
+	// LRU removes the least recently used entries first.
+	LRU EvictionPolicy = iota
+	// LFU removes the least frequently used entries first.
+	LFU
+)
+
 type Cache struct {
 	locks     [256]sync.Mutex
 	segments  [256]segment
@@ -24,12 +34,17 @@ func hashFunc(data []byte) uint64 {
 // `debug.SetGCPercent()`, set it to a much smaller value
 // to limit the memory consumption and GC pause time.
 func NewCache(size int) (cache *Cache) {
+	return NewCacheWithPolicy(size, LRU)
+}
+
+// NewCacheWithPolicy is similar to NewCache, but with the eviction policy.
+func NewCacheWithPolicy(size int, policy EvictionPolicy) (cache *Cache) {
 	if size < 512*1024 {
 		size = 512 * 1024
 	}
 	cache = new(Cache)
 	for i := 0; i < 256; i++ {
-		cache.segments[i] = newSegment(size/256, i)
+		cache.segments[i] = newSegment(size/256, i, policy)
 	}
 	return
 }
@@ -102,6 +117,25 @@ func (cache *Cache) ExpiredCount() (count int64) {
 	return
 }
 
+// EvictionCount returns the number of unexpired entries removed to make room.
+func (cache *Cache) EvictionCount() (count int64) {
+	for i := 0; i < 256; i++ {
+		count += atomic.LoadInt64(&cache.segments[i].totalEvicted)
+	}
+	return
+}
+
+// Size returns the bytes of the ring buffers occupied by the entries,
+// including the entry headers and the deleted entries not yet reclaimed.
+func (cache *Cache) Size() (size int64) {
+	for i := 0; i < 256; i++ {
+		cache.locks[i].Lock()
+		size += cache.segments[i].rb.Size() - cache.segments[i].vacuumLen
+		cache.locks[i].Unlock()
+	}
+	return
+}
+
 func (cache *Cache) EntryCount() (entryCount int64) {
 	for i := 0; i < 256; i++ {
 		entryCount += atomic.LoadInt64(&cache.segments[i].entryCount)
@@ -129,6 +163,10 @@ func (cache *Cache) HitCount() int64 {
 	return atomic.LoadInt64(&cache.hitCount)
 }
 
+func (cache *Cache) MissCount() int64 {
+	return atomic.LoadInt64(&cache.missCount)
+}
+
 func (cache *Cache) LookupCount() int64 {
 	return atomic.LoadInt64(&cache.hitCount) + atomic.LoadInt64(&cache.missCount)
 }
@@ -152,7 +190,7 @@ func (cache *Cache) OverwriteCount() (overwriteCount int64) {
 func (cache *Cache) Clear() {
 	for i := 0; i < 256; i++ {
 		cache.locks[i].Lock()
-		newSeg := newSegment(len(cache.segments[i].rb.data), i)
+		newSeg := newSegment(len(cache.segments[i].rb.data), i, cache.segments[i].policy)
 		cache.segments[i] = newSeg
 		cache.locks[i].Unlock()
 	}
@@ -346,3 +346,33 @@ func BenchmarkHashFunc(b *testing.B) {
 		hashFunc(key)
 	}
 }
+
+func TestEvictionPolicy(t *testing.T) {
+	for _, c := range []struct {
+		policy  EvictionPolicy
+		survive bool
+	}{{LRU, false}, {LFU, true}} {
+		cache := NewCacheWithPolicy(512*1024, c.policy)
+		hot := []byte("hot")
+		cache.Set(hot, make([]byte, 100), 0)
+		for i := 0; i < 1000; i++ {
+			cache.Get(hot)
+		}
+		time.Sleep(time.Second) // the access time is in seconds
+		for i := 0; i < 20000; i++ {
+			cache.Set([]byte(fmt.Sprintf("key%d", i)), make([]byte, 100), 0)
+		}
+		if _, err := cache.Get(hot); (err == nil) != c.survive {
+			t.Errorf("policy %d: hot entry survived=%v, want %v", c.policy, err == nil, c.survive)
+		}
+		if cache.EvictionCount() == 0 {
+			t.Errorf("policy %d: eviction count should be greater than zero", c.policy)
+		}
+		if cache.HitCount() < 1000 || cache.MissCount() > 1 {
+			t.Errorf("policy %d: hits=%d misses=%d", c.policy, cache.HitCount(), cache.MissCount())
+		}
+		if cache.Size() <= 0 || cache.Size() > 512*1024 {
+			t.Errorf("policy %d: size=%d", c.policy, cache.Size())
+		}
+	}
+}
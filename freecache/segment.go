@@ -31,7 +31,7 @@ type entryHdr struct {
 	valCap     uint32
 	deleted    bool
 	slotId     uint8
-	reserved   uint16
+	hitCount   uint16 // used by LFU, saturated at 65535
 }
 
 // a segment contains 256 slots, a slot is an array of entry pointers ordered by hash16 value
@@ -42,6 +42,8 @@ type segment struct {
 	entryCount    int64
 	totalCount    int64      // number of entries in ring buffer, including deleted entries.
 	totalTime     int64      // used to calculate least recent used entry.
+	totalHits     int64      // used to calculate least frequently used entry.
+	totalEvicted  int64      // number of unexpired entries removed to make room.
 	totalEvacuate int64      // used for debug
 	totalExpired  int64      // used for debug
 	overwrites    int64      // used for debug
@@ -49,11 +51,13 @@ type segment struct {
 	slotLens      [256]int32 // The actual length for every slot.
 	slotCap       int32      // max number of entry pointers a slot can hold.
 	slotsData     []entryPtr // shared by all 256 slots
+	policy        EvictionPolicy
 }
 
-func newSegment(bufSize int, segId int) (seg segment) {
+func newSegment(bufSize int, segId int, policy EvictionPolicy) (seg segment) {
 	seg.rb = NewRingBuf(bufSize, 0)
 	seg.segId = segId
+	seg.policy = policy
 	seg.vacuumLen = int64(bufSize)
 	seg.slotCap = 1
 	seg.slotsData = make([]entryPtr, 256*seg.slotCap)
@@ -141,6 +145,7 @@ func (seg *segment) set(key, value []byte, hashVal uint64, expireSeconds int) (e
 	seg.rb.Write(value)
 	seg.rb.Skip(int64(hdr.valCap - hdr.valLen))
 	seg.totalTime += int64(now)
+	seg.totalHits += int64(hdr.hitCount)
 	seg.totalCount++
 	seg.vacuumLen -= entryLen
 	return
@@ -157,23 +162,32 @@ func (seg *segment) evacuate(entryLen int64, slotId uint8, now uint32) (slotModi
 		if oldHdr.deleted {
 			consecutiveEvacuate = 0
 			seg.totalTime -= int64(oldHdr.accessTime)
+			seg.totalHits -= int64(oldHdr.hitCount)
 			seg.totalCount--
 			seg.vacuumLen += oldEntryLen
 			continue
 		}
 		expired := oldHdr.expireAt != 0 && oldHdr.expireAt < now
-		leastRecentUsed := int64(oldHdr.accessTime)*seg.totalCount <= seg.totalTime
-		if expired || leastRecentUsed || consecutiveEvacuate > 5 {
+		var leastUsed bool
+		if seg.policy == LFU {
+			leastUsed = int64(oldHdr.hitCount)*seg.totalCount <= seg.totalHits
+		} else {
+			leastUsed = int64(oldHdr.accessTime)*seg.totalCount <= seg.totalTime
+		}
+		if expired || leastUsed || consecutiveEvacuate > 5 {
 			seg.delEntryPtr(oldHdr.slotId, oldHdr.hash16, oldOff)
 			if oldHdr.slotId == slotId {
 				slotModified = true
 			}
 			consecutiveEvacuate = 0
 			seg.totalTime -= int64(oldHdr.accessTime)
+			seg.totalHits -= int64(oldHdr.hitCount)
 			seg.totalCount--
 			seg.vacuumLen += oldEntryLen
 			if expired {
 				seg.totalExpired++
+			} else {
+				seg.totalEvicted++
 			}
 		} else {
 			// evacuate an old entry that has been accessed recently for better cache hit rate.
@@ -211,6 +225,10 @@ func (seg *segment) get(key []byte, hashVal uint64) (value []byte, err error) {
 	}
 	seg.totalTime += int64(now - hdr.accessTime)
 	hdr.accessTime = now
+	if hdr.hitCount < 1<<16-1 {
+		hdr.hitCount++
+		seg.totalHits++
+	}
 	seg.rb.WriteAt(hdrBuf[:], ptr.offset)
 	value = make([]byte, hdr.valLen)
 
@@ -334,5 +352,6 @@ func (seg *segment) lookupByOff(slot []entryPtr, hash16 uint16, offset int64) (i
 func (seg *segment) resetStatistics() {
 	seg.totalEvacuate = 0
 	seg.totalExpired = 0
+	seg.totalEvicted = 0
 	seg.overwrites = 0
 }
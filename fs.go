@@ -18,6 +18,8 @@ package faygo
 
 import (
 	"bytes"
+	"compress/flate"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -30,29 +32,62 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/henrylee2cn/faygo/acceptencoder"
-	"github.com/henrylee2cn/faygo/freecache"
 	"github.com/henrylee2cn/faygo/markdown"
 )
 
 const indexPage = "/index.html"
 
-// FileServerManager is file cache system manager
+// FileServerManager is file cache system manager.
+// All its methods are safe for concurrent use, provided the cache backend is.
 type FileServerManager struct {
-	files             map[string]CacheFile
-	cache             *freecache.Cache
-	fileExpireSeconds int
-	maxSizeOfSingle   int64
-	enableCache       bool
-	enableCompress    bool
-	errorFunc         ErrorFunc
-	filesLock         sync.RWMutex
+	backend         CacheBackend
+	customBackend   CacheBackend // the backend replaced by SetBackend
+	fileExpire      time.Duration
+	maxSizeOfSingle int64
+	enableCache     bool
+	enableCompress  bool
+	errorFunc       ErrorFunc
+	fs              http.FileSystem // the underlying file system, the local disk by default
+	hits            int64
+	misses          int64
+	assets          map[string]assetHash
+	assetsLock      sync.RWMutex
+	// the fresh precompressed sibling files of the static files
+	precompressed     map[string]precompressedVariants
+	precompressedLock sync.RWMutex
+	// serializes Put with the compression of the content put, see ServeCached
+	putLock sync.RWMutex
+	// the short scopes of the cache keys by the identities of the file systems, see fsScope
+	scopes     map[string]string
+	scopesLock sync.RWMutex
+}
+
+// NewFileServerManager creates a file cache system manager apart from the global one,
+// such as for caching the generated thumbnails, which are inserted by Put and served by ServeCached.
+// The cache size will be set to 512KB at minimum, and a single entry is limited to 1/1024 of it.
+// expire <= 0 means no expire, otherwise it is rounded down to seconds, but at least 1s.
+// If gzip is true, the compressible files are compressed by the Accept-Encoding of the request.
+// note: the files are opened by the existing Open(name, encoding, nocache), there is no Open(name);
+// use OpenBytes to read the files inserted by Put only.
+func NewFileServerManager(sizeMB int64, expire time.Duration, gzip bool) *FileServerManager {
+	manager := newFileServerManager(sizeMB*MB, 0, "", "", true, gzip)
+	if expire > 0 {
+		// the cache backends expire the entries in seconds
+		if expire < time.Second {
+			expire = time.Second
+		}
+		manager.fileExpire = expire
+	}
+	return manager
 }
 
 // The cache size will be set to 512KB at minimum.
@@ -60,38 +95,100 @@ type FileServerManager struct {
 // `debug.SetGCPercent()`, set it to a much smaller value
 // to limit the memory consumption and GC pause time.
 // expireSeconds <= 0 means no expire.
-func newFileServerManager(cacheSize int64, fileExpireSeconds int, enableCache bool, enableCompress bool) *FileServerManager {
+func newFileServerManager(cacheSize int64, fileExpireSeconds int, backend string, evictionPolicy string, enableCache bool, enableCompress bool) *FileServerManager {
 	manager := &FileServerManager{
-		enableCache:    enableCache,
-		enableCompress: enableCompress,
-	}
-	if enableCache {
-		manager.fileExpireSeconds = fileExpireSeconds
-		manager.cache = freecache.NewCache(int(cacheSize))
-		manager.files = map[string]CacheFile{}
-		manager.maxSizeOfSingle = cacheSize / 1024
-		if manager.maxSizeOfSingle < 512 {
-			manager.maxSizeOfSingle = 512
-		}
+		fs:            diskFS{},
+		assets:        map[string]assetHash{},
+		precompressed: map[string]precompressedVariants{},
+		scopes:        map[string]string{},
 	}
+	manager.configure(cacheSize, fileExpireSeconds, backend, evictionPolicy, enableCache, enableCompress)
 	return manager
 }
 
-// Open gets or stores the file with compression and caching options.
+// configure applies the cache and compression options,
+// the file system and the backend replaced by SetBackend are kept.
+func (c *FileServerManager) configure(cacheSize int64, fileExpireSeconds int, backend string, evictionPolicy string, enableCache bool, enableCompress bool) {
+	c.enableCache = enableCache
+	c.enableCompress = enableCompress
+	c.fileExpire = 0
+	c.maxSizeOfSingle = 0
+	if !enableCache {
+		c.backend = nil
+		return
+	}
+	c.fileExpire = time.Duration(fileExpireSeconds) * time.Second
+	switch {
+	case c.customBackend != nil:
+		c.backend = c.customBackend
+	case backend == "lru":
+		c.backend = NewLRUCacheBackend(cacheSize)
+	default:
+		c.backend = NewMemoryCacheBackend(cacheSize, evictionPolicy)
+	}
+	c.maxSizeOfSingle = cacheSize / 1024
+	if c.maxSizeOfSingle < 512 {
+		c.maxSizeOfSingle = 512
+	}
+}
+
+// SetBackend replaces the cache backend, it should be called before serving.
+// It takes effect only when the cache is enabled.
+func (c *FileServerManager) SetBackend(backend CacheBackend) {
+	c.customBackend = backend
+	if c.enableCache {
+		c.backend = backend
+	}
+}
+
+// SetFileSystem replaces the underlying file system, such as a cloud storage or a test fixture,
+// it should be called before serving. If fsys is nil, the local disk is used.
+// The names passed to fsys are the local file paths, and the returned files should implement
+// io.Seeker for the range requests.
+func (c *FileServerManager) SetFileSystem(fsys http.FileSystem) {
+	if fsys == nil {
+		fsys = diskFS{}
+	}
+	c.fs = fsys
+}
+
+// diskFS is the local file system without root, the names are the local file paths.
+type diskFS struct{}
+
+func (diskFS) Open(name string) (http.File, error) {
+	return os.Open(name)
+}
+
+// Open gets or stores the local file with compression and caching options.
 // If the name is larger than 65535 or body is larger than 1/1024 of the cache size,
 // the entry will not be written to the cache.
 func (c *FileServerManager) Open(name string, encoding string, nocache bool) (http.File, error) {
+	return c.OpenFile(nil, name, encoding, nocache)
+}
+
+// OpenFile is similar to Open, but the file is opened from the file system fsys,
+// such as `http.FS(embedFS)`. If fsys is nil, the underlying file system is used.
+// The files of the different file systems are cached apart, even if they have the same name.
+func (c *FileServerManager) OpenFile(fsys http.FileSystem, name string, encoding string, nocache bool) (http.File, error) {
+	if fsys == nil {
+		fsys = c.fs
+	}
 	var f http.File
 	var err error
-	var compressible = encoding != "" && c.enableCompress
-	var cacheable = !nocache && c.enableCache
+	var compressible = encoding != "" && c.enableCompress && acceptencoder.Compressible(mime.TypeByExtension(filepath.Ext(name)))
+	scope, ok := c.fsScope(fsys)
+	var cacheable = !nocache && c.enableCache && ok
+	var key = scopedName(scope, name)
+	if compressible {
+		key = cacheKey(key, encoding, flate.BestCompression)
+	}
 	if cacheable {
-		f, err = c.Get(name)
+		f, err = c.Get(key)
 		if err == nil {
 			return f, nil
 		}
 	}
-	f, err = os.Open(name)
+	f, err = fsys.Open(name)
 	if err != nil {
 		return nil, err
 	}
@@ -123,19 +220,41 @@ func (c *FileServerManager) Open(name string, encoding string, nocache bool) (ht
 			return nil, err
 		}
 	}
-	return c.Set(name, content, fileInfo, encoding)
+	return c.Set(key, content, fileInfo, encoding)
 }
 
 // OpenFS gets or stores the cache file.
 // If the name is larger than 65535 or body is larger than 1/1024 of the cache size,
 // the entry will not be written to the cache.
+// If the file is compressible and has a fresh precompressed sibling file accepted by the client,
+// such as app.js.br or app.js.gz, the sibling file is served instead of compressing dynamically.
 func (c *FileServerManager) OpenFS(ctx *Context, name string, fs FileSystem) (http.File, error) {
+	if ffs, ok := fs.(*fileSystem); ok {
+		if _, ok := ffs.FileSystem.(putFS); ok {
+			// not to cache the variants compressed from the content replaced by Put meanwhile
+			c.putLock.RLock()
+			defer c.putLock.RUnlock()
+		}
+	}
 	var f http.File
 	var err error
-	var compressible = !fs.Nocompress() && c.enableCompress
+	var compressible = !fs.Nocompress() && !ctx.noCompress && c.enableCompress && acceptencoder.Compressible(mime.TypeByExtension(path.Ext(name)))
 	var cacheable = !fs.Nocache() && c.enableCache
+	var key = name
+	var encoding string
+	var level = flate.BestCompression
+	if compressible {
+		if f, ok := c.openPrecompressed(ctx, name, fs, cacheable); ok {
+			return f, nil
+		}
+		encoding = acceptencoder.ParseEncoding(ctx.R)
+		if ctx.hasGzipLevel {
+			level = ctx.gzipLevel
+		}
+		key = cacheKey(name, encoding, level)
+	}
 	if cacheable {
-		f, err = c.Get(name)
+		f, err = c.Get(key)
 		if err == nil {
 			if encoding := f.(*CacheFile).encoding; encoding != "" {
 				ctx.W.Header().Set("Content-Encoding", encoding)
@@ -152,9 +271,10 @@ func (c *FileServerManager) OpenFS(ctx *Context, name string, fs FileSystem) (ht
 		return f, err
 	}
 	var content []byte
-	var encoding string
+	// stop reading once the client is gone, and the partial content is not cached
+	cf := contextFile{File: f, ctx: ctx.Context()}
 	if compressible {
-		content, encoding, err = fileCompress(f, ctx)
+		content, encoding, err = fileCompress(cf, ctx, encoding, level)
 		f.Close()
 		if err != nil {
 			return nil, err
@@ -170,46 +290,345 @@ func (c *FileServerManager) OpenFS(ctx *Context, name string, fs FileSystem) (ht
 		if !cacheable || fileInfo.Size() > c.maxSizeOfSingle {
 			return f, nil
 		}
-		content, err = ioutil.ReadAll(f)
+		content, err = ioutil.ReadAll(cf)
 		f.Close()
 		if err != nil {
 			return nil, err
 		}
 	}
-	return c.Set(name, content, fileInfo, encoding)
+	return c.Set(key, content, fileInfo, encoding)
+}
+
+// contextFile aborts reading the file with the error of the context once it is done,
+// such as the client aborting the download.
+type contextFile struct {
+	http.File
+	ctx context.Context
+}
+
+func (f contextFile) Read(p []byte) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.File.Read(p)
+}
+
+// contextReader is similar to contextFile, but for the io.Reader.
+type contextReader struct {
+	io.Reader
+	ctx context.Context
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.Reader.Read(p)
+}
+
+// cacheKey returns the cache key of the file variant,
+// so that the variants of different encodings and compression levels are cached separately.
+func cacheKey(name, encoding string, level int) string {
+	if encoding == "" {
+		return name
+	}
+	return name + "\x00" + encoding + "\x00" + strconv.Itoa(level)
+}
+
+// CacheStats is the statistics of the file cache.
+type CacheStats struct {
+	Entries     int64   `json:"entries"`     // number of the cached entries
+	Bytes       int64   `json:"bytes"`       // bytes occupied by the cached entries
+	Hits        int64   `json:"hits"`        // number of the cache hits
+	Misses      int64   `json:"misses"`      // number of the cache misses
+	HitRate     float64 `json:"hit_rate"`    // hits / (hits + misses)
+	Evictions   int64   `json:"evictions"`   // number of the unexpired entries removed to make room
+	Expirations int64   `json:"expirations"` // number of the expired entries removed
+}
+
+// Stats returns the statistics of the file cache.
+// If the cache is disabled, returns zero values.
+func (c *FileServerManager) Stats() CacheStats {
+	if !c.enableCache {
+		return CacheStats{}
+	}
+	stats := CacheStats{
+		Entries: c.backend.Len(),
+		Bytes:   c.backend.Bytes(),
+		Hits:    atomic.LoadInt64(&c.hits),
+		Misses:  atomic.LoadInt64(&c.misses),
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(lookups)
+	}
+	if counter, ok := c.backend.(cacheBackendCounter); ok {
+		stats.Evictions = counter.EvictionCount()
+		stats.Expirations = counter.ExpiredCount()
+	}
+	return stats
 }
 
 // Get gets file from cache.
 func (c *FileServerManager) Get(name string) (http.File, error) {
-	b, err := c.cache.Get([]byte(name))
-	if err != nil {
-		c.filesLock.Lock()
-		delete(c.files, name)
-		c.filesLock.Unlock()
-		return nil, err
+	entry, ok := c.backend.Get(name)
+	if !ok {
+		atomic.AddInt64(&c.misses, 1)
+		c.invalidateAssetHash(name)
+		return nil, os.ErrNotExist
 	}
-	c.filesLock.RLock()
-	f := c.files[name]
-	c.filesLock.RUnlock()
-	f.Reader = bytes.NewReader(b)
-	return &f, nil
+	atomic.AddInt64(&c.hits, 1)
+	return &CacheFile{
+		fileInfo: &FileInfo{
+			name:    entry.Name,
+			size:    entry.Size,
+			mode:    0444,
+			modTime: entry.ModTime,
+		},
+		encoding: entry.Encoding,
+		etag:     entry.ETag,
+		Reader:   bytes.NewReader(entry.Content),
+	}, nil
 }
 
 // Set sets file to cache.
 func (c *FileServerManager) Set(name string, body []byte, fileInfo os.FileInfo, encoding string) (http.File, error) {
-	err := c.cache.Set([]byte(name), body, c.fileExpireSeconds)
-	if err != nil {
+	entry := &CacheEntry{
+		Name:     fileInfo.Name(),
+		Size:     fileInfo.Size(),
+		ModTime:  fileInfo.ModTime(),
+		Encoding: encoding,
+		ETag:     fileETag(fileInfo),
+		Content:  body,
+	}
+	if err := c.backend.Set(name, entry, c.fileExpire); err != nil {
 		return nil, err
 	}
-	f := CacheFile{
+	c.invalidateAssetHash(name)
+	return &CacheFile{
 		fileInfo: fileInfo,
 		encoding: encoding,
+		etag:     entry.ETag,
+		Reader:   bytes.NewReader(body),
+	}, nil
+}
+
+// fileETag returns the weak entity tag of the file by its size and modification time.
+func fileETag(fileInfo os.FileInfo) string {
+	return fmt.Sprintf(`W/"%x-%x"`, fileInfo.ModTime().UnixNano(), fileInfo.Size())
+}
+
+// Invalidate removes the cached entries of the file, including all of its compressed variants,
+// and returns the number of the removed entries.
+// The name is the same as the one used to open the file,
+// that is the local file path, or the path in the file system of the static route.
+func (c *FileServerManager) Invalidate(name string) int {
+	c.scopesLock.RLock()
+	names := make([]string, 0, len(c.scopes)+1)
+	names = append(names, name)
+	for _, scope := range c.scopes {
+		names = append(names, scopedName(scope, name))
+	}
+	c.scopesLock.RUnlock()
+	for _, name := range names {
+		c.invalidateAssetHash(name)
+	}
+	c.precompressedLock.Lock()
+	for _, name := range names {
+		delete(c.precompressed, name)
 	}
-	c.filesLock.Lock()
-	c.files[name] = f
-	c.filesLock.Unlock()
-	f.Reader = bytes.NewReader(body)
-	return &f, nil
+	c.precompressedLock.Unlock()
+	if !c.enableCache {
+		return 0
+	}
+	var count int
+	for _, name := range names {
+		if c.backend.Del(name) {
+			count++
+		}
+		for _, encoding := range []string{"gzip", "deflate"} {
+			for level := flate.HuffmanOnly; level <= flate.BestCompression; level++ {
+				if c.backend.Del(cacheKey(name, encoding, level)) {
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+// fsScope returns the scope of the cache keys of the files opened from fsys,
+// which is empty for the underlying file system and the files inserted by Put.
+// ok is false if the identity of fsys is unknown, then its files should not be cached.
+func (c *FileServerManager) fsScope(fsys http.FileSystem) (scope string, ok bool) {
+	if ffs, isFS := fsys.(*fileSystem); isFS {
+		fsys = ffs.FileSystem
+	}
+	if _, isPut := fsys.(putFS); isPut {
+		return "", true
+	}
+	id, ok := fsIdentity(fsValue(fsys))
+	if !ok {
+		return "", false
+	}
+	if underlying, _ := fsIdentity(fsValue(c.fs)); id == underlying {
+		return "", true
+	}
+	c.scopesLock.RLock()
+	scope, ok = c.scopes[id]
+	c.scopesLock.RUnlock()
+	if ok {
+		return scope, true
+	}
+	c.scopesLock.Lock()
+	defer c.scopesLock.Unlock()
+	if scope, ok = c.scopes[id]; !ok {
+		scope = "#" + strconv.Itoa(len(c.scopes)+1)
+		c.scopes[id] = scope
+	}
+	return scope, true
+}
+
+// scopedName returns the name in the scope of the file system.
+func scopedName(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "\x00" + name
+}
+
+// fsValue returns the value of fsys to be identified,
+// the pointer to a struct is dereferenced, so that the file system created on every request,
+// such as the one of ServeFile, is identified by its fields instead of its address.
+func fsValue(fsys http.FileSystem) reflect.Value {
+	v := reflect.ValueOf(fsys)
+	if v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+		return v.Elem()
+	}
+	return v
+}
+
+// fsIdentity returns the identity of the file system value, which is equal for the same file system,
+// such as the address of a pointer or a map, or the root of http.Dir.
+func fsIdentity(v reflect.Value) (string, bool) {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return "nil", true
+	case reflect.Interface:
+		return fsIdentity(v.Elem())
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return v.Type().String() + "@" + strconv.FormatUint(uint64(v.Pointer()), 16), true
+	case reflect.Slice:
+		return v.Type().String() + "@" + strconv.FormatUint(uint64(v.Pointer()), 16) + ":" + strconv.Itoa(v.Len()), true
+	case reflect.String:
+		return v.Type().String() + "(" + strconv.Quote(v.String()) + ")", true
+	case reflect.Bool:
+		return v.Type().String() + "(" + strconv.FormatBool(v.Bool()) + ")", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Type().String() + "(" + strconv.FormatInt(v.Int(), 10) + ")", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Type().String() + "(" + strconv.FormatUint(v.Uint(), 10) + ")", true
+	case reflect.Struct:
+		fields := make([]string, v.NumField())
+		for i := range fields {
+			id, ok := fsIdentity(v.Field(i))
+			if !ok {
+				return "", false
+			}
+			fields[i] = id
+		}
+		return v.Type().String() + "{" + strings.Join(fields, ",") + "}", true
+	}
+	// the others, such as the floats, are not expected in a file system
+	return "", false
+}
+
+// InvalidateAll removes all the cached entries.
+func (c *FileServerManager) InvalidateAll() {
+	c.assetsLock.Lock()
+	c.assets = map[string]assetHash{}
+	c.assetsLock.Unlock()
+	c.precompressedLock.Lock()
+	c.precompressed = map[string]precompressedVariants{}
+	c.precompressedLock.Unlock()
+	if c.enableCache {
+		c.backend.Clear()
+	}
+}
+
+// common errors of Put
+var (
+	ErrFileCacheDisabled = errors.New("the file cache is disabled")
+	ErrFileTooLarge      = errors.New("the file is larger than 1/1024 of the cache size")
+)
+
+// Put inserts the synthesized content as the file named name,
+// it is bounded by the cache size and expires like the files read from the file system.
+// The previous content and its compressed variants of the name are replaced.
+// The content must not be modified after Put.
+func (c *FileServerManager) Put(name string, content []byte, modtime time.Time) error {
+	if !c.enableCache {
+		return ErrFileCacheDisabled
+	}
+	if int64(len(content)) > c.maxSizeOfSingle {
+		return ErrFileTooLarge
+	}
+	c.putLock.Lock()
+	defer c.putLock.Unlock()
+	c.Invalidate(name)
+	_, err := c.Set(name, content, &FileInfo{
+		name:    path.Base(name),
+		size:    int64(len(content)),
+		mode:    0444,
+		modTime: modtime,
+	}, "")
+	return err
+}
+
+// OpenBytes returns the content and the file info of the file named name, which is inserted by Put.
+// It never reads the file system, and os.ErrNotExist is returned if the file is missing or expired.
+func (c *FileServerManager) OpenBytes(name string) ([]byte, os.FileInfo, error) {
+	f, err := putFS{c}.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, info, nil
+}
+
+// ServeCached replies to the request with the file inserted by Put,
+// compressed by the Accept-Encoding of the request, and validated by the ETag and Last-Modified,
+// the same as the static files. If the file is missing or expired, 404 is replied.
+func (c *FileServerManager) ServeCached(ctx *Context, name string) {
+	c.serveFile(ctx, FS(putFS{c}), name, false)
+}
+
+// putFS is the file system of the files inserted by Put.
+type putFS struct {
+	manager *FileServerManager
+}
+
+func (fs putFS) Open(name string) (http.File, error) {
+	if !fs.manager.enableCache {
+		return nil, os.ErrNotExist
+	}
+	entry, ok := fs.manager.backend.Get(name)
+	if !ok || entry.Encoding != "" {
+		return nil, os.ErrNotExist
+	}
+	return NewFile(entry.Content, &FileInfo{
+		name:    entry.Name,
+		size:    entry.Size,
+		mode:    0444,
+		modTime: entry.ModTime,
+	}), nil
 }
 
 type (
@@ -251,9 +670,30 @@ func FS(fs http.FileSystem, nocompressAndNocache ...bool) FileSystem {
 	}
 }
 
-// DirFS creates a file system with compression and caching options, similar to http.Dir
+// DirFS creates a file system with compression and caching options, similar to http.Dir,
+// the files are opened from the underlying file system of the global file server manager.
 func DirFS(root string, nocompressAndNocache ...bool) FileSystem {
-	return FS(http.Dir(root), nocompressAndNocache...)
+	return FS(&dirFS{
+		dir:     root,
+		manager: global.fsManager,
+	}, nocompressAndNocache...)
+}
+
+type dirFS struct {
+	dir     string
+	manager *FileServerManager
+}
+
+func (fs *dirFS) Open(name string) (http.File, error) {
+	if filepath.Separator != '/' && strings.ContainsRune(name, filepath.Separator) ||
+		strings.Contains(name, "\x00") {
+		return nil, errors.New("DirFS: invalid character in file path")
+	}
+	dir := fs.dir
+	if dir == "" {
+		dir = "."
+	}
+	return fs.manager.fs.Open(filepath.Join(dir, filepath.FromSlash(path.Clean("/"+name))))
 }
 
 // RenderFS creates a file system with auto-rendering.
@@ -357,6 +797,7 @@ func (fs *markdownFS) Open(name string) (http.File, error) {
 type CacheFile struct {
 	fileInfo os.FileInfo
 	encoding string
+	etag     string
 	*bytes.Reader
 }
 
@@ -505,7 +946,7 @@ func (c *FileServerManager) ServeContent(ctx *Context, name string, modtime time
 		}
 		return size, nil
 	}
-	c.serveContent(ctx, name, modtime, sizeFunc, content)
+	c.serveContent(ctx, name, modtime, sizeFunc, content, false)
 }
 
 // errSeeker is returned by ServeContent's sizeFunc when the content
@@ -521,7 +962,9 @@ const sniffLen = 512
 // if modtime.IsZero(), modtime is unknown.
 // content must be seeked to the beginning of the file.
 // The sizeFunc is called at most once. Its error, if any, is sent in the HTTP response.
-func (c *FileServerManager) serveContent(ctx *Context, name string, modtime time.Time, sizeFunc func() (int64, error), content io.ReadSeeker) {
+// If exactSize is true, the size is the exact length of the content even if it is encoded,
+// such as the precompressed file.
+func (c *FileServerManager) serveContent(ctx *Context, name string, modtime time.Time, sizeFunc func() (int64, error), content io.ReadSeeker, exactSize bool) {
 	if checkLastModified(ctx, modtime) {
 		return
 	}
@@ -629,7 +1072,7 @@ func (c *FileServerManager) serveContent(ctx *Context, name string, modtime time
 		}
 
 		ctx.W.Header().Set("Accept-Ranges", "bytes")
-		if ctx.W.Header().Get("Content-Encoding") == "" {
+		if exactSize || ctx.W.Header().Get("Content-Encoding") == "" {
 			ctx.W.Header().Set("Content-Length", strconv.FormatInt(sendSize, 10))
 		}
 	}
@@ -637,7 +1080,8 @@ func (c *FileServerManager) serveContent(ctx *Context, name string, modtime time
 	ctx.W.WriteHeader(code)
 
 	if ctx.R.Method != "HEAD" {
-		io.CopyN(ctx.W, sendContent, sendSize)
+		// the copy is aborted once the client is gone
+		io.CopyN(ctx.W, contextReader{Reader: sendContent, ctx: ctx.Context()}, sendSize)
 	}
 }
 
@@ -738,6 +1182,10 @@ func (c *FileServerManager) serveFile(ctx *Context, fs FileSystem, name string,
 	// }
 	f, err := c.OpenFS(ctx, name, fs)
 	if err != nil {
+		if ctx.Context().Err() != nil {
+			// the client is gone
+			return
+		}
 		msg, code := toHTTPError(err)
 		global.errorFunc(ctx, msg, code)
 		return
@@ -794,6 +1242,10 @@ func (c *FileServerManager) serveFile(ctx *Context, fs FileSystem, name string,
 
 	// Still a directory? (we didn't find an index.html file)
 	if d.IsDir() {
+		if lfs, ok := fs.(*listingFS); ok {
+			lfs.listDir(ctx, f, name)
+			return
+		}
 		if checkLastModified(ctx, d.ModTime()) {
 			return
 		}
@@ -803,18 +1255,32 @@ func (c *FileServerManager) serveFile(ctx *Context, fs FileSystem, name string,
 	}
 
 	// serveContent will check modification time
+	if ctx.W.Header().Get("Etag") == "" {
+		switch ff := f.(type) {
+		case *CacheFile:
+			if ff.etag != "" {
+				ctx.W.Header().Set("Etag", ff.etag)
+			}
+		case *precompressedFile:
+			ctx.W.Header().Set("Etag", ff.etag)
+		}
+	}
 	sizeFunc := func() (int64, error) { return d.Size(), nil }
-	c.serveContent(ctx, d.Name(), d.ModTime(), sizeFunc, f)
+	_, exactSize := f.(*precompressedFile)
+	c.serveContent(ctx, d.Name(), d.ModTime(), sizeFunc, f, exactSize)
 }
 
-func fileCompress(file http.File, ctx *Context) ([]byte, string, error) {
+func fileCompress(file http.File, ctx *Context, encoding string, level int) ([]byte, string, error) {
 	var buf = &bytes.Buffer{}
-	var encoding string
-	if b, n, _ := acceptencoder.WriteFile(acceptencoder.ParseEncoding(ctx.R), buf, file); b {
-		ctx.W.Header().Set("Content-Encoding", n)
-		encoding = n
+	b, n, err := acceptencoder.WriteFileLevel(encoding, buf, file, level)
+	if err != nil {
+		return nil, "", err
 	}
-	return buf.Bytes(), encoding, nil
+	if !b {
+		return buf.Bytes(), "", nil
+	}
+	ctx.W.Header().Set("Content-Encoding", n)
+	return buf.Bytes(), n, nil
 }
 
 func fileCompress2(f http.File, encoding string) ([]byte, string, error) {
@@ -877,7 +1343,7 @@ func (c *FileServerManager) ServeFile(ctx *Context, name string, nocompressAndNo
 		return
 	}
 	dir, file := filepath.Split(name)
-	c.serveFile(ctx, DirFS(dir, nocompressAndNocache...), file, false)
+	c.serveFile(ctx, FS(&dirFS{dir: dir, manager: c}, nocompressAndNocache...), file, false)
 }
 
 func containsDotDot(v string) bool {
@@ -921,7 +1387,9 @@ func (f *fileHandler) Serve(ctx *Context) error {
 		upath = "/" + upath
 		r.URL.Path = upath
 	}
-	f.fileServerManager.serveFile(ctx, f.root, path.Clean(upath), true)
+	name := path.Clean(upath)
+	f.fileServerManager.setAssetCacheControl(ctx, f.root, name)
+	f.fileServerManager.serveFile(ctx, f.root, name, true)
 	return nil
 }
 
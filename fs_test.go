@@ -0,0 +1,526 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFileCacheInvalidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faygo_fs_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "app.js")
+	if err = ioutil.WriteFile(name, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := newFileServerManager(1<<20, 0, "memory", "lru", true, true)
+	read := func() string {
+		f, err := m.Open(name, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		b, _ := ioutil.ReadAll(f)
+		return string(b)
+	}
+	if got := read(); got != "v1" {
+		t.Fatalf("got %q, want v1", got)
+	}
+	if _, err = m.Open(name, "gzip", false); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(name, []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(); got != "v1" {
+		t.Fatalf("cached: got %q, want v1", got)
+	}
+
+	if n := m.Invalidate(name); n != 2 {
+		t.Fatalf("invalidated %d entries, want the plain and gzip variants", n)
+	}
+	// invalidation is safe under concurrent reads
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if f, err := m.Open(name, "", false); err == nil {
+					ioutil.ReadAll(f)
+					f.Close()
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		m.Invalidate(name)
+	}
+	wg.Wait()
+	if got := read(); got != "v2" {
+		t.Fatalf("invalidated: got %q, want v2", got)
+	}
+
+	if err = ioutil.WriteFile(name, []byte("v3"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m.InvalidateAll()
+	if got := read(); got != "v3" {
+		t.Fatalf("invalidated all: got %q, want v3", got)
+	}
+	if n := m.Stats().Entries; n != 1 {
+		t.Fatalf("entries: got %d, want 1", n)
+	}
+}
+
+func TestFileCacheStats(t *testing.T) {
+	m := newFileServerManager(1200, 0, "lru", "", true, false)
+	content := strings.Repeat("x", 400)
+	m.SetFileSystem(http.FS(fstest.MapFS{
+		"a.js": {Data: []byte(content)},
+		"b.js": {Data: []byte(content)},
+		"c.js": {Data: []byte(content)},
+	}))
+	open := func(name string) {
+		f, err := m.Open(name, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	open("a.js")
+	open("a.js")
+	open("b.js")
+	if stats := m.Stats(); stats.Hits != 1 || stats.Misses != 2 || stats.Entries != 2 || stats.Evictions != 0 || stats.HitRate != 1.0/3 {
+		t.Fatalf("got %+v", stats)
+	}
+	// the third file evicts the least recently used one
+	open("c.js")
+	open("a.js")
+	if stats := m.Stats(); stats.Hits != 1 || stats.Misses != 4 || stats.Entries != 2 || stats.Evictions != 2 {
+		t.Fatalf("got %+v", stats)
+	}
+	if stats := newFileServerManager(1200, 0, "lru", "", false, false).Stats(); stats != (CacheStats{}) {
+		t.Fatalf("disabled: got %+v", stats)
+	}
+}
+
+func TestFileSystem(t *testing.T) {
+	content := strings.Repeat("body { color: red; }\n", 100)
+	m := newFileServerManager(4<<20, 0, "memory", "lru", true, true)
+	m.SetFileSystem(http.FS(fstest.MapFS{
+		"assets/app.css": {Data: []byte(content), ModTime: time.Now()},
+	}))
+	frame := newTestFrame(t, "file_system_test")
+	frame.GET("/app.css", HandlerFunc(func(ctx *Context) error {
+		m.ServeFile(ctx, "assets/app.css")
+		return nil
+	}))
+	frame.build()
+
+	for i := 0; i < 2; i++ {
+		rec := serveTest(frame, httptest.NewRequest("GET", "/app.css", nil))
+		if rec.Code != 200 || rec.Body.String() != content {
+			t.Fatalf("round %d: got %d %q", i, rec.Code, rec.Body.String())
+		}
+	}
+	if stats := m.Stats(); stats.Hits != 1 {
+		t.Fatalf("hits: got %d, want 1", stats.Hits)
+	}
+
+	req := httptest.NewRequest("GET", "/app.css", nil)
+	req.Header.Set("Range", "bytes=0-3")
+	rec := serveTest(frame, req)
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != content[:4] {
+		t.Fatalf("range: got %d %q", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/app.css", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = serveTest(frame, req)
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("gzip: Content-Encoding is not set")
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(zr); string(b) != content {
+		t.Fatalf("gzip: got %q", b)
+	}
+
+	if _, err = m.AssetHash("assets/app.css"); err != nil {
+		t.Fatal(err)
+	}
+	if rec = serveTest(frame, httptest.NewRequest("GET", "/app.css", nil)); rec.Code != 200 {
+		t.Fatalf("got %d", rec.Code)
+	}
+	if _, err = m.Open("assets/missing.css", "", false); !os.IsNotExist(err) {
+		t.Fatalf("missing: got %v", err)
+	}
+}
+
+func TestOpenFileScope(t *testing.T) {
+	m := newFileServerManager(4<<20, 0, "memory", "lru", true, false)
+	underlying := fstest.MapFS{"view/a.html": {Data: []byte("underlying")}}
+	m.SetFileSystem(http.FS(underlying))
+	fsA := http.FS(fstest.MapFS{"view/a.html": {Data: []byte("a")}})
+	fsB := http.FS(fstest.MapFS{"view/a.html": {Data: []byte("b")}})
+	read := func(fsys http.FileSystem) string {
+		f, err := m.OpenFile(fsys, "view/a.html", "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		b, _ := ioutil.ReadAll(f)
+		return string(b)
+	}
+	for i := 0; i < 2; i++ {
+		if a, b, u := read(fsA), read(fsB), read(nil); a != "a" || b != "b" || u != "underlying" {
+			t.Fatalf("round %d: got %q %q %q", i, a, b, u)
+		}
+	}
+	if stats := m.Stats(); stats.Entries != 3 || stats.Hits != 3 {
+		t.Fatalf("got %d entries and %d hits, want 3 and 3", stats.Entries, stats.Hits)
+	}
+	// the same file system is identified by its value, and the underlying one is not scoped
+	if scope, _ := m.fsScope(http.FS(underlying)); scope != "" {
+		t.Fatalf("underlying: got scope %q", scope)
+	}
+	scopeA, _ := m.fsScope(fsA)
+	if again, _ := m.fsScope(fsA); scopeA == "" || again != scopeA {
+		t.Fatalf("the scope of the same file system: got %q and %q", scopeA, again)
+	}
+	// the files of all the file systems are invalidated by the name
+	if n := m.Invalidate("view/a.html"); n != 3 {
+		t.Fatalf("Invalidate: got %d, want 3", n)
+	}
+}
+
+// cancelingWriter cancels the request after the first write, like the client aborting the download.
+type cancelingWriter struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (w *cancelingWriter) Write(b []byte) (int, error) {
+	w.cancel()
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestServeFileCanceled(t *testing.T) {
+	small := strings.Repeat("body { color: red; }\n", 1000)
+	big := bytes.Repeat([]byte{1, 2, 3, 4}, 1<<18)
+	m := newFileServerManager(64<<20, 0, "memory", "lru", true, true)
+	m.SetFileSystem(http.FS(fstest.MapFS{
+		"app.css": {Data: []byte(small), ModTime: time.Now()},
+		"big.bin": {Data: big, ModTime: time.Now()},
+	}))
+	frame := newTestFrame(t, "serve_file_canceled_test")
+	frame.GET("/*name", HandlerFunc(func(ctx *Context) error {
+		m.ServeFile(ctx, ctx.PathParam("name"))
+		return nil
+	}))
+	frame.build()
+
+	// the large file is not cached, and the copy stops once the client is gone
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &cancelingWriter{ResponseRecorder: httptest.NewRecorder(), cancel: cancel}
+	frame.ServeHTTP(w, httptest.NewRequest("GET", "/big.bin", nil).WithContext(ctx))
+	if n := w.Body.Len(); n == 0 || n >= len(big) {
+		t.Fatalf("aborted download: got %d bytes of %d", n, len(big))
+	}
+
+	// the content read by the canceled request is not cached
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("GET", "/app.css", nil).WithContext(ctx)
+	req.Header.Set("Accept-Encoding", "gzip")
+	frame.ServeHTTP(httptest.NewRecorder(), req)
+	frame.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/app.css", nil).WithContext(ctx))
+	if n := m.Stats().Entries; n != 0 {
+		t.Fatalf("entries: got %d, want 0", n)
+	}
+	if rec := serveTest(frame, httptest.NewRequest("GET", "/app.css", nil)); rec.Code != 200 || rec.Body.String() != small {
+		t.Fatalf("got %d %d bytes", rec.Code, rec.Body.Len())
+	}
+	if n := m.Stats().Entries; n != 1 {
+		t.Fatalf("entries: got %d, want 1", n)
+	}
+}
+
+func TestPrecompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faygo_precompressed_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	content := strings.Repeat("console.log('faygo');\n", 100)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(content))
+	zw.Close()
+	files := map[string][]byte{
+		"app.js":     []byte(content),
+		"app.js.gz":  buf.Bytes(),
+		"app.js.br":  []byte("brotli"),
+		"app.css":    []byte(content),
+		"app.css.gz": []byte("stale"),
+	}
+	for name, b := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the files are written in random order, so that their modification times are set explicitly
+	old, now := time.Now().Add(-time.Hour), time.Now().Add(-time.Minute)
+	for name := range files {
+		mtime := now
+		if name == "app.css.gz" {
+			mtime = old
+		}
+		if err = os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := newFileServerManager(4<<20, 0, "memory", "lru", true, true)
+	frame := newTestFrame(t, "precompressed_test")
+	frame.GET("/*file", HandlerFunc(func(ctx *Context) error {
+		m.ServeFile(ctx, filepath.Join(dir, ctx.PathParam("file")))
+		return nil
+	}))
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set(HeaderAcceptEncoding, acceptEncoding)
+		}
+		return serveTest(frame, req)
+	}
+
+	cases := []struct {
+		acceptEncoding, encoding string
+		body                     []byte
+	}{
+		{"gzip, br", "br", files["app.js.br"]},
+		{"gzip, br;q=0.5", "gzip", files["app.js.gz"]},
+		{"deflate", "deflate", nil},
+		{"", "", files["app.js"]},
+	}
+	etags := map[string]string{}
+	for i, c := range cases {
+		rec := get("/app.js", c.acceptEncoding)
+		if rec.Code != 200 || rec.Header().Get(HeaderContentEncoding) != c.encoding {
+			t.Fatalf("case %d: got %d, encoding %q, want %q", i, rec.Code, rec.Header().Get(HeaderContentEncoding), c.encoding)
+		}
+		if got := rec.Header().Get(HeaderContentType); got != mime.TypeByExtension(".js") {
+			t.Fatalf("case %d: Content-Type: got %q", i, got)
+		}
+		if c.body == nil {
+			continue
+		}
+		etag := rec.Header().Get(HeaderETag)
+		if prev, ok := etags[etag]; ok || etag == "" {
+			t.Fatalf("case %d: ETag %q of %q is the same as the one of %q", i, etag, c.encoding, prev)
+		}
+		etags[etag] = c.encoding
+		if !bytes.Equal(rec.Body.Bytes(), c.body) {
+			t.Fatalf("case %d: got body %q", i, rec.Body.String())
+		}
+		if got := rec.Header().Get(HeaderContentLength); got != strconv.Itoa(len(c.body)) {
+			t.Fatalf("case %d: Content-Length: got %q, want %d", i, got, len(c.body))
+		}
+	}
+	if etag := get("/app.js", "br").Header().Get(HeaderETag); etags[etag] != "br" {
+		t.Fatalf("br: ETag %s is not stable", etag)
+	}
+	req := httptest.NewRequest("GET", "/app.js", nil)
+	req.Header.Set(HeaderAcceptEncoding, "gzip")
+	for etag, encoding := range etags {
+		if encoding == "gzip" {
+			req.Header.Set(HeaderIfNoneMatch, etag)
+		}
+	}
+	if rec := serveTest(frame, req); rec.Code != 304 {
+		t.Fatalf("gzip If-None-Match: got %d", rec.Code)
+	}
+	scope, _ := m.fsScope(&dirFS{dir: dir + string(filepath.Separator), manager: m})
+	m.precompressedLock.RLock()
+	variants := m.precompressed[scopedName(scope, "app.js")]
+	m.precompressedLock.RUnlock()
+	if fmt.Sprint(variants.encodings) != "[br gzip]" {
+		t.Fatalf("recorded variants: got %v, want [br gzip]", variants.encodings)
+	}
+
+	// the same name in another directory is recorded apart
+	other, err := ioutil.TempDir("", "faygo_precompressed_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(other)
+	if err = ioutil.WriteFile(filepath.Join(other, "app.js"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	frame.GET("/other/*file", HandlerFunc(func(ctx *Context) error {
+		m.ServeFile(ctx, filepath.Join(other, ctx.PathParam("file")))
+		return nil
+	}))
+	if rec := get("/other/app.js", "br"); rec.Header().Get(HeaderContentEncoding) == "br" || rec.Body.String() == string(files["app.js.br"]) {
+		t.Fatalf("other: got the precompressed sibling of another directory")
+	}
+	m.Invalidate("app.js")
+	m.precompressedLock.RLock()
+	n := len(m.precompressed)
+	m.precompressedLock.RUnlock()
+	if n != 0 {
+		t.Fatalf("Invalidate: %d precompressed records remain", n)
+	}
+
+	// the stale sibling is ignored, and the file is compressed dynamically
+	rec := get("/app.css", "gzip")
+	if rec.Header().Get(HeaderContentEncoding) != "gzip" {
+		t.Fatal("stale: Content-Encoding is not set")
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(zr); string(b) != content {
+		t.Fatalf("stale: got %q", b)
+	}
+}
+
+func TestFileServerManagerPut(t *testing.T) {
+	m := NewFileServerManager(1, 0, true)
+	if _, _, err := m.OpenBytes("thumbs/missing.css"); !os.IsNotExist(err) {
+		t.Fatalf("missing: got %v", err)
+	}
+	// the file system out of the cache is never read
+	if _, _, err := m.OpenBytes("fs_test.go"); !os.IsNotExist(err) {
+		t.Fatalf("file system: got %v", err)
+	}
+	if err := m.Put("thumbs/big.css", make([]byte, 2048), time.Now()); err != ErrFileTooLarge {
+		t.Fatalf("too large: got %v", err)
+	}
+	modtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	content := []byte(strings.Repeat("body{color:red}", 20))
+	if err := m.Put("thumbs/a.css", content, modtime); err != nil {
+		t.Fatal(err)
+	}
+	b, info, err := m.OpenBytes("thumbs/a.css")
+	if err != nil || !bytes.Equal(b, content) || info.Name() != "a.css" || !info.ModTime().Equal(modtime) {
+		t.Fatalf("OpenBytes: got %q %v %v", b, info, err)
+	}
+
+	frame := newTestFrame(t, "fs_put_test")
+	frame.GET("/thumbs/:name", HandlerFunc(func(ctx *Context) error {
+		m.ServeCached(ctx, "thumbs/"+ctx.PathParam("name"))
+		return nil
+	}))
+	get := func(name, acceptEncoding, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/thumbs/"+name, nil)
+		if acceptEncoding != "" {
+			req.Header.Set(HeaderAcceptEncoding, acceptEncoding)
+		}
+		if etag != "" {
+			req.Header.Set(HeaderIfNoneMatch, etag)
+		}
+		return serveTest(frame, req)
+	}
+	rec := get("a.css", "gzip", "")
+	if rec.Code != 200 || rec.Header().Get(HeaderContentEncoding) != "gzip" || rec.Header().Get(HeaderETag) == "" ||
+		rec.Header().Get("Last-Modified") != modtime.Format(http.TimeFormat) {
+		t.Fatalf("gzip: got %d %v", rec.Code, rec.Header())
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(zr); !bytes.Equal(b, content) {
+		t.Fatalf("gzip: got %q", b)
+	}
+	if rec := get("a.css", "gzip", rec.Header().Get(HeaderETag)); rec.Code != 304 {
+		t.Fatalf("If-None-Match: got %d", rec.Code)
+	}
+	if rec := get("missing.css", "", ""); rec.Code != 404 {
+		t.Fatalf("missing: got %d", rec.Code)
+	}
+	// no Last-Modified without the modification time
+	if err := m.Put("thumbs/b.css", content, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if rec := get("b.css", "", ""); rec.Code != 200 || rec.Header().Get("Last-Modified") != "" {
+		t.Fatalf("zero modtime: got %d %v", rec.Code, rec.Header())
+	}
+
+	// replaced with its compressed variants
+	content2 := []byte(strings.Repeat("body{color:blue}", 20))
+	if err := m.Put("thumbs/a.css", content2, modtime.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	rec = get("a.css", "gzip", "")
+	if zr, err = gzip.NewReader(rec.Body); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(zr); !bytes.Equal(b, content2) {
+		t.Fatalf("replaced: got %q", b)
+	}
+
+	// concurrent Put and Open
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				name := fmt.Sprintf("thumbs/%d.css", j%10)
+				if i%2 == 0 {
+					if err := m.Put(name, []byte(name), modtime); err != nil {
+						t.Error(err)
+						return
+					}
+					continue
+				}
+				if b, _, err := m.OpenBytes(name); err == nil && string(b) != name {
+					t.Errorf("%s: got %q", name, b)
+					return
+				}
+				if rec := get(strconv.Itoa(j%10)+".css", "gzip", ""); rec.Code != 200 && rec.Code != 404 {
+					t.Errorf("%s: got %d", name, rec.Code)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -27,11 +27,17 @@ import (
 func graceSignal() {
 	// subscribe to SIGINT signals
 	ch := make(chan os.Signal)
-	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR2)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR2, syscall.SIGHUP)
 	defer func() {
 		os.Exit(0)
 	}()
 	sig := <-ch
+	for sig == syscall.SIGHUP {
+		if err := RotateLogsNow(); err != nil {
+			Warningf("[rotate-logs] %s", err.Error())
+		}
+		sig = <-ch
+	}
 	signal.Stop(ch)
 	switch sig {
 	case syscall.SIGINT, syscall.SIGTERM:
@@ -44,9 +50,10 @@ func graceSignal() {
 // Reboot all the frame services gracefully.
 // Notes: Windows system are not supported!
 func Reboot(timeout ...time.Duration) {
+	// CloseLog gets the frames, so it is called after unlocking
+	defer CloseLog()
 	global.framesLock.Lock()
 	defer global.framesLock.Unlock()
-	defer CloseLog()
 	Print("\x1b[46m[SYS]\x1b[0m rebooting services...")
 
 	var (
@@ -75,10 +82,16 @@ func Reboot(timeout ...time.Duration) {
 			if err != nil {
 				Errorf("[reboot-startNewProcess] %s", err.Error())
 				reboot = false
+			} else {
+				for _, frame := range global.frames {
+					for _, srv := range frame.servers {
+						srv.keepUnixSocket()
+					}
+				}
 			}
 
 			// shut down
-			graceful = shutdown(ctxTimeout, "reboot") && graceful
+			graceful = shutdown(ctxTimeout, global.shutdownTimeout, "reboot") && graceful
 			if !reboot {
 				if graceful {
 					Fatalf("services reboot failed, but shut down gracefully!")
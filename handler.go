@@ -16,6 +16,7 @@ package faygo
 
 import (
 	"errors"
+	"net/http"
 	"reflect"
 	"sort"
 
@@ -93,9 +94,43 @@ type (
 	// The error message should be plain text.
 	ErrorFunc func(ctx *Context, errStr string, status int)
 	// BinderrorFunc is called when binding or validation apiHandler parameters are wrong.
-	BinderrorFunc func(ctx *Context, err error)
+	// All the failures of the request are reported together.
+	BinderrorFunc func(ctx *Context, errs BindErrors)
+	// BindError is the failure of binding or validating a request param.
+	BindError = apiware.BindError
+	// BindErrors is the collection of all the binding failures of a request.
+	BindErrors = apiware.BindErrors
+	// TypeConverter converts a request param string to a value of the registered type.
+	TypeConverter = apiware.TypeConverter
+	// UploadedFile is the uploaded file bound to the `formData` param of the type
+	// `*UploadedFile` or `[]*UploadedFile`, with the content type sniffed from the content.
+	UploadedFile = apiware.UploadedFile
 )
 
+// RegisterTypeConverter registers the converter of the type for binding request params,
+// which takes precedence over the built-in conversions of time.Time, time.Duration, net.IP,
+// the 16-byte UUID arrays and the encoding.TextUnmarshaler types.
+// It must be called before the handlers are registered, such as in the init function.
+func RegisterTypeConverter(t reflect.Type, fn TypeConverter) {
+	apiware.RegisterTypeConverter(t, fn)
+}
+
+// LegacyBinderrorFunc adapts the old style binding failure handler, which receives an error.
+func LegacyBinderrorFunc(fn func(ctx *Context, err error)) BinderrorFunc {
+	return func(ctx *Context, errs BindErrors) {
+		fn(ctx, errs)
+	}
+}
+
+// JSONBinderrorFunc is an alternative to the default BinderrorFunc, which replies the failures in JSON, e.g.
+//
+//	{"errors":[{"field":"age","in":"query","rule":"type","message":"must be an integer"}]}
+//
+// Usage: faygo.SetBinderrorFunc(faygo.JSONBinderrorFunc)
+func JSONBinderrorFunc(ctx *Context, errs BindErrors) {
+	ctx.JSON(http.StatusBadRequest, map[string]BindErrors{"errors": errs})
+}
+
 // Serve implements the Handler, is like ServeHTTP but for Faygo.
 func (h HandlerFunc) Serve(ctx *Context) error {
 	return h(ctx)
@@ -117,7 +152,8 @@ func ToAPIHandler(handler Handler, noDefaultParams bool) (*apiHandler, error) {
 
 	var structPointer = v.Addr().Interface()
 	var bodydecoder = global.bodydecoder
-	if h, ok := structPointer.(HandlerWithBody); ok {
+	h, hasDecoder := structPointer.(HandlerWithBody)
+	if hasDecoder {
 		bodydecoder = h.Decode
 	}
 
@@ -125,7 +161,18 @@ func ToAPIHandler(handler Handler, noDefaultParams bool) (*apiHandler, error) {
 	if err != nil {
 		return nil, err
 	}
-	if paramsAPI.Number() == 0 {
+	if !hasDecoder {
+		setProtobufBodydecoders(paramsAPI)
+	}
+	_, isStreamer := structPointer.(BodyStreamer)
+	if isStreamer {
+		for _, param := range paramsAPI.Params() {
+			if param.In() == "body" {
+				return nil, ErrBodyStreamerWithBody
+			}
+		}
+	}
+	if paramsAPI.Number() == 0 && !isStreamer {
 		return nil, ErrNoParamHandler
 	}
 
@@ -156,14 +203,24 @@ func IsHandlerWithoutPath(handler Handler, noDefaultParams bool) bool {
 // Serve implements the APIHandler.
 // creates a new `*apiHandler`;
 // binds the request path params to `apiHandler.handler`;
+// streams the request body if it is a BodyStreamer;
 // calls Handler.Serve() method.
 func (h *apiHandler) Serve(ctx *Context) error {
 	obj, err := h.paramsAPI.BindNew(ctx.R, ctx.pathParams)
 	if err != nil {
-		global.binderrorFunc(ctx, err)
+		HandleBinderror(ctx, err)
 		ctx.Stop()
 		return nil
 	}
+	ctx.bound, ctx.boundAPI = obj, h.paramsAPI
+	if streamer, ok := obj.(BodyStreamer); ok {
+		if err = streamer.StreamBody(ctx, newStreamDecode(ctx.R.Body)); err != nil {
+			return streamBodyError(ctx, err)
+		}
+		if ctx.Stopped() {
+			return nil
+		}
+	}
 	return obj.(Handler).Serve(ctx)
 }
 
@@ -0,0 +1,631 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/faygo/apiware"
+)
+
+type bindErrorsAPI struct {
+	Age  int    `param:"<in:query> <range:0:150>"`
+	Name string `param:"<in:query> <required> <err:the name is required>"`
+	Tags []int  `param:"<in:query>"`
+}
+
+func (b *bindErrorsAPI) Serve(ctx *Context) error {
+	return ctx.String(200, "ok")
+}
+
+func TestBindErrors(t *testing.T) {
+	frame := newTestFrame(t, "bind_errors_test")
+	frame.GET("/user", new(bindErrorsAPI))
+	defer SetBinderrorFunc(nil)
+
+	SetBinderrorFunc(JSONBinderrorFunc)
+	rec := serveTest(frame, httptest.NewRequest("GET", "/user?age=abc&tags=1&tags=x", nil))
+	if rec.Code != 400 {
+		t.Fatalf("status: got %d, want 400", rec.Code)
+	}
+	var body struct {
+		Errors []map[string]string `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]string{
+		{"field": "age", "in": "query", "rule": "type", "message": "must be an integer"},
+		{"field": "name", "in": "query", "rule": "required", "message": "the name is required"},
+		{"field": "tags", "in": "query", "rule": "type", "message": "must be an integer"},
+	}
+	if len(body.Errors) != len(want) {
+		t.Fatalf("errors: got %v, want %v", body.Errors, want)
+	}
+	for i, e := range want {
+		for k, v := range e {
+			if body.Errors[i][k] != v {
+				t.Fatalf("errors[%d].%s: got %q, want %q", i, k, body.Errors[i][k], v)
+			}
+		}
+	}
+	if strings.Contains(rec.Body.String(), "abc") {
+		t.Fatalf("the raw value is exposed: %s", rec.Body.String())
+	}
+
+	var got error
+	SetBinderrorFunc(LegacyBinderrorFunc(func(ctx *Context, err error) {
+		got = err
+		ctx.String(422, "%v", err)
+	}))
+	rec = serveTest(frame, httptest.NewRequest("GET", "/user?age=200&name=a", nil))
+	errs, ok := got.(BindErrors)
+	if rec.Code != 422 || !ok || len(errs) != 1 || errs[0].Rule != "range" || errs[0].Value != "200" {
+		t.Fatalf("legacy: got %d %#v", rec.Code, got)
+	}
+
+	SetBinderrorFunc(nil)
+	rec = serveTest(frame, httptest.NewRequest("GET", "/user?age=1&name=a", nil))
+	if rec.Code != 200 {
+		t.Fatalf("status: got %d, want 200", rec.Code)
+	}
+}
+
+type bindIntoParams struct {
+	ID   int    `param:"<in:path> <range:1:100>"`
+	Name string `param:"<in:query> <required>"`
+	Note string `param:"<in:body>"`
+}
+
+func TestBindInto(t *testing.T) {
+	frame := newTestFrame(t, "bind_into_test")
+	frame.config.multipartMaxMemory = 2 * MB
+	var bound bindIntoParams
+	frame.POST("/user/:id", HandlerFunc(func(ctx *Context) error {
+		bound = bindIntoParams{}
+		if err := ctx.BindInto(&bound); err != nil {
+			errs, ok := err.(BindErrors)
+			if !ok {
+				return ctx.String(500, "%v", err)
+			}
+			return ctx.String(422, "%d %s %s", len(errs), errs[0].Field, errs[0].Rule)
+		}
+		return ctx.String(200, "ok")
+	}))
+
+	rec := serveTest(frame, httptest.NewRequest("POST", "/user/7?name=a", strings.NewReader(`"hello"`)))
+	if rec.Code != 200 || bound.ID != 7 || bound.Name != "a" || bound.Note != "hello" {
+		t.Fatalf("got %d %q %+v", rec.Code, rec.Body.String(), bound)
+	}
+	rec = serveTest(frame, httptest.NewRequest("POST", "/user/200", strings.NewReader(`"hello"`)))
+	if rec.Code != 422 || rec.Body.String() != "2 id range" {
+		t.Fatalf("invalid: got %d %q", rec.Code, rec.Body.String())
+	}
+	// the params API is cached by the frame, out of the schema of the API handlers
+	if _, err := apiware.GetParamsAPI(reflect.TypeOf(&bound).String()); err == nil {
+		t.Fatal("the params API of BindInto is registered to the schema")
+	}
+	paramsAPI, ok := frame.bindingAPIs.Load(reflect.TypeOf(&bound))
+	if !ok || paramsAPI.(*apiware.ParamsAPI).MaxMemory() != 2*MB {
+		t.Fatalf("cached params API: got %v", paramsAPI)
+	}
+
+	ctx := &Context{R: httptest.NewRequest("GET", "/", nil)}
+	if err := ctx.BindInto(bound); err == nil {
+		t.Fatal("expect an error for the non-pointer")
+	}
+}
+
+type pagination struct {
+	Page    int `param:"<in:query>"`
+	PerPage int `param:"<in:query> <range:1:100>"`
+}
+
+type userFilter struct {
+	Name string   `param:"<in:query>"`
+	Tags []string `param:"<in:query>"`
+}
+
+type userProfile struct {
+	Email string `json:"email"`
+}
+
+type bindNestedAPI struct {
+	pagination
+	Filter userFilter
+	Patch  struct {
+		Profile userProfile `param:"<in:body> <name:profile>"`
+	}
+	Token string `param:"<in:header> <name:X-Token>"`
+}
+
+var boundNested bindNestedAPI
+
+func (b *bindNestedAPI) Serve(ctx *Context) error {
+	boundNested = *b
+	return ctx.String(200, "ok")
+}
+
+type conflictPagination struct {
+	Page int `param:"<in:query> <name:page>"`
+}
+
+type bindConflictAPI struct {
+	pagination
+	conflictPagination
+}
+
+func (b *bindConflictAPI) Serve(ctx *Context) error {
+	return nil
+}
+
+func TestBindNested(t *testing.T) {
+	frame := newTestFrame(t, "bind_nested_test")
+	frame.PATCH("/users", new(bindNestedAPI))
+
+	req := httptest.NewRequest("PATCH", "/users?page=2&per_page=20&filter.name=x&filter.tags=a&filter.tags=b", strings.NewReader(`{"patch":{"email":"a@b.c"}}`))
+	req.Header.Set("X-Token", "t")
+	rec := serveTest(frame, req)
+	if rec.Code != 200 || boundNested.Page != 2 || boundNested.PerPage != 20 ||
+		boundNested.Filter.Name != "x" || !reflect.DeepEqual(boundNested.Filter.Tags, []string{"a", "b"}) ||
+		boundNested.Patch.Profile.Email != "a@b.c" || boundNested.Token != "t" {
+		t.Fatalf("got %d %q %+v", rec.Code, rec.Body.String(), boundNested)
+	}
+
+	var errs BindErrors
+	SetBinderrorFunc(func(ctx *Context, e BindErrors) {
+		errs = e
+		ctx.String(400, "")
+	})
+	defer SetBinderrorFunc(nil)
+	rec = serveTest(frame, httptest.NewRequest("PATCH", "/users?per_page=200&name=x", strings.NewReader(`{"patch":"x"}`)))
+	if rec.Code != 400 || len(errs) != 2 || errs[0].Field != "per_page" || errs[1].Field != "patch.profile" || errs[1].Rule != "decode" {
+		t.Fatalf("invalid: got %d %#v", rec.Code, errs)
+	}
+
+	_, err := ToAPIHandler(new(bindConflictAPI), false)
+	if err == nil || !strings.Contains(err.Error(), "pagination.Page, conflictPagination.Page") {
+		t.Fatalf("conflict: got %v", err)
+	}
+}
+
+type bindUploadAPI struct {
+	Title  string                  `param:"<in:formData> <required>"`
+	Count  int                     `param:"<in:formData> <range:1:10>"`
+	Avatar *multipart.FileHeader   `param:"<in:formData> <required> <maxsize:1KB> <mime:image/png,image/jpeg>"`
+	Photos []*multipart.FileHeader `param:"<in:formData> <mime:image/*>"`
+}
+
+var boundUpload bindUploadAPI
+
+func (b *bindUploadAPI) Serve(ctx *Context) error {
+	boundUpload = *b
+	return ctx.String(200, "ok")
+}
+
+func TestBindUpload(t *testing.T) {
+	frame := newTestFrame(t, "bind_upload_test")
+	frame.POST("/upload", new(bindUploadAPI))
+	defer SetBinderrorFunc(nil)
+	SetBinderrorFunc(JSONBinderrorFunc)
+
+	newRequest := func(avatarType string, avatarSize int, photoType string) *http.Request {
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		w.WriteField("title", "hello")
+		w.WriteField("count", "3")
+		for _, f := range []struct {
+			name, filename, contentType string
+			size                        int
+		}{{"avatar", "a.png", avatarType, avatarSize}, {"photos", "b.png", photoType, 10}} {
+			h := textproto.MIMEHeader{}
+			h.Set("Content-Disposition", `form-data; name="`+f.name+`"; filename="`+f.filename+`"`)
+			h.Set("Content-Type", f.contentType)
+			part, _ := w.CreatePart(h)
+			part.Write(bytes.Repeat([]byte("x"), f.size))
+		}
+		w.Close()
+		req := httptest.NewRequest("POST", "/upload", &body)
+		req.Header.Set(HeaderContentType, w.FormDataContentType())
+		return req
+	}
+
+	rec := serveTest(frame, newRequest("image/png", 100, "image/gif"))
+	if rec.Code != 200 {
+		t.Fatalf("status: got %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	if boundUpload.Title != "hello" || boundUpload.Count != 3 || boundUpload.Avatar == nil ||
+		boundUpload.Avatar.Size != 100 || len(boundUpload.Photos) != 1 {
+		t.Fatalf("bound: %+v", boundUpload)
+	}
+
+	for _, c := range []struct {
+		req  *http.Request
+		rule string
+	}{
+		{newRequest("image/png", 2048, "image/gif"), "maxsize"},
+		{newRequest("text/plain", 100, "image/gif"), "mime"},
+		{newRequest("image/jpeg", 100, "application/pdf"), "mime"},
+	} {
+		rec = serveTest(frame, c.req)
+		var body struct {
+			Errors []map[string]string `json:"errors"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != 400 || len(body.Errors) != 1 || body.Errors[0]["rule"] != c.rule {
+			t.Fatalf("got %d %v, want the rule %q", rec.Code, body.Errors, c.rule)
+		}
+	}
+}
+
+type bindUploadedFileAPI struct {
+	Avatar *UploadedFile   `param:"<in:formData> <required> <maxsize:1KB> <accept:image/png,image/jpeg>"`
+	Docs   []*UploadedFile `param:"<in:formData> <accept:text/plain>"`
+}
+
+var (
+	boundUploadedFile bindUploadedFileAPI
+	uploadSaveDir     string
+	uploadSavedPath   string
+	uploadTempFiles   int
+)
+
+func (b *bindUploadedFileAPI) Serve(ctx *Context) error {
+	boundUploadedFile = *b
+	tmps, _ := filepath.Glob(filepath.Join(os.TempDir(), "multipart-*"))
+	uploadTempFiles = len(tmps)
+	var err error
+	uploadSavedPath, err = b.Avatar.SaveTo(uploadSaveDir, func(f *UploadedFile) string {
+		return "../avatars/1" + filepath.Ext(f.Filename)
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.String(200, "ok")
+}
+
+func TestBindUploadedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faygo_uploaded_file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the uploads are stored in the temporary files of the test directory
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", dir)
+	uploadSaveDir = filepath.Join(dir, "saved")
+
+	frame := newTestFrame(t, "bind_uploaded_file_test")
+	frame.Filter(HandlerFunc(func(ctx *Context) error {
+		return ctx.R.ParseMultipartForm(1)
+	}))
+	frame.POST("/upload", new(bindUploadedFileAPI))
+	defer SetBinderrorFunc(nil)
+	SetBinderrorFunc(JSONBinderrorFunc)
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 100)...)
+	newRequest := func(avatar []byte, docs ...[]byte) *http.Request {
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		// the declared content types are ignored
+		part, _ := w.CreateFormFile("avatar", "me.png")
+		part.Write(avatar)
+		for i, doc := range docs {
+			part, _ = w.CreateFormFile("docs", fmt.Sprintf("doc%d.txt", i))
+			part.Write(doc)
+		}
+		w.Close()
+		req := httptest.NewRequest("POST", "/upload", &body)
+		req.Header.Set(HeaderContentType, w.FormDataContentType())
+		return req
+	}
+
+	rec := serveTest(frame, newRequest(png, []byte("hello"), []byte("world")))
+	if rec.Code != 200 {
+		t.Fatalf("status: got %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	avatar := boundUploadedFile.Avatar
+	if avatar.Filename != "me.png" || avatar.Size != int64(len(png)) || avatar.ContentType != "image/png" ||
+		len(boundUploadedFile.Docs) != 2 || boundUploadedFile.Docs[1].ContentType != "text/plain" {
+		t.Fatalf("bound: %+v, %+v", avatar, boundUploadedFile.Docs)
+	}
+	if uploadTempFiles == 0 {
+		t.Fatal("the uploads should be stored in the temporary files")
+	}
+	// the name returned by the namer is kept inside the directory
+	if uploadSavedPath != filepath.Join(uploadSaveDir, "avatars", "1.png") {
+		t.Fatalf("saved path: got %q", uploadSavedPath)
+	}
+	if b, _ := ioutil.ReadFile(uploadSavedPath); !bytes.Equal(b, png) {
+		t.Fatalf("saved content: got %q", b)
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(dir, "multipart-*")); len(tmps) != 0 {
+		t.Fatalf("the temporary files should be removed: %v", tmps)
+	}
+
+	for _, c := range []struct {
+		req         *http.Request
+		field, rule string
+	}{
+		{newRequest([]byte("plain text")), "avatar", "accept"},
+		{newRequest(append(png, make([]byte, 1024)...)), "avatar", "maxsize"},
+		{newRequest(png, png), "docs", "accept"},
+	} {
+		rec = serveTest(frame, c.req)
+		var body struct {
+			Errors []map[string]string `json:"errors"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != 400 || len(body.Errors) != 1 || body.Errors[0]["field"] != c.field || body.Errors[0]["rule"] != c.rule {
+			t.Fatalf("got %d %v, want the rule %q of %q", rec.Code, body.Errors, c.rule, c.field)
+		}
+	}
+}
+
+type rgb struct{ r, g, b uint8 }
+
+type bindTypesAPI struct {
+	Day     time.Time         `param:"<in:query> <format:2006-01-02>"`
+	At      time.Time         `param:"<in:query>"`
+	Timeout time.Duration     `param:"<in:query>"`
+	IP      net.IP            `param:"<in:query>"`
+	ID      [16]byte          `param:"<in:query>"`
+	Ref     string            `param:"<in:query>" format:"uuid"`
+	Color   rgb               `param:"<in:query>"`
+	Days    []time.Time       `param:"<in:query>" format:"2006-01-02"`
+	Extra   map[string]string `param:"<in:query>"`
+}
+
+var boundTypes bindTypesAPI
+
+func (b *bindTypesAPI) Serve(ctx *Context) error {
+	boundTypes = *b
+	return ctx.String(200, "ok")
+}
+
+func TestBindTypeConverters(t *testing.T) {
+	RegisterTypeConverter(reflect.TypeOf(rgb{}), func(s string) (interface{}, error) {
+		if s != "red" {
+			return nil, errors.New("unknown color " + s)
+		}
+		return rgb{r: 255}, nil
+	})
+	defer RegisterTypeConverter(reflect.TypeOf(rgb{}), nil)
+	frame := newTestFrame(t, "bind_types_test")
+	frame.GET("/", new(bindTypesAPI))
+	defer SetBinderrorFunc(nil)
+	SetBinderrorFunc(JSONBinderrorFunc)
+
+	rec := serveTest(frame, httptest.NewRequest("GET", "/?day=2020-02-03&at=2020-02-03T04:05:06Z&timeout=1m30s"+
+		"&ip=10.0.0.1&id=6ba7b810-9dad-11d1-80b4-00c04fd430c8&ref=6ba7b8109dad11d180b400c04fd430c8"+
+		"&color=red&days=2020-01-01&days=2020-01-02&a=1&b=2&b=3", nil))
+	if rec.Code != 200 {
+		t.Fatalf("status: got %d, body: %s", rec.Code, rec.Body.String())
+	}
+	got := boundTypes
+	if !got.Day.Equal(time.Date(2020, 2, 3, 0, 0, 0, 0, time.UTC)) ||
+		!got.At.Equal(time.Date(2020, 2, 3, 4, 5, 6, 0, time.UTC)) ||
+		got.Timeout != 90*time.Second ||
+		!got.IP.Equal(net.ParseIP("10.0.0.1")) ||
+		got.ID[0] != 0x6b || got.ID[15] != 0xc8 ||
+		got.Color != (rgb{r: 255}) ||
+		len(got.Days) != 2 || got.Days[1].Day() != 2 {
+		t.Fatalf("got %+v", got)
+	}
+	if !reflect.DeepEqual(got.Extra, map[string]string{"a": "1", "b": "2"}) {
+		t.Fatalf("extra: got %v", got.Extra)
+	}
+
+	rec = serveTest(frame, httptest.NewRequest("GET", "/?day=02/03/2020&timeout=x&ip=x&id=x&ref=x&color=blue", nil))
+	var body struct {
+		Errors []map[string]string `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]string{
+		{"field": "day", "message": "must be a time in the format 2006-01-02"},
+		{"field": "timeout", "message": "must be a duration, such as 1h30m"},
+		{"field": "ip", "message": "must be an IP address"},
+		{"field": "id", "message": "must be a UUID"},
+		{"field": "ref", "message": "must be a UUID"},
+		{"field": "color", "message": "is invalid: unknown color blue"},
+	}
+	if len(body.Errors) != len(want) {
+		t.Fatalf("errors: got %v, want %v", body.Errors, want)
+	}
+	for i, e := range want {
+		for k, v := range e {
+			if body.Errors[i][k] != v {
+				t.Fatalf("errors[%d].%s: got %q, want %q", i, k, body.Errors[i][k], v)
+			}
+		}
+	}
+}
+
+type bindClaimsAPI struct {
+	UserID  int64                  `param:"<in:jwt> <name:sub> <required>"`
+	Roles   []string               `param:"<in:jwt>"`
+	Admin   bool                   `param:"<in:jwt>"`
+	Profile map[string]interface{} `param:"<in:jwt>"`
+}
+
+var boundClaims bindClaimsAPI
+
+func (b *bindClaimsAPI) Serve(ctx *Context) error {
+	boundClaims = *b
+	return ctx.String(200, "ok")
+}
+
+func TestBindClaims(t *testing.T) {
+	frame := newTestFrame(t, "bind_claims_test")
+	frame.GET("/", HandlerFunc(func(ctx *Context) error {
+		if ctx.HeaderParam(HeaderAuthorization) != "" {
+			var claims map[string]interface{}
+			json.Unmarshal([]byte(ctx.HeaderParam(HeaderAuthorization)), &claims)
+			ctx.SetClaims(claims)
+		}
+		ctx.Next()
+		return nil
+	}), new(bindClaimsAPI))
+	defer SetBinderrorFunc(nil)
+	SetBinderrorFunc(JSONBinderrorFunc)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(HeaderAuthorization, `{"sub":42,"roles":["a","b"],"admin":true,"profile":{"name":"henry"}}`)
+	rec := serveTest(frame, req)
+	if rec.Code != 200 {
+		t.Fatalf("status: got %d, body: %s", rec.Code, rec.Body.String())
+	}
+	got := boundClaims
+	if got.UserID != 42 || !reflect.DeepEqual(got.Roles, []string{"a", "b"}) || !got.Admin ||
+		got.Profile["name"] != "henry" {
+		t.Fatalf("got %+v", got)
+	}
+
+	rec = serveTest(frame, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), `"field":"sub"`) {
+		t.Fatalf("without claims: got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+type bulkImportAPI struct {
+	Batch string `param:"<in:query> <required>"`
+	count int
+	sum   int
+	heap  uint64 // the heap growth in the middle of the stream
+}
+
+func (b *bulkImportAPI) StreamBody(ctx *Context, decode func(v interface{}) error) error {
+	var base runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&base)
+	for {
+		var record struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		}
+		err := decode(&record)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		b.count++
+		b.sum += record.ID
+		if b.count == 50000 {
+			var m runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&m)
+			if m.HeapAlloc > base.HeapAlloc {
+				b.heap = m.HeapAlloc - base.HeapAlloc
+			}
+		}
+	}
+}
+
+func (b *bulkImportAPI) Serve(ctx *Context) error {
+	return ctx.String(200, fmt.Sprintf("%s %d %d %d", b.Batch, b.count, b.sum, b.heap))
+}
+
+// recordsReader generates a JSON array of n records lazily.
+type recordsReader struct {
+	n, i int
+	buf  []byte
+}
+
+func (r *recordsReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		switch {
+		case r.i > r.n:
+			return 0, io.EOF
+		case r.i == r.n:
+			r.buf = []byte("]")
+		case r.i == 0:
+			r.buf = []byte(`[{"id":0,"name":"record-0"}`)
+		default:
+			r.buf = []byte(fmt.Sprintf(`,{"id":%d,"name":"record-%d"}`, r.i, r.i))
+		}
+		r.i++
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func TestBodyStreamer(t *testing.T) {
+	frame := newTestFrame(t, "body_streamer_test")
+	frame.config.maxRequestBody = 8 * MB
+	frame.POST("/import", new(bulkImportAPI))
+
+	const n = 100000
+	rec := serveTest(frame, httptest.NewRequest("POST", "/import?batch=b1", &recordsReader{n: n}))
+	var (
+		batch      string
+		count, sum int
+		heap       uint64
+	)
+	fmt.Sscan(rec.Body.String(), &batch, &count, &sum, &heap)
+	if rec.Code != 200 || batch != "b1" || count != n || sum != n*(n-1)/2 {
+		t.Fatalf("got %d %q, want b1 %d %d", rec.Code, rec.Body.String(), n, n*(n-1)/2)
+	}
+	// the body is about 3MB, but only the buffer of the decoder is in memory
+	if heap > 512*KB {
+		t.Fatalf("heap grows %d bytes while streaming", heap)
+	}
+
+	// NDJSON
+	rec = serveTest(frame, httptest.NewRequest("POST", "/import?batch=b2", strings.NewReader("{\"id\":1}\n{\"id\":2}\n")))
+	if !strings.HasPrefix(rec.Body.String(), "b2 2 3 ") {
+		t.Fatalf("NDJSON: got %d %q", rec.Code, rec.Body.String())
+	}
+	// the query param is still bound
+	rec = serveTest(frame, httptest.NewRequest("POST", "/import", strings.NewReader("[]")))
+	if rec.Code != 400 {
+		t.Fatalf("without batch: got %d %q", rec.Code, rec.Body.String())
+	}
+	rec = serveTest(frame, httptest.NewRequest("POST", "/import?batch=b3", strings.NewReader(`[{"id":1},{"id":"x"}]`)))
+	if rec.Code != 400 {
+		t.Fatalf("malformed: got %d %q", rec.Code, rec.Body.String())
+	}
+	// the limit applies to the whole body
+	frame.config.maxRequestBody = MB
+	rec = serveTest(frame, httptest.NewRequest("POST", "/import?batch=b4", &recordsReader{n: n}))
+	if rec.Code != 413 {
+		t.Fatalf("too large: got %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultHealthCheckTimeout is the default time-out period for each health check.
+const DefaultHealthCheckTimeout = 3 * time.Second
+
+// HealthCheckFunc checks a dependency, such as pinging the database,
+// it should return before ctx is done.
+type HealthCheckFunc func(ctx context.Context) error
+
+type healthCheck struct {
+	name     string
+	check    HealthCheckFunc
+	critical bool
+}
+
+// Health statuses of the HealthReport
+const (
+	HealthUp       = "up"
+	HealthDegraded = "degraded" // only the non-critical checks fail
+	HealthDown     = "down"
+)
+
+// HealthReport is the result of the health checks.
+type HealthReport struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+// Generic reasons of the failed HealthCheckResult, which are served to the unauthenticated probes
+// in place of the errors, since they may carry the internal details such as the DSN or the stack.
+const (
+	HealthCheckFailed  = "check failed"
+	HealthCheckTimeout = "timeout"
+)
+
+// HealthCheckResult is the result of a health check.
+type HealthCheckResult struct {
+	Status   string `json:"status"` // up or down
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"` // the generic reason, the details are logged
+	Latency  string `json:"latency"`
+}
+
+// RegisterHealthCheck registers a health check of the dependency, such as the database, cache or disk space,
+// which is reported by CheckHealth and ReadinessHandler.
+// A failing check is critical and makes the frame service not ready, unless noncritical is true.
+// The registered check of the same name is replaced.
+//
+//	e.g. frame.RegisterHealthCheck("db", db.PingContext)
+func (frame *Framework) RegisterHealthCheck(name string, check HealthCheckFunc, noncritical ...bool) {
+	if check == nil {
+		return
+	}
+	hc := healthCheck{
+		name:     name,
+		check:    check,
+		critical: len(noncritical) == 0 || !noncritical[0],
+	}
+	frame.lock.Lock()
+	defer frame.lock.Unlock()
+	for i, c := range frame.healthChecks {
+		if c.name == name {
+			frame.healthChecks[i] = hc
+			return
+		}
+	}
+	frame.healthChecks = append(frame.healthChecks, hc)
+}
+
+// SetHealthCheckTimeout sets the time-out period for each health check,
+// if timeout<=0, DefaultHealthCheckTimeout is used.
+func (frame *Framework) SetHealthCheckTimeout(timeout time.Duration) {
+	frame.lock.Lock()
+	frame.healthCheckTimeout = timeout
+	frame.lock.Unlock()
+}
+
+// CheckHealth runs the health checks concurrently, each of them within the time-out period,
+// so that a hung dependency does not hang the caller.
+// The status is down if any critical check fails, degraded if any non-critical check fails, otherwise up.
+func (frame *Framework) CheckHealth(ctx context.Context) HealthReport {
+	frame.lock.RLock()
+	checks := frame.healthChecks
+	timeout := frame.healthCheckTimeout
+	frame.lock.RUnlock()
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+
+	report := HealthReport{Status: HealthUp}
+	if len(checks) == 0 {
+		return report
+	}
+	results := make([]HealthCheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c healthCheck) {
+			defer wg.Done()
+			results[i] = frame.runHealthCheck(ctx, c, timeout)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report.Checks = make(map[string]HealthCheckResult, len(checks))
+	for i, c := range checks {
+		result := results[i]
+		report.Checks[c.name] = result
+		if result.Status == HealthUp {
+			continue
+		}
+		if c.critical {
+			report.Status = HealthDown
+		} else if report.Status == HealthUp {
+			report.Status = HealthDegraded
+		}
+	}
+	return report
+}
+
+// runHealthCheck runs the check within the timeout, the panic is reported as a failure.
+// The error and the stack of the panic are logged, and only the generic reason is reported.
+func (frame *Framework) runHealthCheck(ctx context.Context, c healthCheck, timeout time.Duration) HealthCheckResult {
+	ctxTimeout, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	err := callSafe(ctxTimeout, func() error {
+		return c.check(ctxTimeout)
+	})
+	result := HealthCheckResult{
+		Status:   HealthUp,
+		Critical: c.critical,
+		Latency:  time.Since(start).String(),
+	}
+	if err != nil {
+		frame.syslog.Errorf("[health-%s] %s: %s", frame.NameWithVersion(), c.name, err.Error())
+		result.Status = HealthDown
+		result.Error = HealthCheckFailed
+		if err == context.DeadlineExceeded {
+			result.Error = HealthCheckTimeout
+		}
+	}
+	return result
+}
+
+// ReadinessHandler returns a handler reporting the health checks as JSON, such as for `/readyz`.
+// It replies 200 if the frame service is ready, or 503 if any critical check fails or it is shutting down.
+// The requests are excluded from the access log.
+//
+//	e.g. frame.GET("/readyz", frame.ReadinessHandler())
+func (frame *Framework) ReadinessHandler() HandlerFunc {
+	return func(ctx *Context) error {
+		ctx.noAccessLog = true
+		ctx.SetHeader(HeaderCacheControl, "no-store")
+		var report HealthReport
+		if frame.ShuttingDown() {
+			report.Status = HealthDown
+		} else {
+			report = frame.CheckHealth(ctx.Context())
+		}
+		status := http.StatusOK
+		if report.Status == HealthDown {
+			status = http.StatusServiceUnavailable
+		}
+		return ctx.JSON(status, report)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	frame := newTestFrame(t, "health_test")
+	frame.SetHealthCheckTimeout(20 * time.Millisecond)
+	var dbDown, cacheDown int32
+	frame.RegisterHealthCheck("db", func(ctx context.Context) error {
+		if atomic.LoadInt32(&dbDown) == 1 {
+			// hangs until the timeout
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+	frame.RegisterHealthCheck("cache", func(ctx context.Context) error {
+		if atomic.LoadInt32(&cacheDown) == 1 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, true)
+	frame.GET("/readyz", frame.ReadinessHandler())
+
+	probe := func() (int, HealthReport) {
+		rec := serveTest(frame, httptest.NewRequest("GET", "/readyz", nil))
+		var report HealthReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("%v: %q", err, rec.Body.String())
+		}
+		return rec.Code, report
+	}
+
+	code, report := probe()
+	if code != 200 || report.Status != HealthUp || len(report.Checks) != 2 || report.Checks["db"].Status != HealthUp {
+		t.Fatalf("up: got %d %+v", code, report)
+	}
+
+	atomic.StoreInt32(&cacheDown, 1)
+	code, report = probe()
+	if code != 200 || report.Status != HealthDegraded || report.Checks["cache"].Error != HealthCheckFailed || report.Checks["cache"].Critical {
+		t.Fatalf("degraded: got %d %+v", code, report)
+	}
+
+	atomic.StoreInt32(&dbDown, 1)
+	start := time.Now()
+	code, report = probe()
+	if code != 503 || report.Status != HealthDown || report.Checks["db"].Error != HealthCheckTimeout {
+		t.Fatalf("down: got %d %+v", code, report)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("the hung check should time out")
+	}
+
+	// the panic is reported as a failure
+	frame.RegisterHealthCheck("cache", func(ctx context.Context) error { panic("cache panic") }, true)
+	atomic.StoreInt32(&dbDown, 0)
+	if report = frame.CheckHealth(context.Background()); report.Status != HealthDegraded || report.Checks["cache"].Status != HealthDown ||
+		report.Checks["cache"].Error != HealthCheckFailed {
+		t.Fatalf("panic: got %+v", report)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+)
+
+// HTTP3Server is an HTTP/3 (QUIC) server, such as `*http3.Server` of `github.com/quic-go/quic-go/http3`,
+// so that faygo does not depend on a QUIC implementation.
+// If it has the method `Shutdown(context.Context) error`, it is shut down gracefully,
+// otherwise it is closed.
+type HTTP3Server interface {
+	// ListenAndServe listens on the UDP address and serves the requests until it is closed.
+	ListenAndServe() error
+	// Close closes the server immediately.
+	Close() error
+}
+
+// HTTP3ServerFunc creates the HTTP/3 server on the UDP address, which serves the handler
+// with the copy of the TLS config of the https listener on the same address.
+type HTTP3ServerFunc func(addr string, handler http.Handler, tlsConfig *tls.Config) HTTP3Server
+
+// SetHTTP3 sets the function creating the HTTP/3 servers, which are started beside the https
+// listeners if the experimental config item `http3` is true, for example:
+//
+//	frame.SetHTTP3(func(addr string, handler http.Handler, tlsConfig *tls.Config) faygo.HTTP3Server {
+//		return &http3.Server{Addr: addr, Handler: handler, TLSConfig: http3.ConfigureTLSConfig(tlsConfig)}
+//	})
+//
+// The responses of the https listeners advertise HTTP/3 by the Alt-Svc header.
+// It returns ErrFrameRunning if the frame is running.
+func (frame *Framework) SetHTTP3(fn HTTP3ServerFunc) error {
+	frame.lock.Lock()
+	defer frame.lock.Unlock()
+	if frame.running {
+		return ErrFrameRunning
+	}
+	frame.http3 = fn
+	return nil
+}
+
+// http3MaxAge is the seconds the clients remember the HTTP/3 endpoint of Alt-Svc.
+const http3MaxAge = "86400"
+
+// serveHTTP3 starts the HTTP/3 server on the address of the https server in a new goroutine,
+// and advertises it in the responses of the https server.
+// It must be called after listening, when the TLS config is ready.
+func (server *Server) serveHTTP3(newServer HTTP3ServerFunc) {
+	handler := server.Server.Handler
+	server.http3 = newServer(server.Addr, handler, server.TLSConfig.Clone())
+	altSvc := `h3=":` + server.port() + `"; ma=` + http3MaxAge
+	server.Server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HeaderAltSvc, altSvc)
+		handler.ServeHTTP(w, r)
+	})
+	server.log.Criticalf("\x1b[46m[SYS]\x1b[0m listen and serve HTTP3 (experimental) on %v", server.Addr)
+	go func() {
+		// the failure of the experimental HTTP/3 does not stop the service
+		if err := server.http3.ListenAndServe(); realServeError(err) != nil {
+			server.log.Errorf("[HTTP3] %v", err)
+		}
+	}()
+}
+
+// shutdownHTTP3 shuts down the HTTP/3 server if it is started.
+func (server *Server) shutdownHTTP3(ctxTimeout context.Context) {
+	if server.http3 == nil {
+		return
+	}
+	var err error
+	if s, ok := server.http3.(interface {
+		Shutdown(context.Context) error
+	}); ok {
+		err = s.Shutdown(ctxTimeout)
+	} else {
+		err = server.http3.Close()
+	}
+	if realServeError(err) != nil {
+		server.log.Errorf("[HTTP3] %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// HTTPClientConfig is the config of the outbound HTTP client of the frame,
+// the zero values mean the defaults.
+type HTTPClientConfig struct {
+	// the time limit of each call including the retries, default 30s,
+	// the earlier deadline of the incoming request also aborts the call.
+	Timeout time.Duration
+	// the proxy of the requests, http.ProxyFromEnvironment by default.
+	Proxy func(*http.Request) (*url.URL, error)
+	// the TLS config of the HTTPS requests.
+	TLSConfig *tls.Config
+	// the max idle connections in total and per host, default 100 and 10.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	// the max retries of the idempotent requests failing with the network errors
+	// or the status 502, 503 and 504, 0 disables retrying.
+	MaxRetries int
+	// the backoff before the first retry, which doubles after each retry up to MaxRetryBackoff,
+	// default 100ms and 2s.
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	// called after each outbound attempt, such as counting the calls by host and status,
+	// the status is 0 if err is not nil.
+	Observe func(host string, status int, err error)
+}
+
+// The defaults of HTTPClientConfig.
+const (
+	DefaultHTTPClientTimeout      = 30 * time.Second
+	DefaultHTTPClientRetryBackoff = 100 * time.Millisecond
+	DefaultHTTPClientMaxBackoff   = 2 * time.Second
+)
+
+// SetHTTPClient sets the config of the outbound HTTP client returned by HTTPClient.
+// note: it should be called before Run()
+func (frame *Framework) SetHTTPClient(conf HTTPClientConfig) {
+	frame.lock.Lock()
+	frame.httpClient = newHTTPClient(conf)
+	frame.lock.Unlock()
+}
+
+// HTTPClient returns the outbound HTTP client of the frame, which is shared by the requests.
+// The default one is created on the first call, if SetHTTPClient is not called.
+func (frame *Framework) HTTPClient() *http.Client {
+	frame.lock.RLock()
+	client := frame.httpClient
+	frame.lock.RUnlock()
+	if client != nil {
+		return client
+	}
+	frame.lock.Lock()
+	defer frame.lock.Unlock()
+	if frame.httpClient == nil {
+		frame.httpClient = newHTTPClient(HTTPClientConfig{})
+	}
+	return frame.httpClient
+}
+
+// HTTPClient returns the outbound HTTP client of the frame,
+// use it with the request created by NewRequest.
+func (ctx *Context) HTTPClient() *http.Client {
+	return ctx.frame.HTTPClient()
+}
+
+// NewRequest creates the outbound request with the context of the incoming request,
+// so that the cancellation or the deadline of the incoming request aborts the outbound call,
+// and copies the X-Request-Id, traceparent and tracestate headers.
+//
+//	req, err := ctx.NewRequest("GET", "http://user-service/users/1", nil)
+//	if err != nil {
+//		return err
+//	}
+//	resp, err := ctx.HTTPClient().Do(req)
+func (ctx *Context) NewRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx.R.Context(), method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range propagatedHeaders {
+		if v := ctx.R.Header.Get(key); v != "" {
+			req.Header.Set(key, v)
+		}
+	}
+	return req, nil
+}
+
+var propagatedHeaders = []string{HeaderXRequestID, "Traceparent", "Tracestate"}
+
+func newHTTPClient(conf HTTPClientConfig) *http.Client {
+	if conf.Timeout <= 0 {
+		conf.Timeout = DefaultHTTPClientTimeout
+	}
+	if conf.Proxy == nil {
+		conf.Proxy = http.ProxyFromEnvironment
+	}
+	if conf.MaxIdleConns <= 0 {
+		conf.MaxIdleConns = 100
+	}
+	if conf.MaxIdleConnsPerHost <= 0 {
+		conf.MaxIdleConnsPerHost = 10
+	}
+	if conf.RetryBackoff <= 0 {
+		conf.RetryBackoff = DefaultHTTPClientRetryBackoff
+	}
+	if conf.MaxRetryBackoff <= 0 {
+		conf.MaxRetryBackoff = DefaultHTTPClientMaxBackoff
+	}
+	transport := &http.Transport{
+		Proxy: conf.Proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       conf.TLSConfig,
+		MaxIdleConns:          conf.MaxIdleConns,
+		MaxIdleConnsPerHost:   conf.MaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	return &http.Client{
+		Transport: &retryTransport{base: transport, conf: conf},
+		Timeout:   conf.Timeout,
+	}
+}
+
+// retryTransport retries the idempotent requests with the exponential backoff,
+// and observes each attempt.
+type retryTransport struct {
+	base http.RoundTripper
+	conf HTTPClientConfig
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := t.conf.RetryBackoff
+	for retries := 0; ; retries++ {
+		resp, err := t.base.RoundTrip(req)
+		if t.conf.Observe != nil {
+			var status int
+			if err == nil {
+				status = resp.StatusCode
+			}
+			t.conf.Observe(req.URL.Host, status, err)
+		}
+		if retries >= t.conf.MaxRetries || !isIdempotent(req.Method) || !shouldRetry(resp, err) {
+			return resp, err
+		}
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return resp, err
+			}
+			body, e := req.GetBody()
+			if e != nil {
+				return resp, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4<<10))
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > t.conf.MaxRetryBackoff {
+			backoff = t.conf.MaxRetryBackoff
+		}
+	}
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
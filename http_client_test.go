@@ -0,0 +1,96 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPClient(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1)%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(r.Header.Get(HeaderXRequestID) + " " + r.Header.Get("Traceparent") + " " + string(body)))
+	}))
+	defer upstream.Close()
+
+	frame := newTestFrame(t, "http_client_test")
+	var observed []int
+	var observedErr error
+	frame.SetHTTPClient(HTTPClientConfig{
+		MaxRetries:   3,
+		RetryBackoff: time.Millisecond,
+		Observe: func(host string, status int, err error) {
+			if host != strings.TrimPrefix(upstream.URL, "http://") {
+				t.Errorf("observed host %q", host)
+			}
+			observed = append(observed, status)
+			observedErr = err
+		},
+	})
+	call := HandlerFunc(func(ctx *Context) error {
+		req, err := ctx.NewRequest(ctx.R.Method, upstream.URL, strings.NewReader("data"))
+		if err != nil {
+			return err
+		}
+		resp, err := ctx.HTTPClient().Do(req)
+		if err != nil {
+			return ctx.String(599, err.Error())
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return ctx.String(resp.StatusCode, string(b))
+	})
+	frame.PUT("/call", call)
+	frame.POST("/call", call)
+
+	req := httptest.NewRequest("PUT", "/call", nil)
+	req.Header.Set(HeaderXRequestID, "r1")
+	req.Header.Set("Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	rec := serveTest(frame, req)
+	want := "r1 00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01 data"
+	if rec.Code != 200 || rec.Body.String() != want {
+		t.Fatalf("got %d %q, want 200 %q", rec.Code, rec.Body.String(), want)
+	}
+	if len(observed) != 3 || observed[0] != 503 || observed[2] != 200 {
+		t.Fatalf("observed %v, want [503 503 200]", observed)
+	}
+
+	// the non-idempotent request is not retried
+	observed = nil
+	rec = serveTest(frame, httptest.NewRequest("POST", "/call", nil))
+	if rec.Code != 503 || len(observed) != 1 {
+		t.Fatalf("POST: got %d, observed %v", rec.Code, observed)
+	}
+
+	// the cancellation of the incoming request aborts the outbound call, and nothing is written
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec = serveTest(frame, httptest.NewRequest("PUT", "/call", nil).WithContext(c))
+	if observedErr == nil || !strings.Contains(observedErr.Error(), "context canceled") || rec.Body.Len() != 0 {
+		t.Fatalf("canceled: got %v, %q", observedErr, rec.Body.String())
+	}
+}
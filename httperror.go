@@ -0,0 +1,94 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"errors"
+	"net/http"
+)
+
+// HTTPError is the error returned by the handler, which replies with its status code and message
+// through the ErrorFunc, for example:
+//
+//	return faygo.NewHTTPError(http.StatusNotFound, "user not found")
+//
+// The Internal error is logged, but not sent to the client.
+type HTTPError struct {
+	Code     int
+	Message  string
+	Internal error
+}
+
+// ErrorMapper translates the error returned by the handler to the status code and message,
+// such as sql.ErrNoRows to 404; the status code 0 means that it is not translated.
+type ErrorMapper func(err error) (status int, message string)
+
+// NewHTTPError creates an *HTTPError, whose message defaults to the status text.
+func NewHTTPError(code int, message ...string) *HTTPError {
+	he := &HTTPError{Code: code}
+	if len(message) > 0 {
+		he.Message = message[0]
+	}
+	return he
+}
+
+// Error implements the error interface.
+func (he *HTTPError) Error() string {
+	msg := he.Message
+	if msg == "" {
+		msg = http.StatusText(he.Code)
+	}
+	if he.Internal != nil {
+		return msg + ": " + he.Internal.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the internal error.
+func (he *HTTPError) Unwrap() error {
+	return he.Internal
+}
+
+// SetErrorMapper sets the global ErrorMapper, which is tried for the errors returned by the handlers
+// except *HTTPError, whose untranslated ones reply 500 with the error message.
+// If errorMapper is nil, no error is translated.
+func SetErrorMapper(errorMapper ErrorMapper) {
+	global.errorMapper = errorMapper
+}
+
+// handlerErrorResponse returns the status code and message of the error returned by the handler.
+func handlerErrorResponse(ctx *Context, err error) (int, string) {
+	var he *HTTPError
+	if errors.As(err, &he) {
+		msg := he.Message
+		if msg == "" {
+			msg = http.StatusText(he.Code)
+		}
+		if he.Internal != nil {
+			if he.Code >= 500 {
+				ctx.Log().Errorf("%s: %v", msg, he.Internal)
+			} else {
+				ctx.Log().Debugf("%s: %v", msg, he.Internal)
+			}
+		}
+		return he.Code, msg
+	}
+	if global.errorMapper != nil {
+		if status, msg := global.errorMapper(err); status != 0 {
+			return status, msg
+		}
+	}
+	return http.StatusInternalServerError, err.Error()
+}
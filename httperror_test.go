@@ -0,0 +1,87 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerError(t *testing.T) {
+	SetErrorMapper(func(err error) (int, string) {
+		if errors.Is(err, sql.ErrNoRows) {
+			return http.StatusNotFound, "no such record"
+		}
+		return 0, ""
+	})
+	defer SetErrorMapper(nil)
+
+	frame := newTestFrame(t, "handler_error_test")
+	var after bool
+	group := frame.Group("/", HandlerFunc(func(ctx *Context) error {
+		ctx.SetHeader("X-Middleware", "1")
+		return nil
+	}))
+	group.GET("/http", HandlerFunc(func(ctx *Context) error {
+		return &HTTPError{Code: http.StatusForbidden, Message: "no permission", Internal: errors.New("secret detail")}
+	}), HandlerFunc(func(ctx *Context) error {
+		after = true
+		return nil
+	}))
+	group.GET("/wrapped", HandlerFunc(func(ctx *Context) error {
+		return fmt.Errorf("update: %w", NewHTTPError(http.StatusConflict))
+	}))
+	group.GET("/mapped", HandlerFunc(func(ctx *Context) error {
+		return fmt.Errorf("query user: %w", sql.ErrNoRows)
+	}))
+	group.GET("/generic", HandlerFunc(func(ctx *Context) error {
+		return errors.New("boom")
+	}))
+	group.GET("/written", HandlerFunc(func(ctx *Context) error {
+		ctx.String(http.StatusCreated, "created")
+		return errors.New("failed after writing")
+	}))
+
+	cases := []struct {
+		path, body string
+		code       int
+	}{
+		{"/http", "no permission", http.StatusForbidden},
+		{"/wrapped", "Conflict", http.StatusConflict},
+		{"/mapped", "no such record", http.StatusNotFound},
+		{"/generic", "boom", http.StatusInternalServerError},
+		{"/written", "created", http.StatusCreated},
+	}
+	for _, c := range cases {
+		w := serveTest(frame, httptest.NewRequest("GET", c.path, nil))
+		if w.Code != c.code || !strings.Contains(w.Body.String(), c.body) || w.Header().Get("X-Middleware") != "1" {
+			t.Fatalf("%s: got %d %q", c.path, w.Code, w.Body.String())
+		}
+		if c.path == "/written" && w.Body.String() != "created" {
+			t.Fatalf("the written response is rendered again: %q", w.Body.String())
+		}
+	}
+	if after {
+		t.Fatal("the handler chain is not stopped by the error")
+	}
+	if w := serveTest(frame, httptest.NewRequest("GET", "/http", nil)); strings.Contains(w.Body.String(), "secret detail") {
+		t.Fatal("the internal error is sent to the client")
+	}
+}
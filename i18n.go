@@ -0,0 +1,163 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// I18nConfig is the config of the i18n middleware created by NewI18n.
+type I18nConfig struct {
+	// The available locales, such as "en", "en-US" and "zh-CN", the first one is the default.
+	Locales []string
+	// The query param name overriding the negotiated locale, "lang" by default, "-" disables it.
+	// The overriding locale is remembered by the cookie.
+	QueryKey string
+	// The cookie name overriding the negotiated locale, "lang" by default, "-" disables it.
+	CookieKey string
+	// The max age of the locale cookie in seconds, 0 means the browser session.
+	CookieMaxAge int
+	// The messages by locale and key, the formats of fmt.Sprintf,
+	// looked up in the default locale if they are missing in the chosen one.
+	Messages map[string]map[string]string
+	// Translates the key in the locale with the args, it takes priority over the Messages if not nil.
+	Translate func(lang, key string, args ...interface{}) string
+}
+
+// i18n is the i18n middleware state shared by the contexts.
+type i18n struct {
+	I18nConfig
+	// the available locales by the lowercase name
+	locales map[string]string
+}
+
+// NewI18n creates the i18n middleware choosing the locale of each request.
+// The locale overridden by the query param or the cookie takes priority,
+// otherwise it is the best match of the Accept-Language header in the available locales,
+// such as "en-US" for "en-GB" if only "en-US" is available, or the default locale.
+// The chosen locale is available by ctx.Lang(), the messages are translated by ctx.Tr(),
+// and in the templates rendered by ctx.Render as `{{ lang }}` and `{{ tr("key", args...) }}`.
+func NewI18n(conf I18nConfig) HandlerFunc {
+	if len(conf.Locales) == 0 {
+		Fatalf("NewI18n: no locale is available")
+	}
+	if conf.QueryKey == "" {
+		conf.QueryKey = "lang"
+	}
+	if conf.CookieKey == "" {
+		conf.CookieKey = "lang"
+	}
+	i := &i18n{
+		I18nConfig: conf,
+		locales:    make(map[string]string, len(conf.Locales)),
+	}
+	for _, locale := range conf.Locales {
+		i.locales[strings.ToLower(locale)] = locale
+	}
+	return func(ctx *Context) error {
+		ctx.i18n = i
+		ctx.lang = i.choose(ctx)
+		ctx.SetHeader(HeaderContentLanguage, ctx.lang)
+		return nil
+	}
+}
+
+// choose returns the locale of the request.
+func (i *i18n) choose(ctx *Context) string {
+	if i.QueryKey != "-" {
+		if locale, ok := i.available(ctx.QueryParam(i.QueryKey)); ok {
+			if i.CookieKey != "-" {
+				ctx.SetCookie(i.CookieKey, locale, i.CookieMaxAge)
+			}
+			return locale
+		}
+	}
+	if i.CookieKey != "-" {
+		if locale, ok := i.available(ctx.CookieParam(i.CookieKey)); ok {
+			return locale
+		}
+	}
+	ctx.W.Header().Add(HeaderVary, HeaderAcceptLanguage)
+	return i.negotiate(ctx.HeaderParam(HeaderAcceptLanguage))
+}
+
+func (i *i18n) available(lang string) (string, bool) {
+	if lang == "" {
+		return "", false
+	}
+	locale, ok := i.locales[strings.ToLower(lang)]
+	return locale, ok
+}
+
+// negotiate returns the available locale best matching the Accept-Language header.
+func (i *i18n) negotiate(header string) string {
+	for _, spec := range parseQualityValues(header) {
+		if spec.q <= 0 {
+			continue
+		}
+		if spec.value == "*" {
+			break
+		}
+		if locale, ok := i.locales[spec.value]; ok {
+			return locale
+		}
+		// matches the same language, such as en-US for en-GB or en
+		base := spec.value
+		if n := strings.IndexByte(base, '-'); n != -1 {
+			base = base[:n]
+		}
+		for _, locale := range i.Locales {
+			lower := strings.ToLower(locale)
+			if lower == base || strings.HasPrefix(lower, base+"-") {
+				return locale
+			}
+		}
+	}
+	return i.Locales[0]
+}
+
+func (i *i18n) translate(lang, key string, args ...interface{}) string {
+	if i.Translate != nil {
+		return i.Translate(lang, key, args...)
+	}
+	format, ok := i.Messages[lang][key]
+	if !ok {
+		if format, ok = i.Messages[i.Locales[0]][key]; !ok {
+			format = key
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Lang returns the locale chosen by the i18n middleware, or empty if it is not used.
+func (ctx *Context) Lang() string {
+	return ctx.lang
+}
+
+// Tr translates the message of the key in the locale chosen by the i18n middleware,
+// formatted with the args. It returns the key if the i18n middleware is not used.
+func (ctx *Context) Tr(key string, args ...interface{}) string {
+	if ctx.i18n == nil {
+		if len(args) == 0 {
+			return key
+		}
+		return fmt.Sprintf(key, args...)
+	}
+	return ctx.i18n.translate(ctx.lang, key, args...)
+}
@@ -0,0 +1,86 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestI18n(t *testing.T) {
+	frame := newTestFrame(t, "i18n_test")
+	frame.Filter(NewI18n(I18nConfig{
+		Locales: []string{"en", "zh-CN", "fr-FR"},
+		Messages: map[string]map[string]string{
+			"en":    {"hello": "Hello, %s!", "bye": "Bye"},
+			"zh-CN": {"hello": "你好，%s！"},
+		},
+	}))
+	render := newRender(nil)
+	render.SetFS(http.FS(fstest.MapFS{
+		"hello.html": {Data: []byte(`{{ lang }}: {{ tr("hello", "Tom") }} {{ tr("bye") }}`)},
+	}))
+	frame.GET("/hello", HandlerFunc(func(ctx *Context) error {
+		b, err := render.Render("hello.html", ctx.renderData(nil))
+		if err != nil {
+			return err
+		}
+		return ctx.Bytes(200, MIMETextHTMLCharsetUTF8, b)
+	}))
+
+	get := func(query, acceptLanguage, cookie string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/hello"+query, nil)
+		if acceptLanguage != "" {
+			req.Header.Set(HeaderAcceptLanguage, acceptLanguage)
+		}
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "lang", Value: cookie})
+		}
+		return serveTest(frame, req)
+	}
+	cases := []struct {
+		query, acceptLanguage, cookie string
+		want                          string
+	}{
+		{"", "", "", "en: Hello, Tom! Bye"},
+		{"", "de;q=0.9, zh-TW;q=0.8, en;q=0.5", "", "zh-CN: 你好，Tom！ Bye"},
+		{"", "fr, zh-CN;q=0.9", "", "fr-FR: Hello, Tom! Bye"},
+		{"", "de, *;q=0.5", "", "en: Hello, Tom! Bye"},
+		{"", "zh-CN;q=0, en-GB", "", "en: Hello, Tom! Bye"},
+		{"", "en", "zh-cn", "zh-CN: 你好，Tom！ Bye"},
+		{"", "en", "xx", "en: Hello, Tom! Bye"},
+		{"?lang=zh-CN", "en", "fr-FR", "zh-CN: 你好，Tom！ Bye"},
+	}
+	for _, c := range cases {
+		rec := get(c.query, c.acceptLanguage, c.cookie)
+		if rec.Code != 200 || rec.Body.String() != c.want {
+			t.Fatalf("%+v: got %d %q", c, rec.Code, rec.Body.String())
+		}
+		if lang := rec.Header().Get(HeaderContentLanguage); lang == "" {
+			t.Fatalf("%+v: no Content-Language", c)
+		}
+	}
+	rec := get("?lang=zh-CN", "", "")
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].Name != "lang" || cookies[0].Value != "zh-CN" {
+		t.Fatalf("the overriding locale is not remembered: %v", cookies)
+	}
+
+	ctx := &Context{}
+	if ctx.Lang() != "" || ctx.Tr("%d items", 3) != "3 items" {
+		t.Fatal("without the middleware")
+	}
+}
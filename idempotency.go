@@ -0,0 +1,312 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Headers of the idempotency middleware
+const (
+	HeaderIdempotencyKey     = "Idempotency-Key"
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+// DefaultIdempotencyTTL is the default duration the responses of the idempotency keys are replayed.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// defaultIdempotencyMaxBody is the maximum body of the stored responses.
+const defaultIdempotencyMaxBody = 1 << 20
+
+// Default bounds of the in-memory IdempotencyStore
+const (
+	DefaultIdempotencyStoreMaxEntries = 1 << 16
+	DefaultIdempotencyStoreMaxBytes   = 64 << 20
+)
+
+type (
+	// IdempotencyStore stores the responses of the idempotency keys,
+	// it may be shared across processes, such as redis.
+	IdempotencyStore interface {
+		// Start claims the key for the request, and reports whether it is claimed.
+		// If the key is not claimed, the stored response is returned,
+		// or nil if the request of the key is still in-flight.
+		Start(key string) (response []byte, claimed bool, err error)
+		// Finish stores the response of the claimed key for ttl.
+		Finish(key string, response []byte, ttl time.Duration) error
+		// Abort releases the claimed key without the response, so that it can be retried.
+		Abort(key string) error
+	}
+	// IdempotencyOption is the option of Idempotency.
+	IdempotencyOption func(*idempotency)
+	// MemoryIdempotencyStoreOption is the option of NewMemoryIdempotencyStore.
+	MemoryIdempotencyStoreOption func(*memoryIdempotencyStore)
+	// idempotency is the idempotency middleware state.
+	idempotency struct {
+		store   IdempotencyStore
+		ttl     time.Duration
+		scope   func(ctx *Context) string
+		maxBody int64
+	}
+)
+
+// Idempotency creates the middleware making the retries of the unsafe requests, such as payments, safe.
+// The first response of the `Idempotency-Key` request header is stored, and replayed for the requests
+// with the same key within the ttl (DefaultIdempotencyTTL by default) with the `Idempotent-Replayed: true` header,
+// without calling the following handlers again. While the first request is in-flight,
+// the duplicates are replied 409 Conflict.
+// The key is scoped by the principal of the client, the method and the path. The principal is
+// the digest of the Authorization header and the session ID by default, see IdempotencyScope.
+// The 5xx responses and the ones larger than 1MB are not stored, so that they can be retried,
+// and the Set-Cookie headers are never replayed.
+// The requests without the header are served as usual.
+// If store is nil, the in-memory store is used.
+//
+//	e.g. frame.POST("/charges", faygo.Idempotency(nil), chargeHandler)
+func Idempotency(store IdempotencyStore, opts ...IdempotencyOption) HandlerFunc {
+	if store == nil {
+		store = NewMemoryIdempotencyStore()
+	}
+	m := &idempotency{
+		store:   store,
+		ttl:     DefaultIdempotencyTTL,
+		scope:   idempotencyPrincipal,
+		maxBody: defaultIdempotencyMaxBody,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m.serve
+}
+
+// IdempotencyTTL sets how long the responses are replayed.
+func IdempotencyTTL(ttl time.Duration) IdempotencyOption {
+	return func(m *idempotency) {
+		m.ttl = ttl
+	}
+}
+
+// IdempotencyScope sets the principal scoping the idempotency key, such as the user ID,
+// instead of the digest of the Authorization header and the session ID,
+// so that the keys of the different clients never conflict.
+func IdempotencyScope(fn func(ctx *Context) string) IdempotencyOption {
+	return func(m *idempotency) {
+		m.scope = fn
+	}
+}
+
+func (m *idempotency) serve(ctx *Context) error {
+	idemKey := ctx.HeaderParam(HeaderIdempotencyKey)
+	if idemKey == "" {
+		return nil
+	}
+	key := m.scope(ctx) + "\x00" + ctx.R.Method + " " + ctx.R.URL.Path + "\x00" + idemKey
+	response, claimed, err := m.store.Start(key)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		ctx.Stop()
+		if response == nil {
+			global.errorFunc(ctx, "a request with the same Idempotency-Key is in progress", http.StatusConflict)
+			return nil
+		}
+		status, header, body, err := decodeResponse(response)
+		if err != nil {
+			global.errorFunc(ctx, err.Error(), http.StatusInternalServerError)
+			return nil
+		}
+		h := ctx.W.Header()
+		for k, v := range header {
+			if k != HeaderSetCookie {
+				h[k] = v
+			}
+		}
+		h.Set(HeaderIdempotentReplayed, "true")
+		ctx.W.WriteHeader(status)
+		ctx.W.Write(body)
+		return nil
+	}
+
+	var finished bool
+	defer func() {
+		// the handler panicked or the response is not stored
+		if !finished {
+			if err := m.store.Abort(key); err != nil {
+				ctx.Log().Errorf("Idempotency: %v", err)
+			}
+		}
+	}()
+	rec := &responseRecorder{ResponseWriter: ctx.W.writer, limit: m.maxBody}
+	ctx.W.writer = rec
+	ctx.Next()
+	ctx.W.writer = rec.ResponseWriter
+	status := ctx.W.Status()
+	if rec.overflow || status == 0 || status >= 500 {
+		return nil
+	}
+	finished = true
+	header := make(http.Header, len(ctx.W.Header()))
+	for k, v := range ctx.W.Header() {
+		if k != HeaderSetCookie {
+			header[k] = v
+		}
+	}
+	if err := m.store.Finish(key, encodeResponse(status, header, rec.body.Bytes()), m.ttl); err != nil {
+		ctx.Log().Errorf("Idempotency: %v", err)
+		m.store.Abort(key)
+	}
+	return nil
+}
+
+// idempotencyPrincipal returns the default principal of the client,
+// the digest of the Authorization header and the session ID, so that the credentials are not stored.
+func idempotencyPrincipal(ctx *Context) string {
+	h := sha256.New()
+	io.WriteString(h, ctx.HeaderParam(HeaderAuthorization))
+	if session := ctx.frame.config.Session; session.Enable {
+		io.WriteString(h, "\x00"+ctx.CookieParam(session.Name))
+		if session.EnableSidInHttpHeader {
+			io.WriteString(h, "\x00"+ctx.HeaderParam(session.NameInHttpHeader))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// memoryIdempotencyStore is the in-memory IdempotencyStore.
+type memoryIdempotencyStore struct {
+	entries    map[string]*idempotencyEntry
+	lru        *list.List // the keys of the stored responses, the most recent first
+	size       int64      // the total bytes of the stored responses
+	maxEntries int
+	maxBytes   int64
+	lastSweep  time.Time
+	lock       sync.Mutex
+}
+
+// idempotencyEntry is the stored response, nil if it is in-flight.
+type idempotencyEntry struct {
+	response []byte
+	expires  time.Time
+	elem     *list.Element // nil if it is in-flight
+}
+
+// idempotencySweepInterval is the interval removing the expired entries of the in-memory store.
+const idempotencySweepInterval = time.Minute
+
+// NewMemoryIdempotencyStore creates the in-memory IdempotencyStore,
+// which is the default of Idempotency.
+// At most DefaultIdempotencyStoreMaxEntries responses of DefaultIdempotencyStoreMaxBytes in total
+// are stored, the least recent ones are removed beyond them, so that the random keys of a client
+// can not exhaust the memory. The in-flight requests are never removed.
+func NewMemoryIdempotencyStore(opts ...MemoryIdempotencyStoreOption) IdempotencyStore {
+	s := &memoryIdempotencyStore{
+		entries:    make(map[string]*idempotencyEntry),
+		lru:        list.New(),
+		maxEntries: DefaultIdempotencyStoreMaxEntries,
+		maxBytes:   DefaultIdempotencyStoreMaxBytes,
+		lastSweep:  time.Now(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// IdempotencyStoreMaxEntries sets the maximum number of the stored responses of the in-memory store.
+func IdempotencyStoreMaxEntries(maxEntries int) MemoryIdempotencyStoreOption {
+	return func(s *memoryIdempotencyStore) {
+		s.maxEntries = maxEntries
+	}
+}
+
+// IdempotencyStoreMaxBytes sets the maximum total bytes of the stored responses of the in-memory store.
+func IdempotencyStoreMaxBytes(maxBytes int64) MemoryIdempotencyStoreOption {
+	return func(s *memoryIdempotencyStore) {
+		s.maxBytes = maxBytes
+	}
+}
+
+func (s *memoryIdempotencyStore) Start(key string) ([]byte, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastSweep) >= idempotencySweepInterval {
+		for k, e := range s.entries {
+			if e.response != nil && now.After(e.expires) {
+				s.remove(k)
+			}
+		}
+		s.lastSweep = now
+	}
+	if e, ok := s.entries[key]; ok {
+		if e.response == nil {
+			return nil, false, nil
+		}
+		if now.Before(e.expires) {
+			s.lru.MoveToFront(e.elem)
+			return e.response, false, nil
+		}
+		s.remove(key)
+	}
+	s.entries[key] = &idempotencyEntry{}
+	return nil, true, nil
+}
+
+func (s *memoryIdempotencyStore) Finish(key string, response []byte, ttl time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.remove(key)
+	if s.maxBytes > 0 && int64(len(response)) > s.maxBytes {
+		// too large to be stored, the key is released to be retried
+		return nil
+	}
+	s.entries[key] = &idempotencyEntry{
+		response: response,
+		expires:  time.Now().Add(ttl),
+		elem:     s.lru.PushFront(key),
+	}
+	s.size += int64(len(response))
+	for s.maxEntries > 0 && s.lru.Len() > s.maxEntries || s.maxBytes > 0 && s.size > s.maxBytes {
+		s.remove(s.lru.Back().Value.(string))
+	}
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Abort(key string) error {
+	s.lock.Lock()
+	s.remove(key)
+	s.lock.Unlock()
+	return nil
+}
+
+// remove deletes the entry of the key, it is called with lock held.
+func (s *memoryIdempotencyStore) remove(key string) {
+	e, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	if e.elem != nil {
+		s.lru.Remove(e.elem)
+		s.size -= int64(len(e.response))
+	}
+	delete(s.entries, key)
+}
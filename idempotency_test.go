@@ -0,0 +1,151 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotency(t *testing.T) {
+	frame := newTestFrame(t, "idempotency_test")
+	var calls int32
+	release := make(chan struct{})
+	started := make(chan struct{})
+	frame.POST("/charges", Idempotency(nil, IdempotencyTTL(50*time.Millisecond)), HandlerFunc(func(ctx *Context) error {
+		n := atomic.AddInt32(&calls, 1)
+		if ctx.QueryParam("wait") != "" {
+			started <- struct{}{}
+			<-release
+		}
+		if ctx.QueryParam("fail") != "" {
+			return ctx.String(http.StatusServiceUnavailable, "retry later")
+		}
+		ctx.SetHeader("X-Charge", strconv.Itoa(int(n)))
+		ctx.SetCookie("charge", strconv.Itoa(int(n)))
+		return ctx.String(http.StatusCreated, "charge %d", n)
+	}))
+	postAs := func(url, key, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", url, nil)
+		if key != "" {
+			req.Header.Set(HeaderIdempotencyKey, key)
+		}
+		if authorization != "" {
+			req.Header.Set(HeaderAuthorization, authorization)
+		}
+		return serveTest(frame, req)
+	}
+	post := func(url, key string) *httptest.ResponseRecorder {
+		return postAs(url, key, "")
+	}
+	check := func(rec *httptest.ResponseRecorder, status int, body string, replayed bool) {
+		t.Helper()
+		if rec.Code != status || rec.Body.String() != body || (rec.Header().Get(HeaderIdempotentReplayed) == "true") != replayed {
+			t.Fatalf("got %d %q replayed=%q, want %d %q replayed=%v",
+				rec.Code, rec.Body.String(), rec.Header().Get(HeaderIdempotentReplayed), status, body, replayed)
+		}
+	}
+
+	check(post("/charges", "k1"), 201, "charge 1", false)
+	rec := post("/charges", "k1")
+	check(rec, 201, "charge 1", true)
+	if rec.Header().Get("X-Charge") != "1" {
+		t.Fatalf("the headers are not replayed: %v", rec.Header())
+	}
+	if rec.Header().Get(HeaderSetCookie) != "" {
+		t.Fatalf("the Set-Cookie header is replayed: %v", rec.Header())
+	}
+	check(post("/charges", "k2"), 201, "charge 2", false)
+	check(post("/charges", ""), 201, "charge 3", false)
+	check(post("/charges", ""), 201, "charge 4", false)
+
+	// the 5xx responses are not stored
+	check(post("/charges?fail=1", "k3"), 503, "retry later", false)
+	check(post("/charges", "k3"), 201, "charge 6", false)
+
+	// in-flight
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- post("/charges?wait=1", "k4") }()
+	<-started
+	if rec := post("/charges", "k4"); rec.Code != http.StatusConflict {
+		t.Fatalf("in-flight duplicate: got %d", rec.Code)
+	}
+	close(release)
+	check(<-done, 201, "charge 7", false)
+	check(post("/charges", "k4"), 201, "charge 7", true)
+
+	// the keys of the different principals never conflict
+	check(postAs("/charges", "k5", "Bearer alice"), 201, "charge 8", false)
+	check(postAs("/charges", "k5", "Bearer bob"), 201, "charge 9", false)
+	check(postAs("/charges", "k5", "Bearer alice"), 201, "charge 8", true)
+
+	// expired
+	time.Sleep(60 * time.Millisecond)
+	check(post("/charges", "k1"), 201, "charge 10", false)
+}
+
+func TestMemoryIdempotencyStoreEviction(t *testing.T) {
+	s := NewMemoryIdempotencyStore(IdempotencyStoreMaxEntries(2), IdempotencyStoreMaxBytes(10))
+	store := func(key, response string) {
+		t.Helper()
+		if _, claimed, _ := s.Start(key); !claimed {
+			t.Fatalf("%s: not claimed", key)
+		}
+		s.Finish(key, []byte(response), time.Hour)
+	}
+	stored := func(key string) bool {
+		response, claimed, _ := s.Start(key)
+		if claimed {
+			s.Abort(key)
+		}
+		return response != nil
+	}
+
+	// beyond the max entries, the least recent one is removed
+	store("k1", "a")
+	store("k2", "b")
+	if !stored("k1") {
+		t.Fatal("k1 is not stored")
+	}
+	store("k3", "c")
+	if stored("k2") || !stored("k1") || !stored("k3") {
+		t.Fatal("k2 should be evicted as the least recent one")
+	}
+
+	// beyond the max bytes
+	store("k4", "0123456789")
+	if stored("k1") || stored("k3") || !stored("k4") {
+		t.Fatal("k1 and k3 should be evicted by the size")
+	}
+	// too large to be stored
+	store("k5", "0123456789a")
+	if stored("k5") || !stored("k4") {
+		t.Fatal("the response larger than the max bytes should not be stored")
+	}
+
+	// the in-flight requests are never evicted
+	if _, claimed, _ := s.Start("inflight"); !claimed {
+		t.Fatal("inflight: not claimed")
+	}
+	store("k6", "d")
+	store("k7", "e")
+	if _, claimed, _ := s.Start("inflight"); claimed {
+		t.Fatal("the in-flight request is evicted")
+	}
+}
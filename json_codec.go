@@ -0,0 +1,66 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"encoding/json"
+)
+
+// JSONCodec is the JSON encoder and decoder used by the framework,
+// such as Context.JSON, Context.BindJSON and the default Bodydecoder.
+// The jsoniter.ConfigCompatibleWithStandardLibrary is a drop-in one,
+// which keeps the struct tag behavior of encoding/json.
+type JSONCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	MarshalIndent(v interface{}, prefix, indent string) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// StdJSONCodec is the default JSONCodec using encoding/json.
+var StdJSONCodec JSONCodec = stdJSONCodec{}
+
+type stdJSONCodec struct{}
+
+func (stdJSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (stdJSONCodec) MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
+	return json.MarshalIndent(v, prefix, indent)
+}
+
+func (stdJSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// SetJSONCodec sets the global JSONCodec, if codec is nil, StdJSONCodec is used.
+// note: it should be called before Run()
+//
+//	e.g. faygo.SetJSONCodec(jsoniter.ConfigCompatibleWithStandardLibrary)
+func SetJSONCodec(codec JSONCodec) {
+	if codec == nil {
+		global.jsonCodec = StdJSONCodec
+	} else {
+		global.jsonCodec = codec
+	}
+}
+
+// marshalJSON encodes the data by the global JSONCodec.
+func marshalJSON(data interface{}, isIndent []bool) ([]byte, error) {
+	if len(isIndent) > 0 && isIndent[0] {
+		return global.jsonCodec.MarshalIndent(data, "", "  ")
+	}
+	return global.jsonCodec.Marshal(data)
+}
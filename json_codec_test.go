@@ -0,0 +1,124 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// countingCodec counts the calls of the wrapped JSONCodec.
+type countingCodec struct {
+	JSONCodec
+	marshal, unmarshal int
+}
+
+func (c *countingCodec) Marshal(v interface{}) ([]byte, error) {
+	c.marshal++
+	return c.JSONCodec.Marshal(v)
+}
+
+func (c *countingCodec) Unmarshal(data []byte, v interface{}) error {
+	c.unmarshal++
+	return c.JSONCodec.Unmarshal(data, v)
+}
+
+type jsonCodecAPI struct {
+	User struct {
+		Name string `json:"name"`
+	} `param:"<in:body>"`
+}
+
+func (a *jsonCodecAPI) Serve(ctx *Context) error {
+	return ctx.JSON(200, a.User)
+}
+
+func TestSetJSONCodec(t *testing.T) {
+	codec := &countingCodec{JSONCodec: jsoniter.ConfigCompatibleWithStandardLibrary}
+	SetJSONCodec(codec)
+	defer SetJSONCodec(nil)
+	frame := newTestFrame(t, "json_codec_test")
+	frame.POST("/user", new(jsonCodecAPI))
+	frame.GET("/flash", HandlerFunc(func(ctx *Context) error {
+		if ctx.QueryParam("read") != "" {
+			return ctx.String(200, strings.Join(ctx.Flash(), ","))
+		}
+		ctx.AddFlash("saved")
+		return ctx.String(200, "ok")
+	}))
+	req := httptest.NewRequest("POST", "/user", strings.NewReader(`{"name":"henry"}`))
+	req.Header.Set(HeaderContentType, MIMEApplicationJSON)
+	rec := serveTest(frame, req)
+	if rec.Code != 200 || rec.Body.String() != `{"name":"henry"}` {
+		t.Fatalf("got %d %q", rec.Code, rec.Body.String())
+	}
+	if codec.marshal != 1 || codec.unmarshal != 1 {
+		t.Fatalf("codec calls: marshal %d, unmarshal %d, want 1 and 1", codec.marshal, codec.unmarshal)
+	}
+
+	// the flash messages use the codec too
+	rec = serveTest(frame, httptest.NewRequest("GET", "/flash", nil))
+	req = httptest.NewRequest("GET", "/flash?read=1", nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	if rec = serveTest(frame, req); rec.Body.String() != "saved" {
+		t.Fatalf("flash: got %q", rec.Body.String())
+	}
+	if codec.marshal != 2 || codec.unmarshal != 2 {
+		t.Fatalf("flash codec calls: marshal %d, unmarshal %d, want 2 and 2", codec.marshal, codec.unmarshal)
+	}
+}
+
+type benchJSONItem struct {
+	ID    int               `json:"id"`
+	Name  string            `json:"name"`
+	Tags  []string          `json:"tags,omitempty"`
+	Attrs map[string]string `json:"attrs"`
+	Note  string            `json:"-"`
+}
+
+func benchmarkJSONCodec(b *testing.B, codec JSONCodec) {
+	SetJSONCodec(codec)
+	defer SetJSONCodec(nil)
+	items := make([]benchJSONItem, 100)
+	for i := range items {
+		items[i] = benchJSONItem{ID: i, Name: "faygo", Tags: []string{"a", "b"}, Attrs: map[string]string{"k": "v"}}
+	}
+	data, _ := codec.Marshal(items)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := marshalJSON(items, nil); err != nil {
+			b.Fatal(err)
+		}
+		var out []benchJSONItem
+		if err := global.jsonCodec.Unmarshal(data, &out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJSONCodecStd(b *testing.B) {
+	benchmarkJSONCodec(b, StdJSONCodec)
+}
+
+func BenchmarkJSONCodecJsoniter(b *testing.B) {
+	benchmarkJSONCodec(b, jsoniter.ConfigCompatibleWithStandardLibrary)
+}
@@ -15,8 +15,8 @@
 package faygo
 
 import (
+	"errors"
 	"log"
-	"os"
 	"strings"
 
 	"github.com/henrylee2cn/faygo/logging"
@@ -38,17 +38,40 @@ var (
 	fileBackend *logging.FileBackend
 )
 
+// RotateLogsNow rotates the log files immediately, including the ones of the frames,
+// for example, after logrotate moved them away. It is also triggered by SIGHUP on non-windows systems.
+func RotateLogsNow() error {
+	if fileBackend == nil {
+		return errors.New("the file logger is not enabled")
+	}
+	if err := fileBackend.RotateNow(); err != nil {
+		return err
+	}
+	for _, frame := range AllFrames() {
+		if frame.fileBackend != nil {
+			if err := frame.fileBackend.RotateNow(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (global *GlobalVariables) newFileBackend(filename string) *logging.FileBackend {
+	fileBackend, err := logging.NewDefaultFileBackend(filename, global.config.Log.AsyncLen)
+	if err != nil {
+		panic(err)
+	}
+	fileBackend.MaxSize = global.config.Log.MaxSizeMB * MB
+	fileBackend.MaxDays = int64(global.config.Log.MaxAgeDays)
+	fileBackend.MaxBackups = global.config.Log.MaxBackups
+	fileBackend.Compress = global.config.Log.CompressRotated
+	return fileBackend
+}
+
 func (global *GlobalVariables) initLogger() {
 	if global.config.Log.FileEnable {
-		fileBackend = func() *logging.FileBackend {
-			fileBackend, err := logging.NewDefaultFileBackend(global.logDir+"faygo.log", global.config.Log.AsyncLen)
-			if err != nil {
-				panic(err)
-			}
-			return fileBackend
-		}()
-	} else {
-		os.MkdirAll(global.logDir, 0777)
+		fileBackend = global.newFileBackend(global.logDir + "faygo.log")
 	}
 	consoleFormat := logging.MustStringFormatter("[%{time:2006/01/02 15:04:05.000}] %{message}")
 	consoleBackendLevel := logging.AddModuleLevel(logging.NewBackendFormatter(consoleLogBackend, consoleFormat))
@@ -74,6 +97,7 @@ func (global *GlobalVariables) initLogger() {
 		"globalbiz",
 		consoleFormatString,
 		fileFormatString,
+		fileBackend,
 	)
 	global.bizlog.ExtraCalldepth++
 }
@@ -93,6 +117,7 @@ func (frame *Framework) initSysLogger() {
 		strings.ToLower(frame.NameWithVersion()),
 		consoleFormat,
 		fileFormat,
+		fileBackend,
 	)
 }
 
@@ -101,20 +126,46 @@ func (frame *Framework) initBizLogger() {
 	var fileFormat string
 	// switch frame.config.RunMode {
 	// case RUNMODE_DEV:
-	consoleFormat = "[%{time:2006/01/02 15:04:05.000}] %{color}[%{level:.1s}]%{color:reset} %{message} <%{module} #%{longfile}>"
-	fileFormat = "[%{time:2006/01/02T15:04:05.000Z07:00}] [%{level:.1s}] %{message} <%{module} #%{longfile}>"
+	// the lines are prefixed with the module, i.e. the frame name, to tell the frames apart
+	consoleFormat = "[%{time:2006/01/02 15:04:05.000}] %{color}[%{level:.1s}]%{color:reset} [%{module}] %{message} <#%{longfile}>"
+	fileFormat = "[%{time:2006/01/02T15:04:05.000Z07:00}] [%{level:.1s}] [%{module}] %{message} <#%{longfile}>"
 	// case RUNMODE_PROD:
 	// consoleFormat = "[%{time:2006/01/02 15:04:05.000}] %{color}[%{level:.1s}]%{color:reset} %{message} <%{module} #%{longfile}>"
 	// fileFormat = "[%{time:2006/01/02T15:04:05.000Z07:00}] [%{level:.1s}] %{message} <%{module} #%{longfile}>"
 	// }
+	// each frame has its own bizlog file, such as `./log/myapp_1.0.log`
+	if global.config.Log.FileEnable {
+		frame.fileBackend = global.newFileBackend(frame.LogDir() + frame.logFileName())
+	}
 	frame.bizlog = global.newLogger(
 		strings.ToLower(frame.NameWithVersion()),
 		consoleFormat,
 		fileFormat,
+		frame.fileBackend,
 	)
+	// the config item `log_level` overrides the global levels for the frame
+	if frame.config.LogLevel != "" {
+		level, err := logging.LogLevel(frame.config.LogLevel)
+		if err != nil {
+			panic(err)
+		}
+		frame.bizlog.SetLevel(level)
+	}
+}
+
+// logFileName returns the bizlog file name of the frame, which is the lowercase name
+// with version, whose characters other than letters, digits, '.', '-' and '_' are replaced with '_'.
+func (frame *Framework) logFileName() string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', '0' <= r && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, strings.ToLower(frame.NameWithVersion())) + ".log"
 }
 
-func (global *GlobalVariables) newLogger(module string, consoleFormatString, fileFormatString string) *logging.Logger {
+func (global *GlobalVariables) newLogger(module string, consoleFormatString, fileFormatString string, fileBackend *logging.FileBackend) *logging.Logger {
 	consoleLevel, err := logging.LogLevel(global.config.Log.ConsoleLevel)
 	if err != nil {
 		panic(err)
@@ -125,6 +176,9 @@ func (global *GlobalVariables) newLogger(module string, consoleFormatString, fil
 	}
 	consoleFormat := logging.MustStringFormatter(consoleFormatString)
 	fileFormat := logging.MustStringFormatter(fileFormatString)
+	if global.config.Log.FileJSON {
+		fileFormat = logging.JSONFormatter{}
+	}
 	backends := []logging.Backend{}
 
 	if global.config.Log.ConsoleEnable {
@@ -0,0 +1,131 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Field is a key-value pair carried by the logger and attached to each record.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// WithFields returns a new logger which shares the backend with l,
+// carrying the fields of l followed by the alternating keys and values,
+// such as `log.WithFields("order_id", id, "user", name)`.
+// A key without value is paired with nil.
+func (l *Logger) WithFields(keyvals ...interface{}) *Logger {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	fields := make([]Field, len(l.fields), len(l.fields)+(len(keyvals)+1)/2)
+	copy(fields, l.fields)
+	for i := 0; i < len(keyvals); i += 2 {
+		f := Field{Key: fmt.Sprint(keyvals[i])}
+		if i+1 < len(keyvals) {
+			f.Value = keyvals[i+1]
+		}
+		fields = append(fields, f)
+	}
+	return &Logger{
+		Module:         l.Module,
+		backend:        l.backend,
+		haveBackend:    l.haveBackend,
+		ExtraCalldepth: l.ExtraCalldepth,
+		status:         l.status,
+		fields:         fields,
+	}
+}
+
+// Fields returns the fields carried by the logger.
+func (l *Logger) Fields() []Field {
+	return l.fields
+}
+
+// writeFieldsText writes the fields as ` key=value` pairs,
+// quoting the values containing spaces, quotes or equal signs.
+func writeFieldsText(w io.Writer, fields []Field) {
+	var buf bytes.Buffer
+	for _, f := range fields {
+		buf.WriteByte(' ')
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+		v := fmt.Sprint(f.Value)
+		if v == "" || strings.ContainsAny(v, " \t\r\n\"=") {
+			v = strconv.Quote(v)
+		}
+		buf.WriteString(v)
+	}
+	w.Write(buf.Bytes())
+}
+
+// JSONFormatter formats the records as JSON objects with the time, level,
+// module, message and file keys, followed by the fields as keys.
+type JSONFormatter struct {
+	// TimeLayout is the layout of the time, RFC3339 with milliseconds by default.
+	TimeLayout string
+}
+
+// Format implements the Formatter interface.
+func (f JSONFormatter) Format(calldepth int, colorful bool, r *Record, output io.Writer) error {
+	layout := f.TimeLayout
+	if layout == "" {
+		layout = rfc3339Milli
+	}
+	_, file, line, ok := runtime.Caller(calldepth + 1)
+	if !ok {
+		file = "???"
+		line = 0
+	} else if idx := strings.Index(file, "/src/"); idx >= 0 {
+		file = file[idx+5:]
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	writeJSONKey(&buf, "time", r.Time.Format(layout), true)
+	writeJSONKey(&buf, "level", r.Level.String(), false)
+	writeJSONKey(&buf, "module", r.Module, false)
+	writeJSONKey(&buf, "message", r.Message(), false)
+	writeJSONKey(&buf, "file", file+":"+strconv.Itoa(line), false)
+	for _, field := range r.Fields {
+		writeJSONKey(&buf, field.Key, field.Value, false)
+	}
+	buf.WriteByte('}')
+	_, err := output.Write(buf.Bytes())
+	return err
+}
+
+func writeJSONKey(buf *bytes.Buffer, key string, value interface{}, first bool) {
+	if !first {
+		buf.WriteByte(',')
+	}
+	k, _ := json.Marshal(key)
+	buf.Write(k)
+	buf.WriteByte(':')
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(v)
+}
@@ -2,12 +2,14 @@ package logging
 
 import (
 	"bytes"
+	"compress/gzip"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -33,9 +35,14 @@ type FileBackend struct {
 
 	// Rotate daily
 	Daily         bool  `json:"daily"`
-	MaxDays       int64 `json:"maxdays"`
+	MaxDays       int64 `json:"maxdays"` // the rotated files older than MaxDays are removed, 0 means not limited
 	dailyOpenDate int
 
+	// The maximum number of the rotated files to retain, 0 means not limited
+	MaxBackups int `json:"maxbackups"`
+	// Compress the rotated files with gzip
+	Compress bool `json:"compress"`
+
 	Rotate bool `json:"rotate"`
 
 	Perm os.FileMode `json:"perm"`
@@ -82,15 +89,7 @@ func NewDefaultFileBackend(filename string, asyncLen ...int) (*FileBackend, erro
 
 // start file logger. create log file and set to locker-inside file writer.
 func (w *FileBackend) startLogger() error {
-	file, err := w.createLogFile()
-	if err != nil {
-		return err
-	}
-	if w.fileWriter != nil {
-		w.fileWriter.Close()
-	}
-	w.fileWriter = file
-	err = w.initFd()
+	err := w.openFile()
 	if err == nil {
 		w.status = 1
 		if w.asyncMsgChan != nil {
@@ -109,9 +108,24 @@ func (w *FileBackend) startLogger() error {
 	return err
 }
 
+// openFile opens the log file and sets it to the file writer.
+func (w *FileBackend) openFile() error {
+	file, err := w.createLogFile()
+	if err != nil {
+		return err
+	}
+	if w.fileWriter != nil {
+		w.fileWriter.Close()
+	}
+	w.fileWriter = file
+	return w.initFd()
+}
+
+// needRotate reports whether the message of the size should be written to a new file,
+// it must be called with the lock held.
 func (w *FileBackend) needRotate(size int, day int) bool {
 	return (w.MaxLines > 0 && w.maxLinesCurLines >= w.MaxLines) ||
-		(w.MaxSize > 0 && w.maxSizeCurSize >= w.MaxSize) ||
+		(w.MaxSize > 0 && w.maxSizeCurSize > 0 && w.maxSizeCurSize+size > w.MaxSize) ||
 		(w.Daily && day != w.dailyOpenDate)
 
 }
@@ -131,15 +145,14 @@ func (w *FileBackend) Log(calldepth int, rec *Record) {
 	}
 	d := rec.Time.Day()
 	if w.Rotate {
+		// the message that triggers the rotation is written to the new file
+		w.Lock()
 		if w.needRotate(len(msg), d) {
-			w.Lock()
-			if w.needRotate(len(msg), d) {
-				if err := w.doRotate(rec.Time); err != nil {
-					fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.Filename, err)
-				}
+			if err := w.doRotate(rec.Time); err != nil {
+				fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.Filename, err)
 			}
-			w.Unlock()
 		}
+		w.Unlock()
 	}
 	if w.asyncMsgChan != nil {
 		w.asyncMsgChan <- msg
@@ -149,6 +162,18 @@ func (w *FileBackend) Log(calldepth int, rec *Record) {
 	w.statusLock.RUnlock()
 }
 
+// RotateNow rotates the log file immediately, such as on SIGHUP from logrotate.
+func (w *FileBackend) RotateNow() error {
+	w.statusLock.RLock()
+	defer w.statusLock.RUnlock()
+	if w.status == 0 {
+		return errors.New("FileBackend is closed")
+	}
+	w.Lock()
+	defer w.Unlock()
+	return w.doRotate(time.Now())
+}
+
 // Close close the file description, close file writer.
 // Flush waits until all records in the buffered channel have been processed,
 // and flushs file logger.
@@ -253,11 +278,11 @@ func (w *FileBackend) doRotate(logTime time.Time) error {
 	if w.MaxLines > 0 || w.MaxSize > 0 {
 		for ; err == nil && num <= 999; num++ {
 			fName = w.fileNameOnly + fmt.Sprintf(".%s.%03d%s", logTime.Format("2006-01-02"), num, w.suffix)
-			_, err = os.Lstat(fName)
+			err = lstatRotated(fName)
 		}
 	} else {
 		fName = fmt.Sprintf("%s.%s%s", w.fileNameOnly, logTime.Format("2006-01-02"), w.suffix)
-		_, err = os.Lstat(fName)
+		err = lstatRotated(fName)
 	}
 	// return error if the last file checked still existed
 	if err == nil {
@@ -270,9 +295,16 @@ func (w *FileBackend) doRotate(logTime time.Time) error {
 	// Rename the file to its new found name
 	// even if occurs error,we MUST guarantee to  restart new logger
 	renameErr := os.Rename(w.Filename, fName)
-	// re-start logger
-	startLoggerErr := w.startLogger()
-	go w.deleteOldLog()
+	// re-open the file, the asynchronous writer keeps running
+	startLoggerErr := w.openFile()
+	go func() {
+		if renameErr == nil && w.Compress {
+			if err := compressFile(fName); err != nil {
+				fmt.Fprintf(os.Stderr, "FileLogWriter(%q): compress: %s\n", fName, err)
+			}
+		}
+		w.deleteOldLog()
+	}()
 
 	if startLoggerErr != nil {
 		return fmt.Errorf("Rotate StartLogger: %s\n", startLoggerErr)
@@ -284,21 +316,84 @@ func (w *FileBackend) doRotate(logTime time.Time) error {
 
 }
 
+// lstatRotated returns nil if the rotated file or its compressed one exists.
+func lstatRotated(name string) error {
+	_, err := os.Lstat(name)
+	if err != nil {
+		_, err = os.Lstat(name + ".gz")
+	}
+	return err
+}
+
+// compressFile compresses the file to name.gz and removes it.
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if err2 := dst.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	os.Chtimes(name+".gz", info.ModTime(), info.ModTime())
+	return os.Remove(name)
+}
+
+// deleteOldLog removes the rotated files older than MaxDays, and the oldest ones beyond MaxBackups.
 func (w *FileBackend) deleteOldLog() {
 	dir := filepath.Dir(w.Filename)
+	prefix := filepath.Base(w.fileNameOnly) + "."
+	var backups []os.FileInfo
 	filepath.Walk(dir, func(path string, info os.FileInfo, err error) (returnErr error) {
 		defer func() {
 			if r := recover(); r != nil {
 				fmt.Fprintf(os.Stderr, "Unable to delete old log '%s', error: %v\n", path, r)
 			}
 		}()
-
-		if !info.IsDir() && info.ModTime().Unix() < (time.Now().Unix()-60*60*24*w.MaxDays) {
-			if strings.HasPrefix(filepath.Base(path), w.fileNameOnly) &&
-				strings.HasSuffix(filepath.Base(path), w.suffix) {
-				os.Remove(path)
+		if err != nil || info.IsDir() {
+			if info != nil && info.IsDir() && path != dir {
+				return filepath.SkipDir
 			}
+			return
 		}
+		base := filepath.Base(path)
+		if base == filepath.Base(w.Filename) || !strings.HasPrefix(base, prefix) ||
+			!(strings.HasSuffix(base, w.suffix) || strings.HasSuffix(base, w.suffix+".gz")) {
+			return
+		}
+		if w.MaxDays > 0 && info.ModTime().Unix() < (time.Now().Unix()-60*60*24*w.MaxDays) {
+			os.Remove(path)
+			return
+		}
+		backups = append(backups, info)
 		return
 	})
+	if w.MaxBackups <= 0 || len(backups) <= w.MaxBackups {
+		return
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].ModTime().Equal(backups[j].ModTime()) {
+			return backups[i].ModTime().After(backups[j].ModTime())
+		}
+		return backups[i].Name() > backups[j].Name()
+	})
+	for _, info := range backups[w.MaxBackups:] {
+		os.Remove(filepath.Join(dir, info.Name()))
+	}
 }
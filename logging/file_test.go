@@ -2,9 +2,15 @@ package logging
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -196,3 +202,81 @@ func BenchmarkFileOnGoroutine(b *testing.B) {
 	fileBackend.Close()
 	os.Remove("test4.log")
 }
+
+func TestFileRotateBySize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faygo-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "rotate.log")
+	fileBackend, err := NewDefaultFileBackend(filename, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileBackend.MaxSize = 1024
+	fileBackend.Compress = true
+	log := NewLogger("TestFileRotate")
+	log.SetBackend(AddModuleLevel(NewBackendFormatter(fileBackend, MustStringFormatter(`%{message}`))))
+
+	const goroutines, lines = 8, 100
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < lines; j++ {
+				log.Infof("goroutine %d line %d", i, j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err = fileBackend.RotateNow(); err != nil {
+		t.Fatal(err)
+	}
+	log.Info("after rotate")
+	log.Close()
+	// wait for the background compression
+	time.Sleep(200 * time.Millisecond)
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) < 3 {
+		t.Fatalf("expect rotated files, got %d files", len(infos))
+	}
+	var count int
+	for _, info := range infos {
+		b, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(info.Name(), ".gz") {
+			zr, err := gzip.NewReader(bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b, err = ioutil.ReadAll(zr); err != nil {
+				t.Fatal(err)
+			}
+		} else if info.Name() != "rotate.log" {
+			t.Fatalf("rotated file %q is not compressed", info.Name())
+		}
+		count += bytes.Count(b, []byte("\n"))
+	}
+	if count != goroutines*lines+1 {
+		t.Fatalf("expect %d lines, got %d", goroutines*lines+1, count)
+	}
+
+	fileBackend, err = NewDefaultFileBackend(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fileBackend.Close()
+	fileBackend.MaxBackups = 2
+	fileBackend.deleteOldLog()
+	if infos, _ = ioutil.ReadDir(dir); len(infos) != 3 {
+		t.Fatalf("expect 2 backups and the current file, got %d files", len(infos))
+	}
+}
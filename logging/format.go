@@ -304,8 +304,14 @@ func (f *stringFormatter) Format(calldepth int, colorful bool, r *Record, output
 				v = r.Module
 				break
 			case fmtVerbMessage:
-				v = r.Message()
-				break
+				if len(r.Fields) == 0 {
+					v = r.Message()
+					break
+				}
+				var buf bytes.Buffer
+				buf.WriteString(r.Message())
+				writeFieldsText(&buf, r.Fields)
+				v = buf.String()
 			case fmtVerbLongfile, fmtVerbShortfile:
 				_, file, line, ok := runtime.Caller(calldepth + 1)
 				if !ok {
@@ -47,6 +47,7 @@ type Record struct {
 	Module string
 	Level  Level
 	Args   []interface{}
+	Fields []Field
 
 	// message is kept as a pointer to have shallow copies update this once
 	// needed.
@@ -108,6 +109,7 @@ type Logger struct {
 
 	status int8 // 0:close 1:run
 	lock   sync.RWMutex
+	fields []Field
 }
 
 // NewLogger creates and returns a Logger object based on the module name.
@@ -118,6 +120,21 @@ func NewLogger(module string) *Logger {
 	}
 }
 
+// WithModule returns a new logger with the module name, which shares the backend with l.
+// Note: closing either of them closes the shared backend.
+func (l *Logger) WithModule(module string) *Logger {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return &Logger{
+		Module:         module,
+		backend:        l.backend,
+		haveBackend:    l.haveBackend,
+		ExtraCalldepth: l.ExtraCalldepth,
+		status:         l.status,
+		fields:         l.fields,
+	}
+}
+
 // Reset restores the internal state of the logging library.
 func Reset() {
 	// TODO make a global Init() method to be less magic? or make it such that
@@ -136,8 +153,19 @@ func (l *Logger) SetBackend(backend LeveledBackend) {
 	l.haveBackend = true
 }
 
+// SetLevel sets the default level of the backend set by SetBackend,
+// which also applies to the loggers sharing the backend, such as the ones created by WithModule.
+func (l *Logger) SetLevel(level Level) {
+	if l.haveBackend {
+		l.backend.SetLevel(level, "")
+	}
+}
+
 // IsEnabledFor returns true if the logger is enabled for the given level.
 func (l *Logger) IsEnabledFor(level Level) bool {
+	if l.haveBackend {
+		return l.backend.IsEnabledFor(level, l.Module)
+	}
 	return defaultBackend.IsEnabledFor(level, l.Module)
 }
 
@@ -169,7 +197,9 @@ func (l *Logger) log(lvl Level, format *string, args ...interface{}) {
 		record.Time = timeNow()
 		record.Module = l.Module
 		record.Level = lvl
-		record.Args = args
+		// copy the args so that they do not escape when the level is disabled
+		record.Args = append([]interface{}(nil), args...)
+		record.Fields = l.fields
 		record.fmt = format
 
 		record.formatter = nil
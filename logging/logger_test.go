@@ -4,7 +4,11 @@
 
 package logging
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
 
 type Password string
 
@@ -60,3 +64,63 @@ func TestPrivateBackend(t *testing.T) {
 		t.Error("logged to defaultBackend:", MemoryRecordN(privateBackend, 0))
 	}
 }
+
+func TestWithFields(t *testing.T) {
+	backend := InitForTesting(DEBUG)
+	log := NewLogger("test").WithFields("request_id", "r1")
+	order := log.WithFields("order_id", 42, "note", "two words")
+	order.Info("charged")
+	if s := MemoryRecordN(backend, 0).Formatted(0, false); s != `charged request_id=r1 order_id=42 note="two words"` {
+		t.Errorf("fields line: %v", s)
+	}
+	log.Info("plain")
+	if s := MemoryRecordN(backend, 1).Formatted(0, false); s != "plain request_id=r1" {
+		t.Errorf("the parent logger should not inherit the child fields: %v", s)
+	}
+	if len(order.WithModule("other").Fields()) != 3 {
+		t.Error("WithModule should keep the fields")
+	}
+}
+
+func TestJSONFormatter(t *testing.T) {
+	log := NewLogger("test").WithFields("order_id", 42, "err", errTest("failed"))
+	backend := NewMemoryBackend(1)
+	lvlBackend := AddModuleLevel(NewBackendFormatter(backend, JSONFormatter{}))
+	log.SetBackend(lvlBackend)
+	log.Warning("charged")
+	var buf bytes.Buffer
+	rec := MemoryRecordN(backend, 0)
+	buf.WriteString(rec.Formatted(0, false))
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("%v: %s", err, buf.String())
+	}
+	if m["message"] != "charged" || m["level"] != "WARNING" || m["module"] != "test" || m["order_id"] != float64(42) || m["err"] != "failed" {
+		t.Errorf("unexpected JSON record: %s", buf.String())
+	}
+}
+
+type errTest string
+
+func (e errTest) Error() string { return string(e) }
+
+func TestDisabledLevelNoAlloc(t *testing.T) {
+	log := NewLogger("test").WithFields("request_id", "r1")
+	lvlBackend := AddModuleLevel(NewMemoryBackend(1))
+	lvlBackend.SetLevel(INFO, "")
+	log.SetBackend(lvlBackend)
+	if n := testing.AllocsPerRun(100, func() { log.Debug("hidden") }); n != 0 {
+		t.Errorf("logging below the enabled level allocates %v times", n)
+	}
+}
+
+func BenchmarkWithFieldsDisabled(b *testing.B) {
+	log := NewLogger("test").WithFields("request_id", "r1", "route", "/users/:id")
+	lvlBackend := AddModuleLevel(NewMemoryBackend(1))
+	lvlBackend.SetLevel(INFO, "")
+	log.SetBackend(lvlBackend)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		log.Debug("hidden")
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"golang.org/x/crypto/acme"
+)
+
+// the policies of the config item `tls_client_auth`
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                   tls.RequireAndVerifyClientCert,
+	"require_and_verify": tls.RequireAndVerifyClientCert,
+	"verify_if_given":    tls.VerifyClientCertIfGiven,
+	"require":            tls.RequireAnyClientCert,
+	"request":            tls.RequestClientCert,
+}
+
+const __clientAuthTypes__ = "require_and_verify | verify_if_given | require | request"
+
+// SetClientCAs sets the CA pool to verify the TLS client certificates (mTLS) of the https
+// and letsencrypt listeners, and the policy, such as tls.RequireAndVerifyClientCert,
+// overriding the config items `tls_client_cafile` and `tls_client_auth`.
+// The connection failing the verification is rejected during the TLS handshake,
+// and the verified certificate is returned by Context.ClientCert.
+// The listener added by AddListener with the ClientCAs in its TLSConfig keeps its own.
+// It returns ErrFrameRunning if the frame is running.
+func (frame *Framework) SetClientCAs(pool *x509.CertPool, clientAuth tls.ClientAuthType) error {
+	frame.lock.Lock()
+	defer frame.lock.Unlock()
+	if frame.running {
+		return ErrFrameRunning
+	}
+	frame.clientCAs = pool
+	frame.clientAuth = clientAuth
+	return nil
+}
+
+// clientAuthType returns the policy of the TLS client certificates set by SetClientCAs or the config.
+func (frame *Framework) clientAuthType() tls.ClientAuthType {
+	if frame.clientCAs != nil {
+		return frame.clientAuth
+	}
+	return clientAuthTypes[frame.config.TLSClientAuth]
+}
+
+// ClientCert returns the TLS client certificate verified by the CA pool of SetClientCAs
+// or the config item `tls_client_cafile`, such as ctx.ClientCert().Subject.CommonName,
+// or nil if the request is not over TLS or no certificate is verified.
+func (ctx *Context) ClientCert() *x509.Certificate {
+	if ctx.R.TLS == nil || len(ctx.R.TLS.VerifiedChains) == 0 || len(ctx.R.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return ctx.R.TLS.VerifiedChains[0][0]
+}
+
+// setClientAuth sets the CA pool and the policy of the TLS client certificates to the TLS config,
+// unless it has the ClientCAs of its own.
+func (server *Server) setClientAuth(tlsConfig *tls.Config) error {
+	if tlsConfig.ClientCAs != nil {
+		return nil
+	}
+	pool := server.clientCAs
+	if pool == nil {
+		if server.clientCAFile == "" {
+			return nil
+		}
+		b, err := ioutil.ReadFile(server.clientCAFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return fmt.Errorf("no certificate is found in the client CA file %s", server.clientCAFile)
+		}
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = server.clientAuth
+	return nil
+}
+
+// acmeWithoutClientAuth lets the TLS-ALPN challenges of Let's Encrypt pass the client certificate
+// authentication, since the validation servers present no client certificate.
+func acmeWithoutClientAuth(tlsConfig *tls.Config) {
+	if tlsConfig.ClientAuth == tls.NoClientCert || tlsConfig.GetConfigForClient != nil {
+		return
+	}
+	acmeConfig := tlsConfig.Clone()
+	acmeConfig.ClientAuth = tls.NoClientCert
+	acmeConfig.ClientCAs = nil
+	acmeConfig.NextProtos = []string{acme.ALPNProto}
+	tlsConfig.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == acme.ALPNProto {
+			return acmeConfig, nil
+		}
+		return nil, nil
+	}
+}
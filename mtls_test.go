@@ -0,0 +1,155 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestCert creates a certificate signed by the parent, or a self-signed CA if parent is nil.
+func newTestCert(t *testing.T, cn string, parent *tls.Certificate, client bool) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	signer, signerKey := tmpl, interface{}(key)
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		tmpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		if client {
+			tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestClientCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faygo_mtls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCert(t, "test ca", nil, false)
+	otherCA := newTestCert(t, "other ca", nil, false)
+	caFile := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]}), 0644)
+
+	frame := newTestFrame(t, "client_cert_test")
+	addr := freeAddr(t)
+	frame.config.NetTypes = nil
+	frame.config.Addrs = nil
+	frame.config.TLSClientCAFile = caFile
+	frame.AddListener(Listener{
+		NetType:   NETTYPE_HTTPS,
+		Addr:      addr,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{newTestCert(t, "server", &ca, false)}},
+	})
+	frame.GET("/", HandlerFunc(func(ctx *Context) error {
+		if cert := ctx.ClientCert(); cert != nil {
+			return ctx.String(200, cert.Subject.CommonName)
+		}
+		return ctx.String(200, "anonymous")
+	}))
+	if err := frame.run(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		frame.shutdown(ctx)
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+	get := func(certs ...tls.Certificate) (string, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+		defer client.CloseIdleConnections()
+		resp, err := client.Get("https://" + addr + "/")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		return string(b), err
+	}
+	if body, err := get(newTestCert(t, "billing-service", &ca, true)); err != nil || body != "billing-service" {
+		t.Fatalf("verified client: got %q, %v", body, err)
+	}
+	if body, err := get(); err == nil {
+		t.Fatalf("no client certificate: got %q", body)
+	}
+	if body, err := get(newTestCert(t, "intruder", &otherCA, true)); err == nil {
+		t.Fatalf("untrusted client certificate: got %q", body)
+	}
+}
+
+func TestSetClientCAs(t *testing.T) {
+	ca := newTestCert(t, "test ca", nil, false)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	frame := newTestFrame(t, "set_client_cas_test")
+	frame.config.TLSClientCAFile = "not-exist.pem"
+	if err := frame.SetClientCAs(pool, tls.VerifyClientCertIfGiven); err != nil {
+		t.Fatal(err)
+	}
+	srv := frame.newServers()[0]
+	tlsConfig := srv.newTLSConfig()
+	if err := srv.setClientAuth(tlsConfig); err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.ClientCAs != pool || tlsConfig.ClientAuth != tls.VerifyClientCertIfGiven {
+		t.Fatalf("got %v, %v", tlsConfig.ClientCAs, tlsConfig.ClientAuth)
+	}
+	// letsencrypt still passes the TLS-ALPN challenges
+	acmeWithoutClientAuth(tlsConfig)
+	conf, _ := tlsConfig.GetConfigForClient(&tls.ClientHelloInfo{SupportedProtos: []string{"acme-tls/1"}})
+	if conf == nil || conf.ClientAuth != tls.NoClientCert {
+		t.Fatalf("acme config: got %v", conf)
+	}
+	if conf, _ = tlsConfig.GetConfigForClient(&tls.ClientHelloInfo{SupportedProtos: []string{"h2"}}); conf != nil {
+		t.Fatal("the other connections should use the client certificate authentication")
+	}
+}
@@ -76,6 +76,11 @@ type (
 		parent     *MuxAPI
 		children   []*MuxAPI
 		frame      *Framework
+		fs         FileSystem // file system of the static route
+		websocket  bool
+		version    string // API version of the route, see Version
+		// constraints of the path params, such as `{id:int}`
+		constraints []pathParamConstraint
 	}
 	// Methodset is the methods string of request
 	Methodset string
@@ -120,6 +125,10 @@ func newMuxAPI(frame *Framework, name string, methodset Methodset, pattern strin
 //  PUT
 //  TRACE
 //  "*"——CONNECT/DELETE/GET/HEAD/OPTIONS/PATCH/POST/PUT/TRACE
+// The nonstandard methods, such as PURGE, must be separated from others by space, ',', '|' or ';',
+// e.g. "GET|PURGE".
+// The other tokens, such as "GET/POST", are matched with the common methods they contain as before,
+// and it panics if such a token contains none of them and is not a valid method.
 func (m *Methodset) Methods() []string {
 	s := strings.ToUpper(string(*m))
 	if strings.Contains(s, "*") {
@@ -127,15 +136,81 @@ func (m *Methodset) Methods() []string {
 		copy(methods, RESTfulMethodList)
 		return methods
 	}
+	tokens := strings.FieldsFunc(s, isMethodSeparator)
+	var known []string
+	var custom []string
+	for _, token := range tokens {
+		switch {
+		case isRESTfulMethods(token):
+			known = append(known, token)
+		case isLetters(token):
+			custom = append(custom, token)
+		default:
+			if !containsRESTfulMethod(token) {
+				if !isValidMethod(token) {
+					Panicf("invalid method: %q", token)
+				}
+				custom = append(custom, token)
+				continue
+			}
+			known = append(known, token)
+		}
+	}
 	methods := []string{}
 	for _, method := range RESTfulMethodList {
-		if strings.Contains(s, method) {
+		for _, token := range known {
+			if strings.Contains(token, method) {
+				methods = append(methods, method)
+				break
+			}
+		}
+	}
+	sort.Strings(custom)
+	for i, method := range custom {
+		if i == 0 || method != custom[i-1] {
 			methods = append(methods, method)
 		}
 	}
 	return methods
 }
 
+func isMethodSeparator(r rune) bool {
+	return r == ' ' || r == ',' || r == '|' || r == ';' || r == '\t'
+}
+
+// containsRESTfulMethod returns whether the token contains any of the RESTful methods.
+func containsRESTfulMethod(token string) bool {
+	for _, method := range RESTfulMethodList {
+		if strings.Contains(token, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLetters returns whether the token consists of the letters only, such as "PROPPATCH".
+func isLetters(token string) bool {
+	for i := 0; i < len(token); i++ {
+		if c := token[i]; c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// isRESTfulMethods returns whether the token consists of the RESTful methods, such as "GETPOST".
+func isRESTfulMethods(token string) bool {
+	if token == "" {
+		return true
+	}
+	for _, method := range RESTfulMethodList {
+		if strings.HasPrefix(token, method) && isRESTfulMethods(token[len(method):]) {
+			return true
+		}
+	}
+	return false
+}
+
 // HasMethod checks whether the specified method exists or not.
 func (mux *MuxAPI) HasMethod(method string) bool {
 	method = strings.ToUpper(method)
@@ -186,6 +261,36 @@ func (mux *MuxAPI) NamedAPI(name string, methodset Methodset, pattern string, ha
 	return child
 }
 
+// Handle adds a subordinate node of the single method to the current muxAPI grouping node.
+// The method can be any valid HTTP method, including the nonstandard ones such as PURGE.
+// notes: handler cannot be nil.
+func (mux *MuxAPI) Handle(method string, pattern string, handlers ...Handler) *MuxAPI {
+	return mux.NamedHandle("", method, pattern, handlers...)
+}
+
+// NamedHandle adds a subordinate node of the single method with the name to the current muxAPI grouping node.
+// notes: handler cannot be nil.
+func (mux *MuxAPI) NamedHandle(name string, method string, pattern string, handlers ...Handler) *MuxAPI {
+	if !isValidMethod(method) {
+		mux.frame.Log().Panicf("invalid method: %q\n", method)
+	}
+	return mux.NamedAPI(name, Methodset(method), pattern, handlers...)
+}
+
+// isValidMethod returns whether the method is a token of RFC 7230.
+func isValidMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+	for i := 0; i < len(method); i++ {
+		c := method[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte("\"(),/:;<=>?@[\\]{}*|", c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // GET is a shortcut for muxAPI.API("GET", pattern, handlers...)
 func (mux *MuxAPI) GET(pattern string, handlers ...Handler) *MuxAPI {
 	return mux.API("GET", pattern, handlers...)
@@ -283,7 +388,9 @@ func (mux *MuxAPI) NamedStaticFS(name, pattern string, fs FileSystem) *MuxAPI {
 			return fileServer.Serve(ctx)
 		})
 	}(global.fsManager.FileServer(fs))
-	return mux.NamedAPI(name, "GET", pattern, handler)
+	mux = mux.NamedAPI(name, "GET", pattern, handler)
+	mux.fs = fs
+	return mux
 }
 
 // StaticFS is similar to NamedStaticFS, but no name.
@@ -302,6 +409,32 @@ func (mux *MuxAPI) Static(pattern string, root string, nocompressAndNocache ...b
 	return mux.NamedStatic(root, pattern, root, nocompressAndNocache...)
 }
 
+// CacheRules sets the Cache-Control of the files served by the static route by the rules
+// in the form "pattern: value", evaluated in order with the first match winning, for example:
+//
+//	frame.Static("/static", "./static/").CacheRules(
+//		"*.html: no-cache",
+//		"*.woff2: max-age=31536000, immutable",
+//		"img/**: max-age=86400",
+//	)
+//
+// The files matching no rule use the default rule of the content hash URL.
+// See StaticCacheControl for the patterns and the rules setting the additional headers.
+func (mux *MuxAPI) CacheRules(rules ...string) *MuxAPI {
+	parsed := make([]CacheControlRule, len(rules))
+	for i, rule := range rules {
+		idx := strings.Index(rule, ":")
+		if idx < 0 {
+			mux.frame.Log().Panicf("CacheRules: invalid rule %q, want \"pattern: value\"\n", rule)
+		}
+		parsed[i] = CacheControlRule{
+			Pattern:      strings.TrimSpace(rule[:idx]),
+			CacheControl: strings.TrimSpace(rule[idx+1:]),
+		}
+	}
+	return mux.Use(StaticCacheControl(parsed...))
+}
+
 // Use inserts the middlewares at the left end of the node's handler chain.
 // notes: handler cannot be nil.
 func (mux *MuxAPI) Use(handlers ...Handler) *MuxAPI {
@@ -370,9 +503,14 @@ func (mux *MuxAPI) comb() {
 		mux.handlers[i] = h
 	}
 
-	mux.path = mux.pattern
+	var err error
+	mux.path, mux.constraints, err = parsePathConstraints(mux.pattern)
+	if err != nil {
+		mux.frame.Log().Panicf("%s\n", err.Error())
+	}
 	if mux.parent != nil {
 		mux.path = path.Join(mux.parent.path, mux.path)
+		mux.constraints = append(append([]pathParamConstraint{}, mux.parent.constraints...), mux.constraints...)
 		mux.notes = append(mux.parent.notes, mux.notes...)
 		mux.paramInfos = append(mux.parent.paramInfos, mux.paramInfos...)
 		mux.handlers = append(mux.parent.handlers, mux.handlers...)
@@ -0,0 +1,276 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RenderOffer is the offer of Negotiate, which is rendered by the pongo2 render.
+type RenderOffer struct {
+	Name string // template file name
+	Data Map
+}
+
+// qualityValue is an item of the header value with quality, such as `text/html;q=0.8`.
+type qualityValue struct {
+	value string
+	q     float64
+}
+
+// parseQualityValues parses the header value with quality, such as Accept and Accept-Language,
+// the items are sorted by quality in descending order.
+func parseQualityValues(header string) []qualityValue {
+	var specs []qualityValue
+	for _, item := range strings.Split(header, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		spec := qualityValue{q: 1}
+		params := strings.Split(item, ";")
+		spec.value = strings.ToLower(strings.TrimSpace(params[0]))
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if len(param) > 2 && (param[0] == 'q' || param[0] == 'Q') && param[1] == '=' {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					spec.q = q
+				}
+			}
+		}
+		specs = append(specs, spec)
+	}
+	sort.SliceStable(specs, func(i, j int) bool {
+		return specs[i].q > specs[j].q
+	})
+	return specs
+}
+
+// acceptQuality returns the quality of the media type by the most specific matching range.
+func acceptQuality(specs []qualityValue, mediaType string) float64 {
+	var q float64 = -1
+	var precision = -1
+	slash := strings.IndexByte(mediaType, '/')
+	for _, spec := range specs {
+		var p int
+		switch {
+		case spec.value == mediaType:
+			p = 2
+		case slash != -1 && spec.value == mediaType[:slash]+"/*":
+			p = 1
+		case spec.value == "*/*":
+			p = 0
+		default:
+			continue
+		}
+		if p > precision {
+			precision = p
+			q = spec.q
+		}
+	}
+	return q
+}
+
+// negotiatePriority is the preferred order when the qualities are equal.
+var negotiatePriority = []string{
+	MIMEApplicationJSON,
+	MIMETextHTML,
+	MIMEApplicationXML,
+	MIMETextXML,
+	MIMETextPlain,
+}
+
+// NegotiateType returns the offered MIME type that best matches the Accept header,
+// returns "" if none is acceptable.
+// If the Accept header is empty, all MIME types are acceptable.
+func (ctx *Context) NegotiateType(offers ...string) string {
+	accept := ctx.HeaderParam(HeaderAccept)
+	if accept == "" {
+		accept = "*/*"
+	}
+	specs := parseQualityValues(accept)
+	var best string
+	var bestQ float64
+	for _, offer := range offers {
+		if q := acceptQuality(specs, strings.ToLower(offer)); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// Accepts returns the offered MIME type that best matches the Accept header,
+// returns "" if none is acceptable. It is the same as NegotiateType.
+func (ctx *Context) Accepts(offers ...string) string {
+	return ctx.NegotiateType(offers...)
+}
+
+// NegotiateSpec is the spec of NegotiateFormat.
+type NegotiateSpec struct {
+	// Data to be sent
+	Data interface{}
+	// HTMLTemplate is the name of the template that renders the Data as HTML,
+	// the Data is passed to the template as is if it is a Map, otherwise as `Data`.
+	// If empty, HTML is not offered.
+	HTMLTemplate string
+	// Offered formats in the preferred order: json, xml, html, text, protobuf,
+	// default to json, xml, html (if HTMLTemplate is set) and text.
+	// The protobuf format requires the Data to be a ProtoMessage.
+	Offers []string
+	// If true, replies in the first offered format when no offer is acceptable, otherwise replies 406.
+	FallbackToFirst bool
+}
+
+// negotiateFormats maps the format names of NegotiateSpec to the MIME types.
+var negotiateFormats = map[string]string{
+	"json":     MIMEApplicationJSON,
+	"xml":      MIMEApplicationXML,
+	"html":     MIMETextHTML,
+	"text":     MIMETextPlain,
+	"protobuf": MIMEApplicationXProtobuf,
+}
+
+// NegotiateFormat replies the Data of the spec in the format that best matches the client's Accept header,
+// with the JSON, XML, Render or String helper.
+func (ctx *Context) NegotiateFormat(status int, spec NegotiateSpec) error {
+	formats := spec.Offers
+	if len(formats) == 0 {
+		formats = []string{"json", "xml", "html", "text"}
+	}
+	offers := make([]string, 0, len(formats))
+	for _, format := range formats {
+		mediaType, ok := negotiateFormats[strings.ToLower(format)]
+		if !ok {
+			return fmt.Errorf("NegotiateFormat: unsupported format %q", format)
+		}
+		if mediaType == MIMETextHTML && spec.HTMLTemplate == "" {
+			continue
+		}
+		if mediaType == MIMEApplicationXProtobuf {
+			if _, ok := spec.Data.(ProtoMessage); !ok {
+				return errors.New("NegotiateFormat: the protobuf format requires the Data to be a ProtoMessage")
+			}
+		}
+		offers = append(offers, mediaType)
+	}
+	if len(offers) == 0 {
+		return errors.New("NegotiateFormat: no format is offered")
+	}
+
+	ctx.W.Header().Add(HeaderVary, HeaderAccept)
+	mediaType := ctx.NegotiateType(offers...)
+	if mediaType == "" {
+		if !spec.FallbackToFirst {
+			ctx.Error(http.StatusNotAcceptable, http.StatusText(http.StatusNotAcceptable))
+			return nil
+		}
+		mediaType = offers[0]
+	}
+	switch mediaType {
+	case MIMEApplicationJSON:
+		return ctx.JSON(status, spec.Data)
+	case MIMEApplicationXML:
+		return ctx.XML(status, spec.Data)
+	case MIMETextHTML:
+		data, ok := spec.Data.(Map)
+		if !ok {
+			data = Map{"Data": spec.Data}
+		}
+		return ctx.Render(status, spec.HTMLTemplate, data)
+	case MIMEApplicationXProtobuf:
+		return ctx.Protobuf(status, spec.Data.(ProtoMessage))
+	default:
+		return ctx.String(status, "%v", spec.Data)
+	}
+}
+
+// Negotiate replies in the format that best matches the client's Accept header.
+// The keys of offers are MIME types: the offer of application/json is sent as JSON,
+// the offer of application/xml or text/xml is sent as XML,
+// the offer of text/html can be a RenderOffer rendered by the pongo2 render or an HTML string,
+// the offer of application/x-protobuf or application/protobuf can be a ProtoMessage,
+// and the offer of other types must be a string or []byte which is sent as is.
+// If no offer is acceptable, replies 406.
+func (ctx *Context) Negotiate(status int, offers map[string]interface{}) error {
+	types := make([]string, 0, len(offers))
+	for _, t := range negotiatePriority {
+		if _, ok := offers[t]; ok {
+			types = append(types, t)
+		}
+	}
+	var others []string
+	for t := range offers {
+		if !negotiateHasPriority(t) {
+			others = append(others, t)
+		}
+	}
+	sort.Strings(others)
+	types = append(types, others...)
+
+	ctx.W.Header().Add(HeaderVary, HeaderAccept)
+	mediaType := ctx.NegotiateType(types...)
+	if mediaType == "" {
+		ctx.Error(http.StatusNotAcceptable, http.StatusText(http.StatusNotAcceptable))
+		return nil
+	}
+	data := offers[mediaType]
+	switch mediaType {
+	case MIMEApplicationJSON:
+		return ctx.JSON(status, data)
+	case MIMEApplicationXML:
+		return ctx.XML(status, data)
+	case MIMETextXML:
+		b, err := xml.Marshal(data)
+		if err != nil {
+			return err
+		}
+		return ctx.Bytes(status, MIMETextXMLCharsetUTF8, append([]byte(xml.Header), b...))
+	case MIMETextHTML:
+		switch d := data.(type) {
+		case RenderOffer:
+			return ctx.Render(status, d.Name, d.Data)
+		case *RenderOffer:
+			return ctx.Render(status, d.Name, d.Data)
+		case string:
+			return ctx.HTML(status, d)
+		}
+	}
+	switch d := data.(type) {
+	case ProtoMessage:
+		if isProtobufType(mediaType) {
+			return ctx.protobuf(status, mediaType, d)
+		}
+	case []byte:
+		return ctx.Bytes(status, mediaType, d)
+	case string:
+		return ctx.Bytes(status, mediaType, []byte(d))
+	}
+	return fmt.Errorf("Negotiate: unsupported offer type %T for %s", data, mediaType)
+}
+
+func negotiateHasPriority(t string) bool {
+	for _, p := range negotiatePriority {
+		if p == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcceptQuality(t *testing.T) {
+	specs := parseQualityValues("text/html;q=0.8, application/*;q=0.5, application/xml;q=0, */*;q=0.1")
+	cases := []struct {
+		mediaType string
+		q         float64
+	}{
+		{"text/html", 0.8},
+		{"application/json", 0.5},
+		{"application/xml", 0},
+		{"text/plain", 0.1},
+	}
+	for _, c := range cases {
+		if q := acceptQuality(specs, c.mediaType); q != c.q {
+			t.Errorf("acceptQuality(%q) = %v, want %v", c.mediaType, q, c.q)
+		}
+	}
+	if q := acceptQuality(parseQualityValues("text/html"), "application/json"); q >= 0 {
+		t.Errorf("acceptQuality of an unmatched type = %v, want < 0", q)
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	frame := newTestFrame(t, "negotiate_format_test")
+	spec := NegotiateSpec{Data: Map{"a": 1}, Offers: []string{"json", "text"}}
+	frame.GET("/", HandlerFunc(func(ctx *Context) error {
+		return ctx.NegotiateFormat(200, spec)
+	}))
+	cases := []struct {
+		accept, contentType string
+		status              int
+	}{
+		{"", MIMEApplicationJSONCharsetUTF8, 200},
+		{"text/plain, application/json;q=0.5", MIMETextPlainCharsetUTF8, 200},
+		{"text/*;q=0.9, */*;q=0.1", MIMETextPlainCharsetUTF8, 200},
+		{"image/png", "", 406},
+		{";;,q=,text/plain;q=abc;;=,", MIMETextPlainCharsetUTF8, 200},
+		{",,,", "", 406},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(HeaderAccept, c.accept)
+		w := serveTest(frame, req)
+		if w.Code != c.status {
+			t.Errorf("Accept %q: got status %d, want %d", c.accept, w.Code, c.status)
+			continue
+		}
+		if c.contentType != "" && w.Header().Get(HeaderContentType) != c.contentType {
+			t.Errorf("Accept %q: got %q, want %q", c.accept, w.Header().Get(HeaderContentType), c.contentType)
+		}
+	}
+
+	spec.FallbackToFirst = true
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(HeaderAccept, "image/png")
+	if w := serveTest(frame, req); w.Code != 200 || w.Header().Get(HeaderContentType) != MIMEApplicationJSONCharsetUTF8 {
+		t.Errorf("fallback: got %d %q", w.Code, w.Header().Get(HeaderContentType))
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PathConstraint reports whether the value of the path parameter is valid.
+type PathConstraint func(value string) bool
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+var pathConstraints = struct {
+	sync.RWMutex
+	m map[string]PathConstraint
+}{
+	m: map[string]PathConstraint{
+		"int": func(value string) bool {
+			_, err := strconv.ParseInt(value, 10, 64)
+			return err == nil
+		},
+		"uint": func(value string) bool {
+			_, err := strconv.ParseUint(value, 10, 64)
+			return err == nil
+		},
+		"uuid": uuidRegexp.MatchString,
+	},
+}
+
+// RegisterPathConstraint registers the custom constraint type of the path parameters,
+// such as `RegisterPathConstraint("even", isEven)` for the route `/pages/{n:even}`.
+// The built-in types are int, uint and uuid.
+// note: it should be called before Run()
+func RegisterPathConstraint(name string, constraint PathConstraint) {
+	if name == "" || constraint == nil {
+		Panic("RegisterPathConstraint: the name and constraint cannot be empty")
+	}
+	pathConstraints.Lock()
+	pathConstraints.m[name] = constraint
+	pathConstraints.Unlock()
+}
+
+func getPathConstraint(name string) (PathConstraint, bool) {
+	pathConstraints.RLock()
+	defer pathConstraints.RUnlock()
+	c, ok := pathConstraints.m[name]
+	return c, ok
+}
+
+// pathParamConstraint is the constraint of the path parameter.
+type pathParamConstraint struct {
+	key   string
+	check PathConstraint
+}
+
+// parsePathConstraints replaces the constrained path parameters of the pattern,
+// such as `{id:int}`, `{name:uuid}` or `{code:[a-z]{3}}`, with `:id`, `:name` and `:code`,
+// and returns their constraints.
+// The type which is not registered is a regular expression matching the whole value.
+// `{id}` is the same as `:id`.
+func parsePathConstraints(pattern string) (string, []pathParamConstraint, error) {
+	if !strings.Contains(pattern, "{") {
+		return pattern, nil, nil
+	}
+	var (
+		b           strings.Builder
+		constraints []pathParamConstraint
+	)
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '{' {
+			b.WriteByte(pattern[i])
+			continue
+		}
+		if i > 0 && pattern[i-1] != '/' {
+			return "", nil, fmt.Errorf("the path parameter must start a segment in path '%s'", pattern)
+		}
+		// find the matching brace
+		depth, end := 0, -1
+		for j := i; j < len(pattern) && end < 0; j++ {
+			switch pattern[j] {
+			case '{':
+				depth++
+			case '}':
+				if depth--; depth == 0 {
+					end = j
+				}
+			}
+		}
+		if end < 0 {
+			return "", nil, fmt.Errorf("unclosed '{' in path '%s'", pattern)
+		}
+		if end+1 < len(pattern) && pattern[end+1] != '/' {
+			return "", nil, fmt.Errorf("the path parameter must end a segment in path '%s'", pattern)
+		}
+		param := pattern[i+1 : end]
+		key, typ := param, ""
+		if idx := strings.Index(param, ":"); idx >= 0 {
+			key, typ = param[:idx], param[idx+1:]
+		}
+		if key == "" || strings.ContainsAny(key, ":*/") {
+			return "", nil, fmt.Errorf("invalid path parameter name '%s' in path '%s'", key, pattern)
+		}
+		b.WriteString(":" + key)
+		i = end
+		if typ == "" {
+			continue
+		}
+		check, ok := getPathConstraint(typ)
+		if !ok {
+			re, err := regexp.Compile("^(?:" + typ + ")$")
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid constraint of path parameter '%s' in path '%s': %v", key, pattern, err)
+			}
+			check = re.MatchString
+		}
+		constraints = append(constraints, pathParamConstraint{key: key, check: check})
+	}
+	return b.String(), constraints, nil
+}
+
+// checkPathConstraints returns the function checking the path params,
+// or nil if there is no constraint.
+func checkPathConstraints(constraints []pathParamConstraint) func(PathParams) bool {
+	if len(constraints) == 0 {
+		return nil
+	}
+	return func(ps PathParams) bool {
+		for _, c := range constraints {
+			if !c.check(ps.ByName(c.key)) {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"sort"
 )
 
 type TemplateWriter interface {
@@ -191,3 +192,18 @@ func (tpl *Template) Execute(context Context) (string, error) {
 	return buffer.String(), nil
 
 }
+
+// BlockNames returns the names of the blocks defined in the template itself, excluding its parents.
+func (tpl *Template) BlockNames() []string {
+	names := make([]string, 0, len(tpl.blocks))
+	for name := range tpl.blocks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Parent returns the template extended by the template, or nil.
+func (tpl *Template) Parent() *Template {
+	return tpl.parent
+}
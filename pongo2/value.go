@@ -13,6 +13,14 @@ type Value struct {
 	safe bool // used to indicate whether a Value needs explicit escaping in the template
 }
 
+// Trusted is implemented by the values which are already safe in the output
+// context reported by TrustedContext, such as "html", "js" or "url".
+// Only the values trusted in the "html" context skip the 'escape' filter,
+// the others are escaped as usual when output into the HTML.
+type Trusted interface {
+	TrustedContext() string
+}
+
 // AsValue converts any given value to a pongo2.Value
 // Usually being used within own functions passed to a template
 // through a Context or within filter functions.
@@ -40,6 +48,16 @@ func (v *Value) getResolvedValue() reflect.Value {
 	return v.val
 }
 
+// IsTrusted checks whether the underlying value implements Trusted
+// and is trusted in the given output context, such as "html".
+func (v *Value) IsTrusted(context string) bool {
+	if !v.val.IsValid() || !v.val.CanInterface() {
+		return false
+	}
+	t, ok := v.val.Interface().(Trusted)
+	return ok && t.TrustedContext() == context
+}
+
 // Checks whether the underlying value is a string
 func (v *Value) IsString() bool {
 	return v.getResolvedValue().Kind() == reflect.String
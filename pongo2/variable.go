@@ -15,6 +15,7 @@ const (
 var (
 	typeOfValuePtr   = reflect.TypeOf(new(Value))
 	typeOfExecCtxPtr = reflect.TypeOf(new(ExecutionContext))
+	typeOfError      = reflect.TypeOf((*error)(nil)).Elem()
 )
 
 type variablePart struct {
@@ -191,7 +192,7 @@ func (nv *nodeVariable) Execute(ctx *ExecutionContext, writer TemplateWriter) *E
 		return err
 	}
 
-	if !nv.expr.FilterApplied("safe") && !value.safe && value.IsString() && ctx.Autoescape {
+	if !nv.expr.FilterApplied("safe") && !value.safe && value.IsString() && ctx.Autoescape && !value.IsTrusted("html") {
 		// apply escape filter
 		value, err = filters["escape"](value, nil)
 		if err != nil {
@@ -346,9 +347,9 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 						t.NumIn(), vr.String(), len(currArgs))
 			}
 
-			// Output arguments
-			if t.NumOut() != 1 {
-				return nil, fmt.Errorf("'%s' must have exactly 1 output argument", vr.String())
+			// Output arguments, the second one can be an error
+			if t.NumOut() != 1 && (t.NumOut() != 2 || t.Out(1) != typeOfError) {
+				return nil, fmt.Errorf("'%s' must have exactly 1 output argument, or 2 with an error", vr.String())
 			}
 
 			// Evaluate all parameters
@@ -405,7 +406,11 @@ func (vr *variableResolver) resolve(ctx *ExecutionContext) (*Value, error) {
 			}
 
 			// Call it and get first return parameter back
-			rv := current.Call(parameters)[0]
+			results := current.Call(parameters)
+			if len(results) == 2 && !results[1].IsNil() {
+				return nil, results[1].Interface().(error)
+			}
+			rv := results[0]
 
 			if rv.Type() != typeOfValuePtr {
 				current = reflect.ValueOf(rv.Interface())
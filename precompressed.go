@@ -0,0 +1,174 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+// precompressedSiblings are the content encodings and the extensions of the precompressed sibling files,
+// such as app.js.br and app.js.gz, in the preferred order.
+var precompressedSiblings = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// precompressedVariants records the fresh precompressed sibling files of a file.
+type precompressedVariants struct {
+	encodings []string
+	expire    time.Time // zero means no expire
+}
+
+// precompressedFile is the precompressed sibling file served as the original one.
+type precompressedFile struct {
+	http.File
+	fileInfo os.FileInfo
+	etag     string // the entity tag of the encoding, differs from the ones of the other encodings
+}
+
+// Stat returns the name of the original file, and the size of the precompressed one.
+func (f *precompressedFile) Stat() (os.FileInfo, error) {
+	return f.fileInfo, nil
+}
+
+// openPrecompressed opens the precompressed sibling file of name with the best encoding accepted by the client,
+// and sets the Content-Encoding header; ok is false if there is no one.
+func (c *FileServerManager) openPrecompressed(ctx *Context, name string, fs FileSystem, cacheable bool) (f http.File, ok bool) {
+	accept := ctx.R.Header.Get(HeaderAcceptEncoding)
+	if accept == "" {
+		return nil, false
+	}
+	encodings := c.precompressedEncodings(name, fs, cacheable)
+	if len(encodings) == 0 {
+		return nil, false
+	}
+	specs := parseQualityValues(accept)
+	var best string
+	var bestQ float64
+	for _, encoding := range encodings {
+		if q := encodingQuality(specs, encoding); q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	if best == "" {
+		return nil, false
+	}
+	for _, sibling := range precompressedSiblings {
+		if sibling.encoding != best {
+			continue
+		}
+		sf, err := fs.Open(name + sibling.ext)
+		if err != nil {
+			return nil, false
+		}
+		info, err := sf.Stat()
+		if err != nil {
+			sf.Close()
+			return nil, false
+		}
+		ctx.W.Header().Set(HeaderContentEncoding, best)
+		ctx.W.Header().Add(HeaderVary, HeaderAcceptEncoding)
+		return &precompressedFile{
+			File: sf,
+			fileInfo: &FileInfo{
+				name:    path.Base(name),
+				size:    info.Size(),
+				mode:    info.Mode(),
+				modTime: info.ModTime(),
+			},
+			etag: precompressedETag(info, best),
+		}, true
+	}
+	return nil, false
+}
+
+// precompressedETag returns the weak entity tag of the precompressed file with the encoding.
+func precompressedETag(fileInfo os.FileInfo, encoding string) string {
+	return fmt.Sprintf(`W/"%x-%x-%s"`, fileInfo.ModTime().UnixNano(), fileInfo.Size(), encoding)
+}
+
+// encodingQuality returns the quality of the content encoding in the Accept-Encoding header.
+func encodingQuality(specs []qualityValue, encoding string) float64 {
+	var q float64 = -1
+	for _, spec := range specs {
+		if spec.value == encoding {
+			return spec.q
+		}
+		if spec.value == "*" {
+			q = spec.q
+		}
+	}
+	return q
+}
+
+// precompressedEncodings returns the encodings of the fresh precompressed sibling files of name,
+// the result is recorded by the file system and name to avoid the repeated stat calls if cacheable.
+// The sibling file older than the original one is stale, and is ignored with a warning.
+func (c *FileServerManager) precompressedEncodings(name string, fs FileSystem, cacheable bool) []string {
+	scope, ok := c.fsScope(fs)
+	cacheable = cacheable && ok
+	key := scopedName(scope, name)
+	if cacheable {
+		c.precompressedLock.RLock()
+		variants, ok := c.precompressed[key]
+		c.precompressedLock.RUnlock()
+		if ok && (variants.expire.IsZero() || time.Now().Before(variants.expire)) {
+			return variants.encodings
+		}
+	}
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil
+	}
+	info, err := f.Stat()
+	f.Close()
+	if err != nil || info.IsDir() {
+		return nil
+	}
+	var encodings []string
+	for _, sibling := range precompressedSiblings {
+		sf, err := fs.Open(name + sibling.ext)
+		if err != nil {
+			continue
+		}
+		sinfo, err := sf.Stat()
+		sf.Close()
+		if err != nil || sinfo.IsDir() {
+			continue
+		}
+		if sinfo.ModTime().Before(info.ModTime()) {
+			Warningf("[static] the precompressed file %s is older than the original one, compress it dynamically", name+sibling.ext)
+			continue
+		}
+		encodings = append(encodings, sibling.encoding)
+	}
+	if cacheable {
+		variants := precompressedVariants{encodings: encodings}
+		if c.fileExpire > 0 {
+			variants.expire = time.Now().Add(c.fileExpire)
+		}
+		c.precompressedLock.Lock()
+		c.precompressed[key] = variants
+		c.precompressedLock.Unlock()
+	}
+	return encodings
+}
@@ -0,0 +1,128 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/henrylee2cn/faygo/apiware"
+)
+
+// MIMEApplicationXProtobuf is the common alias of MIMEApplicationProtobuf.
+const MIMEApplicationXProtobuf = "application/x-protobuf"
+
+// ProtoMessage is the method set of the generated protobuf messages,
+// such as github.com/golang/protobuf/proto.Message.
+type ProtoMessage interface {
+	Reset()
+	String() string
+	ProtoMessage()
+}
+
+// ProtobufCodec is the protobuf encoder and decoder used by the framework,
+// such as Context.Protobuf, Context.BindProtobuf and ProtobufBodydecoder.
+// Register it to avoid depending on the protobuf package by default.
+//
+//	e.g.
+//	type protoCodec struct{}
+//	func (protoCodec) Marshal(m faygo.ProtoMessage) ([]byte, error) { return proto.Marshal(m) }
+//	func (protoCodec) Unmarshal(b []byte, m faygo.ProtoMessage) error { return proto.Unmarshal(b, m) }
+//	faygo.SetProtobufCodec(protoCodec{})
+type ProtobufCodec interface {
+	Marshal(m ProtoMessage) ([]byte, error)
+	Unmarshal(b []byte, m ProtoMessage) error
+}
+
+var (
+	// ErrNoProtobufCodec is returned when no ProtobufCodec is registered.
+	ErrNoProtobufCodec = errors.New("the ProtobufCodec is not set, please call faygo.SetProtobufCodec()")
+	// ErrNotProtoMessage is returned when the object does not implement ProtoMessage.
+	ErrNotProtoMessage = errors.New("the object is not a ProtoMessage")
+)
+
+// SetProtobufCodec sets the global ProtobufCodec, if codec is nil, the protobuf support is disabled.
+// note: it should be called before Run()
+func SetProtobufCodec(codec ProtobufCodec) {
+	global.protobufCodec = codec
+}
+
+// ProtobufBodydecoder decodes the protobuf request body into the param which implements ProtoMessage.
+// It is used for the `body` param when the request Content-Type is application/x-protobuf or application/protobuf.
+func ProtobufBodydecoder(dest reflect.Value, body []byte) error {
+	if global.protobufCodec == nil {
+		return ErrNoProtobufCodec
+	}
+	var obj interface{}
+	if dest.Kind() == reflect.Ptr {
+		if dest.IsNil() {
+			dest.Set(reflect.New(dest.Type().Elem()))
+		}
+		obj = dest.Interface()
+	} else {
+		obj = dest.Addr().Interface()
+	}
+	msg, ok := obj.(ProtoMessage)
+	if !ok {
+		return ErrNotProtoMessage
+	}
+	return global.protobufCodec.Unmarshal(body, msg)
+}
+
+// setProtobufBodydecoders selects ProtobufBodydecoder for the protobuf requests,
+// except that the handler decodes the body by itself.
+func setProtobufBodydecoders(paramsAPI *apiware.ParamsAPI) {
+	paramsAPI.SetMediaBodydecoder(MIMEApplicationXProtobuf, ProtobufBodydecoder)
+	paramsAPI.SetMediaBodydecoder(MIMEApplicationProtobuf, ProtobufBodydecoder)
+}
+
+// isProtobufType reports whether the media type is a protobuf one.
+func isProtobufType(mediaType string) bool {
+	if i := strings.IndexByte(mediaType, ';'); i != -1 {
+		mediaType = mediaType[:i]
+	}
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	return mediaType == MIMEApplicationXProtobuf || mediaType == MIMEApplicationProtobuf
+}
+
+// BindProtobuf reads protobuf from request's body
+func (ctx *Context) BindProtobuf(msg ProtoMessage) error {
+	if global.protobufCodec == nil {
+		return ErrNoProtobufCodec
+	}
+	rawData, err := ioutil.ReadAll(ctx.R.Body)
+	if err != nil {
+		return err
+	}
+	return global.protobufCodec.Unmarshal(rawData, msg)
+}
+
+// Protobuf sends a protobuf response with status code, the Content-Type is application/x-protobuf.
+func (ctx *Context) Protobuf(status int, msg ProtoMessage) error {
+	return ctx.protobuf(status, MIMEApplicationXProtobuf, msg)
+}
+
+func (ctx *Context) protobuf(status int, contentType string, msg ProtoMessage) error {
+	if global.protobufCodec == nil {
+		return ErrNoProtobufCodec
+	}
+	b, err := global.protobufCodec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return ctx.Bytes(status, contentType, b)
+}
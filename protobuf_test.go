@@ -0,0 +1,125 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testProtoMsg is a fake generated protobuf message.
+type testProtoMsg struct {
+	Name string `json:"name"`
+}
+
+func (m *testProtoMsg) Reset()         { *m = testProtoMsg{} }
+func (m *testProtoMsg) String() string { return m.Name }
+func (*testProtoMsg) ProtoMessage()    {}
+
+// testProtoCodec encodes the testProtoMsg as "pb:<name>".
+type testProtoCodec struct{}
+
+func (testProtoCodec) Marshal(m ProtoMessage) ([]byte, error) {
+	return []byte("pb:" + m.String()), nil
+}
+
+func (testProtoCodec) Unmarshal(b []byte, m ProtoMessage) error {
+	if !strings.HasPrefix(string(b), "pb:") {
+		return errors.New("malformed protobuf")
+	}
+	m.Reset()
+	m.(*testProtoMsg).Name = string(b[3:])
+	return nil
+}
+
+type protobufAPI struct {
+	Msg testProtoMsg `param:"<in:body>"`
+}
+
+func (a *protobufAPI) Serve(ctx *Context) error {
+	return ctx.Negotiate(200, map[string]interface{}{
+		MIMEApplicationJSON:      &a.Msg,
+		MIMEApplicationXProtobuf: &a.Msg,
+	})
+}
+
+func TestProtobuf(t *testing.T) {
+	frame := newTestFrame(t, "protobuf_test")
+	frame.POST("/msg", new(protobufAPI))
+	frame.GET("/format", HandlerFunc(func(ctx *Context) error {
+		return ctx.NegotiateFormat(200, NegotiateSpec{
+			Data:   &testProtoMsg{Name: "format"},
+			Offers: []string{"protobuf", "json"},
+		})
+	}))
+	frame.POST("/bind", HandlerFunc(func(ctx *Context) error {
+		var msg testProtoMsg
+		if err := ctx.BindProtobuf(&msg); err != nil {
+			return err
+		}
+		return ctx.Protobuf(201, &msg)
+	}))
+
+	do := func(method, path, contentType, accept, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set(HeaderContentType, contentType)
+		}
+		req.Header.Set(HeaderAccept, accept)
+		return serveTest(frame, req)
+	}
+
+	// no codec is set
+	if rec := do("POST", "/msg", MIMEApplicationXProtobuf, MIMEApplicationJSON, "pb:henry"); rec.Code != 400 {
+		t.Fatalf("without codec: got %d %q, want 400", rec.Code, rec.Body.String())
+	}
+
+	SetProtobufCodec(testProtoCodec{})
+	defer SetProtobufCodec(nil)
+
+	cases := []struct {
+		contentType, accept, body string
+		code                      int
+		wantType, wantBody        string
+	}{
+		{MIMEApplicationXProtobuf, MIMEApplicationXProtobuf, "pb:henry", 200, MIMEApplicationXProtobuf, "pb:henry"},
+		{MIMEApplicationProtobuf + "; proto=test", MIMEApplicationJSON, "pb:henry", 200, MIMEApplicationJSONCharsetUTF8, `{"name":"henry"}`},
+		{MIMEApplicationJSON, MIMEApplicationXProtobuf, `{"name":"henry"}`, 200, MIMEApplicationXProtobuf, "pb:henry"},
+		{MIMEApplicationXProtobuf, MIMEApplicationJSON, `{"name":"henry"}`, 400, "", ""},
+	}
+	for i, c := range cases {
+		rec := do("POST", "/msg", c.contentType, c.accept, c.body)
+		if rec.Code != c.code {
+			t.Fatalf("case %d: got %d %q, want %d", i, rec.Code, rec.Body.String(), c.code)
+		}
+		if c.code != 200 {
+			continue
+		}
+		if got := rec.Header().Get(HeaderContentType); got != c.wantType || rec.Body.String() != c.wantBody {
+			t.Fatalf("case %d: got %q %q, want %q %q", i, got, rec.Body.String(), c.wantType, c.wantBody)
+		}
+	}
+
+	rec := do("GET", "/format", "", MIMEApplicationXProtobuf, "")
+	if rec.Body.String() != "pb:format" || rec.Header().Get(HeaderContentType) != MIMEApplicationXProtobuf {
+		t.Fatalf("NegotiateFormat: got %q %q", rec.Header().Get(HeaderContentType), rec.Body.String())
+	}
+	rec = do("POST", "/bind", MIMEApplicationXProtobuf, "", "pb:bind")
+	if rec.Code != 201 || rec.Body.String() != "pb:bind" {
+		t.Fatalf("BindProtobuf: got %d %q", rec.Code, rec.Body.String())
+	}
+}
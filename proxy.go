@@ -0,0 +1,224 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultProxyFailTimeout is the default period during which an upstream
+// target is skipped after a dial error.
+const DefaultProxyFailTimeout = 10 * time.Second
+
+type (
+	// ProxyConfig is the config of the reverse proxy handler.
+	ProxyConfig struct {
+		// List of upstream targets, they are selected in round-robin order.
+		Targets []*url.URL
+		// Rewrite modifies the outgoing request after the target has been applied,
+		// for example to strip or replace a path prefix.
+		Rewrite func(*http.Request)
+		// FlushInterval specifies the flush interval to flush to the client
+		// while copying the response body.
+		// A negative value means to flush immediately after each write.
+		FlushInterval time.Duration
+		// If true, the Host header of the incoming request is passed to the upstream,
+		// otherwise it is replaced by the target host.
+		PassHostHeader bool
+		// FailTimeout is the period during which a target is skipped after a dial error.
+		// If FailTimeout<=0, 'DefaultProxyFailTimeout'(10s) is used.
+		FailTimeout time.Duration
+	}
+	// proxyHandler is a reverse proxy handler with round-robin balancing and
+	// passive health checks.
+	proxyHandler struct {
+		config  ProxyConfig
+		targets []*proxyTarget
+		next    uint32
+		proxy   *httputil.ReverseProxy
+	}
+	proxyTarget struct {
+		url       *url.URL
+		downUntil int64 // UnixNano
+	}
+	proxyState struct {
+		ctx    *Context
+		target *proxyTarget
+		start  time.Time
+	}
+	proxyStateKey struct{}
+)
+
+// ErrNoProxyTarget is returned when the reverse proxy config has no targets.
+var ErrNoProxyTarget = errors.New("reverse proxy requires at least one target")
+
+// NewProxyHandler creates a reverse proxy handler.
+// The upstream latency is recorded separately in the access log.
+// Websocket requests are passed through to the upstream.
+func NewProxyHandler(config ProxyConfig) (Handler, error) {
+	if len(config.Targets) == 0 {
+		return nil, ErrNoProxyTarget
+	}
+	if config.FailTimeout <= 0 {
+		config.FailTimeout = DefaultProxyFailTimeout
+	}
+	p := &proxyHandler{
+		config:  config,
+		targets: make([]*proxyTarget, len(config.Targets)),
+	}
+	for i, u := range config.Targets {
+		p.targets[i] = &proxyTarget{url: u}
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Director:       p.director,
+		FlushInterval:  config.FlushInterval,
+		ModifyResponse: p.modifyResponse,
+		ErrorHandler:   p.errorHandler,
+	}
+	return HandlerFunc(p.serve), nil
+}
+
+// NamedReverseProxy registers a reverse proxy handler with the name for all methods.
+// The handlers of the parent nodes, such as the authentication middlewares, run first.
+func (mux *MuxAPI) NamedReverseProxy(name, pattern string, config ProxyConfig) *MuxAPI {
+	handler, err := NewProxyHandler(config)
+	if err != nil {
+		mux.frame.Log().Panicf("%s\n", err.Error())
+	}
+	return mux.NamedAPI(name, "*", pattern, handler)
+}
+
+// ReverseProxy is similar to NamedReverseProxy, but no name.
+func (mux *MuxAPI) ReverseProxy(pattern string, config ProxyConfig) *MuxAPI {
+	return mux.NamedReverseProxy("reverseproxy", pattern, config)
+}
+
+func (p *proxyHandler) serve(ctx *Context) error {
+	target := p.pick()
+	if target == nil {
+		ctx.Error(http.StatusServiceUnavailable, "no available upstream")
+		return nil
+	}
+	state := &proxyState{
+		ctx:    ctx,
+		target: target,
+		start:  time.Now(),
+	}
+	r := ctx.R.WithContext(context.WithValue(ctx.R.Context(), proxyStateKey{}, state))
+	p.proxy.ServeHTTP(ctx.W, r)
+	if ctx.upstreamLatency == 0 {
+		ctx.upstreamLatency = time.Since(state.start)
+	}
+	return nil
+}
+
+// pick selects the next healthy target in round-robin order,
+// returns nil if all targets are marked down.
+func (p *proxyHandler) pick() *proxyTarget {
+	count := uint32(len(p.targets))
+	now := time.Now().UnixNano()
+	for i := uint32(0); i < count; i++ {
+		t := p.targets[(atomic.AddUint32(&p.next, 1)-1)%count]
+		if atomic.LoadInt64(&t.downUntil) <= now {
+			return t
+		}
+	}
+	return nil
+}
+
+func (p *proxyHandler) director(r *http.Request) {
+	state := r.Context().Value(proxyStateKey{}).(*proxyState)
+	target := state.target.url
+	r.URL.Scheme = target.Scheme
+	r.URL.Host = target.Host
+	r.URL.Path, r.URL.RawPath = joinURLPath(target, r.URL)
+	if target.RawQuery == "" || r.URL.RawQuery == "" {
+		r.URL.RawQuery = target.RawQuery + r.URL.RawQuery
+	} else {
+		r.URL.RawQuery = target.RawQuery + "&" + r.URL.RawQuery
+	}
+	if !p.config.PassHostHeader {
+		r.Host = target.Host
+	}
+	if r.Header.Get(HeaderXRequestID) == "" {
+		r.Header.Set(HeaderXRequestID, RandomString(16))
+	}
+	if p.config.Rewrite != nil {
+		p.config.Rewrite(r)
+	}
+}
+
+// joinURLPath joins the paths of the target and the request like httputil.NewSingleHostReverseProxy,
+// keeping the trailing slash and the escaped path, such as `%2F`.
+func joinURLPath(a, b *url.URL) (path, rawpath string) {
+	if a.RawPath == "" && b.RawPath == "" {
+		return singleJoiningSlash(a.Path, b.Path), ""
+	}
+	apath := a.EscapedPath()
+	bpath := b.EscapedPath()
+	aslash := strings.HasSuffix(apath, "/")
+	bslash := strings.HasPrefix(bpath, "/")
+	switch {
+	case aslash && bslash:
+		return a.Path + b.Path[1:], apath + bpath[1:]
+	case !aslash && !bslash:
+		return a.Path + "/" + b.Path, apath + "/" + bpath
+	}
+	return a.Path + b.Path, apath + bpath
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+func (p *proxyHandler) modifyResponse(resp *http.Response) error {
+	state := resp.Request.Context().Value(proxyStateKey{}).(*proxyState)
+	state.ctx.upstreamLatency = time.Since(state.start)
+	return nil
+}
+
+func (p *proxyHandler) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	state := r.Context().Value(proxyStateKey{}).(*proxyState)
+	state.ctx.upstreamLatency = time.Since(state.start)
+	if isDialError(err) {
+		atomic.StoreInt64(&state.target.downUntil, time.Now().Add(p.config.FailTimeout).UnixNano())
+		state.ctx.Log().Warningf("[proxy] upstream %s is marked down for %s: %s", state.target.url.Host, p.config.FailTimeout, err.Error())
+	} else {
+		state.ctx.Log().Warningf("[proxy] upstream %s: %s", state.target.url.Host, err.Error())
+	}
+	// the detail, such as the upstream address, is only logged
+	global.errorFunc(state.ctx, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+}
+
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,148 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReverseProxyHealth(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream-Path", r.URL.Path)
+		w.Header().Set("X-Upstream-Request-Id", r.Header.Get(HeaderXRequestID))
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+	// a closed listener causes a dial error
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := "http://" + ln.Addr().String()
+	ln.Close()
+
+	deadURL, _ := url.Parse(dead)
+	liveURL, _ := url.Parse(upstream.URL)
+	frame := newTestFrame(t, "proxy_health_test")
+	frame.ReverseProxy("/api/v2/*path", ProxyConfig{
+		Targets: []*url.URL{deadURL, liveURL},
+		Rewrite: func(r *http.Request) {
+			r.URL.Path = r.URL.Path[len("/api"):]
+		},
+	})
+
+	rec := serveTest(frame, httptest.NewRequest("GET", "/api/v2/users", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("first request: got status %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+	if strings.Contains(rec.Body.String(), deadURL.Host) || !strings.Contains(rec.Body.String(), http.StatusText(http.StatusBadGateway)) {
+		t.Fatalf("first request: the upstream address is exposed: %q", rec.Body.String())
+	}
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/api/v2/users", nil)
+		req.Header.Set(HeaderXRequestID, "abc")
+		rec = serveTest(frame, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: got status %d, want %d", i, rec.Code, http.StatusOK)
+		}
+		if p := rec.Header().Get("X-Upstream-Path"); p != "/v2/users" {
+			t.Fatalf("request %d: got upstream path %q, want %q", i, p, "/v2/users")
+		}
+		if id := rec.Header().Get("X-Upstream-Request-Id"); id != "abc" {
+			t.Fatalf("request %d: got request id %q, want %q", i, id, "abc")
+		}
+	}
+}
+
+func TestReverseProxyPath(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RequestURI))
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL + "/base")
+	frame := newTestFrame(t, "proxy_path_test")
+	frame.ReverseProxy("/docs/*path", ProxyConfig{Targets: []*url.URL{target}})
+	for _, c := range []struct{ uri, want string }{
+		// the trailing slash is kept
+		{"/docs/", "/base/docs/"},
+		{"/docs/a?x=1", "/base/docs/a?x=1"},
+		// the escaped slash is not decoded
+		{"/docs/a%2Fb/", "/base/docs/a%2Fb/"},
+	} {
+		if rec := serveTest(frame, httptest.NewRequest("GET", c.uri, nil)); rec.Code != 200 || rec.Body.String() != c.want {
+			t.Errorf("%s: got %d %q, want %q", c.uri, rec.Code, rec.Body.String(), c.want)
+		}
+	}
+}
+
+func TestReverseProxyWebsocket(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+		// echoes the lines
+		for {
+			line, err := rw.ReadString('\n')
+			if err != nil {
+				return
+			}
+			rw.WriteString("echo " + line)
+			rw.Flush()
+		}
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+	frame := newTestFrame(t, "proxy_websocket_test")
+	frame.ReverseProxy("/ws", ProxyConfig{Targets: []*url.URL{target}})
+	frame.build()
+	// a real server, so that the upgraded connection is hijacked from ctx.W
+	server := httptest.NewServer(frame)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: example.com\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n"))
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Upgrade") != "websocket" {
+		t.Fatalf("got %d %v", resp.StatusCode, resp.Header)
+	}
+	conn.Write([]byte("ping\n"))
+	if line, err := br.ReadString('\n'); err != nil || line != "echo ping\n" {
+		t.Fatalf("got %q, %v", line, err)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headers of the quota middleware
+const (
+	HeaderXRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderXRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderXRateLimitReset     = "X-RateLimit-Reset"
+)
+
+type (
+	// PrincipalFunc returns the principal the quota is counted by, such as the API key or the user ID,
+	// empty means the request is not limited.
+	PrincipalFunc func(ctx *Context) string
+	// QuotaLimit is the number of the requests allowed in the sliding window,
+	// Limit <= 0 means unlimited.
+	QuotaLimit struct {
+		Limit  int
+		Window time.Duration
+	}
+	// QuotaStore stores the request counters of the fixed windows of each principal,
+	// two adjacent ones are weighted into the sliding window.
+	// It may be shared across processes, such as redis.
+	QuotaStore interface {
+		// Increment adds 1 to the counter of the key in the fixed window starting at start,
+		// and returns the new count and the count of the previous window, which starts at start-window.
+		// The counters older than the previous window are no longer used.
+		Increment(key string, start time.Time, window time.Duration) (current, previous int64, err error)
+	}
+	// QuotaConfig is the config of the quota middleware created by NewQuota.
+	QuotaConfig struct {
+		// Returns the principal of the request, required.
+		Principal PrincipalFunc
+		// The limit of the principals, used if Limits is nil or returns the zero QuotaLimit.
+		Default QuotaLimit
+		// Loads the limit of the principal, such as from the database, optional.
+		// It is called for each request, so it should be cached if it is slow.
+		Limits func(principal string) (QuotaLimit, error)
+		// The counter store, the in-memory one by default.
+		Store QuotaStore
+		// If true, the request is served without the quota if the Limits or the Store fails,
+		// otherwise it is replied 503.
+		FailOpen bool
+	}
+	// quota is the quota middleware state.
+	quota struct {
+		QuotaConfig
+		now func() time.Time
+	}
+)
+
+// NewQuota creates the middleware limiting the requests of each principal, such as the API key,
+// in the sliding window, which avoids the bursts at the window boundaries of the fixed window.
+// The X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset (the Unix time in seconds
+// when the current fixed window ends) headers are set on every limited response,
+// and the exhausted requests are replied 429 with a JSON body and Retry-After.
+// The exhausted requests are also counted, so that the clients retrying aggressively stay limited.
+//
+//	e.g. frame.Filter(faygo.NewQuota(faygo.QuotaConfig{
+//		Principal: func(ctx *faygo.Context) string { return ctx.HeaderParam("X-API-Key") },
+//		Default:   faygo.QuotaLimit{Limit: 1000, Window: time.Hour},
+//	}))
+func NewQuota(conf QuotaConfig) HandlerFunc {
+	if conf.Principal == nil {
+		Fatalf("NewQuota: the principal function is required")
+	}
+	if conf.Store == nil {
+		conf.Store = NewMemoryQuotaStore()
+	}
+	q := &quota{QuotaConfig: conf, now: time.Now}
+	return q.serve
+}
+
+func (q *quota) serve(ctx *Context) error {
+	principal := q.Principal(ctx)
+	if principal == "" {
+		return nil
+	}
+	limit := q.Default
+	if q.Limits != nil {
+		l, err := q.Limits(principal)
+		if err != nil {
+			return q.fail(ctx, err)
+		}
+		if l != (QuotaLimit{}) {
+			limit = l
+		}
+	}
+	if limit.Limit <= 0 || limit.Window <= 0 {
+		return nil
+	}
+	now := q.now()
+	start := now.Truncate(limit.Window)
+	current, previous, err := q.Store.Increment(principal, start, limit.Window)
+	if err != nil {
+		return q.fail(ctx, err)
+	}
+	// weights the previous window by its part overlapping the sliding window
+	weight := 1 - float64(now.Sub(start))/float64(limit.Window)
+	used := int(math.Ceil(float64(previous)*weight)) + int(current)
+	remaining := limit.Limit - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	reset := start.Add(limit.Window)
+	h := ctx.W.Header()
+	h.Set(HeaderXRateLimitLimit, strconv.Itoa(limit.Limit))
+	h.Set(HeaderXRateLimitRemaining, strconv.Itoa(remaining))
+	h.Set(HeaderXRateLimitReset, strconv.FormatInt(reset.Unix(), 10))
+	if used <= limit.Limit {
+		return nil
+	}
+	ctx.Stop()
+	retryAfter := int64(math.Ceil(reset.Sub(now).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	h.Set(HeaderRetryAfter, strconv.FormatInt(retryAfter, 10))
+	return ctx.JSON(http.StatusTooManyRequests, Map{
+		"error":     "rate limit exceeded",
+		"limit":     limit.Limit,
+		"remaining": 0,
+		"reset":     reset.Unix(),
+	})
+}
+
+// fail handles the error of the Limits or the Store by the FailOpen.
+func (q *quota) fail(ctx *Context, err error) error {
+	ctx.Log().Errorf("Quota: %v", err)
+	if q.FailOpen {
+		return nil
+	}
+	ctx.Stop()
+	global.errorFunc(ctx, "the quota is unavailable", http.StatusServiceUnavailable)
+	return nil
+}
+
+// memoryQuotaStore is the in-memory QuotaStore.
+type memoryQuotaStore struct {
+	counters  map[string]*quotaCounter
+	lastSweep time.Time
+	lock      sync.Mutex
+}
+
+// quotaCounter is the counters of the current and previous fixed windows.
+type quotaCounter struct {
+	start             time.Time
+	window            time.Duration
+	current, previous int64
+}
+
+// quotaSweepInterval is the interval removing the unused counters of the in-memory store.
+const quotaSweepInterval = time.Minute
+
+// NewMemoryQuotaStore creates the in-memory QuotaStore,
+// which is the default of NewQuota.
+func NewMemoryQuotaStore() QuotaStore {
+	return &memoryQuotaStore{
+		counters:  make(map[string]*quotaCounter),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *memoryQuotaStore) Increment(key string, start time.Time, window time.Duration) (int64, int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastSweep) >= quotaSweepInterval {
+		for k, c := range s.counters {
+			if now.Sub(c.start) >= 2*c.window {
+				delete(s.counters, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	c, ok := s.counters[key]
+	switch {
+	case !ok || c.window != window:
+		c = &quotaCounter{start: start, window: window}
+		s.counters[key] = c
+	case !c.start.Before(start):
+		// the same window, or the request of the previous window arrives late
+	case c.start.Add(window).Equal(start):
+		c.start, c.previous, c.current = start, c.current, 0
+	default:
+		c.start, c.previous, c.current = start, 0, 0
+	}
+	c.current++
+	return c.current, c.previous, nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type failingQuotaStore struct{}
+
+func (failingQuotaStore) Increment(string, time.Time, time.Duration) (int64, int64, error) {
+	return 0, 0, errors.New("store is down")
+}
+
+func TestQuota(t *testing.T) {
+	now := time.Unix(3600*1000, 0)
+	q := &quota{
+		QuotaConfig: QuotaConfig{
+			Principal: func(ctx *Context) string { return ctx.HeaderParam("X-API-Key") },
+			Default:   QuotaLimit{Limit: 3, Window: time.Minute},
+			Limits: func(principal string) (QuotaLimit, error) {
+				switch principal {
+				case "gold":
+					return QuotaLimit{Limit: 10, Window: time.Minute}, nil
+				case "broken":
+					return QuotaLimit{}, errors.New("db is down")
+				}
+				return QuotaLimit{}, nil
+			},
+			Store: NewMemoryQuotaStore(),
+		},
+		now: func() time.Time { return now },
+	}
+	frame := newTestFrame(t, "quota_test")
+	frame.GET("/api", HandlerFunc(q.serve), HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, "ok")
+	}))
+	get := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api", nil)
+		req.Header.Set("X-API-Key", key)
+		return serveTest(frame, req)
+	}
+	reset := strconv.FormatInt(now.Add(time.Minute).Unix(), 10)
+	for i := 2; i >= 0; i-- {
+		rec := get("free")
+		if rec.Code != 200 || rec.Header().Get(HeaderXRateLimitLimit) != "3" ||
+			rec.Header().Get(HeaderXRateLimitRemaining) != strconv.Itoa(i) || rec.Header().Get(HeaderXRateLimitReset) != reset {
+			t.Fatalf("remaining %d: got %d %v", i, rec.Code, rec.Header())
+		}
+	}
+	rec := get("free")
+	var body struct {
+		Error     string `json:"error"`
+		Remaining int    `json:"remaining"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if rec.Code != 429 || body.Error == "" || body.Remaining != 0 || rec.Header().Get(HeaderRetryAfter) != "60" {
+		t.Fatalf("exhausted: got %d %q %v", rec.Code, rec.Body.String(), rec.Header())
+	}
+	// the other principals are counted separately
+	if rec := get("gold"); rec.Code != 200 || rec.Header().Get(HeaderXRateLimitRemaining) != "9" {
+		t.Fatalf("gold: got %d %v", rec.Code, rec.Header())
+	}
+	if rec := get(""); rec.Code != 200 || rec.Header().Get(HeaderXRateLimitLimit) != "" {
+		t.Fatalf("anonymous: got %d %v", rec.Code, rec.Header())
+	}
+
+	// the 4 requests of the previous window still count by 3/4 at the first quarter of the next window,
+	// while a fixed window would allow a burst at the boundary
+	now = now.Add(time.Minute + 15*time.Second)
+	if rec := get("free"); rec.Code != 429 {
+		t.Fatalf("sliding window: got %d %v", rec.Code, rec.Header())
+	}
+	now = now.Add(30 * time.Second)
+	if rec := get("free"); rec.Code != 200 || rec.Header().Get(HeaderXRateLimitRemaining) != "0" {
+		t.Fatalf("sliding window: got %d %v", rec.Code, rec.Header())
+	}
+
+	// fail-closed by default
+	if rec := get("broken"); rec.Code != 503 {
+		t.Fatalf("fail-closed: got %d", rec.Code)
+	}
+	q.FailOpen = true
+	if rec := get("broken"); rec.Code != 200 {
+		t.Fatalf("fail-open: got %d", rec.Code)
+	}
+	q.Store = failingQuotaStore{}
+	if rec := get("free"); rec.Code != 200 || rec.Header().Get(HeaderXRateLimitLimit) != "" {
+		t.Fatalf("fail-open store: got %d %v", rec.Code, rec.Header())
+	}
+}
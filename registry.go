@@ -0,0 +1,133 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// ServiceInstance is the running frame service passed to the OnStart and OnStop functions.
+type ServiceInstance struct {
+	Name    string
+	Version string
+	// the bound addresses of the listeners, e.g. with the real port if the config addr is ":0"
+	Addrs []net.Addr
+	// the net types of the listeners in the same order as Addrs, e.g. "http" and "https"
+	NetTypes []string
+}
+
+// Registry is a service discovery registry, such as Consul or etcd, plugged in by Framework.UseRegistry.
+type Registry interface {
+	// Register is called after the frame service starts listening.
+	Register(ctx context.Context, instance *ServiceInstance) error
+	// Deregister is called before the frame service stops accepting and drains the connections.
+	Deregister(ctx context.Context, instance *ServiceInstance) error
+}
+
+// LifecycleFunc is the function called by OnStart and OnStop.
+type LifecycleFunc func(ctx context.Context, instance *ServiceInstance) error
+
+// OnStart registers a function to be called after the frame service starts listening, such as registering the service.
+// The functions are called in the registration order, and on every run, e.g. after Restart.
+// If one returns an error, the rest are not called, and running fails with the error,
+// but the listeners are not closed.
+// note: it should be called before Run()
+func (frame *Framework) OnStart(fn LifecycleFunc) {
+	if fn == nil {
+		return
+	}
+	frame.lock.Lock()
+	frame.startHooks = append(frame.startHooks, fn)
+	frame.lock.Unlock()
+}
+
+// OnStop registers a function to be called when the frame service stops, such as deregistering the service.
+// The functions are called in the reverse order of registration, before the 'PreStopDelay',
+// the listeners are closed and the connections are drained, so that the traffic stops arriving first.
+// Unlike OnShutdown, they are also called by Restart.
+// The error or panic of one function is logged and makes the shutdown not graceful, but does not prevent the others.
+func (frame *Framework) OnStop(fn LifecycleFunc) {
+	if fn == nil {
+		return
+	}
+	frame.lock.Lock()
+	frame.stopHooks = append(frame.stopHooks, fn)
+	frame.lock.Unlock()
+}
+
+// UseRegistry registers the frame service to the registry after it starts listening,
+// and deregisters it when it stops.
+// note: it should be called before Run()
+func (frame *Framework) UseRegistry(registry Registry) {
+	frame.OnStart(registry.Register)
+	frame.OnStop(registry.Deregister)
+}
+
+// newServiceInstance returns the instance of the frame service with the bound listeners.
+func (frame *Framework) newServiceInstance(lns []net.Listener) *ServiceInstance {
+	instance := &ServiceInstance{
+		Name:     frame.name,
+		Version:  frame.version,
+		Addrs:    make([]net.Addr, len(lns)),
+		NetTypes: make([]string, len(lns)),
+	}
+	for i, ln := range lns {
+		instance.Addrs[i] = ln.Addr()
+		instance.NetTypes[i] = frame.servers[i].netType
+	}
+	return instance
+}
+
+// runStartHooks calls the OnStart functions in order, and returns the first error.
+func (frame *Framework) runStartHooks(instance *ServiceInstance) error {
+	frame.lock.RLock()
+	hooks := frame.startHooks
+	frame.lock.RUnlock()
+	for _, fn := range hooks {
+		if err := callLifecycle(context.Background(), fn, instance); err != nil {
+			frame.syslog.Errorf("[start-%s] OnStart: %s", frame.NameWithVersion(), err.Error())
+			return fmt.Errorf("[%s] OnStart: %s", frame.NameWithVersion(), err.Error())
+		}
+	}
+	return nil
+}
+
+// runStopHooks calls the OnStop functions in the reverse order within ctxTimeout,
+// returns false if any fails, panics or times out.
+func (frame *Framework) runStopHooks(ctxTimeout context.Context, instance *ServiceInstance) bool {
+	frame.lock.RLock()
+	hooks := frame.stopHooks
+	frame.lock.RUnlock()
+	graceful := true
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := callLifecycle(ctxTimeout, hooks[i], instance); err != nil {
+			graceful = false
+			frame.syslog.Errorf("[shutdown-%s] OnStop: %s", frame.NameWithVersion(), err.Error())
+			if ctxTimeout.Err() != nil {
+				break
+			}
+		}
+	}
+	return graceful
+}
+
+// callLifecycle calls the lifecycle function within ctx, and converts the panic to an error.
+func callLifecycle(ctx context.Context, fn LifecycleFunc, instance *ServiceInstance) error {
+	return callSafe(ctx, func() error {
+		return fn(ctx, instance)
+	})
+}
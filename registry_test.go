@@ -0,0 +1,92 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRegistry records the registered instances.
+type testRegistry struct {
+	events []string
+	// reports whether the service is still accepting when deregistered
+	acceptingOnDeregister bool
+}
+
+func (r *testRegistry) Register(ctx context.Context, instance *ServiceInstance) error {
+	r.events = append(r.events, "register "+instance.Name+" "+instance.NetTypes[0])
+	if strings.HasSuffix(instance.Addrs[0].String(), ":0") {
+		return errors.New("the listen address is not bound")
+	}
+	return nil
+}
+
+func (r *testRegistry) Deregister(ctx context.Context, instance *ServiceInstance) error {
+	r.events = append(r.events, "deregister")
+	resp, err := http.Get("http://" + instance.Addrs[0].String() + "/")
+	if err == nil {
+		resp.Body.Close()
+		r.acceptingOnDeregister = true
+	}
+	return nil
+}
+
+func TestUseRegistry(t *testing.T) {
+	frame := newTestFrame(t, "registry_test")
+	frame.config.Addrs = []string{"127.0.0.1:0"}
+	frame.GET("/", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, "ok")
+	}))
+	registry := new(testRegistry)
+	frame.UseRegistry(registry)
+	frame.OnStop(func(ctx context.Context, instance *ServiceInstance) error {
+		registry.events = append(registry.events, "flush")
+		return errors.New("flush failed")
+	})
+	if err := frame.run(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if frame.shutdown(ctx) {
+		t.Fatal("the error of OnStop function should be reported")
+	}
+	if got := strings.Join(registry.events, ","); got != "register registry_test http,flush,deregister" {
+		t.Fatalf("events: got %q", got)
+	}
+	if !registry.acceptingOnDeregister {
+		t.Fatal("the service should be accepting when deregistered")
+	}
+	// stopped already
+	if !frame.shutdown(ctx) || len(registry.events) != 3 {
+		t.Fatalf("the OnStop functions should be called once: %v", registry.events)
+	}
+
+	frame = newTestFrame(t, "registry_error_test")
+	frame.config.Addrs = []string{"127.0.0.1:0"}
+	frame.OnStart(func(ctx context.Context, instance *ServiceInstance) error {
+		return errors.New("consul is unavailable")
+	})
+	err := frame.run()
+	defer frame.shutdown(ctx)
+	if err == nil || !strings.Contains(err.Error(), "consul is unavailable") {
+		t.Fatalf("OnStart error: got %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/henrylee2cn/faygo/pongo2"
+)
+
+type (
+	// SafeHTML is a trusted HTML fragment, which is rendered without escaping.
+	SafeHTML string
+	// SafeJS is a trusted JavaScript expression,
+	// which is rendered without escaping by the `safe_js` filter.
+	SafeJS string
+	// SafeURL is a trusted URL,
+	// which is rendered without checking the scheme by the `safe_url` filter.
+	SafeURL string
+)
+
+// TrustedContext implements pongo2.Trusted.
+func (SafeHTML) TrustedContext() string { return "html" }
+
+// TrustedContext implements pongo2.Trusted.
+func (SafeJS) TrustedContext() string { return "js" }
+
+// TrustedContext implements pongo2.Trusted.
+func (SafeURL) TrustedContext() string { return "url" }
+
+// UnsafeURLReplacement replaces the URL with an unsafe scheme in the `safe_url` filter.
+const UnsafeURLReplacement = "about:invalid#unsafe"
+
+func init() {
+	pongo2.RegisterFilter("safe_js", filterSafeJS)
+	pongo2.RegisterFilter("safe_url", filterSafeURL)
+}
+
+// filterSafeJS passes SafeJS through, and escapes any other value
+// so that it can be put into a JavaScript string literal.
+func filterSafeJS(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	if s, ok := in.Interface().(SafeJS); ok {
+		return pongo2.AsSafeValue(string(s)), nil
+	}
+	out, err := pongo2.ApplyFilter("escapejs", in, nil)
+	if err != nil {
+		return nil, err
+	}
+	return pongo2.AsSafeValue(out.String()), nil
+}
+
+// filterSafeURL passes SafeURL through, replaces the URL with a scheme
+// other than http, https or mailto by UnsafeURLReplacement,
+// and escapes the URL as an HTML attribute value.
+func filterSafeURL(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+	if s, ok := in.Interface().(SafeURL); ok {
+		return pongo2.AsSafeValue(string(s)), nil
+	}
+	s := in.String()
+	if !isSafeURL(s) {
+		s = UnsafeURLReplacement
+	}
+	out, err := pongo2.ApplyFilter("escape", pongo2.AsValue(s), nil)
+	if err != nil {
+		return nil, err
+	}
+	return pongo2.AsSafeValue(out.String()), nil
+}
+
+func isSafeURL(s string) bool {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// EscapeViolation is a template variable output into the script or URL context
+// without the filter escaping it for the context.
+type EscapeViolation struct {
+	File     string
+	Line     int
+	Variable string
+	Context  string // "js" or "url"
+}
+
+func (v EscapeViolation) String() string {
+	filter := "safe_js"
+	if v.Context == "url" {
+		filter = "safe_url"
+	}
+	return fmt.Sprintf("%s:%d: variable %q in %s context is not filtered by %s", v.File, v.Line, v.Variable, v.Context, filter)
+}
+
+var (
+	tplVarRegexp       = regexp.MustCompile(`\{\{-?\s*([\s\S]*?)\s*-?\}\}`)
+	openAttrRegexp     = regexp.MustCompile(`([a-zA-Z_:][-a-zA-Z0-9_:.]*)\s*=\s*(?:"[^"]*|'[^']*|[^\s"'>]*)$`)
+	scriptOpenRegexp   = regexp.MustCompile(`(?i)<script\b`)
+	scriptCloseRegexp  = regexp.MustCompile(`(?i)</script\b`)
+	urlAttrs           = map[string]bool{"href": true, "src": true, "action": true, "formaction": true, "xlink:href": true}
+	contextSafeFilters = map[string][]string{
+		// the filters escaping for each context, iriencode is not one for url, since it keeps the scheme such as `javascript:`
+		"js":  {"safe_js", "escapejs"},
+		"url": {"safe_url", "urlencode"},
+	}
+)
+
+// LintEscaping reports the variables of the template source output into
+// the script context, such as `<script>` or the `on*` attributes,
+// without the `safe_js` filter, and the ones output into the URL context,
+// such as the `href` or `src` attributes, without the `safe_url` filter.
+func LintEscaping(filename string, src []byte) []EscapeViolation {
+	var violations []EscapeViolation
+	text := string(src)
+	for _, loc := range tplVarRegexp.FindAllStringSubmatchIndex(text, -1) {
+		expr := text[loc[2]:loc[3]]
+		context := escapeContext(text[:loc[0]])
+		if context == "" {
+			continue
+		}
+		parts := strings.Split(expr, "|")
+		variable := strings.TrimSpace(parts[0])
+		if variable == "" || strings.ContainsAny(variable[:1], `"'0123456789`) {
+			continue // literal
+		}
+		if hasAnyFilter(parts[1:], contextSafeFilters[context]) {
+			continue
+		}
+		violations = append(violations, EscapeViolation{
+			File:     filename,
+			Line:     strings.Count(text[:loc[0]], "\n") + 1,
+			Variable: variable,
+			Context:  context,
+		})
+	}
+	return violations
+}
+
+// escapeContext returns the context at the end of the template source before the variable.
+func escapeContext(before string) string {
+	if open := scriptOpenRegexp.FindAllStringIndex(before, -1); len(open) > 0 {
+		closing := scriptCloseRegexp.FindAllStringIndex(before, -1)
+		if len(closing) == 0 || closing[len(closing)-1][0] < open[len(open)-1][0] {
+			// after the `>` of the script tag
+			if strings.Contains(before[open[len(open)-1][0]:], ">") {
+				return "js"
+			}
+		}
+	}
+	// inside a tag?
+	if lt := strings.LastIndex(before, "<"); lt > strings.LastIndex(before, ">") {
+		if m := openAttrRegexp.FindStringSubmatch(before[lt:]); m != nil {
+			name := strings.ToLower(m[1])
+			switch {
+			case strings.HasPrefix(name, "on"):
+				return "js"
+			case urlAttrs[name]:
+				return "url"
+			}
+		}
+	}
+	return ""
+}
+
+func hasAnyFilter(filters []string, names []string) bool {
+	for _, f := range filters {
+		f = strings.TrimSpace(f)
+		if i := strings.Index(f, ":"); i >= 0 {
+			f = strings.TrimSpace(f[:i])
+		}
+		for _, name := range names {
+			if f == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetStrictEscaping sets whether to refuse the templates which output
+// the variables into the script or URL context without the `safe_js`
+// or `safe_url` filter.
+// If false, Precompile only logs the violations as warnings.
+// note: it should be called before rendering
+func (render *Render) SetStrictEscaping(strict bool) {
+	render.Lock()
+	render.strictEscaping = strict
+	render.tplCache = make(map[string]*Tpl)
+	render.Unlock()
+}
+
+// compile parses the template, and lints it in the strict escaping mode.
+func (render *Render) compile(filename string, fbytes []byte) (*pongo2.Template, error) {
+	// the template set is not safe for the concurrent compiling
+	render.compileLock.Lock()
+	tpl, err := render.set.FromBytesWithName(filename, fbytes)
+	render.compileLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if render.strictEscaping {
+		if violations := LintEscaping(filename, fbytes); len(violations) > 0 {
+			return nil, escapeError(violations)
+		}
+	}
+	return tpl, nil
+}
+
+func escapeError(violations []EscapeViolation) error {
+	lines := make([]string, len(violations))
+	for i, v := range violations {
+		lines[i] = v.String()
+	}
+	return errors.New(strings.Join(lines, "\n"))
+}
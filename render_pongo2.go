@@ -3,9 +3,16 @@ package faygo
 import (
 	"bytes"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,8 +22,9 @@ import (
 type (
 	// Tpl is template with modfied time.
 	Tpl struct {
-		template *pongo2.Template
-		modTime  time.Time
+		template      *pongo2.Template
+		modTime       time.Time
+		layoutModTime time.Time // modified time of the layout, only for the template rendered with layout
 	}
 	// Render is a custom faygo template renderer using pongo2.
 	Render struct {
@@ -24,7 +32,12 @@ type (
 		tplCache      map[string]*Tpl
 		tplContext    pongo2.Context // Context hold globle func for tpl
 		openCacheFile func(name string) (http.File, error)
-		caching       bool // false=disable caching, true=enable caching
+		caching       bool            // false=disable caching, true=enable caching
+		layout        string          // default layout of RenderWithLayout
+		fs            http.FileSystem // file system of the templates
+		// refuse the templates outputting the variables into the script or URL context without escaping
+		strictEscaping bool
+		compileLock    sync.Mutex // serializes the compiling of the template set
 		sync.RWMutex
 	}
 )
@@ -37,9 +50,54 @@ func newRender(openCacheFile func(name string) (http.File, error)) *Render {
 		tplContext:    make(pongo2.Context),
 		openCacheFile: openCacheFile,
 		caching:       openCacheFile != nil,
+		fs:            diskFS{},
 	}
 }
 
+// SetFS sets the file system of the templates, such as `http.FS(embedFS)`,
+// so that the templates can be embedded in the binary.
+// The template names are the slash-separated paths in the file system.
+// If fsys is nil, the local file system is used, which is the default.
+// note: it should be called before rendering
+func (render *Render) SetFS(fsys http.FileSystem) {
+	render.Lock()
+	defer render.Unlock()
+	if fsys == nil {
+		render.fs = diskFS{}
+		render.set = pongo2.NewSet("faygo", pongo2.DefaultLoader)
+	} else {
+		render.fs = fsys
+		render.set = pongo2.NewSet("faygo", &fsLoader{fs: fsys})
+	}
+	render.tplCache = make(map[string]*Tpl)
+}
+
+// fsLoader is the pongo2 template loader of the file system,
+// which resolves the templates extended or included.
+type fsLoader struct {
+	fs http.FileSystem
+}
+
+func (l *fsLoader) Abs(base, name string) string {
+	if strings.HasPrefix(name, "/") || base == "" {
+		return path.Clean("/" + name)
+	}
+	return path.Join(path.Dir(path.Clean("/"+base)), name)
+}
+
+func (l *fsLoader) Get(name string) (io.Reader, error) {
+	f, err := l.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
+
 // TemplateVar sets the global template variable or function
 func (render *Render) TemplateVar(name string, v interface{}) {
 	switch d := v.(type) {
@@ -58,10 +116,11 @@ func (render *Render) Render(filename string, data Map) ([]byte, error) {
 		b, _, err := render.fromCache(filename, data, false)
 		return b, err
 	}
-	f, err := os.Open(filename)
+	f, err := render.fs.Open(filename)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 
 	var fbytes []byte
 	fbytes, err = ioutil.ReadAll(f)
@@ -73,28 +132,26 @@ func (render *Render) Render(filename string, data Map) ([]byte, error) {
 
 }
 
+// RenderToString renders the template to a string without writing a response,
+// such as for the emails, and returns the pongo2 error with the file and line if it fails.
+// It is safe to be called concurrently, the data is not modified.
+func (render *Render) RenderToString(filename string, data Map) (string, error) {
+	b, err := render.Render(filename, data)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
 // RenderFromBytesWithName should render the template to the io.Writer.
 func (render *Render) RenderFromBytesWithName(filename string, fbytes []byte, data Map) ([]byte, error) {
-	template, err := render.set.FromBytesWithName(filename, fbytes)
+	template, err := render.compile(filename, fbytes)
 	if err != nil {
 		return nil, err
 	}
 
-	var data2 pongo2.Context
-	if data == nil {
-		data2 = render.tplContext
-
-	} else {
-		data2 = pongo2.Context(data)
-		for k, v := range render.tplContext {
-			if _, ok := data2[k]; !ok {
-				data2[k] = v
-			}
-		}
-	}
-
 	var b bytes.Buffer
-	err = template.ExecuteWriter(data2, &b)
+	err = template.ExecuteWriter(render.context(data), &b)
 	return b.Bytes(), err
 }
 
@@ -132,36 +189,249 @@ func (render *Render) fromCache(fname string, data Map, withInfo bool) ([]byte,
 
 	} else {
 		// The cache template does not exist or the file is updated
-		render.Lock()
-		defer render.Unlock()
-
 		// Create a new template and cache it
 		fbytes, _ := ioutil.ReadAll(f)
-		tpl, err = render.set.FromBytesWithName(fname, fbytes)
+		render.Lock()
+		tpl, err = render.compile(fname, fbytes)
+		if err == nil {
+			render.tplCache[fname] = &Tpl{template: tpl, modTime: fileInfo.ModTime()}
+		}
+		render.Unlock()
 		if err != nil {
 			return nil, nil, err
 		}
+	}
 
-		render.tplCache[fname] = &Tpl{template: tpl, modTime: fileInfo.ModTime()}
+	var b bytes.Buffer
+	err = tpl.ExecuteWriter(render.context(data), &b)
+	if withInfo {
+		return b.Bytes(), newNowFileInfo(fileInfo, int64(b.Len())), err
 	}
+	return b.Bytes(), nil, err
+}
 
-	var data2 pongo2.Context
-	if data == nil {
-		data2 = render.tplContext
-	} else {
-		data2 = pongo2.Context(data)
-		for k, v := range render.tplContext {
-			if _, ok := data2[k]; !ok {
-				data2[k] = v
+// Precompile parses all the templates with the extensions under the dir,
+// and returns the errors of all the failed templates.
+// If caching is enabled, the parsed templates are cached,
+// so their names must be the same as the ones passed to Render, such as `view/index.html`.
+// The variables output into the script or URL context without escaping are
+// returned as errors in the strict escaping mode, otherwise logged as warnings.
+func (render *Render) Precompile(dir string, extensions ...string) error {
+	var errs []string
+	err := walkFS(render.fs, dir, func(filename string, info os.FileInfo) {
+		if !hasExtension(filename, extensions) {
+			return
+		}
+		fbytes, fileInfo, err := render.readFile(filename)
+		if err != nil {
+			errs = append(errs, err.Error())
+			return
+		}
+		tpl, err := render.compile(filename, fbytes)
+		if err != nil {
+			errs = append(errs, err.Error())
+			return
+		}
+		if !render.strictEscaping {
+			for _, v := range LintEscaping(filename, fbytes) {
+				Warningf("Precompile templates: %s", v)
+			}
+		}
+		if render.caching {
+			render.Lock()
+			render.tplCache[filename] = &Tpl{template: tpl, modTime: fileInfo.ModTime()}
+			render.Unlock()
+		}
+	})
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) > 0 {
+		return errors.New("Precompile templates:\n" + strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// walkFS walks the files under the dir of the file system in lexical order.
+func walkFS(fsys http.FileSystem, dir string, fn func(filename string, info os.FileInfo)) error {
+	f, err := fsys.Open(dir)
+	if err != nil {
+		return err
+	}
+	infos, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	sort.Sort(byName(infos))
+	for _, info := range infos {
+		filename := path.Join(dir, info.Name())
+		if _, ok := fsys.(diskFS); ok {
+			filename = filepath.Join(dir, info.Name())
+		}
+		if info.IsDir() {
+			if err = walkFS(fsys, filename, fn); err != nil {
+				return err
 			}
+			continue
+		}
+		fn(filename, info)
+	}
+	return nil
+}
+
+func hasExtension(filename string, extensions []string) bool {
+	if len(extensions) == 0 {
+		return true
+	}
+	ext := filepath.Ext(filename)
+	for _, e := range extensions {
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// LayoutContentBlock is the block of the layout,
+// into which the template without any block is rendered by RenderWithLayout.
+const LayoutContentBlock = "content"
+
+var blockTagRegexp = regexp.MustCompile(`\{%-?\s*block\s`)
+
+// SetLayout sets the default layout of RenderWithLayout.
+func (render *Render) SetLayout(layout string) {
+	render.Lock()
+	render.layout = layout
+	render.Unlock()
+}
+
+// RenderWithLayout renders the template into the layout,
+// so that the template does not need to start with `{% extends %}`.
+// The blocks of the template override the blocks with the same names of the layout,
+// and the template without any block is rendered into the `content` block.
+// If the layout is empty, the default layout set by SetLayout is used.
+// An error is returned if the layout does not define a block of the template.
+// The template and layout are cached the same as Render.
+func (render *Render) RenderWithLayout(layout, filename string, data Map) ([]byte, error) {
+	if layout == "" {
+		render.RLock()
+		layout = render.layout
+		render.RUnlock()
+		if layout == "" {
+			return nil, errors.New("RenderWithLayout: no layout is specified for " + filename)
+		}
+	}
+	fbytes, fileInfo, err := render.readFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	_, layoutInfo, err := render.readFile(layout)
+	if err != nil {
+		return nil, err
+	}
+
+	key := filename + "\x00" + layout
+	render.RLock()
+	tplObj, has := render.tplCache[key]
+	render.RUnlock()
+	var tpl *pongo2.Template
+	if has && tplObj.modTime.Equal(fileInfo.ModTime()) && tplObj.layoutModTime.Equal(layoutInfo.ModTime()) {
+		tpl = tplObj.template
+	} else {
+		tpl, err = render.compileWithLayout(layout, filename, fbytes)
+		if err != nil {
+			return nil, err
+		}
+		if render.caching {
+			render.Lock()
+			render.tplCache[key] = &Tpl{template: tpl, modTime: fileInfo.ModTime(), layoutModTime: layoutInfo.ModTime()}
+			render.Unlock()
 		}
 	}
 	var b bytes.Buffer
-	err = tpl.ExecuteWriter(data2, &b)
-	if withInfo {
-		return b.Bytes(), newNowFileInfo(fileInfo, int64(b.Len())), err
+	err = tpl.ExecuteWriter(render.context(data), &b)
+	return b.Bytes(), err
+}
+
+// compileWithLayout compiles the template extending the layout,
+// and checks that the layout defines all the blocks of the template.
+func (render *Render) compileWithLayout(layout, filename string, fbytes []byte) (*pongo2.Template, error) {
+	absLayout := path.Clean("/" + layout)
+	if _, ok := render.fs.(diskFS); ok {
+		abs, err := filepath.Abs(layout)
+		if err != nil {
+			return nil, err
+		}
+		absLayout = filepath.ToSlash(abs)
 	}
-	return b.Bytes(), nil, err
+	var src bytes.Buffer
+	src.WriteString(`{% extends "`)
+	src.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(absLayout))
+	src.WriteString(`" %}`)
+	if blockTagRegexp.Match(fbytes) {
+		src.Write(fbytes)
+	} else {
+		src.WriteString("{% block " + LayoutContentBlock + " %}")
+		src.Write(fbytes)
+		src.WriteString("{% endblock %}")
+	}
+	tpl, err := render.compile(filename, src.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	defined := map[string]bool{}
+	for parent := tpl.Parent(); parent != nil; parent = parent.Parent() {
+		for _, name := range parent.BlockNames() {
+			defined[name] = true
+		}
+	}
+	for _, name := range tpl.BlockNames() {
+		if !defined[name] {
+			return nil, fmt.Errorf("RenderWithLayout: the layout %s has no block %q used by %s", layout, name, filename)
+		}
+	}
+	return tpl, nil
+}
+
+// readFile reads the template file through the file cache if caching is enabled.
+func (render *Render) readFile(filename string) ([]byte, os.FileInfo, error) {
+	var f http.File
+	var err error
+	if render.caching {
+		f, err = render.openCacheFile(filename)
+	} else {
+		f, err = render.fs.Open(filename)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if fileInfo.IsDir() {
+		return nil, nil, errors.New(filename + " is a directory")
+	}
+	fbytes, err := ioutil.ReadAll(f)
+	return fbytes, fileInfo, err
+}
+
+// context returns the template context merged with the global template variables.
+func (render *Render) context(data Map) pongo2.Context {
+	if data == nil {
+		return render.tplContext
+	}
+	// copies the data, so that the same data can be rendered concurrently
+	ctx := make(pongo2.Context, len(data)+len(render.tplContext))
+	for k, v := range render.tplContext {
+		ctx[k] = v
+	}
+	for k, v := range data {
+		ctx[k] = v
+	}
+	return ctx
 }
 
 type nowFileInfo struct {
@@ -192,10 +462,11 @@ func (render *Render) renderForFS(filename string, data Map) ([]byte, os.FileInf
 	if render.caching {
 		return render.fromCache(filename, data, true)
 	}
-	f, err := os.Open(filename)
+	f, err := render.fs.Open(filename)
 	if err != nil {
 		return nil, nil, err
 	}
+	defer f.Close()
 
 	fileInfo, err := f.Stat()
 	if err != nil {
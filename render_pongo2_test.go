@@ -0,0 +1,286 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/henrylee2cn/faygo/pongo2"
+)
+
+func TestRenderWithLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faygo_layout_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"layout.html":  `<title>{% block title %}default{% endblock %}</title><body>{% block content %}{% endblock %}</body>`,
+		"plain.html":   `hello {{ name }}`,
+		"blocks.html":  `{% block title %}{{ name }}{% endblock %}{% block content %}body{% endblock %}`,
+		"missing.html": `{% block sidebar %}side{% endblock %}`,
+	}
+	for name, content := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	render := newRender(nil)
+	render.SetLayout(filepath.Join(dir, "layout.html"))
+	cases := []struct{ name, want string }{
+		{"plain.html", "<title>default</title><body>hello faygo</body>"},
+		{"blocks.html", "<title>faygo</title><body>body</body>"},
+	}
+	for _, c := range cases {
+		b, err := render.RenderWithLayout("", filepath.Join(dir, c.name), Map{"name": "faygo"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, b, c.want)
+		}
+	}
+	_, err = render.RenderWithLayout("", filepath.Join(dir, "missing.html"), nil)
+	if err == nil || !strings.Contains(err.Error(), `"sidebar"`) {
+		t.Fatalf("expected the missing block error, got %v", err)
+	}
+}
+
+func TestPrecompile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faygo_precompile_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	good := filepath.Join(dir, "good.html")
+	bad := filepath.Join(dir, "sub", "bad.html")
+	os.MkdirAll(filepath.Dir(bad), 0755)
+	ioutil.WriteFile(good, []byte(`{{ name }}`), 0644)
+	ioutil.WriteFile(bad, []byte(`{% if %}`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "skip.txt"), []byte(`{% if %}`), 0644)
+
+	render := newRender(func(name string) (http.File, error) { return os.Open(name) })
+	err = render.Precompile(dir, ".html")
+	if err == nil || !strings.Contains(err.Error(), "bad.html") || strings.Contains(err.Error(), "skip.txt") {
+		t.Fatalf("expected the error of bad.html only, got %v", err)
+	}
+	if _, ok := render.tplCache[good]; !ok {
+		t.Fatal("the precompiled template should be cached")
+	}
+	os.Remove(bad)
+	if err = render.Precompile(dir, ".html"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenderFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"view/base.html":  {Data: []byte(`[{% block content %}{% endblock %}]`)},
+		"view/index.html": {Data: []byte(`{% extends "base.html" %}{% block content %}{{ name }}{% endblock %}`)},
+		"view/plain.html": {Data: []byte(`{{ name }}!`)},
+		"view/broken.tpl": {Data: []byte(`{% if %}`)},
+	}
+	for _, caching := range []bool{false, true} {
+		var render *Render
+		if caching {
+			m := newFileServerManager(1<<20, 0, "memory", "lru", true, false)
+			render = newRender(func(name string) (http.File, error) {
+				return m.OpenFile(render.fs, name, "", false)
+			})
+		} else {
+			render = newRender(nil)
+		}
+		render.SetFS(http.FS(fsys))
+		b, err := render.Render("view/index.html", Map{"name": "faygo"})
+		if err != nil || string(b) != "[faygo]" {
+			t.Fatalf("caching=%v: Render got %q, %v", caching, b, err)
+		}
+		b, err = render.RenderWithLayout("view/base.html", "view/plain.html", Map{"name": "faygo"})
+		if err != nil || string(b) != "[faygo!]" {
+			t.Fatalf("caching=%v: RenderWithLayout got %q, %v", caching, b, err)
+		}
+		if err = render.Precompile("view", ".html"); err != nil {
+			t.Fatalf("caching=%v: %v", caching, err)
+		}
+		if err = render.Precompile("view"); err == nil || !strings.Contains(err.Error(), "broken.tpl") {
+			t.Fatalf("caching=%v: expected the error of broken.tpl, got %v", caching, err)
+		}
+	}
+}
+
+func TestStrictEscaping(t *testing.T) {
+	fsys := fstest.MapFS{
+		"view/page.html": {Data: []byte("<a href=\"{{ link }}\">{{ title }}</a>\n" +
+			"<script>var a = 1 < 2; var n = \"{{ name }}\";</script>\n" +
+			"<button onclick=\"go('{{ id|safe_js }}')\">{{ html }}</button>")},
+		"view/safe.html": {Data: []byte(`<a href="{{ link|safe_url }}">{{ html }}</a><script>"{{ name|safe_js }}"</script>`)},
+	}
+	violations := LintEscaping("view/page.html", fsys["view/page.html"].Data)
+	if len(violations) != 2 ||
+		violations[0].String() != `view/page.html:1: variable "link" in url context is not filtered by safe_url` ||
+		violations[1].String() != `view/page.html:2: variable "name" in js context is not filtered by safe_js` {
+		t.Fatalf("unexpected violations: %v", violations)
+	}
+	violations = LintEscaping("view/filters.html", []byte(`<a href="{{ next|iriencode }}">`+"\n"+`<a href="/search?q={{ q|urlencode }}">`))
+	if len(violations) != 1 || violations[0].Variable != "next" || violations[0].Line != 1 {
+		t.Fatalf("iriencode: unexpected violations: %v", violations)
+	}
+
+	render := newRender(nil)
+	render.SetFS(http.FS(fsys))
+	data := Map{"link": "javascript:alert(1)", "name": `"</script>`, "html": SafeHTML("<b>x</b>"), "id": "1"}
+	if _, err := render.Render("view/page.html", data); err != nil {
+		t.Fatal(err)
+	}
+	b, err := render.Render("view/safe.html", data)
+	if err != nil || string(b) != `<a href="about:invalid#unsafe"><b>x</b></a><script>"\u0022\u003C/script\u003E"</script>` {
+		t.Fatalf("got %q, %v", b, err)
+	}
+	data["link"], data["name"] = SafeURL("javascript:void(0)"), SafeJS("a\"b")
+	if b, _ = render.Render("view/safe.html", data); string(b) != `<a href="javascript:void(0)"><b>x</b></a><script>"a"b"</script>` {
+		t.Fatalf("got %q", b)
+	}
+
+	// the values trusted in the other contexts are still escaped in the HTML
+	if b, _ = render.Render("view/page.html", Map{"html": SafeJS("<script>alert(1)</script>"), "id": "1"}); !strings.Contains(string(b), "&lt;script&gt;alert(1)&lt;/script&gt;</button>") {
+		t.Fatalf("got %q", b)
+	}
+
+	render.SetStrictEscaping(true)
+	if _, err = render.Render("view/page.html", data); err == nil || !strings.Contains(err.Error(), "page.html:2") {
+		t.Fatalf("expected the escaping error, got %v", err)
+	}
+	if err = render.Precompile("view"); err == nil || !strings.Contains(err.Error(), "page.html:1") || strings.Contains(err.Error(), "safe.html") {
+		t.Fatalf("expected the escaping error of page.html only, got %v", err)
+	}
+}
+
+func TestRenderToString(t *testing.T) {
+	fsys := fstest.MapFS{
+		"mail/welcome.html": {Data: []byte(`Hi {{ name }}, {{ greeting }}`)},
+		"mail/broken.html":  {Data: []byte("line1\n{% if %}")},
+	}
+	for _, caching := range []bool{false, true} {
+		var render *Render
+		if caching {
+			m := newFileServerManager(1<<20, 0, "memory", "lru", true, false)
+			render = newRender(func(name string) (http.File, error) {
+				return m.OpenFile(render.fs, name, "", false)
+			})
+		} else {
+			render = newRender(nil)
+		}
+		render.SetFS(http.FS(fsys))
+		render.TemplateVar("greeting", "welcome")
+		// the same data is rendered concurrently
+		data := Map{"name": "faygo"}
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s, err := render.RenderToString("mail/welcome.html", data)
+				if err != nil || s != "Hi faygo, welcome" {
+					t.Errorf("caching=%v: got %q, %v", caching, s, err)
+				}
+			}()
+		}
+		wg.Wait()
+		if len(data) != 1 {
+			t.Fatalf("caching=%v: the data is modified: %v", caching, data)
+		}
+		_, err := render.RenderToString("mail/broken.html", nil)
+		if _, ok := err.(*pongo2.Error); !ok || !strings.Contains(err.Error(), "mail/broken.html | Line 2") {
+			t.Fatalf("caching=%v: expected the pongo2 error with the file and line, got %v", caching, err)
+		}
+	}
+}
+
+func TestFragment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faygo_fragment_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	row := filepath.Join(dir, "row.html")
+	broken := filepath.Join(dir, "broken.html")
+	ioutil.WriteFile(row, []byte(`<tr><td>{{ name }}</td></tr>`), 0644)
+	ioutil.WriteFile(broken, []byte(`{% if %}`), 0644)
+	frame := newTestFrame(t, "fragment_test")
+	var fragmentErr error
+	frame.GET("/row", HandlerFunc(func(ctx *Context) error {
+		return ctx.Fragment(200, row, Map{"name": "<faygo>"})
+	}))
+	frame.GET("/broken", HandlerFunc(func(ctx *Context) error {
+		fragmentErr = ctx.Fragment(200, broken, nil)
+		return nil
+	}))
+	rec := serveTest(frame, httptest.NewRequest("GET", "/row", nil))
+	if rec.Body.String() != "<tr><td>&lt;faygo&gt;</td></tr>" || rec.Header().Get(HeaderContentType) != MIMETextHTMLCharsetUTF8 ||
+		rec.Header().Get(HeaderCacheControl) != "" {
+		t.Fatalf("got %q %v", rec.Body.String(), rec.Header())
+	}
+	rec = serveTest(frame, httptest.NewRequest("GET", "/broken", nil))
+	if _, ok := fragmentErr.(*pongo2.Error); !ok || rec.Body.Len() != 0 {
+		t.Fatalf("got %v %q", fragmentErr, rec.Body.String())
+	}
+}
+
+func TestErrorTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "faygo_error_template_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	notFound := filepath.Join(dir, "404.html")
+	broken := filepath.Join(dir, "500.html")
+	ioutil.WriteFile(notFound, []byte(`<h1>{{ status }} {{ status_text }}</h1>{{ method }} {{ url }}`), 0644)
+	ioutil.WriteFile(broken, []byte(`{% if %}`), 0644)
+	SetErrorTemplate(http.StatusNotFound, notFound)
+	SetErrorTemplate(http.StatusInternalServerError, broken)
+	defer SetErrorTemplate(http.StatusNotFound, "")
+	defer SetErrorTemplate(http.StatusInternalServerError, "")
+
+	frame := newTestFrame(t, "error_template_test")
+	frame.GET("/fail/:status", HandlerFunc(func(ctx *Context) error {
+		status, _ := strconv.Atoi(ctx.Param("status"))
+		ctx.Error(status, "failed")
+		return nil
+	}))
+	cases := []struct {
+		path string
+		code int
+		want string
+	}{
+		{"/missing?a=1", 404, "<h1>404 Not Found</h1>GET /missing?a=1"},
+		{"/fail/500", 500, "faygo/" + VERSION},
+		{"/fail/503", 503, "faygo/" + VERSION},
+	}
+	for _, c := range cases {
+		w := serveTest(frame, httptest.NewRequest("GET", c.path, nil))
+		if w.Code != c.code || !strings.Contains(w.Body.String(), c.want) {
+			t.Fatalf("%s: got %d %q, want %d %q", c.path, w.Code, w.Body.String(), c.code, c.want)
+		}
+	}
+}
@@ -0,0 +1,567 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/faygo/acceptencoder"
+)
+
+// Headers of the response cache
+const (
+	HeaderXCache = "X-Cache"
+	HeaderAge    = "Age"
+)
+
+// Default bounds of a response cache
+const (
+	DefaultResponseCacheSize    = 32 << 20
+	DefaultResponseCacheMaxKeys = 1 << 16
+)
+
+type (
+	// ResponseCache is a middleware caching the responses of the expensive read routes for a short time,
+	// the hits are served without calling the following handlers.
+	// Only the GET and HEAD responses are cached, and the ones with Set-Cookie never.
+	ResponseCache struct {
+		ttl      time.Duration
+		keyFunc  func(ctx *Context) string
+		headers  []string
+		statuses map[int]bool
+		maxSize  int64
+		backend  CacheBackend
+		maxKeys  int
+		keys     map[string]*list.Element // the stored keys for Invalidate
+		keyList  *list.List               // the stored keys, the most recent first
+		keysLock sync.Mutex
+		calls    map[string]*responseCacheCall
+		lock     sync.Mutex
+		// called with the key prefix after Invalidate, "" for InvalidateAll
+		onInvalidate []func(keyPrefix string)
+	}
+	// ResponseCacheOption is the option of CacheResponse.
+	ResponseCacheOption func(*ResponseCache)
+	// responseCacheCall is an in-flight miss, the concurrent misses of the same key wait for it.
+	responseCacheCall struct {
+		done  chan struct{}
+		entry *CacheEntry
+	}
+)
+
+var _ Handler = new(ResponseCache)
+
+// CacheResponse creates a response caching middleware with the ttl.
+// The responses are keyed by the method, path, query, negotiated content encoding and
+// the headers selected by CacheVaryHeaders, or by the CacheKeyFunc.
+// The body is stored as sent, that is compressed if the gzip is enabled,
+// so the hits skip both the handlers and the compressor.
+// By default, only the 200 responses are cached, in a LRU cache of DefaultResponseCacheSize bytes,
+// and the body larger than 1/64 of the size bound is not cached.
+// At most DefaultResponseCacheMaxKeys responses are cached, the least recent ones are removed beyond it.
+// The cached responses carry the ETag of the body and `Cache-Control: max-age=<ttl>`,
+// unless the handlers set them, and If-None-Match is replied 304 Not Modified.
+// The responses with `Cache-Control: no-store` or `private` are not cached.
+// The concurrent misses of the same key call the following handlers only once.
+// As a shared cache (RFC 9111 §3.5), the requests with the Authorization header are never served
+// from the cache, and their responses are cached only with `Cache-Control: public`, since the key
+// does not include the caller; to cache them per caller, add the header to the key:
+//
+//	faygo.CacheResponse(time.Minute, faygo.CacheVaryHeaders("Authorization"))
+//
+//	e.g. frame.GET("/report", faygo.CacheResponse(time.Second), reportHandler)
+func CacheResponse(ttl time.Duration, opts ...ResponseCacheOption) *ResponseCache {
+	rc := &ResponseCache{
+		ttl:      ttl,
+		statuses: map[int]bool{http.StatusOK: true},
+		maxSize:  DefaultResponseCacheSize,
+		maxKeys:  DefaultResponseCacheMaxKeys,
+		keys:     make(map[string]*list.Element),
+		keyList:  list.New(),
+		calls:    make(map[string]*responseCacheCall),
+	}
+	rc.keyFunc = rc.defaultKey
+	for _, opt := range opts {
+		opt(rc)
+	}
+	if rc.backend == nil {
+		rc.backend = NewLRUCacheBackend(rc.maxSize)
+	}
+	return rc
+}
+
+// CacheKeyFunc replaces the cache key builder.
+func CacheKeyFunc(fn func(ctx *Context) string) ResponseCacheOption {
+	return func(rc *ResponseCache) {
+		rc.keyFunc = fn
+	}
+}
+
+// CacheVaryHeaders adds the request headers to the default cache key, such as `Accept-Language`.
+func CacheVaryHeaders(headers ...string) ResponseCacheOption {
+	return func(rc *ResponseCache) {
+		for _, h := range headers {
+			rc.headers = append(rc.headers, http.CanonicalHeaderKey(h))
+		}
+	}
+}
+
+// CacheStatuses replaces the status codes of the responses to be cached.
+func CacheStatuses(codes ...int) ResponseCacheOption {
+	return func(rc *ResponseCache) {
+		rc.statuses = make(map[int]bool, len(codes))
+		for _, code := range codes {
+			rc.statuses[code] = true
+		}
+	}
+}
+
+// CacheMaxSize sets the size bound in bytes of the default LRU backend.
+func CacheMaxSize(maxSize int64) ResponseCacheOption {
+	return func(rc *ResponseCache) {
+		rc.maxSize = maxSize
+	}
+}
+
+// CacheMaxKeys sets the maximum number of the cached responses,
+// which bounds the keys kept for Invalidate, such as with the backend of CacheWithBackend.
+func CacheMaxKeys(maxKeys int) ResponseCacheOption {
+	return func(rc *ResponseCache) {
+		rc.maxKeys = maxKeys
+	}
+}
+
+// CacheWithBackend stores the responses in the backend, such as the one of the file cache.
+func CacheWithBackend(backend CacheBackend) ResponseCacheOption {
+	return func(rc *ResponseCache) {
+		rc.backend = backend
+	}
+}
+
+// CacheOnInvalidate adds the function called with the key prefix after Invalidate,
+// or with "" after InvalidateAll, such as to broadcast the invalidation to the other instances.
+func CacheOnInvalidate(fn func(keyPrefix string)) ResponseCacheOption {
+	return func(rc *ResponseCache) {
+		rc.onInvalidate = append(rc.onInvalidate, fn)
+	}
+}
+
+// defaultKey builds the key by the method, path, sorted query, content encoding and the selected headers.
+func (rc *ResponseCache) defaultKey(ctx *Context) string {
+	var b strings.Builder
+	b.WriteString(ctx.R.Method)
+	b.WriteByte(' ')
+	b.WriteString(ctx.R.URL.Path)
+	if query := ctx.R.URL.Query(); len(query) > 0 {
+		b.WriteByte('?')
+		b.WriteString(query.Encode())
+	}
+	b.WriteString("\x00")
+	b.WriteString(acceptencoder.ParseEncoding(ctx.R))
+	for _, h := range rc.headers {
+		b.WriteString("\x00")
+		b.WriteString(h)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(ctx.R.Header[h], ","))
+	}
+	return b.String()
+}
+
+// Serve implements the Handler.
+func (rc *ResponseCache) Serve(ctx *Context) error {
+	if ctx.R.Method != "GET" && ctx.R.Method != "HEAD" {
+		return nil
+	}
+	key := rc.keyFunc(ctx)
+	// the response to the caller is personal, unless the key includes the Authorization
+	personal := ctx.R.Header.Get(HeaderAuthorization) != "" && !rc.varyAuthorization()
+	call := &responseCacheCall{done: make(chan struct{})}
+	if !personal {
+		if entry, ok := rc.backend.Get(key); ok {
+			rc.keysLock.Lock()
+			if e, ok := rc.keys[key]; ok {
+				rc.keyList.MoveToFront(e)
+			}
+			rc.keysLock.Unlock()
+			rc.serveEntry(ctx, entry)
+			return nil
+		}
+		rc.keysLock.Lock()
+		rc.removeKey(key) // expired or evicted
+		rc.keysLock.Unlock()
+		rc.lock.Lock()
+		if call, ok := rc.calls[key]; ok {
+			rc.lock.Unlock()
+			<-call.done
+			if call.entry != nil {
+				rc.serveEntry(ctx, call.entry)
+				return nil
+			}
+			// the response is not cacheable, such as an error
+			return nil
+		}
+		rc.calls[key] = call
+		rc.lock.Unlock()
+
+		defer func() {
+			rc.lock.Lock()
+			delete(rc.calls, key)
+			rc.lock.Unlock()
+			close(call.done)
+		}()
+	}
+	cw := &cacheWriter{limit: rc.maxSize / 64}
+	restore := ctx.W.Wrap(func(w http.ResponseWriter) http.ResponseWriter {
+		cw.ResponseWriter = w
+		return cw
+	})
+	defer restore() // if the handlers panic
+	h := ctx.W.Header()
+	h.Set(HeaderXCache, "MISS")
+	ctx.Next()
+	restore()
+	if cw.streaming || cw.hijacked || !ctx.W.committed {
+		return nil
+	}
+	status, body := ctx.W.Status(), cw.body.Bytes()
+	if rc.statuses[status] && h.Get(HeaderSetCookie) == "" && !noStore(h) && (!personal || isPublic(h)) {
+		if h.Get(HeaderETag) == "" {
+			h.Set(HeaderETag, bodyETag(body))
+		}
+		if h.Get(HeaderCacheControl) == "" && rc.ttl > 0 {
+			h.Set(HeaderCacheControl, "max-age="+strconv.FormatInt(int64(rc.ttl/time.Second), 10))
+		}
+		entry := &CacheEntry{
+			Name:    key,
+			Size:    int64(len(body)),
+			ModTime: time.Now(),
+			ETag:    h.Get(HeaderETag),
+			Content: encodeResponse(status, h, body),
+		}
+		if rc.backend.Set(key, entry, rc.ttl) == nil {
+			rc.keysLock.Lock()
+			rc.addKey(key)
+			rc.keysLock.Unlock()
+			call.entry = entry
+		}
+	}
+	// send the buffered response, which is committed by ctx.W already
+	w := ctx.W.writer
+	if notModified(ctx, status) {
+		ctx.W.status, ctx.W.size = http.StatusNotModified, 0
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	w.WriteHeader(status)
+	_, err := w.Write(body)
+	return err
+}
+
+// noStore reports whether the response forbids the shared caches.
+func noStore(h http.Header) bool {
+	cc := strings.ToLower(h.Get(HeaderCacheControl))
+	return strings.Contains(cc, "no-store") || strings.Contains(cc, "private")
+}
+
+// isPublic reports whether the response allows the shared caches explicitly.
+func isPublic(h http.Header) bool {
+	return strings.Contains(strings.ToLower(h.Get(HeaderCacheControl)), "public")
+}
+
+// varyAuthorization reports whether the default key includes the Authorization header.
+func (rc *ResponseCache) varyAuthorization() bool {
+	for _, h := range rc.headers {
+		if h == HeaderAuthorization {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyETag returns the strong entity tag of the body by its size and hash.
+func bodyETag(body []byte) string {
+	hash := fnv.New64a()
+	hash.Write(body)
+	return `"` + strconv.FormatInt(int64(len(body)), 16) + "-" + strconv.FormatUint(hash.Sum64(), 16) + `"`
+}
+
+// notModified reports whether the cacheable response matches If-None-Match of the request,
+// and removes the headers of the body if it does.
+func notModified(ctx *Context, status int) bool {
+	h := ctx.W.Header()
+	etag := h.Get(HeaderETag)
+	if status != http.StatusOK || etag == "" || !etagMatch(ctx.R.Header.Get(HeaderIfNoneMatch), etag) {
+		return false
+	}
+	delete(h, HeaderContentType)
+	delete(h, HeaderContentLength)
+	return true
+}
+
+// etagMatch reports whether the etag weakly matches one of the comma-separated list of If-None-Match.
+func etagMatch(list, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// serveEntry replies the cached response and stops the following handlers.
+func (rc *ResponseCache) serveEntry(ctx *Context, entry *CacheEntry) {
+	ctx.Stop()
+	status, header, body, err := decodeResponse(entry.Content)
+	if err != nil {
+		global.errorFunc(ctx, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h := ctx.W.Header()
+	for k, v := range header {
+		h[k] = v
+	}
+	h.Set(HeaderXCache, "HIT")
+	h.Set(HeaderAge, strconv.FormatInt(int64(time.Since(entry.ModTime)/time.Second), 10))
+	if notModified(ctx, status) {
+		ctx.W.WriteHeader(http.StatusNotModified)
+		return
+	}
+	ctx.W.WriteHeader(status)
+	if ctx.R.Method != "HEAD" {
+		ctx.W.Write(body)
+	}
+}
+
+// Invalidate removes the cached responses whose keys start with the prefix,
+// such as `GET /report` with the default key, and returns the number of the removed ones.
+func (rc *ResponseCache) Invalidate(keyPrefix string) int {
+	rc.keysLock.Lock()
+	var count int
+	for key := range rc.keys {
+		if strings.HasPrefix(key, keyPrefix) {
+			if rc.backend.Del(key) {
+				count++
+			}
+			rc.removeKey(key)
+		}
+	}
+	rc.keysLock.Unlock()
+	for _, fn := range rc.onInvalidate {
+		fn(keyPrefix)
+	}
+	return count
+}
+
+// InvalidateAll removes all the cached responses, and returns the number of the removed ones.
+// The responses beyond CacheMaxKeys are removed when storing the new ones,
+// so none of the responses in the backend is missed.
+func (rc *ResponseCache) InvalidateAll() int {
+	return rc.Invalidate("")
+}
+
+// addKey records the stored key as the most recent one, and removes the least recent
+// responses beyond maxKeys, so that the keys are bounded even if the backend evicts
+// the entries silently. It is called with keysLock held.
+func (rc *ResponseCache) addKey(key string) {
+	if e, ok := rc.keys[key]; ok {
+		rc.keyList.MoveToFront(e)
+		return
+	}
+	rc.keys[key] = rc.keyList.PushFront(key)
+	for rc.maxKeys > 0 && rc.keyList.Len() > rc.maxKeys {
+		oldest := rc.keyList.Back().Value.(string)
+		rc.backend.Del(oldest)
+		rc.removeKey(oldest)
+	}
+}
+
+// removeKey forgets the key, it is called with keysLock held.
+func (rc *ResponseCache) removeKey(key string) {
+	if e, ok := rc.keys[key]; ok {
+		rc.keyList.Remove(e)
+		delete(rc.keys, key)
+	}
+}
+
+// cacheWriter buffers the response up to the limit, so that the ETag and the Cache-Control
+// can be added to the header before sending it; the larger or flushed response is streamed
+// and not cached.
+type cacheWriter struct {
+	ResponseWriterWrapper
+	status    int
+	body      bytes.Buffer
+	limit     int64
+	streaming bool
+	hijacked  bool
+}
+
+// WriteHeader delays the status until the response is complete or streamed.
+func (w *cacheWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	if !w.streaming && int64(w.body.Len()+len(b)) > w.limit {
+		w.stream()
+	}
+	if w.streaming {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+func (w *cacheWriter) Flush() {
+	if !w.streaming {
+		w.stream()
+	}
+	w.ResponseWriterWrapper.Flush()
+}
+
+func (w *cacheWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriterWrapper.Hijack()
+	w.hijacked = err == nil
+	return conn, rw, err
+}
+
+// stream sends the status and the buffered body, and writes the rest through.
+func (w *cacheWriter) stream() {
+	w.streaming = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(w.body.Bytes())
+	w.body.Reset()
+}
+
+// responseRecorder copies the response body while writing it to the client.
+type responseRecorder struct {
+	http.ResponseWriter
+	body     bytes.Buffer
+	limit    int64
+	overflow bool
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if !r.overflow {
+		if int64(r.body.Len()+len(b)) > r.limit {
+			r.overflow = true
+			r.body.Reset()
+		} else {
+			r.body.Write(b)
+		}
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// hopHeaders are the hop-by-hop headers, which are not cached.
+var hopHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	HeaderXCache:          true,
+	HeaderAge:             true,
+}
+
+// encodeResponse encodes the status, the end-to-end headers and the body.
+func encodeResponse(status int, header http.Header, body []byte) []byte {
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		if !hopHeaders[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	b := appendUvarint(nil, uint64(status))
+	b = appendUvarint(b, uint64(len(keys)))
+	for _, k := range keys {
+		b = appendUvarint(b, uint64(len(k)))
+		b = append(b, k...)
+		b = appendUvarint(b, uint64(len(header[k])))
+		for _, v := range header[k] {
+			b = appendUvarint(b, uint64(len(v)))
+			b = append(b, v...)
+		}
+	}
+	return append(b, body...)
+}
+
+// decodeResponse decodes the response encoded by encodeResponse.
+func decodeResponse(b []byte) (status int, header http.Header, body []byte, err error) {
+	errMalformed := errors.New("ResponseCache: malformed entry")
+	uvarint := func() (uint64, bool) {
+		v, k := binary.Uvarint(b)
+		if k <= 0 {
+			return 0, false
+		}
+		b = b[k:]
+		return v, true
+	}
+	str := func() (string, bool) {
+		n, ok := uvarint()
+		if !ok || uint64(len(b)) < n {
+			return "", false
+		}
+		s := string(b[:n])
+		b = b[n:]
+		return s, true
+	}
+	s, ok := uvarint()
+	if !ok {
+		return 0, nil, nil, errMalformed
+	}
+	n, ok := uvarint()
+	if !ok {
+		return 0, nil, nil, errMalformed
+	}
+	header = make(http.Header, n)
+	for i := uint64(0); i < n; i++ {
+		k, ok := str()
+		if !ok {
+			return 0, nil, nil, errMalformed
+		}
+		m, ok := uvarint()
+		if !ok {
+			return 0, nil, nil, errMalformed
+		}
+		for j := uint64(0); j < m; j++ {
+			v, ok := str()
+			if !ok {
+				return 0, nil, nil, errMalformed
+			}
+			header[k] = append(header[k], v)
+		}
+	}
+	return int(s), header, b, nil
+}
@@ -0,0 +1,259 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheResponse(t *testing.T) {
+	frame := newTestFrame(t, "response_cache_test")
+	rc := CacheResponse(time.Minute)
+	var calls int32
+	frame.GET("/report", rc, HandlerFunc(func(ctx *Context) error {
+		atomic.AddInt32(&calls, 1)
+		ctx.SetHeader("X-Report", "1")
+		return ctx.String(200, "report %s", ctx.QueryParam("id"))
+	}))
+	frame.GET("/cookie", rc, HandlerFunc(func(ctx *Context) error {
+		atomic.AddInt32(&calls, 1)
+		ctx.SetCookie("k", "v")
+		return ctx.String(200, "cookie")
+	}))
+	frame.GET("/error", rc, HandlerFunc(func(ctx *Context) error {
+		atomic.AddInt32(&calls, 1)
+		return ctx.String(500, "error")
+	}))
+	frame.build()
+
+	get := func(u string) (string, string) {
+		rec := serveTest(frame, httptest.NewRequest("GET", u, nil))
+		if rec.Code == 200 && rec.Header().Get("X-Report") == "" && u != "/cookie" {
+			t.Fatalf("%s: the headers are not cached", u)
+		}
+		return rec.Header().Get(HeaderXCache), rec.Body.String()
+	}
+	if x, body := get("/report?id=1"); x != "MISS" || body != "report 1" {
+		t.Fatalf("got %s %q", x, body)
+	}
+	if x, body := get("/report?id=1"); x != "HIT" || body != "report 1" {
+		t.Fatalf("got %s %q", x, body)
+	}
+	if x, _ := get("/report?id=2"); x != "MISS" {
+		t.Fatalf("another query: got %s", x)
+	}
+	if calls != 2 {
+		t.Fatalf("calls: got %d, want 2", calls)
+	}
+	if n := rc.Invalidate("GET /report"); n != 2 {
+		t.Fatalf("Invalidate: got %d, want 2", n)
+	}
+	if x, _ := get("/report?id=1"); x != "MISS" {
+		t.Fatalf("after Invalidate: got %s", x)
+	}
+	for _, u := range []string{"/cookie", "/error"} {
+		calls = 0
+		get(u)
+		if x, _ := get(u); x != "MISS" || calls != 2 {
+			t.Fatalf("%s is cached: %s %d", u, x, calls)
+		}
+	}
+}
+
+func TestCacheResponseMaxKeys(t *testing.T) {
+	frame := newTestFrame(t, "response_cache_max_keys_test")
+	var invalidated []string
+	rc := CacheResponse(time.Minute, CacheMaxKeys(2), CacheOnInvalidate(func(keyPrefix string) {
+		invalidated = append(invalidated, keyPrefix)
+	}))
+	frame.GET("/report", rc, HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, "report %s", ctx.QueryParam("id"))
+	}))
+	frame.build()
+	get := func(u string) string {
+		return serveTest(frame, httptest.NewRequest("GET", u, nil)).Header().Get(HeaderXCache)
+	}
+	for _, id := range []string{"1", "2", "1", "3"} {
+		get("/report?id=" + id)
+	}
+	// the least recent one is removed beyond the bound
+	if len(rc.keys) != 2 || rc.keyList.Len() != 2 || rc.backend.Len() != 2 {
+		t.Fatalf("keys: got %d %d %d, want 2", len(rc.keys), rc.keyList.Len(), rc.backend.Len())
+	}
+	if x := get("/report?id=2"); x != "MISS" {
+		t.Fatalf("the least recent one: got %s", x)
+	}
+	if x := get("/report?id=3"); x != "HIT" {
+		t.Fatalf("the recent one: got %s", x)
+	}
+	if n := rc.InvalidateAll(); n != 2 || len(rc.keys) != 0 || rc.keyList.Len() != 0 || rc.backend.Len() != 0 {
+		t.Fatalf("InvalidateAll: got %d, %d keys and %d entries left", n, len(rc.keys), rc.backend.Len())
+	}
+	if len(invalidated) != 1 || invalidated[0] != "" {
+		t.Fatalf("CacheOnInvalidate: got %q", invalidated)
+	}
+}
+
+func TestCacheResponseSingleflight(t *testing.T) {
+	frame := newTestFrame(t, "response_cache_singleflight_test")
+	var calls int32
+	frame.GET("/slow", CacheResponse(time.Minute), HandlerFunc(func(ctx *Context) error {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return ctx.String(200, "slow")
+	}))
+	frame.build()
+	var wg sync.WaitGroup
+	var failed int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			frame.ServeHTTP(rec, httptest.NewRequest("GET", "/slow", nil))
+			if rec.Code != 200 || rec.Body.String() != "slow" {
+				atomic.AddInt32(&failed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if failed > 0 {
+		t.Fatalf("%d requests failed", failed)
+	}
+	if calls != 1 {
+		t.Fatalf("calls: got %d, want 1", calls)
+	}
+}
+
+func TestCacheResponseETag(t *testing.T) {
+	frame := newTestFrame(t, "response_cache_etag_test")
+	enableGzip := global.config.Gzip.Enable
+	global.config.Gzip.Enable = true
+	defer func() { global.config.Gzip.Enable = enableGzip }()
+	var invalidated []string
+	rc := CacheResponse(time.Minute, CacheOnInvalidate(func(prefix string) {
+		invalidated = append(invalidated, prefix)
+	}))
+	var calls int32
+	body := strings.Repeat("report ", 100)
+	frame.GET("/report", rc, HandlerFunc(func(ctx *Context) error {
+		atomic.AddInt32(&calls, 1)
+		return ctx.String(200, body)
+	}))
+	frame.GET("/private", rc, HandlerFunc(func(ctx *Context) error {
+		atomic.AddInt32(&calls, 1)
+		ctx.SetHeader(HeaderCacheControl, "private, max-age=10")
+		return ctx.String(200, "private")
+	}))
+	get := func(u, encoding, inm string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", u, nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		if inm != "" {
+			req.Header.Set(HeaderIfNoneMatch, inm)
+		}
+		return serveTest(frame, req)
+	}
+
+	miss := get("/report", "gzip", "")
+	etag := miss.Header().Get(HeaderETag)
+	if etag == "" || miss.Header().Get(HeaderCacheControl) != "max-age=60" || miss.Header().Get(HeaderContentEncoding) != "gzip" {
+		t.Fatalf("miss: got %v", miss.Header())
+	}
+	hit := get("/report", "gzip", "")
+	if hit.Header().Get(HeaderXCache) != "HIT" || hit.Header().Get(HeaderETag) != etag ||
+		hit.Header().Get(HeaderContentEncoding) != "gzip" || hit.Body.String() != miss.Body.String() {
+		t.Fatalf("hit: got %v", hit.Header())
+	}
+	if calls != 1 {
+		t.Fatalf("calls: got %d, want 1", calls)
+	}
+	// the compressed and plain variants have different ETags
+	if plain := get("/report", "", ""); plain.Body.String() != body || plain.Header().Get(HeaderETag) == etag {
+		t.Fatalf("plain: got %v", plain.Header())
+	}
+	if rec := get("/report", "gzip", `"x", `+etag); rec.Code != 304 || rec.Body.Len() != 0 {
+		t.Fatalf("If-None-Match of the hit: got %d", rec.Code)
+	}
+
+	if n := rc.InvalidateAll(); n != 2 || len(invalidated) != 1 || invalidated[0] != "" {
+		t.Fatalf("InvalidateAll: got %d %q", n, invalidated)
+	}
+	if rec := get("/report", "gzip", etag); rec.Code != 304 || rec.Header().Get(HeaderXCache) != "MISS" {
+		t.Fatalf("If-None-Match of the miss: got %d %v", rec.Code, rec.Header())
+	}
+	if rec := get("/report", "gzip", etag); rec.Code != 304 || rec.Header().Get(HeaderXCache) != "HIT" {
+		t.Fatalf("If-None-Match of the hit: got %d %v", rec.Code, rec.Header())
+	}
+
+	calls = 0
+	get("/private", "", "")
+	if rec := get("/private", "", ""); rec.Header().Get(HeaderXCache) != "MISS" || calls != 2 {
+		t.Fatalf("private is cached: %v", rec.Header())
+	}
+}
+
+func TestCacheResponseAuthorization(t *testing.T) {
+	frame := newTestFrame(t, "response_cache_authorization_test")
+	me := HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, "user %s", ctx.HeaderParam(HeaderAuthorization))
+	})
+	frame.GET("/me", CacheResponse(time.Minute), me)
+	frame.GET("/public", CacheResponse(time.Minute), HandlerFunc(func(ctx *Context) error {
+		ctx.SetHeader(HeaderCacheControl, "public, max-age=60")
+		return ctx.String(200, "public")
+	}))
+	frame.GET("/vary", CacheResponse(time.Minute, CacheVaryHeaders(HeaderAuthorization)), me)
+	frame.build()
+	get := func(u, authorization string) (string, string) {
+		req := httptest.NewRequest("GET", u, nil)
+		if authorization != "" {
+			req.Header.Set(HeaderAuthorization, authorization)
+		}
+		rec := serveTest(frame, req)
+		return rec.Header().Get(HeaderXCache), rec.Body.String()
+	}
+
+	// the personal response is never served to another caller
+	get("/me", "")
+	if _, body := get("/me", "Bearer alice"); body != "user Bearer alice" {
+		t.Fatalf("alice: got %q", body)
+	}
+	if _, body := get("/me", "Bearer bob"); body != "user Bearer bob" {
+		t.Fatalf("bob: got %q", body)
+	}
+	if x, body := get("/me", ""); x != "HIT" || body != "user " {
+		t.Fatalf("anonymous: got %s %q", x, body)
+	}
+
+	// the public response to the authorized request is shared
+	get("/public", "Bearer alice")
+	if x, body := get("/public", ""); x != "HIT" || body != "public" {
+		t.Fatalf("public: got %s %q", x, body)
+	}
+
+	// keyed by the Authorization, the responses are cached per caller
+	get("/vary", "Bearer alice")
+	if x, body := get("/vary", "Bearer alice"); x != "HIT" || body != "user Bearer alice" {
+		t.Fatalf("vary alice: got %s %q", x, body)
+	}
+	if x, body := get("/vary", "Bearer bob"); x != "MISS" || body != "user Bearer bob" {
+		t.Fatalf("vary bob: got %s %q", x, body)
+	}
+}
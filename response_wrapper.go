@@ -0,0 +1,142 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// ResponseWriterWrapper is the base of the writers wrapping the underlying writer of Context.W by Response.Wrap.
+// It passes Flush and Hijack through to the wrapped writer if they are supported,
+// and Unwrap for http.ResponseController, so embed it and override Write and WriteHeader:
+//
+//	type countingWriter struct {
+//		faygo.ResponseWriterWrapper
+//		n int
+//	}
+//
+//	func (w *countingWriter) Write(b []byte) (int, error) {
+//		w.n += len(b)
+//		return w.ResponseWriter.Write(b)
+//	}
+type ResponseWriterWrapper struct {
+	http.ResponseWriter
+}
+
+// Flush flushes the wrapped writer if it supports http.Flusher.
+func (w *ResponseWriterWrapper) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hijacks the connection of the wrapped writer if it supports http.Hijacker.
+func (w *ResponseWriterWrapper) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("webserver doesn't support Hijack")
+}
+
+// Unwrap returns the wrapped writer.
+func (w *ResponseWriterWrapper) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Wrap replaces the underlying writer of the response with the one returned by fn,
+// which wraps the current one, usually by embedding ResponseWriterWrapper,
+// and returns the function restoring the current one.
+// The Response still handles the status, the size and the cookies of the session,
+// then passes the header and the body to the wrapper, so the wrapper gets the body
+// compressed if the gzip is enabled; use TransformResponse to transform the plain body.
+//
+//	restore := ctx.W.Wrap(func(w http.ResponseWriter) http.ResponseWriter {
+//		return &countingWriter{ResponseWriterWrapper: faygo.ResponseWriterWrapper{ResponseWriter: w}}
+//	})
+//	defer restore()
+//	ctx.Next()
+func (resp *Response) Wrap(fn func(w http.ResponseWriter) http.ResponseWriter) (restore func()) {
+	w := resp.writer
+	resp.writer = fn(w)
+	return func() {
+		resp.writer = w
+	}
+}
+
+// TransformResponse creates the middleware transforming the response body of the following handlers,
+// such as minifying the HTML or injecting a banner. The body is buffered and passed to fn
+// uncompressed, then the result is compressed if the gzip is enabled. fn can read the status and
+// the headers, such as the Content-Type, from ctx.W, and should return the body as is if it is not
+// to be transformed.
+// The flushes are delayed until the handlers return, and the hijacked or already encoded
+// responses, such as the compressed static files, are not transformed.
+//
+//	e.g. frame.Use(faygo.TransformResponse(minifyHTML))
+func TransformResponse(fn func(ctx *Context, body []byte) []byte) HandlerFunc {
+	return func(ctx *Context) error {
+		bw := &bufferedWriter{}
+		restore := ctx.W.Wrap(func(w http.ResponseWriter) http.ResponseWriter {
+			bw.ResponseWriter = w
+			return bw
+		})
+		defer restore() // if the handlers panic
+		noCompress := ctx.noCompress
+		ctx.noCompress = true
+		ctx.Next()
+		ctx.noCompress = noCompress
+		restore()
+		if bw.hijacked || !ctx.W.committed {
+			return nil
+		}
+		w, header := ctx.W.writer, ctx.W.Header()
+		body := bw.buf.Bytes()
+		if len(header[HeaderContentEncoding]) == 0 {
+			body = ctx.compressBody(header.Get(HeaderContentType), fn(ctx, body))
+			header.Set(HeaderContentLength, strconv.Itoa(len(body)))
+		}
+		w.WriteHeader(ctx.W.status)
+		n, err := w.Write(body)
+		ctx.W.size = int64(n)
+		return err
+	}
+}
+
+// bufferedWriter buffers the response body until the handlers return.
+type bufferedWriter struct {
+	ResponseWriterWrapper
+	buf      bytes.Buffer
+	hijacked bool
+}
+
+// WriteHeader delays the status, which is sent with the transformed body.
+func (w *bufferedWriter) WriteHeader(int) {}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	return w.buf.Write(b)
+}
+
+// Flush is delayed until the handlers return.
+func (w *bufferedWriter) Flush() {}
+
+func (w *bufferedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriterWrapper.Hijack()
+	w.hijacked = err == nil
+	return conn, rw, err
+}
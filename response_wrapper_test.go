@@ -0,0 +1,133 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var htmlSpaces = regexp.MustCompile(`>\s+<`)
+
+// minifyHTML is a naive HTML minifier removing the spaces between the tags.
+func minifyHTML(ctx *Context, body []byte) []byte {
+	if !strings.HasPrefix(ctx.W.Header().Get(HeaderContentType), MIMETextHTML) {
+		return body
+	}
+	return htmlSpaces.ReplaceAll(body, []byte("><"))
+}
+
+func ExampleTransformResponse() {
+	frame := New("example")
+	frame.Use(TransformResponse(minifyHTML))
+	frame.GET("/", HandlerFunc(func(ctx *Context) error {
+		return ctx.HTML(200, "<ul>\n  <li>a</li>\n  <li>b</li>\n</ul>")
+	}))
+}
+
+type byteCounter struct {
+	ResponseWriterWrapper
+	n int
+}
+
+func (w *byteCounter) Write(b []byte) (int, error) {
+	w.n += len(b)
+	return w.ResponseWriter.Write(b)
+}
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (r *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.hijacked = true
+	c, _ := net.Pipe()
+	return c, nil, nil
+}
+
+func TestTransformResponse(t *testing.T) {
+	frame := newTestFrame(t, "transform_response_test")
+	enableGzip := global.config.Gzip.Enable
+	global.config.Gzip.Enable = true
+	defer func() { global.config.Gzip.Enable = enableGzip }()
+	html := strings.Repeat("<ul>\n  <li>item</li>\n</ul>\n", 10)
+	frame.Use(TransformResponse(minifyHTML))
+	frame.GET("/html", HandlerFunc(func(ctx *Context) error {
+		return ctx.HTML(201, html)
+	}))
+	frame.GET("/text", HandlerFunc(func(ctx *Context) error {
+		ctx.W.Flush()
+		return ctx.String(200, "a  >  < b")
+	}))
+
+	req := httptest.NewRequest("GET", "/html", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := serveTest(frame, req)
+	if rec.Code != 201 || rec.Header().Get(HeaderContentEncoding) != "gzip" {
+		t.Fatalf("html: got %d %v", rec.Code, rec.Header())
+	}
+	if rec.Header().Get(HeaderContentLength) != strconv.Itoa(rec.Body.Len()) {
+		t.Fatalf("Content-Length: got %s, want %d", rec.Header().Get(HeaderContentLength), rec.Body.Len())
+	}
+	r, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	if want := strings.TrimSpace(strings.Repeat("<ul><li>item</li></ul>", 10)) + "\n"; string(b) != want {
+		t.Fatalf("html: got %q, want %q", b, want)
+	}
+
+	rec = serveTest(frame, httptest.NewRequest("GET", "/text", nil))
+	if rec.Body.String() != "a  >  < b" || rec.Flushed {
+		t.Fatalf("text: got %q, flushed %v", rec.Body.String(), rec.Flushed)
+	}
+
+}
+
+func TestResponseWrap(t *testing.T) {
+	frame := newTestFrame(t, "response_wrap_test")
+	bc := &byteCounter{}
+	frame.GET("/", HandlerFunc(func(ctx *Context) error {
+		restore := ctx.W.Wrap(func(w http.ResponseWriter) http.ResponseWriter {
+			bc.ResponseWriter = w
+			return bc
+		})
+		defer restore()
+		ctx.String(200, "hello")
+		ctx.W.Flush()
+		_, _, err := ctx.W.Hijack()
+		return err
+	}))
+	frame.build()
+	hr := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	frame.ServeHTTP(hr, httptest.NewRequest("GET", "/", nil))
+	if bc.n != 5 || hr.Body.String() != "hello" {
+		t.Fatalf("got %q, counted %d", hr.Body.String(), bc.n)
+	}
+	// Flush and Hijack pass through the wrapper
+	if !hr.Flushed || !hr.hijacked {
+		t.Fatalf("flushed %v, hijacked %v", hr.Flushed, hr.hijacked)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"net"
 	"net/http"
 	"runtime"
+	"strconv"
 )
 
 // Response wraps an http.ResponseWriter and implements its interface to be used
@@ -152,11 +153,21 @@ func (resp *Response) Flush() {
 // take over the connection.
 func (resp *Response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	if hj, ok := resp.writer.(http.Hijacker); ok {
-		return hj.Hijack()
+		conn, rw, err := hj.Hijack()
+		if err == nil && resp.context != nil && resp.context.stream != nil {
+			resp.context.stream.hijacked(conn)
+		}
+		return conn, rw, err
 	}
 	return nil, nil, errors.New("webserver doesn't support Hijack")
 }
 
+// Unwrap returns the underlying http.ResponseWriter, so that http.ResponseController
+// can reach its methods, such as SetWriteDeadline.
+func (resp *Response) Unwrap() http.ResponseWriter {
+	return resp.writer
+}
+
 // CloseNotify implements the http.CloseNotifier interface to allow detecting
 // when the underlying connection has gone away.
 // This mechanism can be used to cancel long operations on the server if the
@@ -203,3 +214,55 @@ func (resp *Response) multiCommitted() {
 		resp.context.Log().Warningf("multiple response.WriteHeader calls\n[TRACE]\n%s\n", stack)
 	}
 }
+
+// headResponseWriter serves the HEAD request with the GET handler, it discards the body
+// and delays the header, so that the Content-Length can be set to the discarded size.
+type headResponseWriter struct {
+	http.ResponseWriter
+	resp   *Response
+	status int
+	size   int64
+}
+
+// discardHeadBody swaps the response writer to serve the HEAD request with the GET handler,
+// finish must be called after the handler.
+func (resp *Response) discardHeadBody() *headResponseWriter {
+	w := &headResponseWriter{ResponseWriter: resp.writer, resp: resp}
+	resp.writer = w
+	return w
+}
+
+// WriteHeader records the status, which is sent by finish.
+func (w *headResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Write discards the body and counts its size.
+func (w *headResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	w.size += int64(len(b))
+	return len(b), nil
+}
+
+// finish restores the response writer and sends the header,
+// with the Content-Length if the handler did not set it.
+func (w *headResponseWriter) finish() {
+	w.resp.writer = w.ResponseWriter
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	h := w.Header()
+	if w.size > 0 && h.Get(HeaderContentLength) == "" && h.Get("Transfer-Encoding") == "" {
+		h.Set(HeaderContentLength, strconv.FormatInt(w.size, 10))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// restore restores the response writer without sending anything,
+// so that the panic of the handler can be replied.
+func (w *headResponseWriter) restore() {
+	w.resp.writer = w.ResponseWriter
+	w.resp.committed = false
+}
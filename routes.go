@@ -0,0 +1,187 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// RouteInfo is the information of a registered route.
+type RouteInfo struct {
+	Method      string `json:"method"`
+	Pattern     string `json:"pattern"`
+	Name        string `json:"name"`
+	HandlerName string `json:"handler_name"` // name of the endpoint handler type or function
+	Group       string `json:"group"`        // path prefix of the parent group
+	Static      bool   `json:"static"`
+	Websocket   bool   `json:"websocket"`
+	Nocompress  bool   `json:"nocompress"`
+	Version     string `json:"version,omitempty"` // API version of the versioned route
+}
+
+// Flags returns the flags of the route joined by '|', such as `static|nocompress`,
+// and the API version of the versioned route, such as `v2`.
+func (r RouteInfo) Flags() string {
+	var flags []string
+	if r.Static {
+		flags = append(flags, "static")
+	}
+	if r.Websocket {
+		flags = append(flags, "websocket")
+	}
+	if r.Nocompress {
+		flags = append(flags, "nocompress")
+	}
+	if r.Version != "" {
+		flags = append(flags, "v"+r.Version)
+	}
+	return strings.Join(flags, "|")
+}
+
+// Routes returns the registered routes sorted by the pattern and method.
+// It does not change the route tree, so it can be called at any time,
+// but the system routes such as the static and apidoc are included only after the frame is built.
+func (frame *Framework) Routes() []RouteInfo {
+	var routes []RouteInfo
+	for _, mux := range frame.MuxAPI.Family() {
+		if mux.IsGroup() {
+			continue
+		}
+		info := RouteInfo{
+			Pattern:    mux.fullPath(),
+			Name:       mux.name,
+			Static:     mux.fs != nil,
+			Websocket:  mux.websocket,
+			Nocompress: mux.fs != nil && mux.fs.Nocompress(),
+			Version:    mux.apiVersion(),
+		}
+		if mux.parent != nil {
+			info.Group = mux.parent.fullPath()
+		}
+		if info.Static {
+			info.HandlerName = fmt.Sprintf("FileServer(%T)", mux.fs)
+		} else if len(mux.handlers) > 0 {
+			info.HandlerName = handlerName(mux.handlers[len(mux.handlers)-1])
+		}
+		for _, method := range mux.methods {
+			info.Method = method
+			routes = append(routes, info)
+		}
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		if routes[i].Method != routes[j].Method {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Version < routes[j].Version
+	})
+	return routes
+}
+
+// fullPath returns the path joined with the parents' patterns.
+func (mux *MuxAPI) fullPath() string {
+	if mux.parent == nil {
+		return path.Join("/", mux.pattern)
+	}
+	return path.Join(mux.parent.fullPath(), mux.pattern)
+}
+
+// apiVersion returns the API version of the route, which is inherited from the group.
+func (mux *MuxAPI) apiVersion() string {
+	for m := mux; m != nil; m = m.parent {
+		if m.version != "" {
+			return m.version
+		}
+	}
+	return ""
+}
+
+// MarkWebsocket marks the route as a websocket endpoint, which is shown in the route inspection.
+func (mux *MuxAPI) MarkWebsocket() *MuxAPI {
+	mux.websocket = true
+	return mux
+}
+
+// handlerName returns the name of the handler type or function.
+func handlerName(h Handler) string {
+	switch x := h.(type) {
+	case *apiHandler:
+		return x.paramsAPI.Name()
+	case *controllerAction:
+		return x.paramsAPI.Name() + "." + reflect.TypeOf(x.paramsAPI.Raw()).Method(x.method).Name
+	case HandlerFunc:
+		if f := runtime.FuncForPC(reflect.ValueOf(x).Pointer()); f != nil {
+			return f.Name()
+		}
+	}
+	return reflect.TypeOf(h).String()
+}
+
+// printRoutes logs the route table in aligned columns.
+func (frame *Framework) printRoutes() {
+	routes := frame.Routes()
+	var patternWidth, handlerWidth = len("PATTERN"), len("HANDLER")
+	for _, r := range routes {
+		if len(r.Pattern) > patternWidth {
+			patternWidth = len(r.Pattern)
+		}
+		if len(r.HandlerName) > handlerWidth {
+			handlerWidth = len(r.HandlerName)
+		}
+	}
+	format := fmt.Sprintf("\x1b[46m[SYS]\x1b[0m %%7s | %%-%ds | %%-%ds | %%s", patternWidth, handlerWidth)
+	frame.syslog.Criticalf(format, "METHOD", "PATTERN", "HANDLER", "FLAGS")
+	for _, r := range routes {
+		frame.syslog.Criticalf(format, r.Method, r.Pattern, r.HandlerName, r.Flags())
+	}
+}
+
+// RoutesHandler creates a handler that returns the routes of all the frames in JSON,
+// keyed by the frame name with version. It can be used as an admin route:
+//
+//	frame.GET("/debug/routes", faygo.RoutesHandler())
+//
+// It is also registered automatically when 'router::debug_routes' is true.
+func RoutesHandler() HandlerFunc {
+	return func(ctx *Context) error {
+		all := map[string][]RouteInfo{}
+		for _, frame := range AllFrames() {
+			all[frame.NameWithVersion()] = frame.Routes()
+		}
+		return ctx.JSON(http.StatusOK, all, true)
+	}
+}
+
+// debugRoutesPath is the path of the route inspection endpoint.
+const debugRoutesPath = "/debug/routes"
+
+// regDebugRoutes registers the route inspection endpoint,
+// restricted by the same IP whitelist as the apidoc.
+func (frame *Framework) regDebugRoutes() {
+	if frame.config.APIdoc.NoLimit {
+		frame.MuxAPI.NamedGET("Debug-Routes", debugRoutesPath, RoutesHandler())
+	} else {
+		frame.MuxAPI.NamedGET("Debug-Routes", debugRoutesPath, newIPFilter(frame.config.APIdoc.Whitelist, frame.config.APIdoc.RealIP), RoutesHandler())
+	}
+	frame.syslog.Criticalf("Route inspection's URL path is '%s'", debugRoutesPath)
+}
@@ -0,0 +1,472 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRoutes(t *testing.T) {
+	frame := newTestFrame(t, "routes_test")
+	frame.config.Router.DebugRoutes = true
+	frame.config.Router.PrintRoutes = true
+	frame.config.APIdoc.NoLimit = true
+	v1 := frame.Group("/v1")
+	v1.GET("/users/:id", HandlerFunc(func(ctx *Context) error { return nil }))
+	v1.NamedAPI("chat", "GET", "/chat", HandlerFunc(func(ctx *Context) error { return nil })).MarkWebsocket()
+	dir := "./faygo_routes_test"
+	defer os.RemoveAll(dir)
+	frame.Static("/assets", dir, true)
+
+	w := serveTest(frame, httptest.NewRequest("GET", debugRoutesPath, nil))
+	var all map[string][]RouteInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &all); err != nil {
+		t.Fatal(err)
+	}
+	routes := all[frame.NameWithVersion()]
+	want := []RouteInfo{
+		{Method: "GET", Pattern: "/assets/*filepath", Name: dir, Group: "/", Static: true, Nocompress: true},
+		{Method: "GET", Pattern: "/debug/routes", Name: "Debug-Routes", Group: "/"},
+		{Method: "GET", Pattern: "/v1/chat", Name: "chat", Group: "/v1", Websocket: true},
+		{Method: "GET", Pattern: "/v1/users/:id", Group: "/v1"},
+	}
+	if len(routes) != len(want) {
+		t.Fatalf("got %d routes: %+v", len(routes), routes)
+	}
+	for i, r := range routes {
+		if r.HandlerName == "" {
+			t.Errorf("route %s has no handler name", r.Pattern)
+		}
+		r.HandlerName = ""
+		if r != want[i] {
+			t.Errorf("route %d: got %+v, want %+v", i, r, want[i])
+		}
+	}
+	if name := routes[3].HandlerName; !strings.Contains(name, "TestRoutes") {
+		t.Errorf("handler name of the function: got %q", name)
+	}
+}
+
+func TestHandleHEAD(t *testing.T) {
+	gzipEnable := global.config.Gzip.Enable
+	global.config.Gzip.Enable = true
+	defer func() { global.config.Gzip.Enable = gzipEnable }()
+
+	frame := newTestFrame(t, "handle_head_test")
+	text := strings.Repeat("hello faygo ", 100)
+	frame.GET("/text", HandlerFunc(func(ctx *Context) error {
+		ctx.SetHeader("X-Custom", "1")
+		return ctx.String(200, text)
+	}))
+	frame.GET("/stream", HandlerFunc(func(ctx *Context) error {
+		for i := 0; i < 10; i++ {
+			ctx.W.Write([]byte("0123456789"))
+			ctx.W.Flush()
+		}
+		return nil
+	}))
+	frame.GET("/head", HandlerFunc(func(ctx *Context) error { return ctx.String(200, "get") }))
+	frame.HEAD("/head", HandlerFunc(func(ctx *Context) error {
+		ctx.SetHeader("X-Head", "1")
+		ctx.NoContent(204)
+		return nil
+	}))
+
+	get := httptest.NewRequest("GET", "/text", nil)
+	get.Header.Set(HeaderAcceptEncoding, "gzip")
+	getRec := serveTest(frame, get)
+	head := httptest.NewRequest("HEAD", "/text", nil)
+	head.Header.Set(HeaderAcceptEncoding, "gzip")
+	rec := serveTest(frame, head)
+	if rec.Code != 200 || rec.Body.Len() != 0 ||
+		rec.Header().Get("X-Custom") != "1" ||
+		rec.Header().Get(HeaderContentEncoding) != "gzip" ||
+		rec.Header().Get(HeaderContentLength) != getRec.Header().Get(HeaderContentLength) {
+		t.Fatalf("HEAD /text: got %d %v %q, GET: %v", rec.Code, rec.Header(), rec.Body.String(), getRec.Header())
+	}
+
+	rec = serveTest(frame, httptest.NewRequest("HEAD", "/stream", nil))
+	if rec.Code != 200 || rec.Body.Len() != 0 || rec.Header().Get(HeaderContentLength) != "100" {
+		t.Fatalf("HEAD /stream: got %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+
+	rec = serveTest(frame, httptest.NewRequest("HEAD", "/head", nil))
+	if rec.Code != 204 || rec.Header().Get("X-Head") != "1" {
+		t.Fatalf("HEAD /head: got %d %v", rec.Code, rec.Header())
+	}
+
+	frame.handleHEAD = false
+	rec = serveTest(frame, httptest.NewRequest("HEAD", "/text", nil))
+	if rec.Code != 405 {
+		t.Fatalf("HEAD /text without handle_head: got %d", rec.Code)
+	}
+}
+
+func TestCustomMethods(t *testing.T) {
+	for methodset, expect := range map[Methodset]string{
+		"GETOPTIONS":      "GET OPTIONS",
+		"get post":        "GET POST",
+		"GET|PURGE":       "GET PURGE",
+		"PROPPATCH, GET":  "GET PROPPATCH",
+		"purge;mkcol get": "GET MKCOL PURGE",
+		"GET/POST":        "GET POST",
+		"get-post|PURGE":  "GET POST PURGE",
+		"M-SEARCH":        "M-SEARCH",
+	} {
+		if methods := strings.Join(methodset.Methods(), " "); methods != expect {
+			t.Errorf("Methodset(%q): expect %q, got %q", methodset, expect, methods)
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expect panic on the invalid method token")
+			}
+		}()
+		methodset := Methodset("GET PURGE/BAN")
+		methodset.Methods()
+	}()
+
+	frame := newTestFrame(t, "custom_methods_test")
+	frame.Filter(func(ctx *Context) error {
+		if ctx.Method() == "POST" {
+			if method := ctx.HeaderParam(HeaderXHTTPMethodOverride); method != "" {
+				ctx.OverrideMethod(method)
+			}
+		}
+		return nil
+	})
+	frame.Handle("PURGE", "/cache", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, ctx.Method()+" "+ctx.OriginalMethod())
+	}))
+	frame.PATCH("/cache", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, ctx.Method()+" "+ctx.OriginalMethod())
+	}))
+
+	rec := serveTest(frame, httptest.NewRequest("PURGE", "/cache", nil))
+	if rec.Code != 200 || rec.Body.String() != "PURGE PURGE" {
+		t.Fatalf("PURGE /cache: got %d %q", rec.Code, rec.Body.String())
+	}
+	req := httptest.NewRequest("POST", "/cache", nil)
+	req.Header.Set(HeaderXHTTPMethodOverride, "patch")
+	rec = serveTest(frame, req)
+	if rec.Code != 200 || rec.Body.String() != "PATCH POST" {
+		t.Fatalf("overridden POST /cache: got %d %q", rec.Code, rec.Body.String())
+	}
+	rec = serveTest(frame, httptest.NewRequest("GET", "/cache", nil))
+	if allow := rec.Header().Get("Allow"); rec.Code != 405 || !strings.Contains(allow, "PURGE") {
+		t.Fatalf("GET /cache: got %d, Allow: %q", rec.Code, allow)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expect panic on the invalid method")
+		}
+	}()
+	frame.Handle("BAD METHOD", "/bad", HandlerFunc(func(ctx *Context) error { return nil }))
+}
+
+func TestHandleOPTIONS(t *testing.T) {
+	frame := newTestFrame(t, "handle_options_test")
+	handler := HandlerFunc(func(ctx *Context) error { return ctx.String(200, ctx.Method()) })
+	frame.GET("/users/:id", handler)
+	frame.API("POST|PURGE", "/users/:id", handler)
+	frame.DELETE("/users/*rest", handler)
+	frame.StaticFS("/files", DirFS("."))
+	frame.PUT("/files/*"+FilepathKey, handler)
+	frame.OPTIONS("/custom", HandlerFunc(func(ctx *Context) error {
+		ctx.SetHeader(HeaderAllow, "custom")
+		ctx.NoContent(204)
+		return nil
+	}))
+	frame.GET("/custom", handler)
+
+	for path, expect := range map[string]string{
+		"/users/1":    "DELETE, GET, HEAD, OPTIONS, POST, PURGE",
+		"/files/a.go": "GET, HEAD, OPTIONS, PUT",
+		"/custom":     "custom",
+	} {
+		rec := serveTest(frame, httptest.NewRequest("OPTIONS", path, nil))
+		if allow := rec.Header().Get(HeaderAllow); rec.Code != 204 || allow != expect {
+			t.Errorf("OPTIONS %s: expect 204 %q, got %d %q", path, expect, rec.Code, allow)
+		}
+	}
+	rec := serveTest(frame, httptest.NewRequest("PUT", "/users/1", nil))
+	if allow := rec.Header().Get(HeaderAllow); rec.Code != 405 || allow != "DELETE, GET, HEAD, OPTIONS, POST, PURGE" {
+		t.Errorf("PUT /users/1: got %d %q", rec.Code, allow)
+	}
+	rec = serveTest(frame, httptest.NewRequest("OPTIONS", "/none", nil))
+	if rec.Code != 404 {
+		t.Errorf("OPTIONS /none: expect 404, got %d", rec.Code)
+	}
+
+	frame.handleOPTIONS = false
+	rec = serveTest(frame, httptest.NewRequest("OPTIONS", "/users/1", nil))
+	if rec.Code == 204 || rec.Header().Get(HeaderAllow) != "" {
+		t.Errorf("OPTIONS /users/1 without handle_options: got %d %q", rec.Code, rec.Header().Get(HeaderAllow))
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	var errStatus int
+	SetErrorFunc(func(ctx *Context, errStr string, status int) {
+		errStatus = status
+		ctx.String(status, errStr)
+	})
+	defer SetErrorFunc(nil)
+
+	frame := newTestFrame(t, "method_not_allowed_test")
+	handler := HandlerFunc(func(ctx *Context) error { return ctx.String(200, ctx.Method()) })
+	frame.GET("/articles/:id", handler)
+	frame.PUT("/articles/:id", handler)
+	frame.POST("/articles", handler)
+
+	rec := serveTest(frame, httptest.NewRequest("DELETE", "/articles/1", nil))
+	if allow := rec.Header().Get(HeaderAllow); rec.Code != 405 || errStatus != 405 ||
+		allow != "GET, HEAD, OPTIONS, PUT" || rec.Body.String() != "Method Not Allowed" {
+		t.Fatalf("DELETE /articles/1: got %d %q %q", rec.Code, allow, rec.Body.String())
+	}
+	rec = serveTest(frame, httptest.NewRequest("GET", "/articles", nil))
+	if allow := rec.Header().Get(HeaderAllow); rec.Code != 405 || allow != "OPTIONS, POST" {
+		t.Fatalf("GET /articles: got %d %q", rec.Code, allow)
+	}
+	rec = serveTest(frame, httptest.NewRequest("DELETE", "/comments/1", nil))
+	if rec.Code != 404 || rec.Header().Get(HeaderAllow) != "" {
+		t.Fatalf("DELETE /comments/1: got %d %q", rec.Code, rec.Header().Get(HeaderAllow))
+	}
+
+	frame.handleMethodNotAllowed = false
+	rec = serveTest(frame, httptest.NewRequest("DELETE", "/articles/1", nil))
+	if rec.Code != 404 || rec.Header().Get(HeaderAllow) != "" {
+		t.Fatalf("DELETE /articles/1 without handle_method_not_allowed: got %d", rec.Code)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	frame := newTestFrame(t, "not_found_test")
+	frame.GET("/", HandlerFunc(func(ctx *Context) error { return ctx.String(200, "home") }))
+	var missing string
+	frame.SetNotFound(HandlerFunc(func(ctx *Context) error {
+		missing = ctx.Path()
+		if ctx.QueryParam("silent") != "" {
+			return nil
+		}
+		return ctx.HTML(404, "<h1>lost?</h1>")
+	}))
+
+	rec := serveTest(frame, httptest.NewRequest("GET", "/nowhere", nil))
+	if rec.Code != 404 || rec.Body.String() != "<h1>lost?</h1>" || missing != "/nowhere" {
+		t.Fatalf("GET /nowhere: got %d %q, missing path %q", rec.Code, rec.Body.String(), missing)
+	}
+	rec = serveTest(frame, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != 200 || rec.Body.String() != "home" {
+		t.Fatalf("GET /: got %d %q", rec.Code, rec.Body.String())
+	}
+	rec = serveTest(frame, httptest.NewRequest("GET", "/nowhere?silent=1", nil))
+	if rec.Code != 404 || strings.Contains(rec.Body.String(), "lost") {
+		t.Fatalf("GET /nowhere?silent=1: got %d %q", rec.Code, rec.Body.String())
+	}
+
+	frame.SetNotFound(nil)
+	rec = serveTest(frame, httptest.NewRequest("GET", "/nowhere", nil))
+	if rec.Code != 404 || strings.Contains(rec.Body.String(), "lost") {
+		t.Fatalf("GET /nowhere without handler: got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestTrailingSlashAndCleanPath(t *testing.T) {
+	frame := newTestFrame(t, "trailing_slash_test")
+	frame.GET("/users", HandlerFunc(func(ctx *Context) error { return ctx.String(200, "users "+ctx.Path()) }))
+	frame.GET("/files/", HandlerFunc(func(ctx *Context) error { return ctx.String(200, "files") }))
+
+	rec := serveTest(frame, httptest.NewRequest("GET", "/users/", nil))
+	if rec.Code != 301 || rec.Header().Get("Location") != "/users" {
+		t.Fatalf("GET /users/ with redirection: got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	frame.trailingSlashEquivalent = true
+	rec = serveTest(frame, httptest.NewRequest("GET", "/users/", nil))
+	if rec.Code != 200 || rec.Body.String() != "users /users/" {
+		t.Fatalf("GET /users/ as equivalent: got %d %q", rec.Code, rec.Body.String())
+	}
+	rec = serveTest(frame, httptest.NewRequest("GET", "/files", nil))
+	if rec.Code != 200 || rec.Body.String() != "files" {
+		t.Fatalf("GET /files as equivalent: got %d %q", rec.Code, rec.Body.String())
+	}
+
+	frame.redirectFixedPath = false
+	rec = serveTest(frame, httptest.NewRequest("GET", "/static/..//x/../users", nil))
+	if rec.Code != 404 {
+		t.Fatalf("GET unclean path: got %d %q", rec.Code, rec.Body.String())
+	}
+	frame.cleanPath = true
+	rec = serveTest(frame, httptest.NewRequest("GET", "/static/..//x/../users", nil))
+	if rec.Code != 200 || rec.Body.String() != "users /users" {
+		t.Fatalf("GET cleaned path: got %d %q", rec.Code, rec.Body.String())
+	}
+	rec = serveTest(frame, httptest.NewRequest("GET", "/../../users", nil))
+	if rec.Code != 200 || rec.Body.String() != "users /users" {
+		t.Fatalf("GET path above the root: got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPathConstraints(t *testing.T) {
+	RegisterPathConstraint("even", func(value string) bool {
+		n, err := strconv.Atoi(value)
+		return err == nil && n%2 == 0
+	})
+	frame := newTestFrame(t, "path_constraints_test")
+	echo := HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, ctx.Path()+" "+fmt.Sprint(ctx.pathParams))
+	})
+	frame.GET("/users/{id:int}", echo)
+	frame.GET("/files/{name:uuid}", echo)
+	frame.GET("/codes/{code:[a-z]{3}}/{n}", echo)
+	frame.GET("/pages/{n:even}", echo)
+	frame.Group("/orgs/{org:uint}").GET("/repos/{repo:[a-z]+}", echo)
+
+	for path, want := range map[string]int{
+		"/users/42":  200,
+		"/users/-1":  200,
+		"/users/abc": 404,
+		"/files/6ba7b810-9dad-11d1-80b4-00c04fd430c8": 200,
+		"/files/6ba7b810":       404,
+		"/codes/abc/1":          200,
+		"/codes/abcd/1":         404,
+		"/pages/2":              200,
+		"/pages/3":              404,
+		"/orgs/1/repos/faygo":   200,
+		"/orgs/x/repos/faygo":   404,
+		"/orgs/1/repos/Faygo42": 404,
+	} {
+		rec := serveTest(frame, httptest.NewRequest("GET", path, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s: got %d %q, want %d", path, rec.Code, rec.Body.String(), want)
+		}
+	}
+	rec := serveTest(frame, httptest.NewRequest("GET", "/codes/abc/1", nil))
+	if rec.Body.String() != "/codes/abc/1 [{code abc} {n 1}]" {
+		t.Fatalf("path params: got %q", rec.Body.String())
+	}
+
+	for _, pattern := range []string{"/a{id}", "/{id}x", "/{id:int", "/{:int}", "/{id:[}"} {
+		if _, _, err := parsePathConstraints(pattern); err == nil {
+			t.Errorf("parsePathConstraints(%q): expected an error", pattern)
+		}
+	}
+}
+
+func TestURLFor(t *testing.T) {
+	frame := newTestFrame(t, "url_for_test")
+	ok := HandlerFunc(func(ctx *Context) error { return ctx.String(200, "ok") })
+	frame.NamedGET("home", "/", ok)
+	frame.NamedGroup("users", "/users").NamedGET("user", "/{id:int}/posts/:post", ok)
+	frame.NamedGET("file", "/files/*filepath", ok)
+	frame.NamedGET("dup", "/a", ok)
+	frame.NamedGET("dup", "/b", ok)
+	if _, err := frame.URLFor("home"); err == nil {
+		t.Fatal("expected the error before the routes are built")
+	}
+	render := newRender(nil)
+	render.SetFS(http.FS(fstest.MapFS{
+		"link.html": {Data: []byte(`<a href="{{ url_for("user", "id", 5, "post", "a b", query) }}">`)},
+		"bad.html":  {Data: []byte(`{{ url_for("user", "id", "x", "post", 1) }}`)},
+	}))
+	var html string
+	var renderErr error
+	frame.GET("/render", HandlerFunc(func(ctx *Context) error {
+		data := Map{"query": url.Values{"tab": {"x"}, "q": {"1&2"}}}
+		b, err := render.Render("link.html", ctx.renderData(data))
+		html = string(b)
+		if err != nil {
+			return err
+		}
+		if len(data) != 1 {
+			t.Errorf("the data of the caller is modified: %v", data)
+		}
+		_, renderErr = render.Render("bad.html", ctx.renderData(nil))
+		return nil
+	}))
+	serveTest(frame, httptest.NewRequest("GET", "/render", nil))
+	if want := `<a href="/users/5/posts/a%20b?q=1%262&amp;tab=x">`; html != want {
+		t.Fatalf("url_for: got %q, want %q", html, want)
+	}
+	if renderErr == nil || !strings.Contains(renderErr.Error(), "invalid") {
+		t.Fatalf("url_for with the invalid param: got %v", renderErr)
+	}
+
+	for _, c := range []struct {
+		name   string
+		params []interface{}
+		want   string
+		err    string
+	}{
+		{"home", nil, "/", ""},
+		{"user", []interface{}{"id", 7, "post", "p"}, "/users/7/posts/p", ""},
+		{"file", []interface{}{"filepath", "/css/a b.css"}, "/files/css/a%20b.css", ""},
+		{"user", []interface{}{"id", 7}, "", "missing"},
+		{"user", []interface{}{"id", 7, "post", "p", "extra", 1}, "", "no path param"},
+		{"user", []interface{}{"id", "seven", "post", "p"}, "", "invalid"},
+		{"user", []interface{}{"id"}, "", "no value"},
+		{"nope", nil, "", "no route"},
+		{"dup", nil, "", "different paths"},
+	} {
+		got, err := frame.URLFor(c.name, c.params...)
+		if c.err == "" && (err != nil || got != c.want) {
+			t.Errorf("URLFor(%q, %v): got %q, %v, want %q", c.name, c.params, got, err, c.want)
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("URLFor(%q, %v): got %q, %v, want the error %q", c.name, c.params, got, err, c.err)
+		}
+	}
+}
+
+func TestRoutePattern(t *testing.T) {
+	frame := newTestFrame(t, "route_pattern_test")
+	var pattern string
+	capture := HandlerFunc(func(ctx *Context) error {
+		pattern = ctx.RoutePattern()
+		return nil
+	})
+	frame.Group("/users", capture).GET("/{id:int}", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, "user")
+	}))
+	frame.StaticFS("/public", FS(http.FS(fstest.MapFS{"a.txt": {Data: []byte("a")}}))).Use(capture)
+	frame.SetNotFound(HandlerFunc(func(ctx *Context) error {
+		pattern = "not found: " + ctx.RoutePattern()
+		return nil
+	}))
+	for path, want := range map[string]string{
+		"/users/7":      "/users/:id",
+		"/public/a.txt": "",
+		"/nowhere":      "not found: ",
+	} {
+		pattern = "unset"
+		serveTest(frame, httptest.NewRequest("GET", path, nil))
+		if pattern != want {
+			t.Errorf("GET %s: got route pattern %q, want %q", path, pattern, want)
+		}
+	}
+}
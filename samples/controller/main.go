@@ -0,0 +1,79 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/henrylee2cn/faygo"
+)
+
+// User is the user model.
+type User struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+// UserController is a controller with five actions,
+// its fields are bound per request from the path, query, header and body.
+type UserController struct {
+	// Routes of the actions, others are derived from the method names.
+	faygo.Controller `route:"GetOne=GET /:id; PutOne=PUT /:id; DeleteOne=DELETE /:id"`
+
+	ID    int64  `param:"<in:path> <name:id> <desc:user ID>"`
+	Page  int    `param:"<in:query> <desc:page number>"`
+	Token string `param:"<in:header> <name:X-Token> <desc:admin token>"`
+	User  User   `param:"<in:body> <desc:user info>"`
+}
+
+// Get lists the users: GET /users?page=1
+func (c *UserController) Get(ctx *faygo.Context) error {
+	return ctx.JSON(http.StatusOK, faygo.Map{"page": c.Page, "users": []User{}})
+}
+
+// Post creates a user: POST /users
+func (c *UserController) Post(ctx *faygo.Context) error {
+	return ctx.JSON(http.StatusCreated, c.User)
+}
+
+// GetOne gets the user: GET /users/:id
+func (c *UserController) GetOne(ctx *faygo.Context) error {
+	return ctx.JSON(http.StatusOK, faygo.Map{"id": c.ID})
+}
+
+// PutOne updates the user: PUT /users/:id
+func (c *UserController) PutOne(ctx *faygo.Context) error {
+	return ctx.JSON(http.StatusOK, faygo.Map{"id": c.ID, "user": c.User})
+}
+
+// DeleteOne deletes the user: DELETE /users/:id
+func (c *UserController) DeleteOne(ctx *faygo.Context) error {
+	if c.Token != "admin" {
+		return ctx.String(http.StatusForbidden, "invalid token")
+	}
+	ctx.NoContent(http.StatusNoContent)
+	return nil
+}
+
+func main() {
+	app := faygo.New("controller", "1.0")
+	if _, err := app.RouteController("/users", &UserController{Page: 1}); err != nil {
+		faygo.Fatalf("%v", err)
+	}
+	// Start the service
+	faygo.Run()
+
+	// PS: By visiting /apidoc to test.
+}
@@ -0,0 +1,95 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/henrylee2cn/faygo"
+)
+
+// MemcacheBackend is a file cache backend over memcached,
+// so that the instances on one host share the cache, and it is warm after every deploy.
+type MemcacheBackend struct {
+	client *memcache.Client
+	prefix string
+}
+
+var _ faygo.CacheBackend = (*MemcacheBackend)(nil)
+
+// key returns a valid memcached key, since the file cache keys may be long or contain control characters.
+func (m *MemcacheBackend) key(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return m.prefix + hex.EncodeToString(sum[:])
+}
+
+// Get returns the unexpired entry.
+func (m *MemcacheBackend) Get(key string) (*faygo.CacheEntry, bool) {
+	item, err := m.client.Get(m.key(key))
+	if err != nil {
+		return nil, false
+	}
+	entry := new(faygo.CacheEntry)
+	if entry.UnmarshalBinary(item.Value) != nil {
+		return nil, false
+	}
+	return entry, true
+}
+
+// Set stores the entry.
+func (m *MemcacheBackend) Set(key string, entry *faygo.CacheEntry, ttl time.Duration) error {
+	b, err := entry.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return m.client.Set(&memcache.Item{
+		Key:        m.key(key),
+		Value:      b,
+		Expiration: int32(ttl / time.Second),
+	})
+}
+
+// Del removes the entry.
+func (m *MemcacheBackend) Del(key string) bool {
+	return m.client.Delete(m.key(key)) == nil
+}
+
+// Clear removes all entries of the memcached servers.
+func (m *MemcacheBackend) Clear() {
+	m.client.DeleteAll()
+}
+
+// Len is not reported by the memcached client.
+func (m *MemcacheBackend) Len() int64 { return 0 }
+
+// Bytes is not reported by the memcached client.
+func (m *MemcacheBackend) Bytes() int64 { return 0 }
+
+func main() {
+	faygo.SetFileCacheBackend(&MemcacheBackend{
+		client: memcache.New("127.0.0.1:11211"),
+		prefix: "faygo:",
+	})
+	app := faygo.New("memcache", "1.0")
+	app.Static("/public", "./public")
+	app.GET("/stats", faygo.HandlerFunc(func(ctx *faygo.Context) error {
+		return ctx.JSON(200, faygo.FileCacheStats())
+	}))
+	// Start the service
+	faygo.Run()
+}
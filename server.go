@@ -16,6 +16,8 @@ package faygo
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"net"
 	"net/http"
 	"os"
@@ -69,6 +71,23 @@ const (
 	__netTypes__ = "http | https | unix_http | unix_https | letsencrypt | unix_letsencrypt"
 )
 
+// Listener is an additional listener of the frame, which serves the same routes
+// as the ones of the config items `net_types` and `addrs`, with its own TLS settings.
+type Listener struct {
+	// Network type: http|https|unix_http|unix_https|letsencrypt|unix_letsencrypt
+	NetType string
+	// Listening address; the prefix 'unix:' means the Unix domain socket
+	Addr string
+	// TLS certificate and key file path, the ones of the frame config are used if empty
+	TLSCertFile string
+	TLSKeyFile  string
+	// Let's Encrypt TLS certificate cache directory, the one of the frame config is used if empty
+	LetsencryptDir string
+	// Optional TLS config, such as for the client certificate authentication;
+	// the certificate files are loaded only if it provides no certificate.
+	TLSConfig *tls.Config
+}
+
 // Server web server object
 type Server struct {
 	nameWithVersion string
@@ -77,16 +96,20 @@ type Server struct {
 	tlsCertFile     string
 	tlsKeyFile      string
 	letsencryptDir  string
+	tlsConfig       *tls.Config
+	clientCAFile    string
+	clientCAs       *x509.CertPool
+	clientAuth      tls.ClientAuthType
+	autoTLS         *autoTLS // the automatic certificates, nil if not enabled
 	unixFileMode    os.FileMode
+	unixListener    *net.UnixListener
+	http3           HTTP3Server // the HTTP/3 server on the same address, nil if not enabled
 	*http.Server
 	log *logging.Logger
 }
 
-func (server *Server) run() {
-	server.initAddr()
-	server.setNet()
-	ln := server.listen()
-
+// serve logs and serves the listener in a new goroutine.
+func (server *Server) serve(ln net.Listener) {
 	typ := strings.ToUpper(server.netType)
 	switch server.netType {
 	case NETTYPE_HTTPS, NETTYPE_UNIX_HTTPS, NETTYPE_LETSENCRYPT, NETTYPE_UNIX_LETSENCRYPT:
@@ -94,10 +117,12 @@ func (server *Server) run() {
 	}
 	server.log.Criticalf("\x1b[46m[SYS]\x1b[0m listen and serve %s on %v", typ, server.Addr)
 
-	err := server.Server.Serve(ln)
-	if realServeError(err) != nil {
-		server.log.Fatalf("%v\n", err)
-	}
+	go func() {
+		err := server.Server.Serve(ln)
+		if realServeError(err) != nil {
+			server.log.Fatalf("%v\n", err)
+		}
+	}()
 }
 
 func (server *Server) isHttps() bool {
@@ -132,72 +157,167 @@ func (server *Server) initAddr() {
 	}
 }
 
-func (server *Server) setNet() {
+func (server *Server) setNet() error {
 	switch server.netType {
 	case NETTYPE_HTTP, NETTYPE_HTTPS, NETTYPE_LETSENCRYPT:
 		server.net = "tcp"
 	case NETTYPE_UNIX_HTTP, NETTYPE_UNIX_HTTPS, NETTYPE_UNIX_LETSENCRYPT:
 		server.net = "unix"
 	default:
-		server.log.Fatalf("[NET] Please set a valid config item net_type, refer to the following:\n%s\n", __netTypes__)
+		return fmt.Errorf("[NET] Please set a valid config item net_type, refer to the following:\n%s", __netTypes__)
+	}
+	return nil
+}
+
+// unixAddrPrefix is the prefix of the Unix domain socket address, such as `unix:/run/app.sock`,
+// with which the http, https and letsencrypt net types are turned into the Unix ones.
+const unixAddrPrefix = "unix:"
+
+// resolveUnixAddr turns the net type into the Unix one if the address has the prefix `unix:`.
+func (server *Server) resolveUnixAddr() {
+	if !strings.HasPrefix(server.Addr, unixAddrPrefix) {
+		return
+	}
+	server.Addr = strings.TrimPrefix(server.Addr, unixAddrPrefix)
+	switch server.netType {
+	case NETTYPE_HTTP:
+		server.netType = NETTYPE_UNIX_HTTP
+	case NETTYPE_HTTPS:
+		server.netType = NETTYPE_UNIX_HTTPS
+	case NETTYPE_LETSENCRYPT:
+		server.netType = NETTYPE_UNIX_LETSENCRYPT
+	}
+}
+
+// removeStaleSocket removes the socket file left by the process which exited without cleanup.
+// The socket file that is still being listened, such as by the parent process during
+// the graceful reboot, is kept.
+func removeStaleSocket(addr string) error {
+	info, err := os.Lstat(addr)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("[NET:UNIX] %s exists and is not a unix socket file", addr)
+	}
+	if conn, err := net.DialTimeout("unix", addr, time.Second); err == nil {
+		conn.Close()
+		return nil
+	}
+	if err = os.Remove(addr); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("[NET:UNIX] Unexpected error when trying to remove unix socket file. Addr: %s | Trace: %s", addr, err.Error())
+	}
+	return nil
+}
+
+// keepUnixSocket keeps the socket file when the listener is closed,
+// so that the new process of the graceful reboot can serve on it.
+func (server *Server) keepUnixSocket() {
+	if server.unixListener != nil {
+		server.unixListener.SetUnlinkOnClose(false)
 	}
 }
 
 var grace = new(gracenet.Net)
 
-func (server *Server) listen() net.Listener {
+// listen announces on the server address, it does not serve.
+func (server *Server) listen() (net.Listener, error) {
+	server.initAddr()
+	if err := server.setNet(); err != nil {
+		return nil, err
+	}
 	switch server.netType {
 	case NETTYPE_HTTPS, NETTYPE_UNIX_HTTPS:
-		var cert tls.Certificate
-		cert, err := tls.LoadX509KeyPair(server.tlsCertFile, server.tlsKeyFile)
-		if err != nil {
-			server.log.Fatalf("%v\n", err)
-			return nil
+		tlsConfig := server.newTLSConfig()
+		auto := server.autoTLS != nil && len(tlsConfig.Certificates) == 0 && tlsConfig.GetCertificate == nil &&
+			server.tlsCertFile == "" && server.tlsKeyFile == ""
+		if auto {
+			tlsConfig.GetCertificate = server.autoTLS.getCertificate
+			withACMEProto(tlsConfig)
+		} else if len(tlsConfig.Certificates) == 0 && tlsConfig.GetCertificate == nil {
+			cert, err := tls.LoadX509KeyPair(server.tlsCertFile, server.tlsKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
 		}
-		server.TLSConfig = &tls.Config{
-			Certificates:             []tls.Certificate{cert},
-			NextProtos:               []string{"http/1.1", "h2"},
-			PreferServerCipherSuites: true,
+		if err := server.setClientAuth(tlsConfig); err != nil {
+			return nil, err
 		}
-
-	case NETTYPE_LETSENCRYPT, NETTYPE_UNIX_LETSENCRYPT:
-		m := autocert.Manager{
-			Prompt: autocert.AcceptTOS,
+		if auto {
+			acmeWithoutClientAuth(tlsConfig)
 		}
+		server.TLSConfig = tlsConfig
 
-		if server.letsencryptDir == "" {
-			// then the user passed empty by own will, then I guess user doesnt' want any cache directory
+	case NETTYPE_LETSENCRYPT, NETTYPE_UNIX_LETSENCRYPT:
+		tlsConfig := server.newTLSConfig()
+		if server.autoTLS != nil {
+			tlsConfig.GetCertificate = server.autoTLS.getCertificate
 		} else {
-			m.Cache = autocert.DirCache(server.letsencryptDir)
+			m := autocert.Manager{
+				Prompt: autocert.AcceptTOS,
+			}
+
+			if server.letsencryptDir == "" {
+				// then the user passed empty by own will, then I guess user doesnt' want any cache directory
+			} else {
+				m.Cache = autocert.DirCache(server.letsencryptDir)
+			}
+			tlsConfig.GetCertificate = m.GetCertificate
+		}
+		withACMEProto(tlsConfig)
+		if err := server.setClientAuth(tlsConfig); err != nil {
+			return nil, err
 		}
-		server.TLSConfig = &tls.Config{GetCertificate: m.GetCertificate}
+		acmeWithoutClientAuth(tlsConfig)
+		server.TLSConfig = tlsConfig
 	}
 
-	switch server.netType {
-	case NETTYPE_UNIX_HTTPS, NETTYPE_UNIX_LETSENCRYPT:
-		if errOs := os.Remove(server.Addr); errOs != nil && !os.IsNotExist(errOs) {
-			server.log.Fatalf("[NET:UNIX] Unexpected error when trying to remove unix socket file. Addr: %s | Trace: %s\n", server.Addr, errOs.Error())
-			return nil
+	var isUnix = server.net == "unix"
+	if isUnix {
+		if err := removeStaleSocket(server.Addr); err != nil {
+			return nil, err
 		}
-		defer func() {
-			err := os.Chmod(server.Addr, server.unixFileMode)
-			if err != nil {
-				server.log.Fatalf("[NET:UNIX] Cannot chmod %#o for %q: %s\n", server.unixFileMode, server.Addr, err.Error())
-			}
-		}()
 	}
 
 	ln, err := grace.Listen(server.net, server.Addr)
 	if err != nil {
-		server.log.Fatalf("%v\n", err)
-		return nil
+		return nil, err
+	}
+	if isUnix {
+		if err = os.Chmod(server.Addr, server.unixFileMode); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("[NET:UNIX] Cannot chmod %#o for %q: %s", server.unixFileMode, server.Addr, err.Error())
+		}
+		// the inherited listener does not remove the socket file by default
+		server.unixListener = ln.(*net.UnixListener)
+		server.unixListener.SetUnlinkOnClose(true)
+	} else {
+		ln = tcpKeepAliveListener{ln.(*net.TCPListener)}
 	}
-	ln = tcpKeepAliveListener{ln.(*net.TCPListener)}
 	if server.TLSConfig != nil {
 		ln = tls.NewListener(ln, server.TLSConfig)
 	}
 
-	return ln
+	return ln, nil
+}
+
+// newTLSConfig returns a copy of the listener's TLS config, or the default one.
+func (server *Server) newTLSConfig() *tls.Config {
+	if server.tlsConfig == nil {
+		return &tls.Config{
+			NextProtos:               []string{"http/1.1", "h2"},
+			PreferServerCipherSuites: true,
+		}
+	}
+	tlsConfig := server.tlsConfig.Clone()
+	if len(tlsConfig.NextProtos) == 0 {
+		tlsConfig.NextProtos = []string{"http/1.1", "h2"}
+	}
+	return tlsConfig
 }
 
 // tcpKeepAliveListener sets TCP keep-alive timeouts on accepted
@@ -0,0 +1,208 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// HeaderXShadow marks the request mirrored by the shadow traffic middleware.
+const HeaderXShadow = "X-Shadow"
+
+// the defaults of the shadow traffic middleware
+const (
+	defaultShadowMaxBodyBytes = 1 << 20
+	defaultShadowTimeout      = 5 * time.Second
+	defaultShadowMaxInflight  = 100
+)
+
+type (
+	// ShadowConfig is the config of the shadow traffic middleware created by NewShadow.
+	ShadowConfig struct {
+		// The base URL the requests are mirrored to, such as "http://canary:8080",
+		// to which the path and the query of the request are appended.
+		URL string
+		// The handler the requests are mirrored to, such as the new code path, instead of URL.
+		Handler http.Handler
+		// The fraction of the requests mirrored, in (0, 1].
+		Rate float64
+		// The maximum bytes of the request body buffered for the mirror, 1MB by default;
+		// the requests with the larger bodies are not mirrored.
+		MaxBodyBytes int64
+		// The timeout of the mirrored request, 5s by default.
+		Timeout time.Duration
+		// The maximum of the mirrored requests in flight, 100 by default;
+		// the requests beyond it are not mirrored.
+		MaxInflight int32
+		// The client sending the mirrored requests to URL, http.DefaultClient by default.
+		Client *http.Client
+	}
+	// shadow is the shadow traffic middleware state.
+	shadow struct {
+		ShadowConfig
+		target   *url.URL
+		random   func() float64
+		inflight int32
+	}
+	// discardResponseWriter is the ResponseWriter of the mirrored request to the handler.
+	discardResponseWriter struct {
+		header http.Header
+	}
+)
+
+// NewShadow creates the middleware mirroring the sampled requests to a secondary handler or URL,
+// such as for testing the new code path with the real traffic, without affecting the primary response.
+// The request body is buffered up to MaxBodyBytes, and the mirror is fired asynchronously
+// as a background task with the `X-Shadow: 1` header; its response and errors are ignored.
+// The requests with the `X-Shadow` header are never mirrored again, so that the services
+// mirroring to each other do not loop.
+//
+//	e.g. frame.Filter(faygo.NewShadow(faygo.ShadowConfig{
+//		URL:  "http://canary:8080",
+//		Rate: 0.1,
+//	}))
+func NewShadow(conf ShadowConfig) HandlerFunc {
+	return newShadow(conf).serve
+}
+
+func newShadow(conf ShadowConfig) *shadow {
+	if (conf.URL == "") == (conf.Handler == nil) {
+		Fatalf("NewShadow: either the URL or the handler is required")
+	}
+	if conf.Rate <= 0 || conf.Rate > 1 {
+		Fatalf("NewShadow: the rate must be in (0, 1], got %v", conf.Rate)
+	}
+	if conf.MaxBodyBytes <= 0 {
+		conf.MaxBodyBytes = defaultShadowMaxBodyBytes
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = defaultShadowTimeout
+	}
+	if conf.MaxInflight <= 0 {
+		conf.MaxInflight = defaultShadowMaxInflight
+	}
+	if conf.Client == nil {
+		conf.Client = http.DefaultClient
+	}
+	s := &shadow{ShadowConfig: conf, random: rand.Float64}
+	if conf.URL != "" {
+		target, err := url.Parse(conf.URL)
+		if err != nil || target.Scheme == "" || target.Host == "" {
+			Fatalf("NewShadow: invalid URL %q", conf.URL)
+		}
+		s.target = target
+	}
+	return s
+}
+
+func (s *shadow) serve(ctx *Context) error {
+	if ctx.R.Header.Get(HeaderXShadow) != "" || s.random() >= s.Rate || ctx.R.ContentLength > s.MaxBodyBytes {
+		return nil
+	}
+	body, ok := s.bufferBody(ctx)
+	if !ok {
+		return nil
+	}
+	if atomic.AddInt32(&s.inflight, 1) > s.MaxInflight {
+		atomic.AddInt32(&s.inflight, -1)
+		return nil
+	}
+	req := s.newRequest(ctx.R, body)
+	Go(func(bg context.Context) {
+		defer atomic.AddInt32(&s.inflight, -1)
+		c, cancel := context.WithTimeout(bg, s.Timeout)
+		defer cancel()
+		s.send(req.WithContext(c))
+	})
+	return nil
+}
+
+// bufferBody reads the request body up to MaxBodyBytes, and restores it for the primary handler,
+// returns false if it is larger or fails to read.
+func (s *shadow) bufferBody(ctx *Context) ([]byte, bool) {
+	r := ctx.R
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, s.MaxBodyBytes+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil || int64(len(body)) > s.MaxBodyBytes {
+		return nil, false
+	}
+	return body, true
+}
+
+// newRequest clones the request with the buffered body, to the URL if set.
+func (s *shadow) newRequest(r *http.Request, body []byte) *http.Request {
+	req := r.Clone(context.Background())
+	req.Header.Set(HeaderXShadow, "1")
+	req.ContentLength = int64(len(body))
+	req.Body = http.NoBody
+	if body != nil {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	if s.target != nil {
+		u := *s.target
+		u.Path = strings.TrimRight(u.Path, "/") + r.URL.Path
+		u.RawPath = ""
+		u.RawQuery = r.URL.RawQuery
+		req.URL = &u
+		req.Host = u.Host
+		req.RequestURI = ""
+		// the transport sets the connection headers itself
+		req.Header.Del("Connection")
+	}
+	return req
+}
+
+// send sends the mirrored request, ignoring the response.
+func (s *shadow) send(req *http.Request) {
+	if s.Handler != nil {
+		s.Handler.ServeHTTP(&discardResponseWriter{header: make(http.Header)}, req)
+		return
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		Debugf("[shadow] %s %s: %v", req.Method, req.URL, err)
+		return
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardResponseWriter) WriteHeader(int) {}
@@ -0,0 +1,110 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShadow(t *testing.T) {
+	type mirrored struct{ method, uri, body, shadow string }
+	received := make(chan mirrored, 10)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		received <- mirrored{r.Method, r.RequestURI, string(b), r.Header.Get(HeaderXShadow)}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer target.Close()
+
+	frame := newTestFrame(t, "shadow_test")
+	s := newShadow(ShadowConfig{URL: target.URL + "/mirror/", Rate: 0.5, MaxBodyBytes: 8})
+	sampled := 0.1
+	s.random = func() float64 { return sampled }
+	frame.Filter(HandlerFunc(s.serve))
+	frame.POST("/users", HandlerFunc(func(ctx *Context) error {
+		b, _ := ioutil.ReadAll(ctx.R.Body)
+		return ctx.String(http.StatusCreated, "primary:%s", b)
+	}))
+
+	do := func(body string, header ...string) {
+		req := httptest.NewRequest("POST", "/users?id=1", strings.NewReader(body))
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := serveTest(frame, req)
+		if w.Code != http.StatusCreated || w.Body.String() != "primary:"+body {
+			t.Fatalf("the primary response is affected: %d %q", w.Code, w.Body.String())
+		}
+	}
+	do("hello")
+	select {
+	case m := <-received:
+		if m != (mirrored{"POST", "/mirror/users?id=1", "hello", "1"}) {
+			t.Fatalf("mirrored: got %+v", m)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("the request is not mirrored")
+	}
+
+	// not sampled, and the body larger than MaxBodyBytes
+	sampled = 0.5
+	do("hello")
+	sampled = 0.1
+	do("a large body")
+	// the mirrored request is never mirrored again
+	do("hello", HeaderXShadow, "1")
+	select {
+	case m := <-received:
+		t.Fatalf("unexpected mirrored request: %+v", m)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the failing target does not affect the primary
+	target.Close()
+	do("hello")
+}
+
+func TestShadowHandler(t *testing.T) {
+	received := make(chan string, 1)
+	frame := newTestFrame(t, "shadow_handler_test")
+	frame.Filter(NewShadow(ShadowConfig{
+		Rate: 1,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received <- r.URL.Path
+			w.Write([]byte("ignored"))
+			panic("the new code path panics")
+		}),
+	}))
+	frame.GET("/items", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(http.StatusOK, "primary")
+	}))
+	w := serveTest(frame, httptest.NewRequest("GET", "/items", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "primary" {
+		t.Fatalf("the primary response is affected: %d %q", w.Code, w.Body.String())
+	}
+	select {
+	case p := <-received:
+		if p != "/items" {
+			t.Fatalf("mirrored path: got %q", p)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("the request is not mirrored")
+	}
+}
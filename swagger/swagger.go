@@ -216,7 +216,8 @@ func ParamType(value interface{}) string {
 		rv = rv.Elem()
 	}
 	tn := rv.String()
-	if tn == "multipart.FileHeader" || tn == "[]*multipart.FileHeader" || tn == "[]multipart.FileHeader" {
+	if tn == "multipart.FileHeader" || tn == "[]*multipart.FileHeader" || tn == "[]multipart.FileHeader" ||
+		tn == "apiware.UploadedFile" || tn == "[]*apiware.UploadedFile" {
 		return "file"
 	}
 	return mapping[rv.Kind()]
@@ -0,0 +1,128 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/henrylee2cn/faygo/logging"
+)
+
+type (
+	// Tracer starts the server span of each request, which keeps the tracing dependency optional.
+	// For example, the adapter of OpenTelemetry:
+	//
+	//	type otelTracer struct{ tracer trace.Tracer }
+	//
+	//	func (t otelTracer) Start(ctx context.Context, name string, header http.Header) (context.Context, faygo.Span) {
+	//		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+	//		ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+	//		return ctx, otelSpan{span}
+	//	}
+	Tracer interface {
+		// Start starts a server span as the child of the remote span propagated by the header,
+		// such as the W3C traceparent, and returns the context carrying the span.
+		Start(ctx context.Context, name string, header http.Header) (context.Context, Span)
+	}
+	// Span is the server span of a request.
+	Span interface {
+		// SetName renames the span, such as after the route is matched.
+		SetName(name string)
+		// SetAttribute sets an attribute of the span.
+		SetAttribute(key string, value interface{})
+		// SetError marks the span as failed.
+		SetError(msg string)
+		// TraceID returns the hex trace ID.
+		TraceID() string
+		// End ends the span.
+		End()
+	}
+)
+
+// Attribute keys of the server span.
+const (
+	TraceAttrMethod       = "http.method"
+	TraceAttrRoute        = "http.route"
+	TraceAttrStatusCode   = "http.status_code"
+	TraceAttrResponseSize = "http.response_size"
+)
+
+// SetTracer enables tracing of the frame, a server span is started for each request.
+// The span is named `METHOD route`, covers the filters, the params binding, the handlers
+// and the error rendering, and ends exactly once even on panic.
+// note: it should be called before Run()
+func (frame *Framework) SetTracer(tracer Tracer) {
+	frame.tracer = tracer
+}
+
+// startSpan starts the server span of the request if tracing is enabled.
+func (ctx *Context) startSpan() {
+	if ctx.frame.tracer == nil {
+		return
+	}
+	method := ctx.R.Method
+	c, span := ctx.frame.tracer.Start(ctx.R.Context(), method, ctx.R.Header)
+	ctx.R = ctx.R.WithContext(c)
+	ctx.span = span
+	span.SetAttribute(TraceAttrMethod, method)
+}
+
+// endSpan records the response and ends the server span.
+func (ctx *Context) endSpan() {
+	if ctx.span == nil {
+		return
+	}
+	span := ctx.span
+	ctx.span = nil
+	if ctx.routePattern != "" {
+		span.SetName(ctx.R.Method + " " + ctx.routePattern)
+		span.SetAttribute(TraceAttrRoute, ctx.routePattern)
+	}
+	status := ctx.Status()
+	span.SetAttribute(TraceAttrStatusCode, status)
+	span.SetAttribute(TraceAttrResponseSize, ctx.Size())
+	if status >= 500 {
+		span.SetError(strconv.Itoa(status) + " " + http.StatusText(status))
+	}
+	span.End()
+}
+
+// TraceContext returns the context carrying the server span of the request,
+// so that the handlers can start the child spans, such as for the database calls.
+// It is the same as Context().
+func (ctx *Context) TraceContext() context.Context {
+	return ctx.Context()
+}
+
+// TraceID returns the trace ID of the request, or "" if tracing is disabled.
+func (ctx *Context) TraceID() string {
+	if ctx.span == nil {
+		return ""
+	}
+	return ctx.span.TraceID()
+}
+
+// traceLog returns the request logger with the trace ID or the fields of LogWith,
+// or nil if neither tracing is enabled nor LogWith is called.
+func (ctx *Context) traceLog() *logging.Logger {
+	if ctx.log == nil {
+		if traceID := ctx.TraceID(); traceID != "" {
+			ctx.log = ctx.frame.bizlog.WithModule(ctx.frame.bizlog.Module + " trace_id=" + traceID)
+		}
+	}
+	return ctx.log
+}
@@ -0,0 +1,140 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/henrylee2cn/faygo/logging"
+)
+
+type testSpanKey struct{}
+
+type testSpan struct {
+	name   string
+	parent string
+	attrs  map[string]interface{}
+	err    string
+	ends   int
+}
+
+func (s *testSpan) SetName(name string)                        { s.name = name }
+func (s *testSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *testSpan) SetError(msg string)                        { s.err = msg }
+func (s *testSpan) TraceID() string                            { return "4bf92f3577b34da6a3ce929d0e0e4736" }
+func (s *testSpan) End()                                       { s.ends++ }
+
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, header http.Header) (context.Context, Span) {
+	span := &testSpan{name: name, parent: header.Get("traceparent"), attrs: map[string]interface{}{}}
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+func TestTracer(t *testing.T) {
+	frame := newTestFrame(t, "tracing_test")
+	tracer := new(testTracer)
+	frame.SetTracer(tracer)
+	var fromCtx interface{}
+	var log string
+	frame.GET("/user/:id", HandlerFunc(func(ctx *Context) error {
+		fromCtx = ctx.TraceContext().Value(testSpanKey{})
+		log = ctx.Log().Module
+		return ctx.String(200, "ok")
+	}))
+	frame.GET("/panic", HandlerFunc(func(ctx *Context) error {
+		panic("boom")
+	}))
+
+	req := httptest.NewRequest("GET", "/user/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	serveTest(frame, req)
+	if len(tracer.spans) != 1 {
+		t.Fatalf("spans: got %d, want 1", len(tracer.spans))
+	}
+	span := tracer.spans[0]
+	if span.name != "GET /user/:id" || span.ends != 1 || span.err != "" {
+		t.Fatalf("span: got %+v", span)
+	}
+	if span.parent == "" {
+		t.Fatal("traceparent is not propagated")
+	}
+	if span.attrs[TraceAttrRoute] != "/user/:id" || span.attrs[TraceAttrStatusCode] != 200 || span.attrs[TraceAttrResponseSize] != int64(2) {
+		t.Fatalf("attributes: got %v", span.attrs)
+	}
+	if fromCtx != span {
+		t.Fatal("TraceContext does not carry the span")
+	}
+	if !strings.Contains(log, "trace_id="+span.TraceID()) {
+		t.Fatalf("log module: got %q", log)
+	}
+
+	serveTest(frame, httptest.NewRequest("GET", "/panic", nil))
+	span = tracer.spans[1]
+	if span.ends != 1 || span.err == "" || span.attrs[TraceAttrStatusCode] != 500 {
+		t.Fatalf("panic span: got %+v", span)
+	}
+
+	serveTest(frame, httptest.NewRequest("GET", "/missing", nil))
+	span = tracer.spans[2]
+	if span.name != "GET" || span.ends != 1 || span.attrs[TraceAttrStatusCode] != 404 {
+		t.Fatalf("not found span: got %+v", span)
+	}
+}
+
+func TestLogWith(t *testing.T) {
+	frame := newTestFrame(t, "log_with_test")
+	var fields []logging.Field
+	var module string
+	frame.GET("/orders/:id", HandlerFunc(func(ctx *Context) error {
+		ctx.LogWith("user", "u1")
+		ctx.Next()
+		return nil
+	}), HandlerFunc(func(ctx *Context) error {
+		ctx.LogWith("order_id", ctx.PathParam("id"))
+		fields = ctx.Log().Fields()
+		module = ctx.Log().Module
+		return ctx.String(200, "ok")
+	}))
+
+	req := httptest.NewRequest("GET", "/orders/7", nil)
+	req.Header.Set(HeaderXRequestID, "r1")
+	serveTest(frame, req)
+	want := "[{request_id r1} {route /orders/:id} {user u1} {order_id 7}]"
+	if fmt.Sprint(fields) != want {
+		t.Fatalf("fields: got %v, want %v", fields, want)
+	}
+	if module != frame.bizlog.Module {
+		t.Fatalf("module: got %q", module)
+	}
+
+	serveTest(frame, httptest.NewRequest("GET", "/orders/8", nil))
+	want = "[{route /orders/:id} {user u1} {order_id 8}]"
+	if fmt.Sprint(fields) != want {
+		t.Fatalf("fields of the next request: got %v, want %v", fields, want)
+	}
+}
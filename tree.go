@@ -109,6 +109,7 @@ type node struct {
 	indices   string
 	children  []*node
 	handle    Handle
+	check     func(PathParams) bool // the constraints of the path params, optional
 	priority  uint32
 }
 
@@ -139,6 +140,13 @@ func (n *node) incrementChildPrio(pos int) int {
 // addRoute adds a node with the given handle to the path.
 // Not concurrency-safe!
 func (n *node) addRoute(path string, handle Handle) {
+	n.addCheckedRoute(path, handle, nil)
+}
+
+// addCheckedRoute adds a node with the given handle to the path,
+// which is matched only if check returns true for the path params.
+// Not concurrency-safe!
+func (n *node) addCheckedRoute(path string, handle Handle, check func(PathParams) bool) {
 	fullPath := path
 	n.priority++
 	numParams := countPathParams(path)
@@ -253,7 +261,7 @@ func (n *node) addRoute(path string, handle Handle) {
 					n.incrementChildPrio(len(n.indices) - 1)
 					n = child
 				}
-				n.insertChild(numParams, path, fullPath, handle)
+				n.insertChild(numParams, path, fullPath, handle, check)
 				return
 
 			} else if i == len(path) { // Make node a (in-path) leaf
@@ -261,16 +269,17 @@ func (n *node) addRoute(path string, handle Handle) {
 					panic("a handle is already registered for path '" + fullPath + "'")
 				}
 				n.handle = handle
+				n.check = check
 			}
 			return
 		}
 	} else { // Empty tree
-		n.insertChild(numParams, path, fullPath, handle)
+		n.insertChild(numParams, path, fullPath, handle, check)
 		n.nType = root
 	}
 }
 
-func (n *node) insertChild(numParams uint8, path, fullPath string, handle Handle) {
+func (n *node) insertChild(numParams uint8, path, fullPath string, handle Handle, check func(PathParams) bool) {
 	var offset int // already handled bytes of the path
 
 	// find prefix until first wildcard (beginning with ':'' or '*'')
@@ -370,6 +379,7 @@ func (n *node) insertChild(numParams uint8, path, fullPath string, handle Handle
 				nType:     catchAll,
 				maxParams: 1,
 				handle:    handle,
+				check:     check,
 				priority:  1,
 			}
 			n.children = []*node{child}
@@ -381,6 +391,15 @@ func (n *node) insertChild(numParams uint8, path, fullPath string, handle Handle
 	// insert remaining path part and handle to the leaf
 	n.path = path[offset:]
 	n.handle = handle
+	n.check = check
+}
+
+// value returns the handle if the path params satisfy its constraints.
+func (n *node) value(p PathParams) Handle {
+	if n.check != nil && n.handle != nil && !n.check(p) {
+		return nil
+	}
+	return n.handle
 }
 
 // Returns the handle registered with the given path (key). The values of
@@ -447,7 +466,7 @@ walk: // outer loop for walking the tree
 						return
 					}
 
-					if handle = n.handle; handle != nil {
+					if handle = n.value(p); handle != nil {
 						return
 					} else if len(n.children) == 1 {
 						// No handle found. Check if a handle for this path + a
@@ -469,7 +488,7 @@ walk: // outer loop for walking the tree
 					p[i].Key = n.path[2:]
 					p[i].Value = path
 
-					handle = n.handle
+					handle = n.value(p)
 					return
 
 				default:
@@ -479,7 +498,7 @@ walk: // outer loop for walking the tree
 		} else if path == n.path {
 			// We should have reached the node containing the handle.
 			// Check if this node has a handle registered.
-			if handle = n.handle; handle != nil {
+			if handle = n.value(p); handle != nil {
 				return
 			}
 
@@ -0,0 +1,114 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// URLFor returns the URL path of the route with the name, filling in the path params
+// by the alternating keys and values, and appending the url.Values as the query,
+// such as `frame.URLFor("user", "id", 5, url.Values{"tab": {"posts"}})` for `/users/5?tab=posts`.
+// An error is returned if the route does not exist,
+// or any path param is missing, unknown or does not satisfy its constraint.
+// In the templates rendered by ctx.Render, it is the function `url_for`,
+// such as `{{ url_for("user", "id", 5) }}`.
+// note: the routes are available after the frame is running, such as in the handlers.
+func (frame *Framework) URLFor(name string, params ...interface{}) (string, error) {
+	if frame.namedRoutes == nil {
+		return "", errors.New("URLFor: the routes are not built yet")
+	}
+	apis := frame.namedRoutes[name]
+	if len(apis) == 0 {
+		return "", fmt.Errorf("URLFor: no route is named %q", name)
+	}
+	api := apis[0]
+	for _, a := range apis[1:] {
+		if a.path != api.path {
+			return "", fmt.Errorf("URLFor: the routes named %q have different paths: %s and %s", name, api.path, a.path)
+		}
+	}
+
+	values := make(map[string]string)
+	var query url.Values
+	for i := 0; i < len(params); i++ {
+		if q, ok := params[i].(url.Values); ok {
+			if query == nil {
+				query = make(url.Values)
+			}
+			for k, v := range q {
+				query[k] = append(query[k], v...)
+			}
+			continue
+		}
+		key := fmt.Sprint(params[i])
+		if i+1 >= len(params) {
+			return "", fmt.Errorf("URLFor: the path param %q of the route %q has no value", key, name)
+		}
+		i++
+		values[key] = fmt.Sprint(params[i])
+	}
+
+	segments := strings.Split(api.path, "/")
+	for i, seg := range segments {
+		if len(seg) == 0 || (seg[0] != ':' && seg[0] != '*') {
+			continue
+		}
+		key := seg[1:]
+		value, ok := values[key]
+		if !ok {
+			return "", fmt.Errorf("URLFor: the path param %q of the route %q is missing", key, name)
+		}
+		delete(values, key)
+		for _, c := range api.constraints {
+			if c.key == key && !c.check(value) {
+				return "", fmt.Errorf("URLFor: the path param %q of the route %q is invalid: %q", key, name, value)
+			}
+		}
+		if seg[0] == '*' {
+			// catch-all keeps the slashes
+			parts := strings.Split(strings.TrimPrefix(value, "/"), "/")
+			for j, p := range parts {
+				parts[j] = url.PathEscape(p)
+			}
+			segments[i] = strings.Join(parts, "/")
+		} else {
+			segments[i] = url.PathEscape(value)
+		}
+	}
+	if len(values) > 0 {
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return "", fmt.Errorf("URLFor: the route %q has no path param: %s", name, strings.Join(keys, ", "))
+	}
+	u := strings.Join(segments, "/")
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u, nil
+}
+
+// URLFor returns the URL path of the route with the name of the current frame.
+// See Framework.URLFor.
+func (ctx *Context) URLFor(name string, params ...interface{}) (string, error) {
+	return ctx.frame.URLFor(name, params...)
+}
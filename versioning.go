@@ -0,0 +1,139 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HeaderXAPIVersion is the request header of the API version.
+const HeaderXAPIVersion = "X-API-Version"
+
+// VersionQueryKey is the query param of the API version.
+const VersionQueryKey = "api_version"
+
+// VersionExtractor extracts the requested API version from the request, returns "" if none.
+type VersionExtractor func(ctx *Context) string
+
+// acceptVersion matches the version of the vendor media type, such as `application/vnd.myapp.v2+json`.
+var acceptVersion = regexp.MustCompile(`vnd\.[^,;]*?\.v([0-9A-Za-z_.-]+?)(?:\+[^,;]*)?(?:[,;]|$)`)
+
+// DefaultVersionExtractor extracts the API version from the vendor media type of the Accept header,
+// such as `application/vnd.myapp.v2+json`, the X-API-Version header, or the `api_version` query param in order.
+func DefaultVersionExtractor(ctx *Context) string {
+	if m := acceptVersion.FindStringSubmatch(ctx.HeaderParam(HeaderAccept)); m != nil {
+		return m[1]
+	}
+	if v := ctx.HeaderParam(HeaderXAPIVersion); v != "" {
+		return strings.TrimPrefix(v, "v")
+	}
+	return strings.TrimPrefix(ctx.QueryParam(VersionQueryKey), "v")
+}
+
+// SetVersioning sets the extractor of the requested API version, and the version used when none is requested.
+// If extractor is nil, DefaultVersionExtractor is used.
+// If defaultVersion is empty, the lowest version of each route is the default.
+// note: it should be called before Run()
+func (frame *Framework) SetVersioning(extractor VersionExtractor, defaultVersion string) {
+	frame.versionExtractor = extractor
+	frame.defaultVersion = defaultVersion
+}
+
+// Version sets the API version of the route, or of all the routes of the group,
+// so that the handlers of different versions can be registered on the same method and path,
+// and the request is dispatched by its version, see SetVersioning.
+// If the version is not supported, it replies 406 with the supported versions.
+// Note: all the routes of the same method and path should be versioned.
+//
+//	e.g.
+//	frame.GET("/users", listUsersV1).Version("1")
+//	frame.GET("/users", listUsersV2).Version("2")
+func (mux *MuxAPI) Version(version string) *MuxAPI {
+	mux.version = strings.TrimPrefix(version, "v")
+	return mux
+}
+
+// APIVersion returns the version of the matched versioned route, or "" if the route is not versioned.
+func (ctx *Context) APIVersion() string {
+	return ctx.apiVersion
+}
+
+// versionedRoute is the handles of the different versions on the same method and path.
+type versionedRoute struct {
+	pattern  string // the method and path
+	handles  map[string]Handle
+	versions []string // in ascending order
+}
+
+// add adds the handle of the version, and panics if the version is registered already,
+// the same as the duplicate routes.
+func (vr *versionedRoute) add(version string, handle Handle) {
+	if _, ok := vr.handles[version]; ok {
+		Panic("a handle is already registered for '" + vr.pattern + "' of version 'v" + version + "'")
+	}
+	vr.handles[version] = handle
+	vr.versions = append(vr.versions, version)
+	sort.Slice(vr.versions, func(i, j int) bool {
+		return lessVersion(vr.versions[i], vr.versions[j])
+	})
+}
+
+// lessVersion compares the versions by the dot-separated parts, numerically if both are numbers,
+// such as 1 < 2 < 10 < 10.1.
+func lessVersion(a, b string) bool {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] == bs[i] {
+			continue
+		}
+		x, errX := strconv.Atoi(as[i])
+		y, errY := strconv.Atoi(bs[i])
+		if errX == nil && errY == nil {
+			return x < y
+		}
+		return as[i] < bs[i]
+	}
+	return len(as) < len(bs)
+}
+
+// makeVersionedHandle creates the handle dispatching the request to the handle of its API version.
+func (frame *Framework) makeVersionedHandle(vr *versionedRoute) Handle {
+	extractor := frame.versionExtractor
+	if extractor == nil {
+		extractor = DefaultVersionExtractor
+	}
+	return func(ctx *Context, pathParams PathParams) {
+		ctx.W.Header().Add(HeaderVary, HeaderAccept)
+		ctx.W.Header().Add(HeaderVary, HeaderXAPIVersion)
+		version := extractor(ctx)
+		if version == "" {
+			version = frame.defaultVersion
+			if version == "" {
+				version = vr.versions[0]
+			}
+		}
+		handle, ok := vr.handles[version]
+		if !ok {
+			global.errorFunc(ctx, "unsupported API version `"+version+"`, supported versions: "+strings.Join(vr.versions, ", "), http.StatusNotAcceptable)
+			return
+		}
+		ctx.apiVersion = version
+		handle(ctx, pathParams)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faygo
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVersioning(t *testing.T) {
+	frame := newTestFrame(t, "versioning_test")
+	version := func(body string) HandlerFunc {
+		return func(ctx *Context) error {
+			return ctx.String(200, body+" "+ctx.APIVersion())
+		}
+	}
+	frame.GET("/users", version("list")).Version("1")
+	frame.GET("/users", version("list")).Version("v2")
+	frame.Group("/v3").Version("3").GET("/users", version("group"))
+	frame.GET("/plain", version("plain"))
+
+	cases := []struct {
+		header, value, query string
+		code                 int
+		body                 string
+	}{
+		{"", "", "", 200, "list 1"},
+		{HeaderAccept, "application/vnd.myapp.v2+json", "", 200, "list 2"},
+		{HeaderAccept, "text/html, application/vnd.myapp.v1+json;q=0.9", "", 200, "list 1"},
+		{HeaderXAPIVersion, "v2", "", 200, "list 2"},
+		{"", "", "?api_version=2", 200, "list 2"},
+		{HeaderXAPIVersion, "9", "", 406, "supported versions: 1, 2"},
+	}
+	for i, c := range cases {
+		req := httptest.NewRequest("GET", "/users"+c.query, nil)
+		if c.header != "" {
+			req.Header.Set(c.header, c.value)
+		}
+		rec := serveTest(frame, req)
+		if rec.Code != c.code || !strings.Contains(rec.Body.String(), c.body) {
+			t.Fatalf("case %d: got %d %q, want %d %q", i, rec.Code, rec.Body.String(), c.code, c.body)
+		}
+		if vary := rec.Header()[HeaderVary]; c.code == 200 && len(vary) != 2 {
+			t.Fatalf("case %d: Vary: got %v", i, vary)
+		}
+	}
+	if rec := serveTest(frame, httptest.NewRequest("GET", "/plain", nil)); rec.Body.String() != "plain " {
+		t.Fatalf("plain: got %q", rec.Body.String())
+	}
+
+	var versions []string
+	for _, r := range frame.Routes() {
+		if r.Version != "" {
+			versions = append(versions, r.Pattern+" "+r.Flags())
+		}
+	}
+	if got := strings.Join(versions, ","); got != "/users v1,/users v2,/v3/users v3" {
+		t.Fatalf("routes: got %q", got)
+	}
+
+	frame.initAPIdoc("localhost")
+	for _, pid := range []string{"/users#v1", "/users#v2", "/v3/users#v3"} {
+		opera := frame.apidoc.Paths[pid]["get"]
+		if opera == nil {
+			t.Fatalf("apidoc: no operation of %s", pid)
+		}
+		if !strings.HasSuffix(opera.OperationId, "-v"+pid[len(pid)-1:]+"-GET") {
+			t.Fatalf("apidoc: operation id %q", opera.OperationId)
+		}
+	}
+}
+
+func TestVersioningDefault(t *testing.T) {
+	if !lessVersion("2", "10") || !lessVersion("10", "10.1") || lessVersion("2.1", "2.0") {
+		t.Fatal("the versions should be compared numerically")
+	}
+
+	frame := newTestFrame(t, "versioning_default_test")
+	frame.SetVersioning(func(ctx *Context) string {
+		return ctx.HeaderParam("X-Version")
+	}, "2")
+	frame.GET("/users", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, "v"+ctx.APIVersion())
+	})).Version("1")
+	frame.GET("/users", HandlerFunc(func(ctx *Context) error {
+		return ctx.String(200, "v"+ctx.APIVersion())
+	})).Version("2")
+	if rec := serveTest(frame, httptest.NewRequest("GET", "/users", nil)); rec.Body.String() != "v2" {
+		t.Fatalf("default: got %q", rec.Body.String())
+	}
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("X-Version", "1")
+	if rec := serveTest(frame, req); rec.Body.String() != "v1" {
+		t.Fatalf("custom extractor: got %q", rec.Body.String())
+	}
+}
+
+func TestVersioningDuplicate(t *testing.T) {
+	frame := newTestFrame(t, "versioning_duplicate_test")
+	handler := HandlerFunc(func(ctx *Context) error { return nil })
+	frame.GET("/users", handler).Version("1")
+	frame.GET("/users", handler).Version("2")
+	frame.GET("/users", handler).Version("v1")
+	defer func() {
+		if p := recover(); p == nil || !strings.Contains(fmt.Sprint(p), "'GET /users' of version 'v1'") {
+			t.Fatalf("expect panic on the duplicate version, got %v", p)
+		}
+	}()
+	frame.build()
+}